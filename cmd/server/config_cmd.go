@@ -0,0 +1,108 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"rom-server/internal/config"
+)
+
+// runConfigCommand handles `config <subcommand>` and returns the exit code
+func runConfigCommand(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "usage: rom-server config init [-o path] [-generate-key] [-force]")
+		fmt.Fprintln(os.Stderr, "       rom-server config validate [path]")
+		fmt.Fprintln(os.Stderr, "       rom-server config schema")
+		return 2
+	}
+
+	switch args[0] {
+	case "init":
+		return configInit(args[1:])
+	case "validate":
+		return configValidate(args[1:])
+	case "schema":
+		os.Stdout.Write(config.Schema)
+		return 0
+	default:
+		fmt.Fprintf(os.Stderr, "unknown config command %q\n", args[0])
+		return 2
+	}
+}
+
+// configInit writes a commented starter config
+func configInit(args []string) int {
+	fs := flag.NewFlagSet("config init", flag.ContinueOnError)
+	out := fs.String("o", "config.json", "Where to write the config")
+	generateKey := fs.Bool("generate-key", false, "Generate a random API key instead of \"changeme\"")
+	force := fs.Bool("force", false, "Overwrite an existing file")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	if _, err := os.Stat(*out); err == nil && !*force {
+		fmt.Fprintf(os.Stderr, "%s already exists (use -force to overwrite)\n", *out)
+		return 1
+	}
+
+	apiKey := "changeme"
+	perm := os.FileMode(0644)
+	if *generateKey {
+		key, err := config.GenerateAPIKey()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to generate API key: %v\n", err)
+			return 1
+		}
+		apiKey = key
+		perm = 0600 // The file now holds a secret
+	}
+
+	if err := os.WriteFile(*out, []byte(config.DefaultTemplate(apiKey)), perm); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to write %s: %v\n", *out, err)
+		return 1
+	}
+	// The template's $schema points here so editors can lint the file
+	schemaPath := filepath.Join(filepath.Dir(*out), "config.schema.json")
+	if err := os.WriteFile(schemaPath, config.Schema, 0644); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to write %s: %v\n", schemaPath, err)
+		return 1
+	}
+
+	fmt.Printf("Wrote %s and %s\n", *out, schemaPath)
+	if *generateKey {
+		fmt.Printf("API key: %s\n", apiKey)
+	} else {
+		fmt.Println("Set the API_KEY environment variable before exposing the server.")
+	}
+	return 0
+}
+
+// configValidate runs Validate plus environment checks; exit code 1 on errors
+func configValidate(args []string) int {
+	path := "config.json"
+	if len(args) > 0 {
+		path = args[0]
+	}
+
+	cfg, err := config.Load(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return 1
+	}
+
+	failed := false
+	for _, issue := range cfg.Check() {
+		fmt.Println(issue)
+		if issue.Fatal {
+			failed = true
+		}
+	}
+	if failed {
+		return 1
+	}
+
+	fmt.Printf("%s is valid\n", path)
+	return 0
+}
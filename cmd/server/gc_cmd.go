@@ -0,0 +1,42 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+)
+
+// runGC cleans up storage left behind by interrupted uploads and writes. It
+// is safe to run from cron next to the server unless -prune-records is set.
+func runGC(args []string) int {
+	fs := flag.NewFlagSet("gc", flag.ContinueOnError)
+	configPath := fs.String("config", "config.json", "Path to configuration file")
+	maxAge := fs.Duration("max-age", 24*time.Hour, "Only remove temp files older than this")
+	pruneRecords := fs.Bool("prune-records", false, "Also drop metadata for builds no longer on disk (stop the server first)")
+	dryRun := fs.Bool("dry-run", false, "Report what would be removed without removing it")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	_, fileService, err := openStorage(*configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return 1
+	}
+	defer fileService.Close()
+
+	result, err := fileService.CollectGarbage(*maxAge, *pruneRecords, *dryRun)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return 1
+	}
+
+	verb := "Removed"
+	if *dryRun {
+		verb = "Would remove"
+	}
+	fmt.Printf("%s %d upload temp files, %d partial state writes and %d orphaned metadata records (%d bytes)\n",
+		verb, result.TempFiles, result.PartialWrites, result.Records, result.Reclaimed)
+	return 0
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"rom-server/internal/services"
+)
+
+// runHash records missing checksums and verifies existing ones, e.g. after
+// builds were restored from a backup made outside the server
+func runHash(args []string) int {
+	fs := flag.NewFlagSet("hash", flag.ContinueOnError)
+	configPath := fs.String("config", "config.json", "Path to configuration file")
+	fix := fs.Bool("fix", false, "Replace recorded checksums that don't match the file")
+	verbose := fs.Bool("v", false, "Also list files whose checksum matches")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	_, fileService, err := openStorage(*configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return 1
+	}
+	defer fileService.Close()
+
+	counts := make(map[string]int)
+	err = fileService.HashStorage(*fix, func(r services.HashResult) {
+		counts[r.Status]++
+		switch {
+		case r.Err != nil:
+			fmt.Fprintf(os.Stderr, "%-8s %s: %v\n", r.Status, r.Key, r.Err)
+		case r.Status != services.HashOK || *verbose:
+			fmt.Printf("%-8s %s\n", r.Status, r.Key)
+		}
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return 1
+	}
+
+	fmt.Printf("%d ok, %d added, %d updated, %d mismatched, %d missing, %d errors\n",
+		counts[services.HashOK], counts[services.HashAdded], counts[services.HashUpdated],
+		counts[services.HashMismatch], counts[services.HashMissing], counts[services.HashError])
+	if counts[services.HashMismatch] > 0 || counts[services.HashError] > 0 {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	"rom-server/internal/config"
+)
+
+// runHealthcheck probes /readyz of a running server and exits 0 only on a
+// 200, for Docker HEALTHCHECK and similar probes in images without curl
+func runHealthcheck(args []string) int {
+	fs := flag.NewFlagSet("healthcheck", flag.ContinueOnError)
+	configPath := fs.String("config", "config.json", "Path to configuration file (for the port)")
+	url := fs.String("url", "", "URL to probe instead of http://127.0.0.1:<port>/readyz")
+	timeout := fs.Duration("timeout", 5*time.Second, "Give up after this long")
+	quiet := fs.Bool("q", false, "Only set the exit code")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	target := *url
+	if target == "" {
+		cfg, err := config.Load(*configPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			return 1
+		}
+		target = fmt.Sprintf("http://127.0.0.1:%s/readyz", cfg.Server.Port)
+	}
+
+	client := &http.Client{Timeout: *timeout}
+	resp, err := client.Get(target)
+	if err != nil {
+		if !*quiet {
+			fmt.Fprintf(os.Stderr, "unhealthy: %v\n", err)
+		}
+		return 1
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+
+	if resp.StatusCode != http.StatusOK {
+		if !*quiet {
+			fmt.Fprintf(os.Stderr, "unhealthy: %s: %s\n", resp.Status, bytes.TrimSpace(body))
+		}
+		return 1
+	}
+	if !*quiet {
+		fmt.Println("healthy")
+	}
+	return 0
+}
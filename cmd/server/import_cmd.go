@@ -0,0 +1,133 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"rom-server/internal/config"
+	"rom-server/internal/services"
+)
+
+// stringList collects a repeatable string flag
+type stringList []string
+
+func (l *stringList) String() string { return strings.Join(*l, ",") }
+
+func (l *stringList) Set(v string) error {
+	*l = append(*l, v)
+	return nil
+}
+
+// runImport publishes files from disk as if they had been uploaded, with
+// checksums, file limits and metadata handled the same way
+func runImport(args []string) int {
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	configPath := fs.String("config", "config.json", "Path to configuration file")
+	category := fs.String("category", "", "Category to publish into (required)")
+	notes := fs.String("notes", "", "Release notes for every imported file")
+	uploader := fs.String("uploader", "import", "Name recorded as the uploader")
+	stage := fs.Bool("stage", false, "Stage the files instead of publishing them")
+	var tags stringList
+	fs.Var(&tags, "tag", "Tag to set (repeatable)")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: rom-server import -category name [flags] file...")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *category == "" || fs.NArg() == 0 {
+		fs.Usage()
+		return 2
+	}
+
+	cfg, fileService, err := openStorage(*configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return 1
+	}
+	defer fileService.Close()
+
+	if !cfg.IsValidCategory(*category) {
+		fmt.Fprintf(os.Stderr, "error: unknown or disabled category %q\n", *category)
+		return 1
+	}
+	normalized, err := services.NormalizeNotes(*notes)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return 1
+	}
+	opts := services.UploadOptions{Uploader: *uploader, Notes: normalized, Stage: *stage}
+	if len(tags) > 0 {
+		opts.Tags = tags
+	}
+
+	failed := 0
+	for _, path := range fs.Args() {
+		if err := importFile(cfg, fileService, *category, path, opts); err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", path, err)
+			failed++
+		}
+	}
+	if failed > 0 {
+		fmt.Fprintf(os.Stderr, "%d of %d files failed\n", failed, fs.NArg())
+		return 1
+	}
+	return 0
+}
+
+// importFile checks and saves a single file
+func importFile(cfg *config.Config, fileService *services.FileService, category, path string, opts services.UploadOptions) error {
+	filename := services.SanitizeFilename(path)
+	ext := filepath.Ext(filename)
+	if !cfg.IsAllowedExtensionFor(category, ext) {
+		return fmt.Errorf("file type not allowed in %s (allowed: %s)", category, strings.Join(cfg.AllowedExtsFor(category), ", "))
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if !info.Mode().IsRegular() {
+		return fmt.Errorf("not a regular file")
+	}
+
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(f, header); err != nil {
+		return fmt.Errorf("failed to read file: %w", err)
+	}
+	if strings.EqualFold(ext, ".zip") {
+		if err := services.ValidateZip(f, info.Size()); err != nil {
+			return err
+		}
+	}
+	if strings.EqualFold(ext, ".img") {
+		if opts.Image, err = services.InspectImage(f, info.Size()); err != nil {
+			return err
+		}
+	}
+	if cfg.IsAPKCategory(category) {
+		if opts.APK, err = services.InspectAPK(f, info.Size()); err != nil {
+			return err
+		}
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	sums, err := fileService.SaveUpload(category, filename, f, info.Size(), opts)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s/%s  sha256:%s\n", category, filename, sums.SHA256)
+	return nil
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+
+	"rom-server/internal/config"
+	"rom-server/internal/services"
+)
+
+// keysFile is the key store inside the upload dir
+const keysFile = "keys.json"
+
+// runKeyCommand handles `key <subcommand>` and returns the exit code
+func runKeyCommand(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "usage: rom-server key create [-config path] <name>")
+		fmt.Fprintln(os.Stderr, "       rom-server key list [-config path]")
+		fmt.Fprintln(os.Stderr, "       rom-server key revoke [-config path] <name>")
+		return 2
+	}
+
+	switch args[0] {
+	case "create":
+		return keyCreate(args[1:])
+	case "list":
+		return keyList(args[1:])
+	case "revoke":
+		return keyRevoke(args[1:])
+	default:
+		fmt.Fprintf(os.Stderr, "unknown key command %q\n", args[0])
+		return 2
+	}
+}
+
+// openKeyStore parses -config and an optional name, then opens the key store
+func openKeyStore(name string, args []string, wantName bool) (*config.Config, *services.KeyStore, string, int) {
+	fs := flag.NewFlagSet("key "+name, flag.ContinueOnError)
+	configPath := fs.String("config", "config.json", "Path to configuration file")
+	if err := fs.Parse(args); err != nil {
+		return nil, nil, "", 2
+	}
+	if wantName != (fs.NArg() == 1) {
+		if wantName {
+			fmt.Fprintf(os.Stderr, "usage: rom-server key %s [-config path] <name>\n", name)
+		} else {
+			fmt.Fprintf(os.Stderr, "usage: rom-server key %s [-config path]\n", name)
+		}
+		return nil, nil, "", 2
+	}
+
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return nil, nil, "", 1
+	}
+	if err := os.MkdirAll(cfg.Storage.UploadDir, 0755); err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return nil, nil, "", 1
+	}
+	keys, err := services.NewKeyStore(filepath.Join(cfg.Storage.UploadDir, keysFile))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return nil, nil, "", 1
+	}
+	return cfg, keys, fs.Arg(0), 0
+}
+
+// keyCreate generates a key and prints it once
+func keyCreate(args []string) int {
+	cfg, keys, name, code := openKeyStore("create", args, true)
+	if keys == nil {
+		return code
+	}
+	for _, m := range cfg.GetMaintainers() {
+		if m.Name == name {
+			fmt.Fprintf(os.Stderr, "error: %s is a maintainer in the config file\n", name)
+			return 1
+		}
+	}
+
+	key, _, err := keys.Create(name)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return 1
+	}
+	fmt.Println(key)
+	fmt.Fprintf(os.Stderr, "Created key for %s. It is only shown now; store it somewhere safe.\n", name)
+	return 0
+}
+
+// keyList prints the stored keys without revealing them
+func keyList(args []string) int {
+	_, keys, _, code := openKeyStore("list", args, false)
+	if keys == nil {
+		return code
+	}
+	list, err := keys.List()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return 1
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tPREFIX\tCREATED")
+	for _, k := range list {
+		fmt.Fprintf(tw, "%s\t%s...\t%s\n", k.Name, k.Prefix, k.CreatedAt)
+	}
+	tw.Flush()
+	return 0
+}
+
+// keyRevoke deletes a key; the server rejects it from the next request on
+func keyRevoke(args []string) int {
+	_, keys, name, code := openKeyStore("revoke", args, true)
+	if keys == nil {
+		return code
+	}
+	if err := keys.Revoke(name); err != nil {
+		if errors.Is(err, services.ErrNotFound) {
+			fmt.Fprintf(os.Stderr, "error: no key named %s\n", name)
+		} else {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		}
+		return 1
+	}
+	fmt.Fprintf(os.Stderr, "Revoked key for %s\n", name)
+	return 0
+}
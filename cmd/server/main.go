@@ -1,137 +1,110 @@
 package main
 
 import (
-	"context"
 	"flag"
+	"fmt"
 	"log"
-	"net/http"
 	"os"
-	"os/signal"
-	"syscall"
-	"time"
+	"path/filepath"
+	"sort"
+	"strings"
 
 	"rom-server/internal/config"
-	"rom-server/internal/handlers"
-	"rom-server/internal/middleware"
 	"rom-server/internal/services"
 )
 
-func main() {
-	// Parse command line flags
-	configPath := flag.String("config", "config.json", "Path to configuration file")
-	flag.Parse()
+// command is a subcommand of the binary
+type command struct {
+	run     func(args []string) int // Returns the exit code
+	summary string
+}
 
-	// Initialize logger
-	logger := log.New(os.Stdout, "", log.LstdFlags)
+// commands maps subcommand names to their implementation. Everything but
+// serve works on the same config and storage without the HTTP server, so it
+// can run from cron or a deploy script.
+var commands = map[string]command{
+	"serve":       {runServe, "Run the HTTP server (default)"},
+	"config":      {runConfigCommand, "Create, validate or print the schema of a config file"},
+	"setup":       {runSetup, "Create a config interactively on a fresh install"},
+	"validate":    {runValidate, "Check a config file (same as config validate)"},
+	"import":      {runImport, "Publish files from disk into a category"},
+	"hash":        {runHash, "Record missing checksums and verify existing ones"},
+	"gc":          {runGC, "Remove abandoned temp files and partial writes"},
+	"key":         {runKeyCommand, "Create, list or revoke API keys"},
+	"healthcheck": {runHealthcheck, "Probe a running server's /readyz (exit 0 if ready)"},
+}
 
-	// Load configuration
-	cfg, err := config.Load(*configPath)
-	if err != nil {
-		logger.Fatalf("Failed to load configuration: %v", err)
+func main() {
+	// Plain `rom-server -config x` keeps working: no subcommand means serve
+	name, args := "serve", os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
 	}
 
-	// Update logger format from config
-	logger.SetPrefix(cfg.Logging.Format)
-
-	// Security warning for default API key
-	if cfg.Security.DefaultAPIKey == "changeme" {
-		logger.Println("WARNING: Using default API Key! Set API_KEY environment variable for production.")
+	if name == "help" {
+		usage()
+		os.Exit(0)
 	}
-
-	// Initialize services
-	fileService := services.NewFileService(cfg)
-	
-	// Initialize storage directories
-	if err := fileService.InitializeStorage(); err != nil {
-		logger.Fatalf("Failed to initialize storage: %v", err)
+	cmd, ok := commands[name]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n", name)
+		usage()
+		os.Exit(2)
 	}
+	os.Exit(cmd.run(args))
+}
 
-	// Initialize handlers
-	h := handlers.NewHandlers(cfg, fileService, logger)
-
-	// Create auth middleware
-	authMiddleware := middleware.Auth(cfg, logger)
-
-	// Setup router
-	mux := http.NewServeMux()
-
-	// Public endpoints
-	mux.HandleFunc("/", serveStaticFile("static/download.html"))
-	mux.HandleFunc("/admin", serveStaticFile("static/index.html"))
-	mux.HandleFunc("/health", h.Health)
-	mux.HandleFunc("/api/config", h.GetConfig)
-	mux.HandleFunc("/list", h.ListFiles)
-	
-	// Static assets (favicon, images, etc.)
-	mux.Handle("/static/", http.StripPrefix("/static/", http.FileServer(http.Dir("static"))))
-	mux.HandleFunc("/favicon.ico", func(w http.ResponseWriter, r *http.Request) {
-		http.ServeFile(w, r, "static/favicon.png")
-	})
-	
-	// Protected endpoints (require API key)
-	mux.HandleFunc("/upload", authMiddleware(h.Upload))
-	mux.HandleFunc("/delete", authMiddleware(h.Delete))
-
-	// File downloads with concurrency control
-	mux.Handle("/downloads/", h.ServeDownload(cfg.Storage.UploadDir))
-
-	// Apply middleware chain
-	var handler http.Handler = mux
-	handler = middleware.CORS(handler)
-	handler = middleware.RateLimit(cfg, logger)(handler)
-	handler = middleware.RequestLogger(logger, cfg.Logging.EnableRequestLogging)(handler)
-	handler = middleware.SecurityHeaders(handler)
-
-	// Configure server with optimized settings for concurrent users
-	srv := &http.Server{
-		Addr:              ":" + cfg.Server.Port,
-		Handler:           handler,
-		ReadTimeout:       time.Duration(cfg.Server.ReadTimeoutMinutes) * time.Minute,
-		WriteTimeout:      time.Duration(cfg.Server.WriteTimeoutMinutes) * time.Minute,
-		IdleTimeout:       time.Duration(cfg.Server.IdleTimeoutSeconds) * time.Second,
-		MaxHeaderBytes:    1 << 20, // 1MB max header size
-		ReadHeaderTimeout: 10 * time.Second,
+// usage lists the subcommands
+func usage() {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
 	}
+	sort.Strings(names)
 
-	// Start server in background
-	go func() {
-		logger.Printf("Server starting on :%s", cfg.Server.Port)
-		logger.Printf("Storage path: %s", cfg.Storage.UploadDir)
-		logger.Printf("Max concurrent downloads: %d", cfg.Concurrency.MaxConcurrentDownloads)
-		logger.Printf("Max concurrent uploads: %d", cfg.Concurrency.MaxConcurrentUploads)
-		
-		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			logger.Fatalf("Server error: %v", err)
-		}
-	}()
-
-	// Graceful shutdown
-	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
-	<-quit
-
-	logger.Println("Shutting down server...")
-
-	ctx, cancel := context.WithTimeout(
-		context.Background(),
-		time.Duration(cfg.Server.ShutdownTimeoutSecs)*time.Second,
-	)
-	defer cancel()
+	fmt.Fprintln(os.Stderr, "usage: rom-server <command> [flags]\n\ncommands:")
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %-12s %s\n", name, commands[name].summary)
+	}
+	fmt.Fprintf(os.Stderr, "\nRun a command with -h for its flags.\n")
+}
 
-	if err := srv.Shutdown(ctx); err != nil {
-		logger.Fatalf("Server forced to shutdown: %v", err)
+// runValidate is `config validate` with the -config flag the other commands take
+func runValidate(args []string) int {
+	path, ok := parseConfigFlag("validate", args)
+	if !ok {
+		return 2
 	}
+	return configValidate([]string{path})
+}
 
-	logger.Println("Server exited cleanly")
+// parseConfigFlag parses args that take nothing but -config
+func parseConfigFlag(name string, args []string) (string, bool) {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	configPath := fs.String("config", "config.json", "Path to configuration file")
+	if err := fs.Parse(args); err != nil {
+		return "", false
+	}
+	return *configPath, true
 }
 
-// serveStaticFile returns a handler that serves a specific static file
-func serveStaticFile(path string) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		if r.URL.Path != "/" && r.URL.Path != "/admin" {
-			http.NotFound(w, r)
-			return
-		}
-		http.ServeFile(w, r, path)
+// openStorage loads the config and opens the file service the way the server
+// does, minus webhooks, CDN purges and cluster sync. Close the service to
+// flush stats. Don't run writing commands while the server is up: it keeps
+// metadata in memory and would overwrite their changes.
+func openStorage(configPath string) (*config.Config, *services.FileService, error) {
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	metaStore, err := services.NewMetadataStore(filepath.Join(cfg.Storage.UploadDir, "metadata.json"), nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	fileService := services.NewFileService(cfg, nil, nil, nil, nil, metaStore, nil, log.New(os.Stderr, "", 0))
+	if err := fileService.InitializeStorage(); err != nil {
+		fileService.Close()
+		return nil, nil, err
 	}
+	return cfg, fileService, nil
 }
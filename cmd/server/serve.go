@@ -0,0 +1,507 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"rom-server/internal/cluster"
+	"rom-server/internal/config"
+	"rom-server/internal/handlers"
+	"rom-server/internal/middleware"
+	"rom-server/internal/services"
+	"rom-server/internal/version"
+)
+
+// runServe runs the HTTP server until SIGINT or SIGTERM
+func runServe(args []string) int {
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	configPath := fs.String("config", "config.json", "Path to configuration file")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	// Initialize logger
+	logger := log.New(os.Stdout, "", log.LstdFlags)
+
+	// Load configuration
+	if _, err := os.Stat(*configPath); os.IsNotExist(err) {
+		logger.Fatalf("No configuration at %s; run `rom-server setup -config %s` to create one", *configPath, *configPath)
+	}
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		logger.Fatalf("Failed to load configuration: %v", err)
+	}
+
+	// Update logger format from config
+	logger.SetPrefix(cfg.Logging.Format)
+
+	// Pull credentials from Vault before anything uses them
+	vault := services.NewVault(cfg, logger)
+	if vault != nil {
+		if err := vault.Load(); err != nil {
+			logger.Fatalf("Failed to load secrets from Vault: %v", err)
+		}
+		vault.Start()
+		logger.Printf("Secrets loaded from Vault at %s", cfg.Vault.Address)
+	}
+
+	// Security warning for default API key
+	if cfg.Security.DefaultAPIKey == "changeme" {
+		logger.Println("WARNING: Using default API Key! Set API_KEY environment variable for production.")
+	}
+
+	// Initialize services
+	// Connect to the shared store when running several instances
+	var shared cluster.Store
+	if cfg.Cluster.Enabled {
+		redisStore, err := cluster.NewRedisStore(cfg.Cluster.RedisURL, cfg.Cluster.KeyPrefix)
+		if err != nil {
+			logger.Fatalf("Failed to connect to cluster store: %v", err)
+		}
+		defer redisStore.Close()
+		shared = redisStore
+		logger.Printf("Cluster mode enabled (%s)", cfg.Cluster.RedisURL)
+	}
+
+	// Optional subsystems switched off by feature flags stay nil
+	var metrics *services.Metrics
+	if cfg.FeatureEnabled(config.FlagMetrics) {
+		metrics = services.NewMetrics()
+	}
+
+	// Webhooks, CDN purges, object deletes and mirror pulls run in the
+	// background on a bounded pool
+	workers := services.NewWorkerPool(cfg.Concurrency.WorkerPoolSize, metrics, logger)
+	var notifier *services.Notifier
+	if cfg.FeatureEnabled(config.FlagWebhooks) {
+		notifier = services.NewNotifier(cfg, workers, logger)
+	}
+	metaStore, err := services.NewMetadataStore(filepath.Join(cfg.Storage.UploadDir, "metadata.json"), shared)
+	if err != nil {
+		logger.Fatalf("Failed to load metadata: %v", err)
+	}
+	cdn := services.NewCDN(cfg, workers, logger)
+	objects := services.NewObjectStore(cfg)
+	fileService := services.NewFileService(cfg, notifier, cdn, objects, workers, metaStore, shared, logger)
+
+	// Initialize storage directories
+	if err := fileService.InitializeStorage(); err != nil {
+		logger.Fatalf("Failed to initialize storage: %v", err)
+	}
+
+	// Background maintenance runs on a single elected node in cluster mode
+	leaderTTL := time.Duration(cfg.Cluster.LeaderTTLSeconds) * time.Second
+	if leaderTTL <= 0 {
+		leaderTTL = 15 * time.Second
+	}
+	elector := cluster.NewElector(shared, cfg.Cluster.InstanceID, leaderTTL)
+	go elector.Run()
+
+	scheduler := services.NewScheduler(elector, logger)
+	scheduler.Every("temp-cleanup", time.Hour, func() error {
+		removed, reclaimed, err := fileService.CleanupTempFiles(24 * time.Hour)
+		if removed > 0 {
+			logger.Printf("Temp cleanup: removed %d files (%d bytes)", removed, reclaimed)
+		}
+		return err
+	})
+
+	if cfg.Quarantine.RetentionDays > 0 {
+		scheduler.Every("quarantine-purge", time.Hour, func() error {
+			purged, err := fileService.PurgeExpiredQuarantine()
+			if purged > 0 {
+				logger.Printf("Quarantine: purged %d files older than %d days", purged, cfg.Quarantine.RetentionDays)
+			}
+			return err
+		})
+	}
+
+	// Publishing enforces max_files too; this catches a limit lowered by a
+	// reload and builds left over when enforcing it failed
+	scheduler.Every("retention", time.Hour, func() error {
+		if cfg.GetMaintenance().Enabled {
+			return nil
+		}
+		removed, err := fileService.ApplyRetention()
+		if removed > 0 {
+			logger.Printf("Retention: removed %d builds over max_files", removed)
+		}
+		return err
+	})
+
+	// Scrubbing re-reads every stored build to catch corruption on disk
+	if interval := time.Duration(cfg.Storage.ScrubIntervalHours) * time.Hour; interval > 0 {
+		scheduler.Every("scrub", interval, func() error {
+			checked, failed := 0, 0
+			err := fileService.HashStorage(false, func(r services.HashResult) {
+				checked++
+				switch r.Status {
+				case services.HashMismatch, services.HashMissing:
+					failed++
+					logger.Printf("Scrub: %s is %s", r.Key, r.Status)
+				case services.HashError:
+					failed++
+					logger.Printf("Scrub: %s: %v", r.Key, r.Err)
+				}
+			})
+			if failed > 0 {
+				logger.Printf("Scrub: %d of %d builds failed verification", failed, checked)
+			}
+			return err
+		})
+	}
+
+	// Uploads with a publish_at go live once their time comes
+	scheduler.Every("scheduled-publish", 30*time.Second, func() error {
+		if cfg.GetMaintenance().Enabled {
+			return nil // Leave the disk alone; due builds go out once maintenance ends
+		}
+		published, err := fileService.PublishDue()
+		if published > 0 {
+			logger.Printf("Scheduled publish: %d builds went live", published)
+		}
+		return err
+	})
+
+	// Mirror mode pulls builds from the upstream instead of accepting uploads
+	if mirror := services.NewMirror(cfg, fileService, logger); mirror != nil {
+		interval := time.Duration(cfg.Mirror.SyncIntervalMinutes) * time.Minute
+		if interval <= 0 {
+			interval = 15 * time.Minute
+		}
+		scheduler.Every("mirror-sync", interval, mirror.Sync)
+		workers.Submit("mirror-sync", mirror.Sync)
+		logger.Printf("Read-only mirror of %s", cfg.Mirror.UpstreamURL)
+	}
+
+	// Classic mirrors can pull published builds over rsync
+	var rsyncd *services.RsyncDaemon
+	if cfg.Rsync.Enabled {
+		confPath, err := services.WriteRsyncdConf(cfg)
+		if err != nil {
+			logger.Fatalf("Failed to write rsync config: %v", err)
+		}
+		logger.Printf("rsync module config written to %s", confPath)
+		if cfg.Rsync.RunDaemon {
+			if rsyncd, err = services.StartRsyncDaemon(confPath, logger); err != nil {
+				logger.Fatalf("%v", err)
+			}
+		}
+	}
+
+	// Initialize audit log alongside stored files
+	var auditLog *services.AuditLog
+	if cfg.FeatureEnabled(config.FlagAuditLog) {
+		auditLog = services.NewAuditLog(filepath.Join(cfg.Storage.UploadDir, "audit.log"))
+	}
+
+	// Initialize handlers
+	activity := services.NewActivityFeed(auditLog)
+	announcements, err := services.NewAnnouncementStore(filepath.Join(cfg.Storage.UploadDir, "announcements.json"))
+	if err != nil {
+		logger.Fatalf("Failed to load announcements: %v", err)
+	}
+	pages, err := services.NewPageStore(filepath.Join(cfg.Storage.UploadDir, "pages.json"))
+	if err != nil {
+		logger.Fatalf("Failed to load pages: %v", err)
+	}
+	keyStore, err := services.NewKeyStore(filepath.Join(cfg.Storage.UploadDir, keysFile))
+	if err != nil {
+		logger.Fatalf("Failed to load API keys: %v", err)
+	}
+	testers, err := services.NewTesterStore(filepath.Join(cfg.Storage.UploadDir, "testers.json"))
+	if err != nil {
+		logger.Fatalf("Failed to load beta testers: %v", err)
+	}
+	var speedTests *services.SpeedTests
+	if cfg.FeatureEnabled(config.FlagSpeedTest) {
+		speedTests = services.NewSpeedTests()
+	}
+	var feedback *services.FeedbackStore
+	if cfg.FeatureEnabled(config.FlagFeedback) {
+		if feedback, err = services.NewFeedbackStore(filepath.Join(cfg.Storage.UploadDir, "feedback.json")); err != nil {
+			logger.Fatalf("Failed to load feedback: %v", err)
+		}
+	}
+	var ratings *services.RatingStore
+	if cfg.FeatureEnabled(config.FlagRatings) {
+		if ratings, err = services.NewRatingStore(filepath.Join(cfg.Storage.UploadDir, "ratings.json")); err != nil {
+			logger.Fatalf("Failed to load ratings: %v", err)
+		}
+	}
+	// Per-client request limits; the handlers reach it to purge a client
+	limits := cfg.GetRateLimit()
+	requestLimiter := middleware.NewRateLimiter(limits.RequestsPerMinute, limits.BurstSize, limits.Shards)
+	h := handlers.NewHandlers(cfg, fileService, cdn, auditLog, announcements, activity, metrics, speedTests, feedback, pages, ratings, keyStore, testers, requestLimiter, logger)
+
+	// Create auth middleware
+	authMiddleware := middleware.Auth(cfg, keyStore, logger, func(r *http.Request) {
+		activity.RecordAuthFailure(middleware.LoggedIP(r), r.URL.Path)
+	})
+
+	// Mirrors never accept writes
+	writable := func(next http.HandlerFunc) http.HandlerFunc { return next }
+	if cfg.Mirror.Enabled {
+		writable = h.ReadOnly
+	}
+
+	// Setup router
+	mux := http.NewServeMux()
+
+	// Public endpoints. Patterns carry the method, so the mux answers 405
+	// (with Allow) for the rest; GET patterns also match HEAD.
+	assets := staticFiles(cfg.Server.StaticDir)
+	mux.HandleFunc("GET /{$}", serveStaticFile(assets, "download.html"))
+	mux.HandleFunc("GET /admin", serveStaticFile(assets, "index.html"))
+	mux.HandleFunc("GET /health", h.Health)
+	mux.HandleFunc("GET /readyz", h.Ready)
+	mux.HandleFunc("GET /api/version", h.Version)
+	mux.HandleFunc("GET /api/config", h.GetConfig)
+	mux.HandleFunc("GET /api/v1/bootstrap", h.Bootstrap)
+	mux.HandleFunc("GET /list", h.ListFiles)
+	mux.HandleFunc("GET /api/v1/checksums", h.Checksums)
+	mux.HandleFunc("GET /api/v1/files/{category}/{filename}", h.FileDetails)
+	mux.HandleFunc("GET /builds/{category}/{filename}", h.BuildPreview)
+	mux.HandleFunc("GET /api/v1/files/{category}/{filename}/contents", h.ZipContents)
+	mux.HandleFunc("GET /api/v1/pages", h.ListPages)
+	mux.HandleFunc("GET /api/v1/apps/{package}", h.LatestApp)
+	mux.HandleFunc("GET /api/v1/pages/{device}", h.GetPage)
+	if cfg.FeatureEnabled(config.FlagBadges) {
+		mux.HandleFunc("GET /badge/downloads/{name}", h.DownloadBadge)
+	}
+	if cfg.FeatureEnabled(config.FlagReports) {
+		mux.HandleFunc("POST /api/v1/report", h.Report)
+	}
+	if feedback != nil {
+		mux.HandleFunc("POST /api/v1/feedback", h.SubmitFeedback)
+		mux.HandleFunc("GET /api/v1/files/{category}/{filename}/feedback", h.BuildFeedback)
+	}
+	if ratings != nil {
+		mux.HandleFunc("POST /api/v1/files/{category}/{filename}/rating", h.RateBuild)
+	}
+	if speedTests != nil {
+		mux.HandleFunc("GET /speedtest/{$}", h.SpeedTestIndex)
+		mux.HandleFunc("GET /speedtest/{payload}", h.SpeedTestPayload)
+		mux.HandleFunc("POST /speedtest/results", h.ReportSpeedTest)
+	}
+
+	// Static assets (favicon, images, etc.)
+	mux.Handle("GET /static/", http.StripPrefix("/static/", http.FileServer(http.FS(assets))))
+	mux.HandleFunc("GET /favicon.ico", serveStaticFile(assets, "favicon.png"))
+
+	// Protected endpoints (require API key)
+	mux.Handle("POST /upload", h.Maintenance(authMiddleware(writable(h.Upload))))
+	mux.Handle("POST /upload/finalize", h.Maintenance(authMiddleware(writable(h.FinalizeUpload))))
+	mux.HandleFunc("DELETE /delete", authMiddleware(writable(h.Delete)))
+	mux.HandleFunc("POST /delete", authMiddleware(writable(h.Delete)))
+	mux.HandleFunc("POST /api/v1/files/move", authMiddleware(writable(h.MoveFile)))
+	mux.HandleFunc("POST /api/v1/files/pin", authMiddleware(writable(h.PinFile)))
+	mux.HandleFunc("PATCH /api/v1/files/metadata", authMiddleware(writable(h.UpdateFileMetadata)))
+	mux.HandleFunc("POST /api/v1/files/bulk", authMiddleware(writable(h.Bulk)))
+	mux.HandleFunc("POST /api/v1/checksums/manifest", authMiddleware(writable(h.ImportManifest)))
+	mux.HandleFunc("GET /api/v1/checksums/manifest", authMiddleware(h.ExpectedChecksums))
+	mux.HandleFunc("DELETE /api/v1/checksums/manifest", authMiddleware(writable(h.DropExpectedChecksums)))
+	mux.HandleFunc("GET /api/v1/files/pending", authMiddleware(h.PendingFiles))
+	mux.HandleFunc("DELETE /api/v1/files/pending", authMiddleware(writable(h.DiscardPending)))
+	mux.HandleFunc("POST /api/v1/files/publish", authMiddleware(writable(h.PublishFile)))
+	mux.HandleFunc("POST /api/v1/files/confirm", authMiddleware(writable(h.ConfirmBuild)))
+	mux.HandleFunc("POST /api/v1/files/restore", authMiddleware(writable(h.RestorePrevious)))
+	mux.HandleFunc("PUT /api/v1/pages/{device}", authMiddleware(writable(h.SavePage)))
+	mux.HandleFunc("DELETE /api/v1/pages/{device}", authMiddleware(writable(h.DeletePage)))
+	mux.HandleFunc("GET /api/admin/stats", authMiddleware(h.AdminStats))
+	if cfg.FeatureEnabled(config.FlagStatsExport) {
+		mux.HandleFunc("GET /api/v1/stats/export", authMiddleware(h.ExportStats))
+	}
+	mux.HandleFunc("POST /api/admin/stats/counter", authMiddleware(h.SetCounter))
+	mux.HandleFunc("GET /api/admin/traffic", authMiddleware(h.AdminTraffic))
+	mux.HandleFunc("GET /api/admin/transfers", authMiddleware(h.AdminTransfers))
+	mux.HandleFunc("DELETE /api/admin/transfers", authMiddleware(h.CancelTransfer))
+	mux.HandleFunc("DELETE /api/admin/transfers/{id}", authMiddleware(h.CancelTransfer))
+	if metrics != nil {
+		mux.HandleFunc("GET /metrics", authMiddleware(h.Metrics))
+	}
+	mux.HandleFunc("GET /api/admin/config", authMiddleware(h.AdminConfig))
+	mux.HandleFunc("PATCH /api/admin/config", authMiddleware(h.PatchConfig))
+	mux.HandleFunc("GET /api/admin/announcements", authMiddleware(h.ListAnnouncements))
+	mux.HandleFunc("POST /api/admin/announcements", authMiddleware(h.CreateAnnouncement))
+	mux.HandleFunc("PUT /api/admin/announcements", authMiddleware(h.UpdateAnnouncement))
+	mux.HandleFunc("PUT /api/admin/announcements/{id}", authMiddleware(h.UpdateAnnouncement))
+	mux.HandleFunc("DELETE /api/admin/announcements", authMiddleware(h.DeleteAnnouncement))
+	mux.HandleFunc("DELETE /api/admin/announcements/{id}", authMiddleware(h.DeleteAnnouncement))
+	mux.HandleFunc("GET /api/admin/backup", authMiddleware(h.ExportBackup))
+	mux.HandleFunc("POST /api/admin/backup", authMiddleware(writable(h.RestoreBackup)))
+	mux.HandleFunc("GET /api/admin/activity", authMiddleware(h.AdminActivity))
+	mux.HandleFunc("POST /api/admin/privacy/purge", authMiddleware(h.PurgeClient))
+	if feedback != nil {
+		mux.HandleFunc("GET /api/admin/feedback", authMiddleware(h.AdminFeedback))
+		mux.HandleFunc("POST /api/admin/feedback/{id}/approve", authMiddleware(h.ApproveFeedback))
+		mux.HandleFunc("DELETE /api/admin/feedback/{id}", authMiddleware(h.DeleteFeedback))
+	}
+	if cfg.FeatureEnabled(config.FlagWebDAV) {
+		// Every method, so PROPFIND, MOVE and friends reach the handler
+		davAuth := middleware.Challenge(cfg.GetText().AppName)
+		mux.Handle("/dav/", h.Maintenance(davAuth(authMiddleware(h.WebDAV))))
+	}
+	mux.HandleFunc("GET /api/admin/quarantine", authMiddleware(h.AdminQuarantine))
+	mux.HandleFunc("GET /api/admin/quarantine/{id}", authMiddleware(h.QuarantinedFile))
+	mux.HandleFunc("GET /api/admin/quarantine/{id}/file", authMiddleware(h.DownloadQuarantined))
+	mux.HandleFunc("POST /api/admin/quarantine/{id}/release", authMiddleware(writable(h.ReleaseQuarantined)))
+	mux.HandleFunc("DELETE /api/admin/quarantine/{id}", authMiddleware(writable(h.PurgeQuarantined)))
+	mux.HandleFunc("GET /api/admin/testers", authMiddleware(h.ListTesters))
+	mux.HandleFunc("POST /api/admin/testers", authMiddleware(writable(h.AddTester)))
+	mux.HandleFunc("DELETE /api/admin/testers/{name}", authMiddleware(writable(h.RemoveTester)))
+	if speedTests != nil {
+		mux.HandleFunc("GET /api/admin/speedtest", authMiddleware(h.AdminSpeedTests))
+	}
+
+	// File downloads with concurrency control
+	mux.Handle("GET /downloads/{category}/{filename}", h.Maintenance(h.ServeDownload()))
+	mux.HandleFunc("GET /d/{code}", h.ShortLink)
+	mux.Handle("GET /api/v1/bundle/{category}", h.Maintenance(http.HandlerFunc(h.Bundle)))
+	mux.Handle("GET /api/v1/files/{category}/{filename}/extract", h.Maintenance(http.HandlerFunc(h.ExtractFile)))
+	// Staged builds, for whoever holds the preview link
+	mux.Handle("GET /preview/{token}/{filename}", h.Maintenance(h.Preview()))
+
+	// Apply middleware chain
+	// Short-lived cache for endpoints hammered by update checkers
+	responseCache := middleware.NewResponseCache(
+		time.Duration(cfg.Server.ResponseCacheTTLSecs)*time.Second,
+		"/list", "/api/config", "/api/v1/bootstrap", "/badge/downloads/",
+	)
+
+	// Drop cached responses when what they show changes; admin writes go
+	// through these, while public POSTs (ratings, feedback) just age out
+	fileService.OnChange(responseCache.Purge)
+	announcements.OnChange(responseCache.Purge)
+	pages.OnChange(responseCache.Purge)
+	testers.OnChange(responseCache.Purge)
+
+	var handler http.Handler = mux
+	handler = responseCache.Middleware(handler)
+	handler = middleware.Compress(handler)
+	handler = middleware.CORS(handler)
+	handler = middleware.RateLimit(cfg, requestLimiter, shared, logger)(handler)
+	handler = middleware.RequestLogger(logger, cfg.Logging.EnableRequestLogging)(handler)
+	if cfg.Privacy.AnonymizeIPs {
+		handler = middleware.Privacy(middleware.NewAnonymizer(cfg.Privacy.IPMode, shared))(handler)
+	}
+	handler = middleware.SecurityHeaders(handler)
+
+	// Configure server with optimized settings for concurrent users
+	srv := &http.Server{
+		Addr:              ":" + cfg.Server.Port,
+		Handler:           handler,
+		ReadTimeout:       time.Duration(cfg.Server.ReadTimeoutMinutes) * time.Minute,
+		WriteTimeout:      time.Duration(cfg.Server.WriteTimeoutMinutes) * time.Minute,
+		IdleTimeout:       time.Duration(cfg.Server.IdleTimeoutSeconds) * time.Second,
+		MaxHeaderBytes:    1 << 20, // 1MB max header size
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	// Bind before reporting ready so systemd only starts dependents once
+	// connections are accepted
+	ln, err := net.Listen("tcp", srv.Addr)
+	if err != nil {
+		logger.Fatalf("Server error: %v", err)
+	}
+
+	// Start server in background
+	go func() {
+		logger.Printf("Server %s starting on :%s", version.Version, cfg.Server.Port)
+		logger.Printf("Storage path: %s", cfg.Storage.UploadDir)
+		logger.Printf("Max concurrent downloads: %d (%d small, %d bulk)", cfg.Concurrency.MaxConcurrentDownloads,
+			cfg.DownloadSlots(config.DownloadSmall), cfg.DownloadSlots(config.DownloadBulk))
+		logger.Printf("Max concurrent uploads: %d", cfg.Concurrency.MaxConcurrentUploads)
+
+		if err := srv.Serve(ln); err != nil && err != http.ErrServerClosed {
+			logger.Fatalf("Server error: %v", err)
+		}
+	}()
+
+	// Type=notify units learn we're up; WatchdogSec= restarts a wedged server
+	systemd := services.NewSystemdNotifier(logger)
+	systemd.Ready()
+	systemd.StartWatchdog(fileService.Ping)
+
+	// Hot reload on SIGHUP; in-flight transfers are untouched
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			reloaded := systemd.Reloading()
+			if err := cfg.Reload(*configPath); err != nil {
+				logger.Printf("Config reload failed, keeping current settings: %v", err)
+				reloaded()
+				continue
+			}
+			if err := fileService.ApplyConfigChange(); err != nil {
+				logger.Printf("Failed to apply reloaded config: %v", err)
+			}
+			reloaded()
+			logger.Println("Configuration reloaded")
+		}
+	}()
+
+	// Graceful shutdown
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	<-quit
+
+	logger.Println("Shutting down server...")
+	systemd.Stopping()
+	scheduler.Stop()
+	vault.Stop()
+	elector.Stop()
+	rsyncd.Stop()
+
+	// New connections are refused right away; in-flight requests get the
+	// shutdown timeout, and downloads may then continue until the drain
+	// deadline so users near the end of a big build aren't cut off
+	if err := shutdown(srv, fileService, cfg, logger); err != nil {
+		srv.Close()
+		fileService.Close()
+		logger.Fatalf("Server forced to shutdown: %v", err)
+	}
+
+	// Let queued webhooks and purges go out, then flush batched stats
+	if !workers.Stop(time.Duration(cfg.Server.ShutdownTimeoutSecs) * time.Second) {
+		logger.Println("Gave up waiting for background jobs")
+	}
+	if err := fileService.Close(); err != nil {
+		logger.Printf("Failed to flush stats: %v", err)
+	}
+
+	logger.Println("Server exited cleanly")
+	return 0
+}
+
+// shutdown stops srv gracefully following the configured drain policy
+func shutdown(srv *http.Server, fileService *services.FileService, cfg *config.Config, logger *log.Logger) error {
+	timeout := time.Duration(cfg.Server.ShutdownTimeoutSecs) * time.Second
+	drain := time.Duration(cfg.Server.DownloadDrainSecs) * time.Second
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	err := srv.Shutdown(ctx)
+	if err == nil || drain <= timeout || fileService.CountTransfers(services.TransferDownload) == 0 {
+		return err
+	}
+
+	// Uploads had their grace period; only downloads are worth waiting for
+	if n := fileService.CancelTransfers(services.TransferUpload); n > 0 {
+		logger.Printf("Cancelled %d unfinished uploads", n)
+	}
+	logger.Printf("Draining %d downloads for up to %s", fileService.CountTransfers(services.TransferDownload), drain-timeout)
+
+	drainCtx, drainCancel := context.WithTimeout(context.Background(), drain-timeout)
+	defer drainCancel()
+	return srv.Shutdown(drainCtx)
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"rom-server/internal/config"
+)
+
+// runSetup is the first-run wizard: it asks for the port, storage path and
+// categories, generates the admin key and writes a ready-to-serve config.
+// Flags answer the questions up front; with -yes or no terminal on stdin it
+// doesn't prompt at all.
+func runSetup(args []string) int {
+	fs := flag.NewFlagSet("setup", flag.ContinueOnError)
+	configPath := fs.String("config", "config.json", "Where to write the config")
+	port := fs.String("port", "8080", "HTTP port")
+	uploadDir := fs.String("upload-dir", "uploads", "Where builds are stored")
+	categories := fs.String("categories", "stable", "Comma-separated category keys")
+	maxFiles := fs.Int("max-files", 3, "Builds kept per category")
+	yes := fs.Bool("yes", false, "Accept the flag values without prompting")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	// One-time: never clobber a config, that's what `config init -force` is for
+	if _, err := os.Stat(*configPath); err == nil {
+		fmt.Fprintf(os.Stderr, "%s already exists; setup only creates new configs\n", *configPath)
+		return 1
+	}
+
+	p := &prompter{in: bufio.NewReader(os.Stdin), out: os.Stderr, enabled: !*yes && isTerminal(os.Stdin)}
+	if p.enabled {
+		fmt.Fprintf(p.out, "Setting up %s. Press Enter to keep the [default].\n\n", *configPath)
+	}
+
+	opts := config.TemplateOptions{}
+	opts.Port = p.ask("HTTP port", *port, func(s string) error {
+		if n, err := strconv.Atoi(s); err != nil || n < 1 || n > 65535 {
+			return fmt.Errorf("must be a number from 1 to 65535")
+		}
+		return nil
+	})
+	opts.UploadDir = p.ask("Storage directory", *uploadDir, func(s string) error {
+		if s == "" {
+			return fmt.Errorf("is required")
+		}
+		return nil
+	})
+	names := p.ask("Categories (comma-separated)", *categories, func(s string) error {
+		for _, name := range splitList(s) {
+			if !config.ValidCategoryName(name) {
+				return fmt.Errorf("%q must be lowercase letters, digits, '-' or '_'", name)
+			}
+		}
+		if len(splitList(s)) == 0 {
+			return fmt.Errorf("at least one category is required")
+		}
+		return nil
+	})
+	for _, name := range splitList(names) {
+		cat := config.TemplateCategory{Name: name, DisplayName: titleCase(name), MaxFiles: *maxFiles}
+		cat.DisplayName = p.ask(fmt.Sprintf("  %s: display name", name), cat.DisplayName, nil)
+		cat.Description = p.ask(fmt.Sprintf("  %s: description", name), cat.Description, nil)
+		kept := p.ask(fmt.Sprintf("  %s: builds to keep", name), strconv.Itoa(cat.MaxFiles), func(s string) error {
+			if n, err := strconv.Atoi(s); err != nil || n < 1 {
+				return fmt.Errorf("must be at least 1")
+			}
+			return nil
+		})
+		cat.MaxFiles, _ = strconv.Atoi(kept)
+		opts.Categories = append(opts.Categories, cat)
+	}
+	if p.err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", p.err)
+		return 1
+	}
+
+	key, err := config.GenerateAPIKey()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to generate API key: %v\n", err)
+		return 1
+	}
+	opts.APIKey = key
+
+	// The file holds the key, so only the owner may read it
+	if err := os.WriteFile(*configPath, []byte(config.Template(opts)), 0600); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to write %s: %v\n", *configPath, err)
+		return 1
+	}
+	schemaPath := filepath.Join(filepath.Dir(*configPath), "config.schema.json")
+	if err := os.WriteFile(schemaPath, config.Schema, 0644); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to write %s: %v\n", schemaPath, err)
+		return 1
+	}
+
+	// Create the storage layout now so permission problems show up here
+	_, fileService, err := openStorage(*configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "wrote %s, but it doesn't load: %v\n", *configPath, err)
+		return 1
+	}
+	fileService.Close()
+
+	fmt.Fprintf(os.Stderr, "\nWrote %s and %s.\n", *configPath, schemaPath)
+	fmt.Fprintf(os.Stderr, "Admin API key (also in the config as default_api_key; set API_KEY to override):\n")
+	fmt.Println(key)
+	fmt.Fprintf(os.Stderr, "\nStart the server with: rom-server serve -config %s\n", *configPath)
+	return 0
+}
+
+// prompter asks questions on a terminal, or returns the defaults when disabled
+type prompter struct {
+	in      *bufio.Reader
+	out     io.Writer
+	enabled bool
+	err     error // First read error; later questions return their defaults
+}
+
+// ask prompts until the answer passes check (optional); empty keeps def
+func (p *prompter) ask(question, def string, check func(string) error) string {
+	for {
+		answer := def
+		interactive := p.enabled && p.err == nil
+		if interactive {
+			fmt.Fprintf(p.out, "%s [%s]: ", question, def)
+			line, err := p.in.ReadString('\n')
+			if err != nil && line == "" {
+				p.err = err
+				return def
+			}
+			if line = strings.TrimSpace(line); line != "" {
+				answer = line
+			}
+		}
+		if check == nil {
+			return answer
+		}
+		err := check(answer)
+		if err == nil {
+			return answer
+		}
+		if !interactive {
+			if p.err == nil {
+				p.err = fmt.Errorf("%s: %v", strings.TrimSpace(question), err)
+			}
+			return answer
+		}
+		fmt.Fprintf(p.out, "  %v\n", err)
+	}
+}
+
+// isTerminal reports whether f is an interactive terminal
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// splitList splits a comma-separated list, dropping blanks
+func splitList(s string) []string {
+	var out []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+// titleCase turns a category key like "gapps-beta" into "Gapps Beta"
+func titleCase(name string) string {
+	words := strings.FieldsFunc(name, func(r rune) bool { return r == '-' || r == '_' })
+	for i, w := range words {
+		r := []rune(w)
+		r[0] = unicode.ToUpper(r[0])
+		words[i] = string(r)
+	}
+	return strings.Join(words, " ")
+}
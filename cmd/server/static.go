@@ -0,0 +1,58 @@
+package main
+
+import (
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+
+	"rom-server/static"
+)
+
+// staticFiles returns the web UI: the embedded copy, with any file present
+// in dir (if set) taking its place
+func staticFiles(dir string) fs.FS {
+	if dir == "" {
+		return static.Files
+	}
+	return overlayFS{top: os.DirFS(dir), base: static.Files}
+}
+
+// overlayFS opens a file from top, falling back to base
+type overlayFS struct {
+	top, base fs.FS
+}
+
+func (o overlayFS) Open(name string) (fs.File, error) {
+	if f, err := o.top.Open(name); err == nil {
+		return f, nil
+	}
+	return o.base.Open(name)
+}
+
+// serveStaticFile returns a handler that serves one page
+func serveStaticFile(files fs.FS, name string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		serveFile(w, r, files, name)
+	}
+}
+
+// serveFile writes a file from files with range and conditional request
+// support; embedded files have no modification time
+func serveFile(w http.ResponseWriter, r *http.Request, files fs.FS, name string) {
+	f, err := files.Open(name)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	rs, ok := f.(io.ReadSeeker)
+	if err != nil || info.IsDir() || !ok {
+		http.NotFound(w, r)
+		return
+	}
+	http.ServeContent(w, r, path.Base(name), info.ModTime(), rs)
+}
@@ -1,3 +1,8 @@
 module rom-server
 
-go 1.21
+go 1.22
+
+require (
+	golang.org/x/text v0.14.0
+	golang.org/x/time v0.5.0
+)
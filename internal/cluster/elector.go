@@ -0,0 +1,92 @@
+package cluster
+
+import (
+	"fmt"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// leaderKey is the shared lease key held by the current leader
+const leaderKey = "leader"
+
+// Elector elects a single leader among instances sharing a Store by holding
+// a renewable lease. Without a store every instance is its own leader.
+type Elector struct {
+	store  Store
+	id     string
+	ttl    time.Duration
+	leader int32
+	stop   chan struct{}
+}
+
+// NewElector creates an elector; id defaults to hostname:pid
+func NewElector(store Store, id string, ttl time.Duration) *Elector {
+	if id == "" {
+		host, _ := os.Hostname()
+		id = fmt.Sprintf("%s:%d", host, os.Getpid())
+	}
+	e := &Elector{store: store, id: id, ttl: ttl, stop: make(chan struct{})}
+	if store == nil {
+		e.leader = 1
+	}
+	return e
+}
+
+// ID returns this instance's identity in the election
+func (e *Elector) ID() string {
+	return e.id
+}
+
+// IsLeader reports whether this instance currently holds the lease
+func (e *Elector) IsLeader() bool {
+	return atomic.LoadInt32(&e.leader) == 1
+}
+
+// Run campaigns for and renews the lease until Stop is called
+func (e *Elector) Run() {
+	if e.store == nil {
+		return
+	}
+
+	// Renew well within the TTL so a slow round trip doesn't lose the lease
+	ticker := time.NewTicker(e.ttl / 3)
+	defer ticker.Stop()
+
+	for {
+		e.campaign()
+		select {
+		case <-ticker.C:
+		case <-e.stop:
+			if e.IsLeader() {
+				// Hand over promptly instead of waiting for the lease to expire
+				e.store.CompareAndDelete(leaderKey, e.id)
+			}
+			return
+		}
+	}
+}
+
+// campaign acquires or renews the lease
+func (e *Elector) campaign() {
+	var ok bool
+	var err error
+	if e.IsLeader() {
+		ok, err = e.store.CompareAndExpire(leaderKey, e.id, e.ttl)
+	}
+	if !ok {
+		ok, err = e.store.SetNX(leaderKey, e.id, e.ttl)
+	}
+
+	// On store errors step down: better no leader briefly than two leaders
+	if err != nil || !ok {
+		atomic.StoreInt32(&e.leader, 0)
+		return
+	}
+	atomic.StoreInt32(&e.leader, 1)
+}
+
+// Stop ends the campaign and releases the lease if held
+func (e *Elector) Stop() {
+	close(e.stop)
+}
@@ -0,0 +1,367 @@
+package cluster
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// redisTimeout bounds every round trip so a stuck Redis can't hang requests
+const redisTimeout = 5 * time.Second
+
+// redisPoolSize bounds the connections open at once. Rate limit checks run
+// on every request, so one slow round trip mustn't hold up the others.
+const redisPoolSize = 8
+
+// errNil is returned internally for RESP nil replies
+var errNil = errors.New("redis: nil")
+
+// errPoolClosed is returned by commands sent after Close
+var errPoolClosed = errors.New("redis: store closed")
+
+// RedisStore implements Store on top of a minimal RESP client with a small
+// connection pool. All keys are namespaced with the configured prefix.
+type RedisStore struct {
+	addr     string
+	password string
+	db       int
+	prefix   string
+	slots    chan struct{}   // One per connection in use or idle
+	idle     chan *redisConn // Connections ready for reuse
+	closed   chan struct{}
+	once     sync.Once
+}
+
+// redisConn is one connection, used by a single command at a time
+type redisConn struct {
+	conn net.Conn
+	rd   *bufio.Reader
+}
+
+// NewRedisStore connects to a redis://[:password@]host:port[/db] URL
+func NewRedisStore(rawURL, prefix string) (*RedisStore, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Scheme != "redis" {
+		return nil, fmt.Errorf("invalid redis url %q", rawURL)
+	}
+
+	r := &RedisStore{
+		addr:   u.Host,
+		prefix: prefix,
+		slots:  make(chan struct{}, redisPoolSize),
+		idle:   make(chan *redisConn, redisPoolSize),
+		closed: make(chan struct{}),
+	}
+	if !strings.Contains(r.addr, ":") {
+		r.addr += ":6379"
+	}
+	if u.User != nil {
+		r.password, _ = u.User.Password()
+	}
+	if db := strings.TrimPrefix(u.Path, "/"); db != "" {
+		if r.db, err = strconv.Atoi(db); err != nil {
+			return nil, fmt.Errorf("invalid redis database %q", db)
+		}
+	}
+
+	// Fail at startup rather than on the first request
+	c, err := r.connect()
+	if err != nil {
+		return nil, err
+	}
+	r.slots <- struct{}{}
+	r.put(c)
+	return r, nil
+}
+
+// connect dials Redis and authenticates
+func (r *RedisStore) connect() (*redisConn, error) {
+	conn, err := net.DialTimeout("tcp", r.addr, redisTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to redis: %w", err)
+	}
+	c := &redisConn{conn: conn, rd: bufio.NewReader(conn)}
+
+	if r.password != "" {
+		if _, err := c.roundTrip("AUTH", r.password); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("redis auth failed: %w", err)
+		}
+	}
+	if r.db != 0 {
+		if _, err := c.roundTrip("SELECT", strconv.Itoa(r.db)); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("redis select failed: %w", err)
+		}
+	}
+	return c, nil
+}
+
+// get takes an idle connection or opens one, waiting up to redisTimeout
+// while the pool is full
+func (r *RedisStore) get() (*redisConn, error) {
+	timer := time.NewTimer(redisTimeout)
+	defer timer.Stop()
+	select {
+	case c := <-r.idle:
+		return c, nil
+	case r.slots <- struct{}{}:
+	case <-r.closed:
+		return nil, errPoolClosed
+	case <-timer.C:
+		return nil, errors.New("redis: no free connection")
+	}
+
+	// A connection may have come back while the slot was being taken
+	select {
+	case c := <-r.idle:
+		<-r.slots
+		return c, nil
+	default:
+	}
+	c, err := r.connect()
+	if err != nil {
+		<-r.slots
+		return nil, err
+	}
+	return c, nil
+}
+
+// put returns a healthy connection to the pool
+func (r *RedisStore) put(c *redisConn) {
+	select {
+	case <-r.closed:
+		r.discard(c)
+	default:
+		r.idle <- c // Never blocks: idle has room for every slot
+	}
+}
+
+// discard closes a broken connection and frees its slot
+func (r *RedisStore) discard(c *redisConn) {
+	c.conn.Close()
+	<-r.slots
+}
+
+// do runs a command on a pooled connection. A connection that failed is
+// closed, so the next command dials a fresh one.
+func (r *RedisStore) do(args ...string) (interface{}, error) {
+	c, err := r.get()
+	if err != nil {
+		return nil, err
+	}
+
+	reply, err := c.roundTrip(args...)
+	var redisErr redisError
+	if err != nil && err != errNil && !errors.As(err, &redisErr) {
+		r.discard(c)
+	} else {
+		r.put(c)
+	}
+	return reply, err
+}
+
+// roundTrip writes one command and reads its reply
+func (c *redisConn) roundTrip(args ...string) (interface{}, error) {
+	c.conn.SetDeadline(time.Now().Add(redisTimeout))
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if _, err := io.WriteString(c.conn, b.String()); err != nil {
+		return nil, err
+	}
+	return readReply(c.rd)
+}
+
+// redisError is an error reply sent by the server
+type redisError string
+
+func (e redisError) Error() string { return "redis: " + string(e) }
+
+// readReply parses a single RESP value
+func readReply(rd *bufio.Reader) (interface{}, error) {
+	line, err := rd.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return nil, fmt.Errorf("redis: empty reply")
+	}
+
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, redisError(line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 {
+			return nil, errNil
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(rd, buf); err != nil {
+			return nil, err
+		}
+		return string(buf[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 {
+			return nil, errNil
+		}
+		items := make([]interface{}, n)
+		for i := range items {
+			item, err := readReply(rd)
+			if err != nil && err != errNil {
+				return nil, err
+			}
+			items[i] = item
+		}
+		return items, nil
+	}
+	return nil, fmt.Errorf("redis: unexpected reply %q", line)
+}
+
+func (r *RedisStore) key(name string) string {
+	return r.prefix + name
+}
+
+// HashIncrBy adds delta to a numeric field of a hash
+func (r *RedisStore) HashIncrBy(hash, field string, delta int64) error {
+	_, err := r.do("HINCRBY", r.key(hash), field, strconv.FormatInt(delta, 10))
+	return err
+}
+
+// HashGetAll returns every field of a hash
+func (r *RedisStore) HashGetAll(hash string) (map[string]string, error) {
+	reply, err := r.do("HGETALL", r.key(hash))
+	if err == errNil {
+		return map[string]string{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	items, _ := reply.([]interface{})
+	result := make(map[string]string, len(items)/2)
+	for i := 0; i+1 < len(items); i += 2 {
+		field, _ := items[i].(string)
+		result[field] = fmt.Sprint(items[i+1])
+	}
+	return result, nil
+}
+
+// HashSet stores a field of a hash
+func (r *RedisStore) HashSet(hash, field, value string) error {
+	_, err := r.do("HSET", r.key(hash), field, value)
+	return err
+}
+
+// HashDel removes a field from a hash
+func (r *RedisStore) HashDel(hash, field string) error {
+	_, err := r.do("HDEL", r.key(hash), field)
+	return err
+}
+
+// Incr atomically increments a counter key and returns the new value
+func (r *RedisStore) Incr(key string) (int64, error) {
+	reply, err := r.do("INCR", r.key(key))
+	if err != nil {
+		return 0, err
+	}
+	n, _ := reply.(int64)
+	return n, nil
+}
+
+// IncrWithTTL increments a counter key, setting its expiry when created.
+// Both happen in one script, so a counter can't be left without a TTL.
+func (r *RedisStore) IncrWithTTL(key string, ttl time.Duration) (int64, error) {
+	reply, err := r.do("EVAL", incrWithTTLScript, "1", r.key(key), strconv.FormatInt(ttl.Milliseconds(), 10))
+	if err != nil {
+		return 0, err
+	}
+	n, _ := reply.(int64)
+	return n, nil
+}
+
+// Get returns the value of a key ("" if missing)
+func (r *RedisStore) Get(key string) (string, error) {
+	reply, err := r.do("GET", r.key(key))
+	if err == errNil {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	value, _ := reply.(string)
+	return value, nil
+}
+
+// SetNX sets key to value with a TTL only if it does not exist yet
+func (r *RedisStore) SetNX(key, value string, ttl time.Duration) (bool, error) {
+	_, err := r.do("SET", r.key(key), value, "NX", "PX", strconv.FormatInt(ttl.Milliseconds(), 10))
+	if err == errNil {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Lua scripts make the check-and-act operations atomic. incrWithTTL also
+// gives a counter missing its expiry one, whatever left it that way.
+const (
+	incrWithTTLScript      = `local n = redis.call("INCR", KEYS[1]) if redis.call("PTTL", KEYS[1]) < 0 then redis.call("PEXPIRE", KEYS[1], ARGV[1]) end return n`
+	compareAndExpireScript = `if redis.call("GET", KEYS[1]) == ARGV[1] then return redis.call("PEXPIRE", KEYS[1], ARGV[2]) else return 0 end`
+	compareAndDeleteScript = `if redis.call("GET", KEYS[1]) == ARGV[1] then return redis.call("DEL", KEYS[1]) else return 0 end`
+)
+
+// CompareAndExpire refreshes a key's TTL only if it still holds value
+func (r *RedisStore) CompareAndExpire(key, value string, ttl time.Duration) (bool, error) {
+	reply, err := r.do("EVAL", compareAndExpireScript, "1", r.key(key), value, strconv.FormatInt(ttl.Milliseconds(), 10))
+	if err != nil {
+		return false, err
+	}
+	n, _ := reply.(int64)
+	return n == 1, nil
+}
+
+// CompareAndDelete deletes a key only if it still holds value
+func (r *RedisStore) CompareAndDelete(key, value string) (bool, error) {
+	reply, err := r.do("EVAL", compareAndDeleteScript, "1", r.key(key), value)
+	if err != nil {
+		return false, err
+	}
+	n, _ := reply.(int64)
+	return n == 1, nil
+}
+
+// Close releases the idle connections; ones in use are closed as they
+// come back
+func (r *RedisStore) Close() error {
+	r.once.Do(func() { close(r.closed) })
+	for {
+		select {
+		case c := <-r.idle:
+			r.discard(c)
+		default:
+			return nil
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package cluster
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeRedis answers every command with :1 after delay (per command name)
+// and records the commands it got
+type fakeRedis struct {
+	ln       net.Listener
+	mu       sync.Mutex
+	commands []string
+	delay    map[string]time.Duration
+}
+
+func newFakeRedis(t *testing.T, delay map[string]time.Duration) *fakeRedis {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &fakeRedis{ln: ln, delay: delay}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go f.serve(conn)
+		}
+	}()
+	return f
+}
+
+func (f *fakeRedis) serve(conn net.Conn) {
+	defer conn.Close()
+	rd := bufio.NewReader(conn)
+	for {
+		reply, err := readReply(rd)
+		if err != nil {
+			return
+		}
+		args, _ := reply.([]interface{})
+		if len(args) == 0 {
+			return
+		}
+		name, _ := args[0].(string)
+		f.mu.Lock()
+		f.commands = append(f.commands, name)
+		f.mu.Unlock()
+		time.Sleep(f.delay[name])
+		conn.Write([]byte(":1\r\n"))
+	}
+}
+
+func TestRedisSlowCommandDoesNotBlockOthers(t *testing.T) {
+	f := newFakeRedis(t, map[string]time.Duration{"HGETALL": time.Second})
+	r, err := NewRedisStore("redis://"+f.ln.Addr().String(), "test:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	go r.HashGetAll("slow")
+	time.Sleep(50 * time.Millisecond)
+	start := time.Now()
+	if _, err := r.Incr("fast"); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("Incr waited %v behind a slow command", elapsed)
+	}
+}
+
+func TestRedisIncrWithTTLIsOneCommand(t *testing.T) {
+	f := newFakeRedis(t, nil)
+	r, err := NewRedisStore("redis://"+f.ln.Addr().String(), "test:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	if n, err := r.IncrWithTTL("rl", time.Minute); err != nil || n != 1 {
+		t.Fatalf("IncrWithTTL = %d, %v", n, err)
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if got := strings.Join(f.commands, " "); got != "EVAL" {
+		t.Errorf("IncrWithTTL sent %q, want a single EVAL", got)
+	}
+}
@@ -0,0 +1,30 @@
+package cluster
+
+import "time"
+
+// Store is the shared backend that lets several instances behind a load
+// balancer agree on counters, metadata and coordination state
+type Store interface {
+	// HashIncrBy adds delta to a numeric field of a hash
+	HashIncrBy(hash, field string, delta int64) error
+	// HashGetAll returns every field of a hash
+	HashGetAll(hash string) (map[string]string, error)
+	// HashSet stores a field of a hash
+	HashSet(hash, field, value string) error
+	// HashDel removes a field from a hash
+	HashDel(hash, field string) error
+	// Incr atomically increments a counter key and returns the new value
+	Incr(key string) (int64, error)
+	// IncrWithTTL increments a counter key, setting its expiry when created
+	IncrWithTTL(key string, ttl time.Duration) (int64, error)
+	// Get returns the value of a key ("" if missing)
+	Get(key string) (string, error)
+	// SetNX sets key to value with a TTL only if it does not exist yet
+	SetNX(key, value string, ttl time.Duration) (bool, error)
+	// CompareAndExpire refreshes a key's TTL only if it still holds value
+	CompareAndExpire(key, value string, ttl time.Duration) (bool, error)
+	// CompareAndDelete deletes a key only if it still holds value
+	CompareAndDelete(key, value string) (bool, error)
+	// Close releases the connection
+	Close() error
+}
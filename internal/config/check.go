@@ -0,0 +1,137 @@
+package config
+
+import (
+	_ "embed"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Schema is the JSON Schema for config.json, for editors and CI linting
+//
+//go:embed config.schema.json
+var Schema []byte
+
+// Issue is a problem found by Check
+type Issue struct {
+	Fatal   bool // Errors stop deployment; warnings are advisory
+	Message string
+}
+
+func (i Issue) String() string {
+	if i.Fatal {
+		return "error: " + i.Message
+	}
+	return "warning: " + i.Message
+}
+
+// categoryName matches names that are safe in URLs and directory names
+var categoryName = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// ValidCategoryName reports whether name can be used as a category key
+func ValidCategoryName(name string) bool {
+	return categoryName.MatchString(name)
+}
+
+// Check runs deeper checks than Validate against the local machine:
+// directories writable, extensions well-formed, timeouts sane. It assumes
+// Validate already passed.
+func (c *Config) Check() []Issue {
+	var issues []Issue
+	fail := func(format string, args ...interface{}) {
+		issues = append(issues, Issue{Fatal: true, Message: fmt.Sprintf(format, args...)})
+	}
+	warn := func(format string, args ...interface{}) {
+		issues = append(issues, Issue{Message: fmt.Sprintf(format, args...)})
+	}
+
+	if port, err := strconv.Atoi(c.Server.Port); err != nil || port < 1 || port > 65535 {
+		fail("server.port %q is not a valid port", c.Server.Port)
+	}
+	if c.Server.ReadTimeoutMinutes < 1 || c.Server.WriteTimeoutMinutes < 1 {
+		fail("server read/write timeouts must be at least 1 minute")
+	} else if c.Server.WriteTimeoutMinutes < 10 {
+		warn("server.write_timeout_minutes of %d may cut off large downloads on slow connections", c.Server.WriteTimeoutMinutes)
+	}
+	if c.Server.IdleTimeoutSeconds < 1 {
+		fail("server.idle_timeout_seconds must be at least 1")
+	}
+	if c.Server.ShutdownTimeoutSecs < 1 {
+		warn("server.shutdown_timeout_seconds is %d; in-flight transfers are cut on shutdown", c.Server.ShutdownTimeoutSecs)
+	}
+
+	for name, cat := range c.Categories {
+		if !categoryName.MatchString(name) {
+			fail("category %q should be lowercase letters, digits, '-' or '_'", name)
+		}
+		for _, ext := range cat.AllowedExts {
+			if !strings.HasPrefix(ext, ".") || len(ext) < 2 {
+				fail("category %s: allowed extension %q must start with '.'", name, ext)
+			}
+		}
+	}
+
+	if len(c.AllowedExts) == 0 {
+		fail("allowed_extensions is empty; nothing could be uploaded")
+	}
+	for _, ext := range c.AllowedExts {
+		if !strings.HasPrefix(ext, ".") || len(ext) < 2 {
+			fail("allowed extension %q must start with '.'", ext)
+		}
+	}
+
+	if c.Storage.MaxUploadSizeGB < 1 {
+		fail("storage.max_upload_size_gb must be at least 1")
+	}
+	if _, err := strconv.ParseUint(c.Storage.DirPermissions, 8, 32); c.Storage.DirPermissions != "" && err != nil {
+		fail("storage.dir_permissions %q is not an octal mode", c.Storage.DirPermissions)
+	}
+	if err := checkWritable(c.Storage.UploadDir); err != nil {
+		fail("storage.upload_dir: %v", err)
+	} else if err := checkWritable(filepath.Join(c.Storage.UploadDir, c.Storage.TempDir)); err != nil {
+		fail("storage.temp_dir: %v", err)
+	}
+
+	if c.Server.StaticDir != "" {
+		if info, err := os.Stat(c.Server.StaticDir); err != nil || !info.IsDir() {
+			warn("server.static_dir %q is not a directory; the built-in web UI is served as is", c.Server.StaticDir)
+		}
+	}
+
+	if c.Security.DefaultAPIKey == "changeme" {
+		warn("API key is the default \"changeme\"; set %s or %s_FILE", c.Security.APIKeyEnv, c.Security.APIKeyEnv)
+	}
+
+	return issues
+}
+
+// checkWritable verifies files can be created in dir, or in its nearest
+// existing parent if dir doesn't exist yet (the server creates it on start)
+func checkWritable(dir string) error {
+	target := dir
+	for {
+		info, err := os.Stat(target)
+		if err == nil {
+			if !info.IsDir() {
+				return fmt.Errorf("%s is not a directory", target)
+			}
+			break
+		}
+		parent := filepath.Dir(target)
+		if parent == target {
+			return fmt.Errorf("no existing parent for %s", dir)
+		}
+		target = parent
+	}
+
+	f, err := os.CreateTemp(target, ".write-check-*")
+	if err != nil {
+		return fmt.Errorf("%s is not writable: %w", target, err)
+	}
+	name := f.Name()
+	f.Close()
+	return os.Remove(name)
+}
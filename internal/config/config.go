@@ -4,19 +4,41 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"regexp"
+	"strings"
 	"sync"
 )
 
 // Config is the root configuration structure
 type Config struct {
-	Server      ServerConfig      `json:"server"`
-	Storage     StorageConfig     `json:"storage"`
+	Server      ServerConfig        `json:"server"`
+	Storage     StorageConfig       `json:"storage"`
 	Categories  map[string]Category `json:"categories"`
-	Security    SecurityConfig    `json:"security"`
-	Concurrency ConcurrencyConfig `json:"concurrency"`
-	Text        TextConfig        `json:"text"`
-	AllowedExts []string          `json:"allowed_extensions"`
-	Logging     LoggingConfig     `json:"logging"`
+	Security    SecurityConfig      `json:"security"`
+	Concurrency ConcurrencyConfig   `json:"concurrency"`
+	Text        TextConfig          `json:"text"`
+	AllowedExts []string            `json:"allowed_extensions"`
+	Logging     LoggingConfig       `json:"logging"`
+	Privacy     PrivacyConfig       `json:"privacy"`
+	Analytics   AnalyticsConfig     `json:"analytics"`
+	Webhooks    WebhookConfig       `json:"webhooks"`
+	Traffic     TrafficConfig       `json:"traffic"`
+	Cluster     ClusterConfig       `json:"cluster"`
+	CDN         CDNConfig           `json:"cdn"`
+	ObjectStore ObjectStoreConfig   `json:"object_store"`
+	Mirror      MirrorConfig        `json:"mirror"`
+	Rsync       RsyncConfig         `json:"rsync"`
+	Vault       VaultConfig         `json:"vault"`
+	Maintenance MaintenanceConfig   `json:"maintenance"`
+	Quarantine  QuarantineConfig    `json:"quarantine"`
+	Previews    PreviewConfig       `json:"previews"`
+	Links       []Link              `json:"links,omitempty"` // Support and project links for the download page
+	Flags       map[string]bool     `json:"flags"`           // Optional subsystems; unlisted ones are on
+
+	// Guards the settings that Reload swaps at runtime
+	reloadMu sync.RWMutex
+	patchMu  sync.Mutex // Serializes read-modify-write updates
+	path     string     // File the config was loaded from
 }
 
 type ServerConfig struct {
@@ -25,41 +47,82 @@ type ServerConfig struct {
 	WriteTimeoutMinutes  int    `json:"write_timeout_minutes"`
 	IdleTimeoutSeconds   int    `json:"idle_timeout_seconds"`
 	ShutdownTimeoutSecs  int    `json:"shutdown_timeout_seconds"`
+	DownloadDrainSecs    int    `json:"download_drain_seconds"` // Longer grace for in-flight downloads; 0 = none
+	ResponseCacheTTLSecs int    `json:"response_cache_ttl_seconds"`
+	StaticDir            string `json:"static_dir,omitempty"`      // Overrides embedded web UI files; "" = embedded only
+	DownloadDigest       string `json:"download_digest,omitempty"` // "header" (default), "trailer" or "off"
 }
 
 type StorageConfig struct {
-	UploadDir      string `json:"upload_dir"`
-	TempDir        string `json:"temp_dir"`
-	MaxUploadSizeGB int   `json:"max_upload_size_gb"`
-	DirPermissions string `json:"dir_permissions"`
+	UploadDir          string `json:"upload_dir"`
+	TempDir            string `json:"temp_dir"`
+	MaxUploadSizeGB    int    `json:"max_upload_size_gb"`
+	DirPermissions     string `json:"dir_permissions"`
+	ScrubIntervalHours int    `json:"scrub_interval_hours,omitempty"` // Re-verify stored builds this often (0 = off)
 }
 
 type Category struct {
-	Enabled     bool   `json:"enabled"`
-	MaxFiles    int    `json:"max_files"`
-	DisplayName string `json:"display_name"`
-	Description string `json:"description"`
+	Enabled          bool     `json:"enabled"`
+	MaxFiles         int      `json:"max_files"`
+	DisplayName      string   `json:"display_name"`
+	Description      string   `json:"description"`
+	MaxUploadSizeMB  int      `json:"max_upload_size_mb,omitempty"` // 0 = storage.max_upload_size_gb
+	AllowedExts      []string `json:"allowed_extensions,omitempty"` // Empty = global allowed_extensions
+	ImmutablePattern string   `json:"immutable_pattern,omitempty"`  // Regexp of versioned names cached for a year
+	Restricted       bool     `json:"restricted,omitempty"`         // Only API keys and allowlisted beta testers see it
+	Type             string   `json:"type,omitempty"`               // "" for builds, CategoryAPK for app packages
 }
 
+// CategoryAPK is the type of categories hosting Android apps; every upload
+// must be an APK, and its package details are recorded
+const CategoryAPK = "apk"
+
 type SecurityConfig struct {
 	APIKeyEnv     string          `json:"api_key_env"`
 	DefaultAPIKey string          `json:"default_api_key"`
 	RateLimit     RateLimitConfig `json:"rate_limit"`
+	Maintainers   []Maintainer    `json:"maintainers,omitempty"` // Extra named keys
 }
 
 type RateLimitConfig struct {
 	Enabled           bool `json:"enabled"`
 	RequestsPerMinute int  `json:"requests_per_minute"`
 	BurstSize         int  `json:"burst_size"`
+	Shards            int  `json:"shards"`
 }
 
 type ConcurrencyConfig struct {
-	MaxConcurrentDownloads int `json:"max_concurrent_downloads"`
-	MaxConcurrentUploads   int `json:"max_concurrent_uploads"`
-	DownloadBufferSizeKB   int `json:"download_buffer_size_kb"`
-	WorkerPoolSize         int `json:"worker_pool_size"`
+	MaxConcurrentDownloads    int `json:"max_concurrent_downloads"`
+	MaxConcurrentUploads      int `json:"max_concurrent_uploads"`
+	DownloadBufferSizeKB      int `json:"download_buffer_size_kb"`
+	WorkerPoolSize            int `json:"worker_pool_size"`
+	StatCacheSize             int `json:"stat_cache_size"`
+	UploadQueueTimeoutSeconds int `json:"upload_queue_timeout_seconds"` // Wait for a free upload slot before a 503
+	MaxSegmentsPerClient      int `json:"max_segments_per_client"`      // Parallel download connections per IP
+
+	UploadKBpsPerClient int    `json:"upload_kbps_per_client,omitempty"` // Upload bandwidth per client (0 = unlimited)
+	UploadThrottleBy    string `json:"upload_throttle_by,omitempty"`     // Who shares it: "key" (default) or "ip"
+
+	UploadMinKBps        int `json:"upload_min_kbps,omitempty"`         // Cut off uploads sending less than this (0 = off)
+	UploadMinRateMinutes int `json:"upload_min_rate_minutes,omitempty"` // Over this long (default 2)
+
+	SmallDownloadKB int            `json:"small_download_kb,omitempty"` // Downloads up to this size are DownloadSmall
+	DownloadWeights map[string]int `json:"download_weights,omitempty"`  // Share of max_concurrent_downloads per class
 }
 
+// Download priority classes. Each gets its own share of the download slots,
+// so checksum files, changelogs and OTA manifests never queue behind builds.
+const (
+	DownloadSmall = "small"
+	DownloadBulk  = "bulk"
+)
+
+// DownloadClasses lists the download priority classes
+var DownloadClasses = []string{DownloadSmall, DownloadBulk}
+
+// defaultDownloadWeights gives small files a fifth of the download slots
+var defaultDownloadWeights = map[string]int{DownloadSmall: 1, DownloadBulk: 4}
+
 type TextConfig struct {
 	AppName       string `json:"app_name"`
 	AppTitle      string `json:"app_title"`
@@ -75,57 +138,303 @@ type TextConfig struct {
 	CopySuccess   string `json:"copy_success"`
 	CopyFailed    string `json:"copy_failed"`
 	ServerError   string `json:"server_error"`
+
+	Locale       string                `json:"locale,omitempty"` // Language of the text above; "" = en
+	Translations map[string]TextConfig `json:"-"`                // By locale, e.g. "de" or "pt_BR"; see text.go
 }
 
 type LoggingConfig struct {
-	Level               string `json:"level"`
-	Format              string `json:"format"`
-	EnableRequestLogging bool  `json:"enable_request_logging"`
+	Level                string `json:"level"`
+	Format               string `json:"format"`
+	EnableRequestLogging bool   `json:"enable_request_logging"`
+}
+
+// PrivacyConfig hides client addresses before they are logged or stored.
+// Read at startup.
+type PrivacyConfig struct {
+	AnonymizeIPs bool   `json:"anonymize_ips"`
+	IPMode       string `json:"ip_mode"` // "hash" (salted, salt rotated daily) or "truncate" (/24, /48)
+}
+
+type AnalyticsConfig struct {
+	ExcludeBots   bool     `json:"exclude_bots"`
+	UpdaterAgents []string `json:"updater_agents"`
+	BotAgents     []string `json:"bot_agents"`
+}
+
+type WebhookConfig struct {
+	Enabled        bool    `json:"enabled"`
+	URL            string  `json:"url"`
+	Secret         string  `json:"secret"`
+	SecretEnv      string  `json:"secret_env"`
+	TimeoutSeconds int     `json:"timeout_seconds"`
+	Milestones     []int64 `json:"milestones"`
+	NotifyReports  bool    `json:"notify_reports"` // Send a build.reported event per user report
+}
+
+type TrafficConfig struct {
+	MonthlyCapGB int    `json:"monthly_cap_gb"` // 0 disables the cap
+	CapAction    string `json:"cap_action"`     // "throttle" or "redirect"
+	ThrottleKBps int    `json:"throttle_kbps"`
+	MirrorURL    string `json:"mirror_url"`
+}
+
+type ClusterConfig struct {
+	Enabled             bool   `json:"enabled"`
+	RedisURL            string `json:"redis_url"`
+	KeyPrefix           string `json:"key_prefix"`
+	SyncIntervalSeconds int    `json:"sync_interval_seconds"`
+	InstanceID          string `json:"instance_id"`
+	LeaderTTLSeconds    int    `json:"leader_ttl_seconds"`
+}
+
+type CDNConfig struct {
+	Enabled             bool   `json:"enabled"`
+	Provider            string `json:"provider"`   // "cloudflare" or "fastly"
+	BaseURL             string `json:"base_url"`   // Public URL that maps to /downloads/
+	ZoneID              string `json:"zone_id"`    // Cloudflare
+	ServiceID           string `json:"service_id"` // Fastly (informational, purges are per URL)
+	APIToken            string `json:"api_token"`
+	APITokenEnv         string `json:"api_token_env"`
+	EdgeMaxAgeSeconds   int    `json:"edge_max_age_seconds"`
+	SigningKey          string `json:"signing_key"`
+	SigningKeyEnv       string `json:"signing_key_env"`
+	SignedURLTTLSeconds int    `json:"signed_url_ttl_seconds"`
+}
+
+type ObjectStoreConfig struct {
+	Enabled            bool   `json:"enabled"`
+	Endpoint           string `json:"endpoint"` // e.g. https://s3.eu-central-1.amazonaws.com
+	Region             string `json:"region"`
+	Bucket             string `json:"bucket"`
+	PathStyle          bool   `json:"path_style"` // MinIO and most self-hosted backends
+	AccessKeyID        string `json:"access_key_id"`
+	AccessKeyIDEnv     string `json:"access_key_id_env"`
+	SecretAccessKey    string `json:"secret_access_key"`
+	SecretAccessKeyEnv string `json:"secret_access_key_env"`
+	PresignTTLSeconds  int    `json:"presign_ttl_seconds"`
+}
+
+type MirrorConfig struct {
+	Enabled             bool   `json:"enabled"`
+	UpstreamURL         string `json:"upstream_url"`
+	SyncIntervalMinutes int    `json:"sync_interval_minutes"`
+}
+
+// MaintenanceConfig takes uploads and downloads offline, e.g. for a disk
+// migration, while health checks and admin routes keep working
+type MaintenanceConfig struct {
+	Enabled           bool   `json:"enabled"`
+	Message           string `json:"message"`
+	RetryAfterSeconds int    `json:"retry_after_seconds"` // Sent as Retry-After; 0 omits it
 }
 
-// Global config instance with thread-safe access
-var (
-	instance *Config
-	once     sync.Once
-	mu       sync.RWMutex
+// QuarantineConfig screens every upload before it goes live. One that
+// fails is set aside in quarantine for an admin to release or purge.
+type QuarantineConfig struct {
+	BlocklistFile      string   `json:"blocklist_file,omitempty"`       // SHA-256 hashes to refuse, one per line (sha256sum output works)
+	ScanCommand        []string `json:"scan_command,omitempty"`         // Virus scanner, run with the file's path appended; exit 1 = infected
+	ScanTimeoutSeconds int      `json:"scan_timeout_seconds,omitempty"` // Longer scans count as failed (default 300)
+	RetentionDays      int      `json:"retention_days,omitempty"`       // Purge quarantined files after this long (0 = keep)
+}
+
+// PreviewConfig shapes the Open Graph and Twitter Card tags of the landing
+// pages at /builds/{category}/{filename}, which chat apps and forums read to
+// render a shared link as a card
+type PreviewConfig struct {
+	PublicURL    string            `json:"public_url,omitempty"`    // Origin for og:url and og:image, e.g. https://dl.example.com ("" = the request's host)
+	Image        string            `json:"image,omitempty"`         // Image for builds without a device image (default /static/favicon.png)
+	DeviceImages map[string]string `json:"device_images,omitempty"` // Image URL or path by device codename
+}
+
+type RsyncConfig struct {
+	Enabled        bool     `json:"enabled"`
+	Module         string   `json:"module"`
+	ConfPath       string   `json:"conf_path"`  // Where the generated rsyncd.conf is written
+	RunDaemon      bool     `json:"run_daemon"` // Launch and supervise rsync --daemon
+	Port           int      `json:"port"`
+	HostsAllow     []string `json:"hosts_allow"`
+	MaxConnections int      `json:"max_connections"`
+}
+
+// VaultConfig fetches secrets from a HashiCorp Vault KV engine
+type VaultConfig struct {
+	Enabled                bool   `json:"enabled"`
+	Address                string `json:"address"`   // VAULT_ADDR env overrides
+	TokenEnv               string `json:"token_env"` // Env var (or <VAR>_FILE) holding the Vault token
+	Token                  string `json:"-"`
+	Mount                  string `json:"mount"`      // KV engine mount, e.g. "secret"
+	Path                   string `json:"path"`       // Secret path under the mount
+	KVVersion              int    `json:"kv_version"` // 1 or 2
+	RefreshIntervalMinutes int    `json:"refresh_interval_minutes"`
+}
+
+// Feature flags gating optional subsystems at startup
+const (
+	FlagWebhooks    = "webhooks"     // Webhook delivery
+	FlagMetrics     = "metrics"      // Counters and the /metrics endpoint
+	FlagAuditLog    = "audit_log"    // audit.log of admin actions
+	FlagBadges      = "badges"       // /badge/downloads/ SVGs
+	FlagStatsExport = "stats_export" // /api/v1/stats/export
+	FlagSpeedTest   = "speedtest"    // /speedtest/ payloads and result reports
+	FlagReports     = "reports"      // /api/v1/report for flagging broken builds
+	FlagFeedback    = "feedback"     // Moderated user feedback on builds
+	FlagRatings     = "ratings"      // Thumbs up/down on builds
+	FlagWebDAV      = "webdav"       // /dav/ for managing files from WebDAV clients
 )
 
-// Load reads the configuration from a JSON file
+var knownFlags = []string{FlagWebhooks, FlagMetrics, FlagAuditLog, FlagBadges, FlagStatsExport, FlagSpeedTest, FlagReports, FlagFeedback, FlagRatings, FlagWebDAV}
+
+// Load reads the configuration from a JSON file. There is no global
+// instance: the caller passes the *Config to whatever needs it, so several
+// configs can live side by side (tests, the CLI commands) and a reload only
+// touches the one being served.
 func Load(path string) (*Config, error) {
+	return parse(path)
+}
+
+// parse reads, overrides and validates a config file
+func parse(path string) (*Config, error) {
 	data, err := os.ReadFile(path)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read config file: %w", err)
 	}
 
 	var cfg Config
-	if err := json.Unmarshal(data, &cfg); err != nil {
+	if err := json.Unmarshal(stripComments(data), &cfg); err != nil {
 		return nil, fmt.Errorf("failed to parse config file: %w", err)
 	}
 
 	// Override with environment variables
-	cfg.applyEnvOverrides()
+	if err := cfg.applyEnvOverrides(); err != nil {
+		return nil, err
+	}
 
 	// Validate configuration
 	if err := cfg.Validate(); err != nil {
 		return nil, fmt.Errorf("config validation failed: %w", err)
 	}
 
-	mu.Lock()
-	instance = &cfg
-	mu.Unlock()
-
+	cfg.path = path
 	return &cfg, nil
 }
 
-// Get returns the current configuration (thread-safe)
-func Get() *Config {
-	mu.RLock()
-	defer mu.RUnlock()
-	return instance
+// Reload re-reads the config file and applies the settings that are safe to
+// change at runtime: categories, allowed extensions, rate limits, text,
+// maintenance mode and maintainer keys. Everything else keeps its startup value until a restart.
+// An invalid file leaves the running config untouched.
+func (c *Config) Reload(path string) error {
+	next, err := parse(path)
+	if err != nil {
+		return err
+	}
+
+	c.applyRuntime(RuntimeSettings{
+		Categories:  next.Categories,
+		AllowedExts: next.AllowedExts,
+		RateLimit:   next.Security.RateLimit,
+		Text:        next.Text,
+		Maintenance: next.Maintenance,
+	})
+
+	// Co-maintainers can be added or revoked without a restart
+	c.reloadMu.Lock()
+	c.Security.Maintainers = next.Security.Maintainers
+	c.Links = next.Links
+	c.Previews = next.Previews
+	c.reloadMu.Unlock()
+	return nil
+}
+
+// GetCategories returns the current categories; callers must not modify the map
+func (c *Config) GetCategories() map[string]Category {
+	c.reloadMu.RLock()
+	defer c.reloadMu.RUnlock()
+	return c.Categories
+}
+
+// GetAllowedExts returns the current allowed extensions
+func (c *Config) GetAllowedExts() []string {
+	c.reloadMu.RLock()
+	defer c.reloadMu.RUnlock()
+	return c.AllowedExts
+}
+
+// GetRateLimit returns the current rate limit settings
+func (c *Config) GetRateLimit() RateLimitConfig {
+	c.reloadMu.RLock()
+	defer c.reloadMu.RUnlock()
+	return c.Security.RateLimit
+}
+
+// GetText returns the current UI and API text
+func (c *Config) GetText() TextConfig {
+	c.reloadMu.RLock()
+	defer c.reloadMu.RUnlock()
+	return c.Text
+}
+
+// GetPreviews returns the current link preview settings; callers must not
+// modify the map
+func (c *Config) GetPreviews() PreviewConfig {
+	c.reloadMu.RLock()
+	defer c.reloadMu.RUnlock()
+	return c.Previews
+}
+
+// GetMaintenance returns the current maintenance mode settings
+func (c *Config) GetMaintenance() MaintenanceConfig {
+	c.reloadMu.RLock()
+	defer c.reloadMu.RUnlock()
+	return c.Maintenance
+}
+
+// Secrets are the credentials Vault can rotate while running
+type Secrets struct {
+	APIKey            string `json:"api_key"`
+	WebhookSecret     string `json:"webhook_secret"`
+	CDNAPIToken       string `json:"cdn_api_token"`
+	CDNSigningKey     string `json:"cdn_signing_key"`
+	S3AccessKeyID     string `json:"s3_access_key_id"`
+	S3SecretAccessKey string `json:"s3_secret_access_key"`
+}
+
+// GetSecrets returns the current credentials
+func (c *Config) GetSecrets() Secrets {
+	c.reloadMu.RLock()
+	defer c.reloadMu.RUnlock()
+	return Secrets{
+		APIKey:            c.Security.DefaultAPIKey,
+		WebhookSecret:     c.Webhooks.Secret,
+		CDNAPIToken:       c.CDN.APIToken,
+		CDNSigningKey:     c.CDN.SigningKey,
+		S3AccessKeyID:     c.ObjectStore.AccessKeyID,
+		S3SecretAccessKey: c.ObjectStore.SecretAccessKey,
+	}
+}
+
+// SetSecrets replaces credentials; empty fields keep their current value
+func (c *Config) SetSecrets(s Secrets) {
+	c.reloadMu.Lock()
+	defer c.reloadMu.Unlock()
+
+	set := func(dst *string, v string) {
+		if v != "" {
+			*dst = v
+		}
+	}
+	set(&c.Security.DefaultAPIKey, s.APIKey)
+	set(&c.Webhooks.Secret, s.WebhookSecret)
+	set(&c.CDN.APIToken, s.CDNAPIToken)
+	set(&c.CDN.SigningKey, s.CDNSigningKey)
+	set(&c.ObjectStore.AccessKeyID, s.S3AccessKeyID)
+	set(&c.ObjectStore.SecretAccessKey, s.S3SecretAccessKey)
 }
 
-// applyEnvOverrides allows environment variables to override config values
-func (c *Config) applyEnvOverrides() {
+// applyEnvOverrides allows environment variables to override config values.
+// Secrets can also come from a file named by <VAR>_FILE (e.g. Docker secrets)
+// so they stay out of `ps`, unit files and config.json.
+func (c *Config) applyEnvOverrides() error {
 	// Port override
 	if port := os.Getenv("PORT"); port != "" {
 		c.Server.Port = port
@@ -136,10 +445,62 @@ func (c *Config) applyEnvOverrides() {
 		c.Storage.UploadDir = uploadDir
 	}
 
-	// API Key from environment (required for production)
-	if apiKey := os.Getenv(c.Security.APIKeyEnv); apiKey != "" {
-		c.Security.DefaultAPIKey = apiKey
+	// Same variables the vault CLI uses
+	if c.Vault.TokenEnv == "" {
+		c.Vault.TokenEnv = "VAULT_TOKEN"
+	}
+	if addr := os.Getenv("VAULT_ADDR"); addr != "" {
+		c.Vault.Address = addr
+	}
+
+	type secret struct {
+		env    string
+		target *string
+	}
+	secrets := []secret{
+		{c.Security.APIKeyEnv, &c.Security.DefaultAPIKey}, // Required for production
+		{"REDIS_URL", &c.Cluster.RedisURL},                // May carry a password
+		{c.Webhooks.SecretEnv, &c.Webhooks.Secret},
+		{c.CDN.APITokenEnv, &c.CDN.APIToken},
+		{c.CDN.SigningKeyEnv, &c.CDN.SigningKey},
+		{c.ObjectStore.AccessKeyIDEnv, &c.ObjectStore.AccessKeyID},
+		{c.ObjectStore.SecretAccessKeyEnv, &c.ObjectStore.SecretAccessKey},
+		{c.Vault.TokenEnv, &c.Vault.Token},
+	}
+	for i := range c.Security.Maintainers {
+		m := &c.Security.Maintainers[i]
+		secrets = append(secrets, secret{m.KeyEnv, &m.Key})
+	}
+	for _, s := range secrets {
+		if s.env == "" {
+			continue
+		}
+		value, err := lookupSecret(s.env)
+		if err != nil {
+			return err
+		}
+		if value != "" {
+			*s.target = value
+		}
+	}
+	return nil
+}
+
+// lookupSecret reads env, falling back to the contents of the file named by
+// env_FILE. Trailing newlines in the file are ignored.
+func lookupSecret(env string) (string, error) {
+	if value := os.Getenv(env); value != "" {
+		return value, nil
+	}
+	path := os.Getenv(env + "_FILE")
+	if path == "" {
+		return "", nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s_FILE: %w", env, err)
 	}
+	return strings.TrimRight(string(data), "\r\n"), nil
 }
 
 // Validate checks if the configuration is valid
@@ -148,9 +509,16 @@ func (c *Config) Validate() error {
 		return fmt.Errorf("server port is required")
 	}
 
+	if c.Server.DownloadDrainSecs < 0 {
+		return fmt.Errorf("server download_drain_seconds cannot be negative")
+	}
+
 	if c.Storage.UploadDir == "" {
 		return fmt.Errorf("upload directory is required")
 	}
+	if c.Storage.ScrubIntervalHours < 0 {
+		return fmt.Errorf("storage scrub_interval_hours cannot be negative")
+	}
 
 	if len(c.Categories) == 0 {
 		return fmt.Errorf("at least one category must be defined")
@@ -160,6 +528,119 @@ func (c *Config) Validate() error {
 		if cat.MaxFiles < 1 {
 			return fmt.Errorf("category %s must allow at least 1 file", name)
 		}
+		if cat.MaxUploadSizeMB < 0 {
+			return fmt.Errorf("category %s max_upload_size_mb cannot be negative", name)
+		}
+		if _, err := immutablePattern(cat.ImmutablePattern); err != nil {
+			return fmt.Errorf("category %s immutable_pattern: %w", name, err)
+		}
+		if cat.Type != "" && cat.Type != CategoryAPK {
+			return fmt.Errorf("category %s type must be empty or %q", name, CategoryAPK)
+		}
+	}
+
+	if err := validateMaintainers(c.Security.Maintainers); err != nil {
+		return err
+	}
+
+	if err := validateLinks(c.Links); err != nil {
+		return err
+	}
+
+	if err := validateLocales(c.Text); err != nil {
+		return err
+	}
+
+	if c.Security.RateLimit.Enabled && (c.Security.RateLimit.RequestsPerMinute < 1 || c.Security.RateLimit.BurstSize < 1) {
+		return fmt.Errorf("rate limit requires requests_per_minute and burst_size of at least 1")
+	}
+
+	if c.Cluster.Enabled && c.Cluster.RedisURL == "" {
+		return fmt.Errorf("cluster mode requires redis_url")
+	}
+
+	if c.Webhooks.Enabled && c.Webhooks.URL == "" {
+		return fmt.Errorf("webhooks enabled but no url configured")
+	}
+
+	if c.Traffic.MonthlyCapGB > 0 {
+		switch c.Traffic.CapAction {
+		case "throttle":
+			if c.Traffic.ThrottleKBps < 1 {
+				return fmt.Errorf("traffic throttle_kbps must be at least 1")
+			}
+		case "redirect":
+			if c.Traffic.MirrorURL == "" {
+				return fmt.Errorf("traffic cap_action redirect requires mirror_url")
+			}
+		default:
+			return fmt.Errorf("traffic cap_action must be throttle or redirect")
+		}
+	}
+
+	if c.CDN.Enabled {
+		if c.CDN.BaseURL == "" {
+			return fmt.Errorf("cdn enabled but no base_url configured")
+		}
+		switch c.CDN.Provider {
+		case "cloudflare":
+			if c.CDN.ZoneID == "" {
+				return fmt.Errorf("cdn provider cloudflare requires zone_id")
+			}
+		case "fastly":
+		default:
+			return fmt.Errorf("cdn provider must be cloudflare or fastly")
+		}
+		if c.CDN.SignedURLTTLSeconds < 0 {
+			return fmt.Errorf("cdn signed_url_ttl_seconds cannot be negative")
+		}
+	}
+
+	if c.ObjectStore.Enabled {
+		if c.ObjectStore.Endpoint == "" || c.ObjectStore.Bucket == "" || c.ObjectStore.Region == "" {
+			return fmt.Errorf("object_store requires endpoint, region and bucket")
+		}
+		if !c.Vault.Enabled && (c.ObjectStore.AccessKeyID == "" || c.ObjectStore.SecretAccessKey == "") {
+			return fmt.Errorf("object_store requires access_key_id and a secret access key")
+		}
+	}
+
+	if c.Maintenance.RetryAfterSeconds < 0 {
+		return fmt.Errorf("maintenance retry_after_seconds cannot be negative")
+	}
+
+	if c.Quarantine.ScanTimeoutSeconds < 1 {
+		c.Quarantine.ScanTimeoutSeconds = 300
+	}
+	if c.Quarantine.RetentionDays < 0 {
+		return fmt.Errorf("quarantine retention_days cannot be negative")
+	}
+
+	c.Previews.PublicURL = strings.TrimRight(c.Previews.PublicURL, "/")
+	if u := c.Previews.PublicURL; u != "" && !strings.HasPrefix(u, "https://") && !strings.HasPrefix(u, "http://") {
+		return fmt.Errorf("previews public_url must be an http(s) URL")
+	}
+	if c.Previews.Image == "" {
+		c.Previews.Image = "/static/favicon.png"
+	}
+
+	if c.Mirror.Enabled && c.Mirror.UpstreamURL == "" {
+		return fmt.Errorf("mirror mode requires upstream_url")
+	}
+
+	for name := range c.Flags {
+		if !isKnownFlag(name) {
+			return fmt.Errorf("unknown feature flag %q (known: %s)", name, strings.Join(knownFlags, ", "))
+		}
+	}
+
+	if c.Vault.Enabled {
+		if c.Vault.Address == "" || c.Vault.Path == "" {
+			return fmt.Errorf("vault requires address and path")
+		}
+		if c.Vault.KVVersion != 0 && c.Vault.KVVersion != 1 && c.Vault.KVVersion != 2 {
+			return fmt.Errorf("vault kv_version must be 1 or 2")
+		}
 	}
 
 	if c.Concurrency.MaxConcurrentDownloads < 1 {
@@ -170,18 +651,102 @@ func (c *Config) Validate() error {
 		c.Concurrency.MaxConcurrentUploads = 20
 	}
 
+	if c.Concurrency.UploadQueueTimeoutSeconds < 1 {
+		c.Concurrency.UploadQueueTimeoutSeconds = 30
+	}
+
+	if c.Concurrency.MaxSegmentsPerClient < 1 {
+		c.Concurrency.MaxSegmentsPerClient = 16
+	}
+
+	if c.Concurrency.UploadKBpsPerClient < 0 {
+		return fmt.Errorf("concurrency upload_kbps_per_client cannot be negative")
+	}
+	if c.Concurrency.UploadMinKBps < 0 {
+		return fmt.Errorf("concurrency upload_min_kbps cannot be negative")
+	}
+	if c.Concurrency.UploadMinRateMinutes < 1 {
+		c.Concurrency.UploadMinRateMinutes = 2
+	}
+
+	if c.Concurrency.SmallDownloadKB < 1 {
+		c.Concurrency.SmallDownloadKB = 1024
+	}
+	for class, weight := range c.Concurrency.DownloadWeights {
+		if _, ok := defaultDownloadWeights[class]; !ok {
+			return fmt.Errorf("concurrency download_weights: unknown class %q (use small or bulk)", class)
+		}
+		if weight < 1 {
+			return fmt.Errorf("concurrency download_weights %s must be at least 1", class)
+		}
+	}
+	switch c.Server.DownloadDigest {
+	case "":
+		c.Server.DownloadDigest = "header"
+	case "header", "trailer", "off":
+	default:
+		return fmt.Errorf("server download_digest must be header, trailer or off")
+	}
+
+	switch c.Concurrency.UploadThrottleBy {
+	case "":
+		c.Concurrency.UploadThrottleBy = "key"
+	case "key", "ip":
+	default:
+		return fmt.Errorf("concurrency upload_throttle_by must be key or ip")
+	}
+
+	switch c.Privacy.IPMode {
+	case "":
+		c.Privacy.IPMode = "hash"
+	case "hash", "truncate":
+	default:
+		return fmt.Errorf("privacy ip_mode must be hash or truncate")
+	}
+
 	return nil
 }
 
+// FeatureEnabled reports whether an optional subsystem is switched on.
+// Flags are read once at startup; changing them needs a restart.
+func (c *Config) FeatureEnabled(flag string) bool {
+	enabled, set := c.Flags[flag]
+	return !set || enabled
+}
+
+// isKnownFlag checks a flag name against the known subsystems
+func isKnownFlag(name string) bool {
+	for _, known := range knownFlags {
+		if known == name {
+			return true
+		}
+	}
+	return false
+}
+
 // GetMaxUploadSize returns max upload size in bytes
 func (c *Config) GetMaxUploadSize() int64 {
 	return int64(c.Storage.MaxUploadSizeGB) * 1024 * 1024 * 1024
 }
 
+// MaxUploadSizeFor returns the upload size limit of a category in bytes,
+// falling back to the global limit
+func (c *Config) MaxUploadSizeFor(category string) int64 {
+	if cat, ok := c.GetCategories()[category]; ok && cat.MaxUploadSizeMB > 0 {
+		return int64(cat.MaxUploadSizeMB) * 1024 * 1024
+	}
+	return c.GetMaxUploadSize()
+}
+
+// GetMonthlyCap returns the monthly transfer cap in bytes (0 = unlimited)
+func (c *Config) GetMonthlyCap() int64 {
+	return int64(c.Traffic.MonthlyCapGB) * 1024 * 1024 * 1024
+}
+
 // GetEnabledCategories returns list of enabled category names
 func (c *Config) GetEnabledCategories() []string {
 	var cats []string
-	for name, cat := range c.Categories {
+	for name, cat := range c.GetCategories() {
 		if cat.Enabled {
 			cats = append(cats, name)
 		}
@@ -191,13 +756,100 @@ func (c *Config) GetEnabledCategories() []string {
 
 // IsValidCategory checks if a category name is valid and enabled
 func (c *Config) IsValidCategory(name string) bool {
-	cat, exists := c.Categories[name]
+	cat, exists := c.GetCategories()[name]
 	return exists && cat.Enabled
 }
 
 // IsAllowedExtension checks if file extension is allowed
 func (c *Config) IsAllowedExtension(ext string) bool {
-	for _, allowed := range c.AllowedExts {
+	for _, allowed := range c.GetAllowedExts() {
+		if allowed == ext {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowedExtsFor returns the extensions a category accepts, falling back to
+// the global list (just .apk for APK categories)
+func (c *Config) AllowedExtsFor(category string) []string {
+	cat, ok := c.GetCategories()[category]
+	if ok && len(cat.AllowedExts) > 0 {
+		return cat.AllowedExts
+	}
+	if ok && cat.Type == CategoryAPK {
+		return []string{".apk"}
+	}
+	return c.GetAllowedExts()
+}
+
+// DownloadClass returns the priority class of a download of size bytes
+func (c *Config) DownloadClass(size int64) string {
+	if size <= int64(c.Concurrency.SmallDownloadKB)*1024 {
+		return DownloadSmall
+	}
+	return DownloadBulk
+}
+
+// DownloadSlots returns a priority class's share of max_concurrent_downloads,
+// split by download_weights; every class gets at least one slot
+func (c *Config) DownloadSlots(class string) int {
+	weight := func(class string) int {
+		if w, ok := c.Concurrency.DownloadWeights[class]; ok {
+			return w
+		}
+		return defaultDownloadWeights[class]
+	}
+	total := 0
+	for _, cl := range DownloadClasses {
+		total += weight(cl)
+	}
+	return max(1, c.Concurrency.MaxConcurrentDownloads*weight(class)/total)
+}
+
+// IsAPKCategory reports whether a category hosts Android apps
+func (c *Config) IsAPKCategory(category string) bool {
+	return c.GetCategories()[category].Type == CategoryAPK
+}
+
+// IsImmutable reports whether filename matches its category's
+// immutable_pattern, i.e. names one build that never changes
+func (c *Config) IsImmutable(category, filename string) bool {
+	cat, ok := c.GetCategories()[category]
+	if !ok || cat.ImmutablePattern == "" {
+		return false
+	}
+	re, err := immutablePattern(cat.ImmutablePattern)
+	return err == nil && re.MatchString(filename)
+}
+
+// IsRestricted reports whether a category is kept to beta testers
+func (c *Config) IsRestricted(category string) bool {
+	return c.GetCategories()[category].Restricted
+}
+
+// compiledPatterns caches immutable_pattern regexps across reloads
+var compiledPatterns sync.Map
+
+// immutablePattern compiles an immutable_pattern once; "" matches nothing
+func immutablePattern(pattern string) (*regexp.Regexp, error) {
+	if pattern == "" {
+		return nil, nil
+	}
+	if re, ok := compiledPatterns.Load(pattern); ok {
+		return re.(*regexp.Regexp), nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	compiledPatterns.Store(pattern, re)
+	return re, nil
+}
+
+// IsAllowedExtensionFor checks if a file extension is allowed in a category
+func (c *Config) IsAllowedExtensionFor(category, ext string) bool {
+	for _, allowed := range c.AllowedExtsFor(category) {
 		if allowed == ext {
 			return true
 		}
@@ -0,0 +1,61 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"unicode/utf8"
+)
+
+// LinkTypes are the kinds of link the download page knows how to show
+var LinkTypes = []string{"donate", "sponsor", "forum", "source", "chat", "website", "other"}
+
+// Bounds on the links section
+const (
+	maxLinks     = 20
+	maxLinkLabel = 50
+)
+
+// Link is a maintainer support or project link shown on the download page
+// and returned by /api/config, e.g. a PayPal page or the XDA thread
+type Link struct {
+	Label string `json:"label"`          // e.g. "PayPal"
+	URL   string `json:"url"`            // http(s) or mailto
+	Type  string `json:"type,omitempty"` // One of LinkTypes; "" = other
+}
+
+// validateLinks checks the links section and fills in default types
+func validateLinks(links []Link) error {
+	if len(links) > maxLinks {
+		return fmt.Errorf("at most %d links can be configured", maxLinks)
+	}
+	for i := range links {
+		l := &links[i]
+		l.Label, l.URL = strings.TrimSpace(l.Label), strings.TrimSpace(l.URL)
+		if l.Label == "" || utf8.RuneCountInString(l.Label) > maxLinkLabel {
+			return fmt.Errorf("link %d needs a label of at most %d characters", i+1, maxLinkLabel)
+		}
+		u, err := url.Parse(l.URL)
+		if err != nil || !(((u.Scheme == "http" || u.Scheme == "https") && u.Host != "") || (u.Scheme == "mailto" && u.Opaque != "")) {
+			return fmt.Errorf("link %q needs an http(s) or mailto url", l.Label)
+		}
+		if l.Type == "" {
+			l.Type = "other"
+		}
+		known := false
+		for _, t := range LinkTypes {
+			known = known || l.Type == t
+		}
+		if !known {
+			return fmt.Errorf("link %q type must be one of %s", l.Label, strings.Join(LinkTypes, ", "))
+		}
+	}
+	return nil
+}
+
+// GetLinks returns the current links; callers must not modify the slice
+func (c *Config) GetLinks() []Link {
+	c.reloadMu.RLock()
+	defer c.reloadMu.RUnlock()
+	return c.Links
+}
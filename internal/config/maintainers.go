@@ -0,0 +1,87 @@
+package config
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"regexp"
+)
+
+// AdminName identifies requests made with the main API key
+const AdminName = "admin"
+
+// Maintainer is a co-maintainer with their own API key, so uploads and audit
+// entries can be attributed to them
+type Maintainer struct {
+	Name       string `json:"name"`
+	KeyEnv     string `json:"key_env"`               // Env var (or <VAR>_FILE) holding the key
+	Key        string `json:"key,omitempty"`         // Fallback when the env var is unset
+	UploadKBps int    `json:"upload_kbps,omitempty"` // Own upload bandwidth (0 = upload_kbps_per_client)
+}
+
+// maintainerName matches names that are safe in URLs and log lines
+var maintainerName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,63}$`)
+
+// ValidMaintainerName reports whether name can identify a key holder
+func ValidMaintainerName(name string) bool {
+	return maintainerName.MatchString(name) && name != AdminName
+}
+
+// validateMaintainers checks names are unique and every key is set
+func validateMaintainers(maintainers []Maintainer) error {
+	names := make(map[string]bool, len(maintainers))
+	keys := make(map[string]string, len(maintainers))
+	for _, m := range maintainers {
+		if !maintainerName.MatchString(m.Name) {
+			return fmt.Errorf("maintainer name %q must be letters, digits, '.', '_' or '-'", m.Name)
+		}
+		if m.Name == AdminName || names[m.Name] {
+			return fmt.Errorf("maintainer name %q is reserved or used twice", m.Name)
+		}
+		names[m.Name] = true
+		if m.UploadKBps < 0 {
+			return fmt.Errorf("maintainer %s upload_kbps cannot be negative", m.Name)
+		}
+		if m.Key == "" {
+			return fmt.Errorf("maintainer %s has no key (set %s or %s_FILE)", m.Name, m.KeyEnv, m.KeyEnv)
+		}
+		if other, ok := keys[m.Key]; ok {
+			return fmt.Errorf("maintainers %s and %s share a key", other, m.Name)
+		}
+		keys[m.Key] = m.Name
+	}
+	return nil
+}
+
+// GetMaintainers returns the current co-maintainers; callers must not modify the slice
+func (c *Config) GetMaintainers() []Maintainer {
+	c.reloadMu.RLock()
+	defer c.reloadMu.RUnlock()
+	return c.Security.Maintainers
+}
+
+// UploadKBpsFor returns the upload bandwidth of a key holder in KB/s,
+// their own if set, else the per-client default; 0 means unlimited
+func (c *Config) UploadKBpsFor(name string) int {
+	for _, m := range c.GetMaintainers() {
+		if m.Name == name && m.UploadKBps > 0 {
+			return m.UploadKBps
+		}
+	}
+	return c.Concurrency.UploadKBpsPerClient
+}
+
+// Authenticate returns who owns key: AdminName for the main API key, a
+// maintainer's name for theirs. Every key is compared in constant time.
+func (c *Config) Authenticate(key string) (string, bool) {
+	// Read per request so keys rotated through Vault or reloaded apply immediately
+	name, ok := "", false
+	if subtle.ConstantTimeCompare([]byte(key), []byte(c.GetSecrets().APIKey)) == 1 {
+		name, ok = AdminName, true
+	}
+	for _, m := range c.GetMaintainers() {
+		if subtle.ConstantTimeCompare([]byte(key), []byte(m.Key)) == 1 && !ok {
+			name, ok = m.Name, true
+		}
+	}
+	return name, ok
+}
@@ -0,0 +1,354 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+)
+
+// RuntimeSettings are the parts of the config that can change while running
+type RuntimeSettings struct {
+	Categories  map[string]Category `json:"categories"`
+	AllowedExts []string            `json:"allowed_extensions"`
+	RateLimit   RateLimitConfig     `json:"rate_limit"`
+	Text        TextConfig          `json:"text"`
+	Maintenance MaintenanceConfig   `json:"maintenance"`
+}
+
+// runtimePatch is a partial update; omitted sections stay unchanged and a
+// category set to null is removed
+type runtimePatch struct {
+	Categories  map[string]json.RawMessage `json:"categories"`
+	AllowedExts []string                   `json:"allowed_extensions"`
+	RateLimit   json.RawMessage            `json:"rate_limit"`
+	Text        json.RawMessage            `json:"text"`
+	Maintenance json.RawMessage            `json:"maintenance"`
+}
+
+// Runtime returns a copy of the current runtime settings
+func (c *Config) Runtime() RuntimeSettings {
+	c.reloadMu.RLock()
+	defer c.reloadMu.RUnlock()
+
+	cats := make(map[string]Category, len(c.Categories))
+	for name, cat := range c.Categories {
+		cats[name] = cat
+	}
+	return RuntimeSettings{
+		Categories:  cats,
+		AllowedExts: append([]string(nil), c.AllowedExts...),
+		RateLimit:   c.Security.RateLimit,
+		Text:        c.Text,
+		Maintenance: c.Maintenance,
+	}
+}
+
+// PatchRuntime merges a JSON patch into the runtime settings, validates the
+// result with Validate, applies it and persists it to the config file so it
+// survives restarts and reloads
+func (c *Config) PatchRuntime(patch []byte) (RuntimeSettings, error) {
+	var p runtimePatch
+	if err := decodeStrict(patch, &p); err != nil {
+		return RuntimeSettings{}, fmt.Errorf("invalid patch: %w", err)
+	}
+
+	c.patchMu.Lock()
+	defer c.patchMu.Unlock()
+
+	next := c.Runtime()
+	var changed [][]string // Sections to write back, as key paths
+	if p.Categories != nil {
+		changed = append(changed, []string{"categories"})
+	}
+	for name, raw := range p.Categories {
+		if bytes.Equal(bytes.TrimSpace(raw), []byte("null")) {
+			delete(next.Categories, name)
+			continue
+		}
+		cat := next.Categories[name]
+		if err := decodeStrict(raw, &cat); err != nil {
+			return RuntimeSettings{}, fmt.Errorf("invalid category %s: %w", name, err)
+		}
+		next.Categories[name] = cat
+	}
+	if p.AllowedExts != nil {
+		next.AllowedExts = p.AllowedExts
+		changed = append(changed, []string{"allowed_extensions"})
+	}
+	if p.RateLimit != nil {
+		if err := decodeStrict(p.RateLimit, &next.RateLimit); err != nil {
+			return RuntimeSettings{}, fmt.Errorf("invalid rate_limit: %w", err)
+		}
+		changed = append(changed, []string{"security", "rate_limit"})
+	}
+	if p.Text != nil {
+		if err := next.Text.decode(p.Text, true); err != nil {
+			return RuntimeSettings{}, fmt.Errorf("invalid text: %w", err)
+		}
+		changed = append(changed, []string{"text"})
+	}
+	if p.Maintenance != nil {
+		if err := decodeStrict(p.Maintenance, &next.Maintenance); err != nil {
+			return RuntimeSettings{}, fmt.Errorf("invalid maintenance: %w", err)
+		}
+		changed = append(changed, []string{"maintenance"})
+	}
+
+	if err := c.validateWith(next); err != nil {
+		return RuntimeSettings{}, err
+	}
+	if err := c.persistRuntime(next, changed); err != nil {
+		return RuntimeSettings{}, err
+	}
+	c.applyRuntime(next)
+	return next, nil
+}
+
+// validateWith runs Validate on a copy of the config carrying next
+func (c *Config) validateWith(next RuntimeSettings) error {
+	c.reloadMu.RLock()
+	data, err := json.Marshal(c)
+	c.reloadMu.RUnlock()
+	if err != nil {
+		return err
+	}
+
+	var candidate Config
+	if err := json.Unmarshal(data, &candidate); err != nil {
+		return err
+	}
+	candidate.Categories = next.Categories
+	candidate.AllowedExts = next.AllowedExts
+	candidate.Security.RateLimit = next.RateLimit
+	candidate.Text = next.Text
+	candidate.Maintenance = next.Maintenance
+	return candidate.Validate()
+}
+
+// applyRuntime swaps in new runtime settings
+func (c *Config) applyRuntime(next RuntimeSettings) {
+	c.reloadMu.Lock()
+	defer c.reloadMu.Unlock()
+
+	c.Categories = next.Categories
+	c.AllowedExts = next.AllowedExts
+	c.Security.RateLimit = next.RateLimit
+	c.Text = next.Text
+	c.Maintenance = next.Maintenance
+}
+
+// persistRuntime writes the sections a patch changed back into the config
+// file. Only their values are replaced, so every other key keeps its place,
+// layout and comments, and env-provided secrets stay out of the file.
+func (c *Config) persistRuntime(next RuntimeSettings, changed [][]string) error {
+	if c.path == "" || len(changed) == 0 {
+		return nil
+	}
+
+	data, err := os.ReadFile(c.path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+	values := map[string]interface{}{
+		"categories":         next.Categories,
+		"allowed_extensions": next.AllowedExts,
+		"rate_limit":         next.RateLimit,
+		"text":               next.Text,
+		"maintenance":        next.Maintenance,
+	}
+	for _, path := range changed {
+		if data, err = setJSONValue(data, values[path[len(path)-1]], path...); err != nil {
+			return fmt.Errorf("failed to update config file: %w", err)
+		}
+	}
+
+	tmpPath := c.path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write config file: %w", err)
+	}
+	return os.Rename(tmpPath, c.path)
+}
+
+// setJSONValue returns data, a JSON object that may carry // comments, with
+// the value at path replaced by v. Objects are updated member by member, so
+// only what differs is rewritten; a missing key is added as the last member
+// of its object. The rest of data is kept byte for byte, and new values are
+// indented to line up with their key.
+func setJSONValue(data []byte, v interface{}, path ...string) ([]byte, error) {
+	return setMember(data, 0, len(data), v, path)
+}
+
+// setMember sets path in the object spanning data[from:to]
+func setMember(data []byte, from, to int, v interface{}, path []string) ([]byte, error) {
+	members, open, closing, err := objectMembers(stripComments(data[from:to]))
+	if err != nil {
+		return nil, err
+	}
+
+	if found := memberIndex(members, path[0]); found >= 0 {
+		start, end := from+members[found].start, from+members[found].end
+		if len(path) > 1 {
+			return setMember(data, start, end, v, path[1:])
+		}
+		return replaceValue(data, start, end, v)
+	}
+
+	// Missing: nest the rest of the path and append it to this object
+	for i := len(path) - 1; i > 0; i-- {
+		v = map[string]interface{}{path[i]: v}
+	}
+	var at int
+	var indent, before, after string
+	if len(members) > 0 {
+		at = from + members[len(members)-1].end
+		indent = lineIndent(data, at)
+		before = ",\n" + indent
+	} else {
+		at = from + open + 1
+		indent = lineIndent(data, from+open) + "  "
+		before = "\n" + indent
+		if !bytes.ContainsRune(data[from+open:from+closing], '\n') {
+			after = "\n" + lineIndent(data, from+open)
+		}
+	}
+	key, err := json.Marshal(path[0])
+	if err != nil {
+		return nil, err
+	}
+	value, err := json.MarshalIndent(v, indent, "  ")
+	if err != nil {
+		return nil, err
+	}
+	member := before + string(key) + ": " + string(value) + after
+	return splice(data, at, at, []byte(member)), nil
+}
+
+// replaceValue replaces the value spanning data[start:end] with v. When both
+// are objects and v keeps every key, only the members that differ change.
+func replaceValue(data []byte, start, end int, v interface{}) ([]byte, error) {
+	value, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	old, _, _, oldErr := objectMembers(stripComments(data[start:end]))
+	members, _, _, newErr := objectMembers(value)
+	if oldErr != nil || newErr != nil || !coversKeys(members, old) {
+		indented, err := json.MarshalIndent(v, lineIndent(data, start), "  ")
+		if err != nil {
+			return nil, err
+		}
+		return splice(data, start, end, indented), nil
+	}
+
+	for _, m := range members {
+		raw := json.RawMessage(value[m.start:m.end])
+		if i := memberIndex(old, m.key); i >= 0 && sameJSON(stripComments(data[start+old[i].start:start+old[i].end]), raw) {
+			continue
+		}
+		size := len(data)
+		if data, err = setMember(data, start, end, raw, []string{m.key}); err != nil {
+			return nil, err
+		}
+		end += len(data) - size
+		if old, _, _, err = objectMembers(stripComments(data[start:end])); err != nil {
+			return nil, err
+		}
+	}
+	return data, nil
+}
+
+// coversKeys reports whether members has every key in old
+func coversKeys(members, old []jsonMember) bool {
+	for _, m := range old {
+		if memberIndex(members, m.key) < 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// memberIndex returns the index of the member named key, or -1; with
+// duplicates the last one wins, as when parsing
+func memberIndex(members []jsonMember, key string) int {
+	found := -1
+	for i, m := range members {
+		if m.key == key {
+			found = i
+		}
+	}
+	return found
+}
+
+// sameJSON reports whether two JSON values are equal, ignoring layout
+func sameJSON(a, b []byte) bool {
+	var x, y interface{}
+	if json.Unmarshal(a, &x) != nil || json.Unmarshal(b, &y) != nil {
+		return false
+	}
+	return reflect.DeepEqual(x, y)
+}
+
+// jsonMember is where a member's value sits in an object's text
+type jsonMember struct {
+	key        string
+	start, end int
+}
+
+// objectMembers lists the members of the JSON object in data, with the
+// offsets of its opening and closing braces
+func objectMembers(data []byte) (members []jsonMember, open, closing int, err error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	if d, ok := tok.(json.Delim); !ok || d != '{' {
+		return nil, 0, 0, errors.New("not a JSON object")
+	}
+	open = int(dec.InputOffset()) - 1
+
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, 0, 0, err
+		}
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err != nil {
+			return nil, 0, 0, err
+		}
+		end := int(dec.InputOffset())
+		members = append(members, jsonMember{key: tok.(string), start: end - len(raw), end: end})
+	}
+	if _, err := dec.Token(); err != nil {
+		return nil, 0, 0, err
+	}
+	return members, open, int(dec.InputOffset()) - 1, nil
+}
+
+// lineIndent returns the leading whitespace of the line holding data[i]
+func lineIndent(data []byte, i int) string {
+	start := bytes.LastIndexByte(data[:i], '\n') + 1
+	end := start
+	for end < len(data) && (data[end] == ' ' || data[end] == '\t') {
+		end++
+	}
+	return string(data[start:end])
+}
+
+// splice returns data with data[start:end] replaced by insert
+func splice(data []byte, start, end int, insert []byte) []byte {
+	out := make([]byte, 0, len(data)-(end-start)+len(insert))
+	out = append(out, data[:start]...)
+	out = append(out, insert...)
+	return append(out, data[end:]...)
+}
+
+// decodeStrict unmarshals JSON, rejecting unknown fields so typos surface
+func decodeStrict(data []byte, v interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	return dec.Decode(v)
+}
@@ -0,0 +1,77 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSetJSONValue(t *testing.T) {
+	const doc = `{
+  // Top comment
+  "a": 1,
+  "nested": {
+    "keep": "x",   // Stays
+    "b": {"old": true}
+  },
+  "empty": {}
+}
+`
+	tests := []struct {
+		name string
+		path []string
+		v    interface{}
+		want string
+	}{
+		{"replace top level", []string{"a"}, 2, strings.Replace(doc, `"a": 1`, `"a": 2`, 1)},
+		{"merge object", []string{"nested"}, map[string]interface{}{"keep": "x", "b": map[string]bool{"old": false}, "c": 3}, strings.Replace(doc, `"b": {"old": true}`, "\"b\": {\"old\": false},\n    \"c\": 3", 1)},
+		{"replace nested", []string{"nested", "b"}, map[string]int{"n": 1}, strings.Replace(doc, `"b": {"old": true}`, "\"b\": {\n      \"n\": 1\n    }", 1)},
+		{"append to object", []string{"nested", "c"}, 3, strings.Replace(doc, `"b": {"old": true}`, "\"b\": {\"old\": true},\n    \"c\": 3", 1)},
+		{"fill empty object", []string{"empty", "d"}, "y", strings.Replace(doc, `"empty": {}`, "\"empty\": {\n    \"d\": \"y\"\n  }", 1)},
+		{"add missing section", []string{"new", "e"}, 4, strings.Replace(doc, "\"empty\": {}", "\"empty\": {},\n  \"new\": {\n    \"e\": 4\n  }", 1)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := setJSONValue([]byte(doc), tt.v, tt.path...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("got\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPatchRuntimeKeepsFileLayout(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	original := DefaultTemplate("test-key")
+	if err := os.WriteFile(path, []byte(original), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := cfg.PatchRuntime([]byte(`{"rate_limit": {"requests_per_minute": 7}}`)); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := strings.Replace(original, `"requests_per_minute": 60,`, `"requests_per_minute": 7,`, 1)
+	if string(data) != want {
+		t.Errorf("config file is\n%s\nwant only requests_per_minute changed", data)
+	}
+
+	reloaded, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := reloaded.Security.RateLimit.RequestsPerMinute; got != 7 {
+		t.Errorf("requests_per_minute = %d after reload, want 7", got)
+	}
+}
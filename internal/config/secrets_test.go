@@ -0,0 +1,38 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestObjectStoreCredentialsFromFiles(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{"id": "AKIAEXAMPLE\n", "secret": "s3cr3t\n"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("TEST_S3_ACCESS_KEY_ID_FILE", filepath.Join(dir, "id"))
+	t.Setenv("TEST_S3_SECRET_ACCESS_KEY_FILE", filepath.Join(dir, "secret"))
+
+	c := &Config{ObjectStore: ObjectStoreConfig{
+		AccessKeyID:        "from-config",
+		AccessKeyIDEnv:     "TEST_S3_ACCESS_KEY_ID",
+		SecretAccessKeyEnv: "TEST_S3_SECRET_ACCESS_KEY",
+	}}
+	if err := c.applyEnvOverrides(); err != nil {
+		t.Fatal(err)
+	}
+	if c.ObjectStore.AccessKeyID != "AKIAEXAMPLE" || c.ObjectStore.SecretAccessKey != "s3cr3t" {
+		t.Errorf("credentials = %q/%q, want AKIAEXAMPLE/s3cr3t", c.ObjectStore.AccessKeyID, c.ObjectStore.SecretAccessKey)
+	}
+
+	t.Setenv("TEST_S3_ACCESS_KEY_ID", "from-env")
+	if err := c.applyEnvOverrides(); err != nil {
+		t.Fatal(err)
+	}
+	if c.ObjectStore.AccessKeyID != "from-env" {
+		t.Errorf("access key = %q, want the variable to win over its file", c.ObjectStore.AccessKeyID)
+	}
+}
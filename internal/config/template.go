@@ -0,0 +1,379 @@
+package config
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// defaultTemplate is the commented starter config written by `config init`.
+// Keep it in sync with the Config struct when adding settings.
+const defaultTemplate = `// photon-serve configuration.
+// Comments (// to end of line) are allowed; everything else is plain JSON.
+// Check it with: rom-server config validate <path>
+{
+  "$schema": "./config.schema.json",     // Lets editors lint and autocomplete
+
+  // HTTP listener and timeouts. Long read/write timeouts let multi-GB
+  // uploads and downloads finish on slow connections.
+  "server": {
+    "port": "8080",                    // PORT env overrides
+    "read_timeout_minutes": 60,
+    "write_timeout_minutes": 60,
+    "idle_timeout_seconds": 120,
+    "shutdown_timeout_seconds": 30,    // Grace period for in-flight transfers
+    "download_drain_seconds": 600,     // Downloads may keep going this long on shutdown (0 = no extra time)
+    "response_cache_ttl_seconds": 5,   // Micro-cache for /list, /api/config and badges (0 = off)
+    "static_dir": "",                  // Files here replace the built-in web UI ("" = built-in only)
+    "download_digest": "header"        // Checksums in Digest/Repr-Digest headers; "trailer" also for streamed bodies, "off"
+  },
+
+  // Where builds are stored. temp_dir is relative to upload_dir and must be
+  // on the same filesystem so publishing is an atomic rename.
+  "storage": {
+    "upload_dir": "uploads",           // UPLOAD_DIR env overrides
+    "temp_dir": "temp",
+    "max_upload_size_gb": 5,
+    "dir_permissions": "0755",
+    "scrub_interval_hours": 0          // Re-verify stored builds this often (0 = off)
+  },
+
+  // One entry per download section. The key is used in URLs
+  // (/downloads/<key>/...). The oldest build is removed once max_files is hit.
+  // A category can override the global limits with "max_upload_size_mb" and
+  // "allowed_extensions", e.g. 200 and [".img"] for recovery images.
+  // "immutable_pattern" (e.g. "-[0-9]{8}-") marks names that embed a version;
+  // those downloads are cached for a year instead of an hour.
+  // "restricted": true hides a category from everyone but API keys and the
+  // beta testers added through /api/admin/testers.
+  // "type": "apk" hosts companion apps: uploads must be APKs (.apk unless
+  // "allowed_extensions" says otherwise) and their package details are kept.
+  "categories": {
+{{CATEGORIES}}
+  },
+
+  "security": {
+    "api_key_env": "API_KEY",          // Env var holding the admin API key (preferred)
+    "default_api_key": "{{API_KEY}}",  // Fallback when the env var is unset
+    "rate_limit": {
+      "enabled": true,
+      "requests_per_minute": 60,       // Per client IP
+      "burst_size": 10,
+      "shards": 32
+    },
+    // Co-maintainers get their own keys; uploads show who sent them
+    "maintainers": [
+      // {"name": "alice", "key_env": "API_KEY_ALICE"}
+      // {"name": "ci", "key_env": "API_KEY_CI", "upload_kbps": 20480}
+    ]
+  },
+
+  "concurrency": {
+    "max_concurrent_downloads": 100,
+    "max_concurrent_uploads": 20,
+    "download_buffer_size_kb": 64,
+    "worker_pool_size": 50,
+    "stat_cache_size": 256,             // Hot files whose stat results are cached
+    "upload_queue_timeout_seconds": 30, // Wait for a free upload slot before answering 503
+    "max_segments_per_client": 16,      // Parallel download connections per IP (aria2c -x)
+    // Upload bandwidth per client in KB/s, shared by its parallel uploads,
+    // so a CI runner can't starve downloads on a small uplink (0 = unlimited).
+    // "key" budgets per API key holder, "ip" per address.
+    "upload_kbps_per_client": 0,
+    "upload_throttle_by": "key",
+    // Cut off uploads that send less than upload_min_kbps over
+    // upload_min_rate_minutes, so stalled clients free their upload slot
+    // instead of holding it until the read timeout (0 = off).
+    "upload_min_kbps": 0,
+    "upload_min_rate_minutes": 2,
+    // Downloads up to small_download_kb (checksum files, changelogs, OTA
+    // manifests) get their own share of max_concurrent_downloads, so they
+    // never wait behind builds. Shares are split by weight.
+    "small_download_kb": 1024,
+    "download_weights": {"small": 1, "bulk": 4}
+  },
+
+  // Strings shown on the download page and returned by the API, in the
+  // language named by "locale" (default en). Add translations as nested
+  // blocks that override some strings, e.g.
+  //   "de": {"app_subtitle": "Offizielle Builds"}
+  // /api/config picks one by ?lang= or Accept-Language.
+  "text": {
+    "app_name": "My ROM",
+    "app_title": "My ROM — Downloads",
+    "app_subtitle": "Official builds",
+    "device_name": "My Device",
+    "admin_title": "ROM Manager // Admin",
+    "upload_success": "Upload successful",
+    "upload_failed": "Upload failed",
+    "file_too_large": "File too large",
+    "invalid_file": "Invalid file format",
+    "unauthorized": "Unauthorized access",
+    "no_files_found": "No builds found",
+    "copy_success": "Copied link to clipboard",
+    "copy_failed": "Copy failed",
+    "server_error": "Internal Server Error"
+  },
+
+  "allowed_extensions": [".zip"],
+
+  "logging": {
+    "level": "info",
+    "format": "[ROM-SERVER] ",         // Log line prefix
+    "enable_request_logging": true
+  },
+
+  // Keep client addresses out of logs, the audit log, feedback and the
+  // shared rate limiter. "hash" replaces them with a salted hash (the salt
+  // changes every day), "truncate" zeroes the host part (/24 or /48).
+  "privacy": {
+    "anonymize_ips": false,
+    "ip_mode": "hash"
+  },
+
+  // Per-client download breakdown. Bots are left out of public counts
+  // when exclude_bots is set.
+  "analytics": {
+    "exclude_bots": true,
+    "updater_agents": ["Updater", "OTA"],  // User-Agent substrings of OTA updater apps
+    "bot_agents": []                       // Extra bot substrings on top of the built-in list
+  },
+
+  // Signed JSON POSTs on upload, delete and download milestones
+  "webhooks": {
+    "enabled": false,
+    "url": "",
+    "secret_env": "WEBHOOK_SECRET",
+    "timeout_seconds": 10,
+    "milestones": [1000, 10000, 100000],
+    "notify_reports": false            // Also post builds users report as broken
+  },
+
+  // Monthly transfer cap; once spent, downloads are throttled or redirected
+  "traffic": {
+    "monthly_cap_gb": 0,               // 0 = unlimited
+    "cap_action": "throttle",          // "throttle" or "redirect"
+    "throttle_kbps": 512,
+    "mirror_url": ""
+  },
+
+  // Share counters and metadata between instances through Redis
+  "cluster": {
+    "enabled": false,
+    "redis_url": "redis://127.0.0.1:6379/0",  // REDIS_URL env overrides
+    "key_prefix": "photon:",
+    "sync_interval_seconds": 5,
+    "instance_id": "",                 // Defaults to hostname:pid
+    "leader_ttl_seconds": 15
+  },
+
+  // Front /downloads/ with Cloudflare or Fastly
+  "cdn": {
+    "enabled": false,
+    "provider": "cloudflare",          // "cloudflare" or "fastly"
+    "base_url": "https://cdn.example.com/downloads",
+    "zone_id": "",                     // Cloudflare only
+    "service_id": "",
+    "api_token_env": "CDN_API_TOKEN",
+    "edge_max_age_seconds": 86400,
+    "signing_key_env": "CDN_SIGNING_KEY",
+    "signed_url_ttl_seconds": 3600
+  },
+
+  // S3-compatible bucket for direct uploads that bypass this server
+  "object_store": {
+    "enabled": false,
+    "endpoint": "https://s3.us-east-1.amazonaws.com",
+    "region": "us-east-1",
+    "bucket": "",
+    "path_style": false,               // true for MinIO and most self-hosted backends
+    "access_key_id": "",
+    "access_key_id_env": "S3_ACCESS_KEY_ID",
+    "secret_access_key_env": "S3_SECRET_ACCESS_KEY",
+    "presign_ttl_seconds": 3600
+  },
+
+  // Run as a read-only mirror of another instance
+  "mirror": {
+    "enabled": false,
+    "upstream_url": "",
+    "sync_interval_minutes": 15
+  },
+
+  // Answer uploads and downloads with 503 (health and admin routes stay up).
+  // Reloadable, and switchable via PATCH /api/admin/config.
+  "maintenance": {
+    "enabled": false,
+    "message": "Down for maintenance, back soon",
+    "retry_after_seconds": 600
+  },
+
+  // Screen uploads before they go live; failures are kept for review in
+  // .quarantine/ and handled via /api/admin/quarantine. scan_command gets
+  // the file's path appended and exits 1 on infected files, e.g.
+  // ["clamdscan", "--fdpass", "--no-summary"].
+  "quarantine": {
+    "blocklist_file": "",
+    "scan_command": [],
+    "scan_timeout_seconds": 300,
+    "retention_days": 0
+  },
+
+  // Link previews of the /builds/{category}/{filename} landing pages. The
+  // device of a build is its "device" attribute or a codename in its file
+  // name; images may be URLs or paths such as /static/beryllium.png.
+  "previews": {
+    "public_url": "",
+    "image": "/static/favicon.png",
+    "device_images": {}
+  },
+
+  // Read-only rsync daemon module for traditional mirrors
+  "rsync": {
+    "enabled": false,
+    "module": "photon",
+    "conf_path": "rsyncd.conf",
+    "run_daemon": false,
+    "port": 873,
+    "hosts_allow": [],
+    "max_connections": 10
+  },
+
+  // Fetch secrets from HashiCorp Vault instead of env vars. The secret may
+  // hold api_key, webhook_secret, cdn_api_token, cdn_signing_key,
+  // s3_access_key_id and s3_secret_access_key.
+  "vault": {
+    "enabled": false,
+    "address": "https://vault.example.com:8200",  // VAULT_ADDR env overrides
+    "token_env": "VAULT_TOKEN",        // Or VAULT_TOKEN_FILE
+    "mount": "secret",
+    "path": "photon-serve",
+    "kv_version": 2,
+    "refresh_interval_minutes": 15     // Token renewal and secret re-read
+  },
+
+  // Support and project links for the download page and /api/config.
+  // type: donate, sponsor, forum, source, chat, website or other. Donate
+  // and sponsor links go in the Donate dialog. Reloaded on SIGHUP.
+  // Empty keeps the built-in footer, e.g.
+  //   {"label": "PayPal", "url": "https://paypal.me/you", "type": "donate"},
+  //   {"label": "XDA thread", "url": "https://xdaforums.com/t/...", "type": "forum"}
+  "links": [],
+
+  // Optional subsystems, read at startup. Omitted flags default to on;
+  // set one to false to skip that subsystem entirely.
+  "flags": {
+    "webhooks": true,
+    "metrics": true,
+    "audit_log": true,
+    "badges": true,
+    "stats_export": true,
+    "speedtest": true,
+    "reports": true,
+    "feedback": true,
+    "ratings": true,
+    "webdav": true
+  }
+}
+`
+
+// TemplateOptions are the choices the setup wizard fills into the template;
+// zero values keep the template's defaults
+type TemplateOptions struct {
+	APIKey     string
+	Port       string
+	UploadDir  string
+	Categories []TemplateCategory
+}
+
+// TemplateCategory is a category created by the setup wizard
+type TemplateCategory struct {
+	Name        string
+	DisplayName string
+	Description string
+	MaxFiles    int
+}
+
+// defaultTemplateCategories is the template's single starter category
+var defaultTemplateCategories = []TemplateCategory{
+	{Name: "stable", DisplayName: "Stable", Description: "Recommended builds", MaxFiles: 3},
+}
+
+// DefaultTemplate returns the commented starter config using apiKey as the
+// fallback API key
+func DefaultTemplate(apiKey string) string {
+	return Template(TemplateOptions{APIKey: apiKey})
+}
+
+// Template returns the commented starter config with opts filled in
+func Template(opts TemplateOptions) string {
+	out := strings.Replace(defaultTemplate, "{{API_KEY}}", opts.APIKey, 1)
+	if opts.Port != "" {
+		out = strings.Replace(out, `"port": "8080",`, `"port": `+quote(opts.Port)+`,`, 1)
+	}
+	if opts.UploadDir != "" {
+		out = strings.Replace(out, `"upload_dir": "uploads",`, `"upload_dir": `+quote(opts.UploadDir)+`,`, 1)
+	}
+
+	categories := opts.Categories
+	if len(categories) == 0 {
+		categories = defaultTemplateCategories
+	}
+	blocks := make([]string, len(categories))
+	for i, cat := range categories {
+		blocks[i] = fmt.Sprintf("    %s: {\n"+
+			"      \"enabled\": true,\n"+
+			"      \"max_files\": %d,\n"+
+			"      \"display_name\": %s,\n"+
+			"      \"description\": %s\n"+
+			"    }", quote(cat.Name), cat.MaxFiles, quote(cat.DisplayName), quote(cat.Description))
+	}
+	return strings.Replace(out, "{{CATEGORIES}}", strings.Join(blocks, ",\n"), 1)
+}
+
+// quote renders s as a JSON string
+func quote(s string) string {
+	data, _ := json.Marshal(s)
+	return string(data)
+}
+
+// GenerateAPIKey returns a random 256-bit key, hex encoded
+func GenerateAPIKey() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// stripComments blanks out // comments outside of strings so commented
+// configs parse as JSON. Offsets are preserved for error messages.
+func stripComments(data []byte) []byte {
+	out := make([]byte, len(data))
+	copy(out, data)
+
+	inString, escaped := false, false
+	for i := 0; i < len(out); i++ {
+		c := out[i]
+		switch {
+		case inString:
+			switch {
+			case escaped:
+				escaped = false
+			case c == '\\':
+				escaped = true
+			case c == '"':
+				inString = false
+			}
+		case c == '"':
+			inString = true
+		case c == '/' && i+1 < len(out) && out[i+1] == '/':
+			for ; i < len(out) && out[i] != '\n'; i++ {
+				out[i] = ' '
+			}
+		}
+	}
+	return out
+}
@@ -0,0 +1,233 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// defaultLocale is the language of the text block when it doesn't say
+const defaultLocale = "en"
+
+// localeTag matches a locale key inside the text block: a language, then
+// optionally a script and/or region ("de", "pt_BR", "zh-Hant-TW"). Text
+// fields like "app_name" match too, but hold strings, not objects.
+var localeTag = regexp.MustCompile(`^(?i)[a-z]{2,3}([_-]([a-z]{4}|[a-z]{2}|[0-9]{3}))*$`)
+
+// textFields is TextConfig without its JSON methods, for plain decoding
+type textFields TextConfig
+
+// UnmarshalJSON reads the text block: the default strings, plus a nested
+// object of translated strings per locale key ("de": {...}). Translations
+// only need the strings that differ; the rest fall back to the defaults.
+func (t *TextConfig) UnmarshalJSON(data []byte) error {
+	return t.decode(data, false)
+}
+
+// decode merges a text block into t; strict rejects unknown fields
+func (t *TextConfig) decode(data []byte, strict bool) error {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	translations := make(map[string]TextConfig, len(t.Translations))
+	for tag, tr := range t.Translations {
+		translations[tag] = tr
+	}
+	for key, value := range raw {
+		if !localeTag.MatchString(key) {
+			continue
+		}
+		tag := normalizeLocale(key)
+		if value = bytes.TrimSpace(value); bytes.Equal(value, []byte("null")) {
+			delete(translations, tag) // Lets a config patch drop a locale
+			delete(raw, key)
+			continue
+		}
+		if !bytes.HasPrefix(value, []byte("{")) {
+			continue
+		}
+		tr := translations[tag]
+		dec := json.NewDecoder(bytes.NewReader(value))
+		if strict {
+			dec.DisallowUnknownFields()
+		}
+		if err := dec.Decode((*textFields)(&tr)); err != nil {
+			return fmt.Errorf("text %s: %w", key, err)
+		}
+		if tr.Locale != "" || tr.Translations != nil {
+			return fmt.Errorf("text %s can't hold further locales", key)
+		}
+		translations[tag] = tr
+		delete(raw, key)
+	}
+
+	rest, err := json.Marshal(raw)
+	if err != nil {
+		return err
+	}
+	dec := json.NewDecoder(bytes.NewReader(rest))
+	if strict {
+		dec.DisallowUnknownFields()
+	}
+	fields := textFields(*t)
+	if err := dec.Decode(&fields); err != nil {
+		return err
+	}
+	*t = TextConfig(fields)
+	t.Translations = nil
+	if len(translations) > 0 {
+		t.Translations = translations
+	}
+	return nil
+}
+
+// MarshalJSON writes the text block in the shape UnmarshalJSON reads
+func (t TextConfig) MarshalJSON() ([]byte, error) {
+	base, err := json.Marshal(textFields(t))
+	if err != nil || len(t.Translations) == 0 {
+		return base, err
+	}
+	var doc map[string]interface{}
+	if err := json.Unmarshal(base, &doc); err != nil {
+		return nil, err
+	}
+	for tag, tr := range t.Translations {
+		// Only the strings a translation sets, so the gaps stay visible
+		tr.Translations = nil
+		data, err := json.Marshal(textFields(tr))
+		if err != nil {
+			return nil, err
+		}
+		var strs map[string]string
+		if err := json.Unmarshal(data, &strs); err != nil {
+			return nil, err
+		}
+		for k, v := range strs {
+			if v == "" {
+				delete(strs, k)
+			}
+		}
+		doc[tag] = strs
+	}
+	return json.Marshal(doc)
+}
+
+// normalizeLocale spells a locale key the one way: "pt-br" and "pt_BR" are
+// both "pt_BR"
+func normalizeLocale(tag string) string {
+	parts := strings.FieldsFunc(tag, func(r rune) bool { return r == '_' || r == '-' })
+	for i, p := range parts {
+		switch {
+		case i == 0:
+			parts[i] = strings.ToLower(p)
+		case len(p) == 4:
+			parts[i] = strings.ToUpper(p[:1]) + strings.ToLower(p[1:])
+		default:
+			parts[i] = strings.ToUpper(p)
+		}
+	}
+	return strings.Join(parts, "_")
+}
+
+// validateLocales checks the locale of the default strings
+func validateLocales(t TextConfig) error {
+	if t.Locale != "" && !localeTag.MatchString(t.Locale) {
+		return fmt.Errorf("text locale %q must look like en or pt_BR", t.Locale)
+	}
+	return nil
+}
+
+// DefaultLocale returns the language of the default strings
+func (t TextConfig) DefaultLocale() string {
+	if t.Locale == "" {
+		return defaultLocale
+	}
+	return normalizeLocale(t.Locale)
+}
+
+// Locales lists the languages the text is available in, default first
+func (t TextConfig) Locales() []string {
+	def := t.DefaultLocale()
+	locales := []string{def}
+	for tag := range t.Translations {
+		if tag != def {
+			locales = append(locales, tag)
+		}
+	}
+	sort.Strings(locales[1:])
+	return locales
+}
+
+// Localized returns the text in the best available match for the given
+// language preferences, most preferred first ("pt-BR", "pt", "en"), and
+// the locale picked. A language without an exact match takes its base
+// language or a regional variant of it; with no match at all the default
+// strings are returned.
+func (t TextConfig) Localized(preferences ...string) (TextConfig, string) {
+	locales := t.Locales()
+	for _, pref := range preferences {
+		if pref == "*" {
+			break
+		}
+		if tag := matchLocale(locales, normalizeLocale(pref)); tag != "" {
+			return t.in(tag), tag
+		}
+	}
+	def := t.DefaultLocale()
+	return t.in(def), def
+}
+
+// matchLocale finds the available locale serving a wanted one: the same
+// locale, else its base language, else another variant of that language
+func matchLocale(locales []string, want string) string {
+	lang, _, _ := strings.Cut(want, "_")
+	for _, candidate := range []string{want, lang} {
+		if slices.Contains(locales, candidate) {
+			return candidate
+		}
+	}
+	for _, tag := range locales {
+		if tagLang, _, _ := strings.Cut(tag, "_"); tagLang == lang {
+			return tag
+		}
+	}
+	return ""
+}
+
+// in returns the strings of one locale, filling gaps from the defaults
+func (t TextConfig) in(tag string) TextConfig {
+	out := t
+	out.Translations = nil
+	tr, ok := t.Translations[tag]
+	if !ok {
+		return out
+	}
+	for _, f := range []struct{ dst, src *string }{
+		{&out.AppName, &tr.AppName},
+		{&out.AppTitle, &tr.AppTitle},
+		{&out.AppSubtitle, &tr.AppSubtitle},
+		{&out.DeviceName, &tr.DeviceName},
+		{&out.AdminTitle, &tr.AdminTitle},
+		{&out.UploadSuccess, &tr.UploadSuccess},
+		{&out.UploadFailed, &tr.UploadFailed},
+		{&out.FileTooLarge, &tr.FileTooLarge},
+		{&out.InvalidFile, &tr.InvalidFile},
+		{&out.Unauthorized, &tr.Unauthorized},
+		{&out.NoFilesFound, &tr.NoFilesFound},
+		{&out.CopySuccess, &tr.CopySuccess},
+		{&out.CopyFailed, &tr.CopyFailed},
+		{&out.ServerError, &tr.ServerError},
+	} {
+		if *f.src != "" {
+			*f.dst = *f.src
+		}
+	}
+	out.Locale = tag
+	return out
+}
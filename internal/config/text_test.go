@@ -0,0 +1,65 @@
+package config
+
+import "testing"
+
+func TestLocalized(t *testing.T) {
+	text := TextConfig{
+		AppTitle:     "Builds",
+		NoFilesFound: "No builds yet",
+		Translations: map[string]TextConfig{
+			"de":         {AppTitle: "Builds", NoFilesFound: "Noch keine Builds"},
+			"pt_BR":      {AppTitle: "Compilações"},
+			"zh_Hant_TW": {NoFilesFound: "尚無版本"},
+		},
+	}
+	tests := []struct {
+		name        string
+		preferences []string
+		wantLocale  string
+		wantEmpty   string
+	}{
+		{name: "no preference", wantLocale: "en", wantEmpty: "No builds yet"},
+		{name: "exact", preferences: []string{"de"}, wantLocale: "de", wantEmpty: "Noch keine Builds"},
+		{name: "region falls back to base", preferences: []string{"de-AT"}, wantLocale: "de", wantEmpty: "Noch keine Builds"},
+		{name: "base takes a variant", preferences: []string{"pt"}, wantLocale: "pt_BR", wantEmpty: "No builds yet"},
+		{name: "other variant", preferences: []string{"pt-PT"}, wantLocale: "pt_BR", wantEmpty: "No builds yet"},
+		{name: "spelling normalized", preferences: []string{"ZH-hant-tw"}, wantLocale: "zh_Hant_TW", wantEmpty: "尚無版本"},
+		{name: "first match wins", preferences: []string{"fr", "pt-BR", "de"}, wantLocale: "pt_BR", wantEmpty: "No builds yet"},
+		{name: "default is a match", preferences: []string{"en-GB", "de"}, wantLocale: "en", wantEmpty: "No builds yet"},
+		{name: "wildcard stops", preferences: []string{"fr", "*", "de"}, wantLocale: "en", wantEmpty: "No builds yet"},
+		{name: "nothing matches", preferences: []string{"fr", "ja"}, wantLocale: "en", wantEmpty: "No builds yet"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, locale := text.Localized(tt.preferences...)
+			if locale != tt.wantLocale || got.NoFilesFound != tt.wantEmpty {
+				t.Errorf("Localized(%q) = %s %q, want %s %q", tt.preferences, locale, got.NoFilesFound, tt.wantLocale, tt.wantEmpty)
+			}
+			if got.Translations != nil {
+				t.Errorf("Localized(%q) kept the translations", tt.preferences)
+			}
+		})
+	}
+}
+
+func TestMatchLocale(t *testing.T) {
+	locales := []string{"en", "de", "pt_BR", "pt_PT", "sr_Latn"}
+	tests := []struct {
+		locale string
+		want   string
+	}{
+		{"en", "en"},
+		{"en_US", "en"},
+		{"pt_PT", "pt_PT"},
+		{"pt", "pt_BR"},
+		{"pt_AO", "pt_BR"},
+		{"sr_Cyrl", "sr_Latn"},
+		{"fr", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := matchLocale(locales, tt.locale); got != tt.want {
+			t.Errorf("matchLocale(%q) = %q, want %q", tt.locale, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package handlers
+
+import (
+	"net/http"
+
+	"rom-server/internal/models"
+	"rom-server/internal/services"
+)
+
+// LatestApp returns the newest build (highest versionCode) of an app
+// package hosted in an APK category, for in-app updaters
+// (/api/v1/apps/{package})
+func (h *Handlers) LatestApp(w http.ResponseWriter, r *http.Request) {
+	pkg := r.PathValue("package")
+	files, _, err := h.fileService.QueryFiles(services.FileQuery{
+		Match: func(f models.FileInfo) bool { return f.APK != nil && f.APK.Package == pkg },
+	})
+	if err != nil {
+		h.logger.Printf("Error listing files: %v", err)
+		h.sendError(w, http.StatusInternalServerError, h.cfg.GetText().ServerError)
+		return
+	}
+
+	files = h.visibleFiles(h.viewer(r), files)
+	if len(files) == 0 {
+		h.sendError(w, http.StatusNotFound, "No builds of this app")
+		return
+	}
+	latest := files[0]
+	for _, f := range files[1:] {
+		// Newest first, so an equal versionCode keeps the later upload
+		if f.APK.VersionCode > latest.APK.VersionCode {
+			latest = f
+		}
+	}
+	found := []models.FileInfo{latest}
+	h.ratings.Fill(found)
+	h.sendCachedJSON(w, r, found[0])
+}
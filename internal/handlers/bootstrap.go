@@ -0,0 +1,41 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+
+	"rom-server/internal/models"
+	"rom-server/internal/services"
+)
+
+// Bootstrap returns what the download page needs to start in one response:
+// the public config (with category stats and announcements), the file
+// listing and the device page index. It takes ?lang= and ?token= like
+// /api/config and /list, and answers If-None-Match with 304.
+func (h *Handlers) Bootstrap(w http.ResponseWriter, r *http.Request) {
+	v := h.viewer(r)
+	files, _, err := h.fileService.QueryFiles(services.FileQuery{
+		Match: func(f models.FileInfo) bool { return v.sees(h, f.Category) },
+	})
+	if err != nil {
+		h.logger.Printf("Error listing files: %v", err)
+		h.sendError(w, http.StatusInternalServerError, h.cfg.GetText().ServerError)
+		return
+	}
+	files = h.visibleFiles(v, files)
+	h.ratings.Fill(files)
+
+	pages, err := h.pageIndex()
+	if err != nil {
+		h.logger.Printf("Failed to read pages: %v", err)
+		h.sendError(w, http.StatusInternalServerError, h.cfg.GetText().ServerError)
+		return
+	}
+
+	resp := models.BootstrapResponse{Config: h.publicConfig(r, v), Files: files, Pages: pages}
+	// The listing changes with every upload, so revalidate each time
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Vary", "Accept-Language")
+	w.Header().Set("Content-Language", strings.ReplaceAll(resp.Config.Lang, "_", "-"))
+	h.sendCachedJSON(w, r, resp)
+}
@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+
+	"rom-server/internal/middleware"
+	"rom-server/internal/models"
+	"rom-server/internal/services"
+)
+
+// Bundle streams every build of /{category} as one zip with checksums and
+// a changelog. ?tag=, ?attr= and ?uploader= narrow it to a release group the
+// way they narrow /list.
+func (h *Handlers) Bundle(w http.ResponseWriter, r *http.Request) {
+	category := r.PathValue("category")
+	if !h.cfg.IsValidCategory(category) || !h.viewer(r).sees(h, category) {
+		h.sendError(w, http.StatusNotFound, "Unknown category")
+		return
+	}
+	q := r.URL.Query()
+	attrs, err := services.ParseAttributes(q["attr"])
+	if err != nil {
+		h.sendFieldErrors(w, fieldErrors{{Field: "attr", Message: err.Error()}})
+		return
+	}
+
+	// The mirror has no bundles, so a spent cap can't be redirected
+	capReached := h.fileService.TrafficCapReached()
+	if capReached && h.cfg.Traffic.CapAction == "redirect" {
+		h.sendError(w, http.StatusServiceUnavailable, "Bundles are unavailable until the monthly transfer cap resets")
+		return
+	}
+
+	all, err := h.fileService.ListFiles()
+	if err != nil {
+		h.logger.Printf("Error listing files: %v", err)
+		h.sendError(w, http.StatusInternalServerError, h.cfg.GetText().ServerError)
+		return
+	}
+	var files []models.FileInfo
+	var total int64
+	for _, f := range h.fileService.BundleFiles(services.FilterFiles(all, q["tag"], attrs, q.Get("uploader"))) {
+		if f.Category == category {
+			files = append(files, f)
+			total += f.SizeBytes
+		}
+	}
+	if len(files) == 0 {
+		h.sendError(w, http.StatusNotFound, h.cfg.GetText().NoFilesFound)
+		return
+	}
+
+	name := services.SanitizeFilename(strings.Join(append([]string{category}, q["tag"]...), "-") + "-bundle.zip")
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", attachment(name))
+	w.Header().Set("Cache-Control", "no-store")
+	if r.Method == http.MethodHead {
+		return // The archive is only assembled for a GET
+	}
+
+	defer h.fileService.ReleaseDownloadSlot(h.fileService.AcquireDownloadSlot(total))
+
+	transfer := h.fileService.StartTransfer(services.TransferDownload, category, name, middleware.LoggedIP(r), "", total, abortFunc(w))
+	defer transfer.Done()
+
+	counter := &countingWriter{ResponseWriter: w, status: http.StatusOK, transfer: transfer}
+	var out http.ResponseWriter = counter
+	if capReached {
+		out = newThrottledWriter(counter, int64(h.cfg.Traffic.ThrottleKBps)*1024)
+	}
+
+	out, finishDigest := h.withDigestTrailer(out)
+
+	err = h.fileService.WriteBundle(out, files)
+	h.fileService.AddTraffic(category, counter.written)
+	h.metrics.Add("download_bytes_total", counter.written)
+	if err != nil {
+		// Headers are gone already; the client gets a truncated archive
+		h.logger.Printf("Bundle %s failed after %s: %v", name, services.FormatSize(counter.written), err)
+		return
+	}
+	finishDigest()
+
+	// Each build in a complete bundle counts as a download
+	client := services.ClassifyUserAgent(r.UserAgent(), h.cfg.Analytics)
+	for _, f := range files {
+		h.fileService.IncrementDownloadCount(f.Category, f.Filename, client)
+	}
+	h.metrics.Add("bundles_total", 1)
+}
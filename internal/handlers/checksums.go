@@ -0,0 +1,183 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"rom-server/internal/models"
+	"rom-server/internal/services"
+)
+
+// checksumFormats maps the text formats of /api/v1/checksums to the digest
+// each one lists, in the output style of the coreutils tool of that name
+var checksumFormats = map[string]func(models.FileChecksums) string{
+	"sha256sum": func(f models.FileChecksums) string { return f.SHA256 },
+	"sha1sum":   func(f models.FileChecksums) string { return f.SHA1 },
+	"md5sum":    func(f models.FileChecksums) string { return f.MD5 },
+}
+
+// Checksums lists the SHA-256, SHA-1 and MD5 of every published build, so a
+// flash script can verify a whole batch of downloads with one request.
+// ?category=, ?tag=, ?attr= and ?uploader= narrow it the way they narrow
+// /list; ?format=sha256sum (or sha1sum, md5sum) answers in text that
+// `sha256sum -c` accepts.
+func (h *Handlers) Checksums(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	category := q.Get("category")
+	v := h.viewer(r)
+	if category != "" && (!h.cfg.IsValidCategory(category) || !v.sees(h, category)) {
+		h.sendError(w, http.StatusNotFound, "Unknown category")
+		return
+	}
+	attrs, err := services.ParseAttributes(q["attr"])
+	if err != nil {
+		h.sendFieldErrors(w, fieldErrors{{Field: "attr", Message: err.Error()}})
+		return
+	}
+	format := q.Get("format")
+	digest, ok := checksumFormats[format]
+	if format != "" && format != "json" && !ok {
+		h.sendFieldErrors(w, fieldErrors{{Field: "format", Message: "must be json, sha256sum, sha1sum or md5sum"}})
+		return
+	}
+
+	all, err := h.fileService.ListFiles()
+	if err != nil {
+		h.logger.Printf("Error listing files: %v", err)
+		h.sendError(w, http.StatusInternalServerError, h.cfg.GetText().ServerError)
+		return
+	}
+	resp := models.ChecksumsResponse{Files: []models.FileChecksums{}}
+	for _, f := range services.FilterFiles(h.visibleFiles(v, all), q["tag"], attrs, q.Get("uploader")) {
+		if category != "" && f.Category != category {
+			continue
+		}
+		resp.Files = append(resp.Files, models.FileChecksums{
+			Category:  f.Category,
+			Filename:  f.Filename,
+			SizeBytes: f.SizeBytes,
+			SHA256:    f.SHA256,
+			SHA1:      f.SHA1,
+			MD5:       f.MD5,
+			URL:       f.URL,
+		})
+	}
+	resp.TotalCount = len(resp.Files)
+
+	if !ok {
+		h.sendCachedJSON(w, r, resp)
+		return
+	}
+
+	// One "<hex>  <path>" line per build. Paths are relative to the category
+	// when one was asked for, else to the download root. Builds without the
+	// digest (e.g. MD5 of bucket uploads) are left out rather than guessed.
+	var b strings.Builder
+	for _, f := range resp.Files {
+		sum := digest(f)
+		if sum == "" {
+			continue
+		}
+		name := f.Category + "/" + f.Filename
+		if category != "" {
+			name = f.Filename
+		}
+		fmt.Fprintf(&b, "%s  %s\n", sum, name)
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write([]byte(b.String()))
+}
+
+// ImportManifest checks the builds of ?category= against a sha256sums.txt
+// from the build system, sent as the body or as a "manifest" form file.
+// Builds already uploaded are marked verified or mismatched; the rest are
+// checked when they arrive, and refused if they don't match.
+func (h *Handlers) ImportManifest(w http.ResponseWriter, r *http.Request) {
+	category := r.URL.Query().Get("category")
+	if v := h.validator(); !v.category("category", category) {
+		h.sendInvalid(w, v)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, services.MaxManifestSize)
+	var body io.Reader = r.Body
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		file, _, err := r.FormFile("manifest")
+		if err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				h.sendTooLarge(w, tooLarge.Limit)
+				return
+			}
+			h.sendFieldErrors(w, fieldErrors{{Field: "manifest", Message: "is required (send the file as the manifest field or as the body)"}})
+			return
+		}
+		defer file.Close()
+		body = file
+	}
+
+	sums, err := services.ParseManifest(body)
+	var invalid *services.InvalidField
+	var tooLarge *http.MaxBytesError
+	switch {
+	case errors.As(err, &tooLarge):
+		h.sendTooLarge(w, tooLarge.Limit)
+		return
+	case errors.As(err, &invalid):
+		h.sendFieldErrors(w, fieldErrors{{Field: invalid.Field, Message: invalid.Message}})
+		return
+	case err != nil:
+		h.sendError(w, http.StatusBadRequest, "Failed to read the manifest")
+		return
+	}
+
+	report, err := h.fileService.ImportManifest(category, sums)
+	if err != nil {
+		h.logger.Printf("Failed to import checksum manifest: %v", err)
+		h.sendError(w, http.StatusInternalServerError, h.cfg.GetText().ServerError)
+		return
+	}
+	for _, m := range report.Mismatched {
+		h.logger.Printf("Checksum manifest mismatch for %s in [%s]: expected %s, have %s", m.Filename, category, m.Expected, m.Actual)
+	}
+	h.metrics.Add("manifest_mismatches_total", int64(len(report.Mismatched)))
+	h.recordAudit(r, "checksums.import", category, fmt.Sprintf("%d verified, %d mismatched, %d pending", len(report.Verified), len(report.Mismatched), len(report.Pending)))
+	h.sendJSON(w, http.StatusOK, report)
+}
+
+// ExpectedChecksums lists the manifest entries still waiting for their build
+func (h *Handlers) ExpectedChecksums(w http.ResponseWriter, r *http.Request) {
+	items, err := h.fileService.ExpectedChecksums()
+	if err != nil {
+		h.logger.Printf("Failed to read expected checksums: %v", err)
+		h.sendError(w, http.StatusInternalServerError, h.cfg.GetText().ServerError)
+		return
+	}
+	h.sendJSON(w, http.StatusOK, items)
+}
+
+// DropExpectedChecksums forgets the waiting manifest entries of ?category=,
+// or only the one for ?filename=
+func (h *Handlers) DropExpectedChecksums(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	category, filename := q.Get("category"), services.NormalizeFilename(q.Get("filename"))
+	if v := h.validator(); !v.category("category", category) {
+		h.sendInvalid(w, v)
+		return
+	}
+	dropped, err := h.fileService.DropExpectedChecksums(category, filename)
+	if err != nil {
+		h.logger.Printf("Failed to update expected checksums: %v", err)
+		h.sendError(w, http.StatusInternalServerError, h.cfg.GetText().ServerError)
+		return
+	}
+	target := category
+	if filename != "" {
+		target += "/" + filename
+	}
+	h.recordAudit(r, "checksums.drop", target, fmt.Sprintf("%d entries", dropped))
+	h.sendJSON(w, http.StatusOK, map[string]int{"dropped": dropped})
+}
@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"net/http"
+
+	"rom-server/internal/models"
+	"rom-server/internal/services"
+)
+
+// setDigestHeaders announces a download's recorded checksums as an RFC 3230
+// Digest and an RFC 9530 Repr-Digest, unless download_digest is "off". Both
+// describe the whole file, so ranges carry them too.
+func (h *Handlers) setDigestHeaders(header http.Header, sums models.Checksums) {
+	if h.cfg.Server.DownloadDigest == "off" {
+		return
+	}
+	header.Set("Digest", services.DigestHeader(sums))
+	if repr := services.StructuredDigest(sums); repr != "" {
+		header.Set("Repr-Digest", repr)
+	}
+}
+
+// digestWriter hashes a streamed body on its way out
+type digestWriter struct {
+	http.ResponseWriter
+	sha hash.Hash
+}
+
+func (d *digestWriter) Write(p []byte) (int, error) {
+	n, err := d.ResponseWriter.Write(p)
+	d.sha.Write(p[:n])
+	return n, err
+}
+
+// withDigestTrailer wraps a streamed body whose checksum isn't known up
+// front, when download_digest is "trailer": it announces Content-Digest and
+// Digest trailers and returns the writer to stream through plus a func that
+// fills them in. Call it only once the whole body was written; a response
+// cut short goes without, so it can't be mistaken for a verified one.
+func (h *Handlers) withDigestTrailer(w http.ResponseWriter) (http.ResponseWriter, func()) {
+	if h.cfg.Server.DownloadDigest != "trailer" {
+		return w, func() {}
+	}
+	w.Header().Add("Trailer", "Content-Digest")
+	w.Header().Add("Trailer", "Digest")
+	d := &digestWriter{ResponseWriter: w, sha: sha256.New()}
+	return d, func() {
+		sums := models.Checksums{SHA256: hex.EncodeToString(d.sha.Sum(nil))}
+		w.Header().Set("Content-Digest", services.StructuredDigest(sums))
+		w.Header().Set("Digest", services.DigestHeader(sums))
+	}
+}
@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"path"
+	"path/filepath"
+	"strconv"
+
+	"rom-server/internal/middleware"
+	"rom-server/internal/models"
+	"rom-server/internal/services"
+)
+
+// ExtractFile streams one file (?path=boot.img) out of the zip build at
+// /{category}/{filename}/extract, so users who only need the boot image
+// don't download the whole ROM. Stored entries support ranges.
+func (h *Handlers) ExtractFile(w http.ResponseWriter, r *http.Request) {
+	category, filename := r.PathValue("category"), services.NormalizeFilename(r.PathValue("filename"))
+	entryPath := r.URL.Query().Get("path")
+	v := h.validator()
+	v.required("path", entryPath)
+	if h.sendInvalid(w, v) {
+		return
+	}
+	if !h.cfg.IsValidCategory(category) || !validPathName(filename) || !h.cfg.IsAllowedExtensionFor(category, filepath.Ext(filename)) || !h.viewer(r).sees(h, category) {
+		h.sendError(w, http.StatusNotFound, "File not found")
+		return
+	}
+
+	// The mirror serves whole builds only, so a spent cap can't be redirected
+	capReached := h.fileService.TrafficCapReached()
+	if capReached && h.cfg.Traffic.CapAction == "redirect" {
+		h.sendError(w, http.StatusServiceUnavailable, "Extraction is unavailable until the monthly transfer cap resets")
+		return
+	}
+
+	entry, err := h.fileService.OpenZipEntry(category, filename, entryPath)
+	switch {
+	case errors.Is(err, services.ErrNotFound):
+		h.sendError(w, http.StatusNotFound, "File not found")
+		return
+	case errors.Is(err, services.ErrEntryNotFound):
+		h.sendError(w, http.StatusNotFound, entryPath+" is not in "+filename)
+		return
+	case errors.Is(err, services.ErrNotZip):
+		h.sendError(w, http.StatusUnsupportedMediaType, filename+" is not a zip archive")
+		return
+	case err != nil:
+		h.logger.Printf("Extract %s from %s/%s failed: %v", entryPath, category, filename, err)
+		h.sendError(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+	defer entry.Close()
+	defer h.fileService.ReleaseDownloadSlot(h.fileService.AcquireDownloadSlot(entry.Size))
+
+	name := path.Base(entry.Name)
+	if h.cfg.IsRestricted(category) {
+		w.Header().Set("Cache-Control", "private, no-store")
+	} else {
+		h.cdn.SetCacheHeaders(w.Header(), h.cfg.IsImmutable(category, filename))
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", attachment(name))
+
+	transfer := h.fileService.StartTransfer(services.TransferDownload, category, filename+"/"+entry.Name, middleware.LoggedIP(r), "", entry.Size, abortFunc(w))
+	defer transfer.Done()
+
+	counter := &countingWriter{ResponseWriter: w, status: http.StatusOK, transfer: transfer}
+	var out http.ResponseWriter = counter
+	if capReached {
+		out = newThrottledWriter(counter, int64(h.cfg.Traffic.ThrottleKBps)*1024)
+	}
+
+	if content, ok := entry.Content.(io.ReadSeeker); ok {
+		http.ServeContent(out, r, name, entry.Modified, content)
+	} else {
+		// Compressed: inflated on the way out, so no ranges. A digest trailer
+		// only survives HTTP/1.1 chunked encoding, so with one the length
+		// goes unsent.
+		body, finishDigest := h.withDigestTrailer(out)
+		if body == out {
+			w.Header().Set("Content-Length", strconv.FormatInt(entry.Size, 10))
+		}
+		if r.Method != http.MethodHead {
+			if _, err := io.Copy(body, entry.Content); err != nil {
+				h.logger.Printf("Extract %s from %s/%s failed: %v", entry.Name, category, filename, err)
+			} else {
+				finishDigest()
+			}
+		}
+	}
+
+	h.fileService.AddTraffic(category, counter.written)
+	h.metrics.Add("download_bytes_total", counter.written)
+	if counter.served() && r.Method != http.MethodHead {
+		h.metrics.Add("extracts_total", 1)
+	}
+}
+
+// ZipContents lists the files inside the zip build at
+// /{category}/{filename}/contents (paths, sizes, CRCs), so users and tools
+// can check for GApps or a partition image before downloading
+func (h *Handlers) ZipContents(w http.ResponseWriter, r *http.Request) {
+	category, filename := r.PathValue("category"), services.NormalizeFilename(r.PathValue("filename"))
+	if !h.cfg.IsValidCategory(category) || !validPathName(filename) || !h.cfg.IsAllowedExtensionFor(category, filepath.Ext(filename)) || !h.viewer(r).sees(h, category) {
+		h.sendError(w, http.StatusNotFound, "File not found")
+		return
+	}
+
+	entries, err := h.fileService.ZipContents(category, filename)
+	switch {
+	case errors.Is(err, services.ErrNotFound):
+		h.sendError(w, http.StatusNotFound, "File not found")
+		return
+	case errors.Is(err, services.ErrNotZip):
+		h.sendError(w, http.StatusUnsupportedMediaType, filename+" is not a zip archive")
+		return
+	case err != nil:
+		h.logger.Printf("Listing %s/%s failed: %v", category, filename, err)
+		h.sendError(w, http.StatusInternalServerError, h.cfg.GetText().ServerError)
+		return
+	}
+
+	resp := models.ZipContentsResponse{Category: category, Filename: filename, Entries: entries, TotalCount: len(entries)}
+	for _, e := range entries {
+		resp.TotalSize += e.Size
+	}
+	h.sendCachedJSON(w, r, resp)
+}
@@ -0,0 +1,160 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"path/filepath"
+
+	"rom-server/internal/middleware"
+	"rom-server/internal/models"
+	"rom-server/internal/services"
+)
+
+// SubmitFeedback takes a user's field report on a published build (boots
+// fine, has issues, bootloops) and queues it for a moderator. It shares the
+// per-client limit with build reports.
+func (h *Handlers) SubmitFeedback(w http.ResponseWriter, r *http.Request) {
+	if !h.submitLimiter.Allow(clientHost(r)) {
+		w.Header().Set("Retry-After", "60")
+		h.sendError(w, http.StatusTooManyRequests, "Too much feedback; try again in a minute")
+		return
+	}
+
+	var req models.FeedbackRequest
+	if err := json.NewDecoder(io.LimitReader(r.Body, 64<<10)).Decode(&req); err != nil {
+		h.sendError(w, http.StatusBadRequest, "Invalid JSON body")
+		return
+	}
+	req.Filename = services.NormalizeFilename(req.Filename)
+
+	v := h.validator()
+	v.required("category", req.Category)
+	v.required("filename", req.Filename)
+	if h.sendInvalid(w, v) {
+		return
+	}
+
+	if !h.cfg.IsValidCategory(req.Category) || !h.viewer(r).sees(h, req.Category) {
+		h.sendError(w, http.StatusNotFound, "File not found")
+		return
+	}
+	file, ok := h.publishedFile(req.Category, req.Filename)
+	if !ok {
+		h.sendError(w, http.StatusNotFound, "File not found")
+		return
+	}
+
+	client := middleware.Anonymize(r, clientHost(r))
+	item, err := h.feedback.Submit(req, file.SHA256, client)
+	var invalid *services.InvalidField
+	switch {
+	case errors.As(err, &invalid):
+		h.sendFieldErrors(w, fieldErrors{{Field: invalid.Field, Message: invalid.Message}})
+		return
+	case errors.Is(err, services.ErrFeedbackQueueFull):
+		w.Header().Set("Retry-After", "3600")
+		h.sendError(w, http.StatusServiceUnavailable, "Feedback is closed until the maintainers catch up")
+		return
+	case err != nil:
+		h.logger.Printf("Failed to store feedback: %v", err)
+		h.sendError(w, http.StatusInternalServerError, h.cfg.GetText().ServerError)
+		return
+	}
+
+	h.logger.Printf("Feedback %s from %s: %s/%s %s", item.ID, client, item.Category, item.Filename, item.Outcome)
+	h.metrics.Add("feedback_total", 1)
+	h.sendJSON(w, http.StatusAccepted, map[string]string{"id": item.ID, "message": "Thanks! Your feedback will appear once a maintainer approves it"})
+}
+
+// BuildFeedback lists the approved feedback on the build at
+// /{category}/{filename}/feedback with a tally per outcome
+func (h *Handlers) BuildFeedback(w http.ResponseWriter, r *http.Request) {
+	category, filename := r.PathValue("category"), services.NormalizeFilename(r.PathValue("filename"))
+	if !h.cfg.IsValidCategory(category) || !validPathName(filename) || !h.cfg.IsAllowedExtensionFor(category, filepath.Ext(filename)) || !h.viewer(r).sees(h, category) {
+		h.sendError(w, http.StatusNotFound, "File not found")
+		return
+	}
+	file, ok := h.publishedFile(category, filename)
+	if !ok {
+		h.sendError(w, http.StatusNotFound, "File not found")
+		return
+	}
+
+	resp := models.FeedbackSummary{
+		Category: category,
+		Filename: filename,
+		Outcomes: make(map[string]int64),
+		Feedback: h.feedback.Approved(category, filename, file.SHA256),
+	}
+	for _, outcome := range services.FeedbackOutcomes {
+		resp.Outcomes[outcome] = 0
+	}
+	for _, item := range resp.Feedback {
+		resp.Outcomes[item.Outcome]++
+	}
+	if h.cfg.IsRestricted(category) {
+		w.Header().Set("Cache-Control", "private, no-store")
+	}
+	h.sendCachedJSON(w, r, resp)
+}
+
+// AdminFeedback lists feedback for moderation, newest first: the pending
+// queue by default, ?status=approved or ?status=all for the rest
+func (h *Handlers) AdminFeedback(w http.ResponseWriter, r *http.Request) {
+	status := r.URL.Query().Get("status")
+	if status == "" {
+		status = "pending"
+	}
+	if status != "pending" && status != "approved" && status != "all" {
+		h.sendFieldErrors(w, fieldErrors{{Field: "status", Message: "must be pending, approved or all"}})
+		return
+	}
+
+	items, err := h.feedback.All()
+	if err != nil {
+		h.logger.Printf("Failed to read feedback: %v", err)
+		h.sendError(w, http.StatusInternalServerError, h.cfg.GetText().ServerError)
+		return
+	}
+	shown := items[:0]
+	for _, item := range items {
+		if status == "all" || item.Approved == (status == "approved") {
+			shown = append(shown, item)
+		}
+	}
+	h.sendJSON(w, http.StatusOK, shown)
+}
+
+// ApproveFeedback publishes the feedback at /{id}
+func (h *Handlers) ApproveFeedback(w http.ResponseWriter, r *http.Request) {
+	item, err := h.feedback.Approve(r.PathValue("id"))
+	if err != nil {
+		h.sendFeedbackError(w, err)
+		return
+	}
+	h.recordAudit(r, "feedback.approve", item.Category+"/"+item.Filename, item.ID+": "+item.Outcome)
+	h.sendJSON(w, http.StatusOK, item)
+}
+
+// DeleteFeedback removes the feedback at /{id}, pending or approved
+func (h *Handlers) DeleteFeedback(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if err := h.feedback.Delete(id); err != nil {
+		h.sendFeedbackError(w, err)
+		return
+	}
+	h.recordAudit(r, "feedback.delete", id, "")
+	h.sendJSON(w, http.StatusOK, map[string]string{"message": "Feedback deleted"})
+}
+
+// sendFeedbackError answers a failed moderation action
+func (h *Handlers) sendFeedbackError(w http.ResponseWriter, err error) {
+	if errors.Is(err, services.ErrNotFound) {
+		h.sendError(w, http.StatusNotFound, "Feedback not found")
+		return
+	}
+	h.logger.Printf("Failed to update feedback: %v", err)
+	h.sendError(w, http.StatusInternalServerError, h.cfg.GetText().ServerError)
+}
@@ -1,33 +1,77 @@
 package handlers
 
 import (
+	"encoding/csv"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
 	"io"
 	"log"
+	"mime/multipart"
+	"net"
 	"net/http"
 	"net/url"
+	"os"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"rom-server/internal/config"
+	"rom-server/internal/middleware"
 	"rom-server/internal/models"
 	"rom-server/internal/services"
+	"rom-server/internal/version"
 )
 
 // Handlers contains all HTTP handlers with their dependencies
 type Handlers struct {
 	cfg         *config.Config
 	fileService *services.FileService
+	cdn         *services.CDN
+	audit       *services.AuditLog
+	announce    *services.AnnouncementStore
+	activity    *services.ActivityFeed
+	metrics     *services.Metrics
+	speedTests  *services.SpeedTests
+	keys        *services.KeyStore      // Maintainer keys, for ?key= on public listings
+	testers     *services.TesterStore   // Beta tester allowlist
+	limiter     *middleware.RateLimiter // Per-client request limits
+	feedback    *services.FeedbackStore
+	pages       *services.PageStore
+	ratings     *services.RatingStore
 	logger      *log.Logger
+
+	submitLimiter *middleware.RateLimiter // Per-client limit on reports and feedback
+	voteLimiter   *middleware.RateLimiter // Per-voter limit on ratings
+	uploads       *uploadThrottle         // Per-client upload bandwidth
 }
 
 // NewHandlers creates a new Handlers instance
-func NewHandlers(cfg *config.Config, fs *services.FileService, logger *log.Logger) *Handlers {
+func NewHandlers(cfg *config.Config, fs *services.FileService, cdn *services.CDN, audit *services.AuditLog, announce *services.AnnouncementStore, activity *services.ActivityFeed, metrics *services.Metrics, speedTests *services.SpeedTests, feedback *services.FeedbackStore, pages *services.PageStore, ratings *services.RatingStore, keys *services.KeyStore, testers *services.TesterStore, limiter *middleware.RateLimiter, logger *log.Logger) *Handlers {
 	return &Handlers{
 		cfg:         cfg,
 		fileService: fs,
+		cdn:         cdn,
+		audit:       audit,
+		announce:    announce,
+		activity:    activity,
+		metrics:     metrics,
+		speedTests:  speedTests,
+		keys:        keys,
+		testers:     testers,
+		limiter:     limiter,
+		feedback:    feedback,
+		pages:       pages,
+		ratings:     ratings,
 		logger:      logger,
+
+		submitLimiter: middleware.NewRateLimiter(submitsPerMinute, submitBurst, 0),
+		voteLimiter:   middleware.NewRateLimiter(votesPerMinute, voteBurst, 0),
+		uploads:       newUploadThrottle(),
 	}
 }
 
@@ -36,153 +80,1053 @@ func (h *Handlers) Health(w http.ResponseWriter, r *http.Request) {
 	resp := models.HealthResponse{
 		Status:    "ok",
 		Timestamp: time.Now(),
-		Version:   "2.0.0",
+		Version:   version.Version,
 	}
 	h.sendJSON(w, http.StatusOK, resp)
 }
 
-// GetConfig returns public configuration for frontend
+// Version reports the build's version, commit, build date and Go version
+func (h *Handlers) Version(w http.ResponseWriter, r *http.Request) {
+	h.sendJSON(w, http.StatusOK, version.Get())
+}
+
+// readyTimeout bounds the storage check behind /readyz
+const readyTimeout = 5 * time.Second
+
+// Ready reports whether the server can serve builds: the file service lock
+// is free and the upload dir reachable. Unlike /health it fails on a wedged
+// or unmounted store, so probes can restart or route around the node.
+func (h *Handlers) Ready(w http.ResponseWriter, r *http.Request) {
+	result := make(chan error, 1)
+	go func() { result <- h.fileService.Ping() }()
+
+	var err error
+	select {
+	case err = <-result:
+	case <-time.After(readyTimeout):
+		err = fmt.Errorf("storage check timed out after %s", readyTimeout)
+	}
+	if err != nil {
+		h.logger.Printf("Readiness check failed: %v", err)
+		h.sendError(w, http.StatusServiceUnavailable, "Not ready: storage unavailable")
+		return
+	}
+	h.sendJSON(w, http.StatusOK, models.HealthResponse{
+		Status:    "ready",
+		Timestamp: time.Now(),
+		Version:   version.Version,
+	})
+}
+
+// GetConfig returns public configuration for frontend, with the text in
+// the language asked for by ?lang= or else Accept-Language
 func (h *Handlers) GetConfig(w http.ResponseWriter, r *http.Request) {
 	// Cache config in browser for 5 minutes (it rarely changes)
 	w.Header().Set("Cache-Control", "public, max-age=300")
-	
-	stats := h.fileService.GetCategoryStats()
-	
-	resp := models.ConfigResponse{
-		AppName:     h.cfg.Text.AppName,
-		AppTitle:    h.cfg.Text.AppTitle,
-		AppSubtitle: h.cfg.Text.AppSubtitle,
-		DeviceName:  h.cfg.Text.DeviceName,
-		Categories:  stats,
+	w.Header().Set("Vary", "Accept-Language")
+	resp := h.publicConfig(r, h.viewer(r))
+	w.Header().Set("Content-Language", strings.ReplaceAll(resp.Lang, "_", "-"))
+	h.sendCachedJSON(w, r, resp)
+}
+
+// publicConfig is the configuration the viewer's download page works from,
+// in the language the request prefers
+func (h *Handlers) publicConfig(r *http.Request, v viewer) models.ConfigResponse {
+	var stats []models.CategoryInfo
+	for _, cat := range h.fileService.GetCategoryStats() {
+		if v.sees(h, cat.Name) {
+			stats = append(stats, cat)
+		}
+	}
+	var prefs []string
+	if lang := r.URL.Query().Get("lang"); lang != "" {
+		prefs = append(prefs, lang)
+	}
+	allText := h.cfg.GetText()
+	text, lang := allText.Localized(append(prefs, acceptedLanguages(r.Header.Get("Accept-Language"))...)...)
+	links := []models.Link{}
+	for _, l := range h.cfg.GetLinks() {
+		links = append(links, models.Link{Label: l.Label, URL: l.URL, Type: l.Type})
+	}
+
+	return models.ConfigResponse{
+		AppName:       text.AppName,
+		AppTitle:      text.AppTitle,
+		AppSubtitle:   text.AppSubtitle,
+		DeviceName:    text.DeviceName,
+		Categories:    stats,
+		Announcements: h.announce.Active(),
+		MaxSegments:   h.cfg.Concurrency.MaxSegmentsPerClient,
+		Links:         links,
+		Lang:          lang,
+		Languages:     allText.Locales(),
 		Text: models.TextMessages{
-			UploadSuccess: h.cfg.Text.UploadSuccess,
-			UploadFailed:  h.cfg.Text.UploadFailed,
-			NoFilesFound:  h.cfg.Text.NoFilesFound,
-			CopySuccess:   h.cfg.Text.CopySuccess,
-			CopyFailed:    h.cfg.Text.CopyFailed,
+			UploadSuccess: text.UploadSuccess,
+			UploadFailed:  text.UploadFailed,
+			NoFilesFound:  text.NoFilesFound,
+			CopySuccess:   text.CopySuccess,
+			CopyFailed:    text.CopyFailed,
 		},
 	}
-	h.sendJSON(w, http.StatusOK, resp)
 }
 
-// ListFiles handles file listing requests
+// acceptedLanguages lists the languages of an Accept-Language header, most
+// preferred first; ones with q=0 are left out
+func acceptedLanguages(header string) []string {
+	type language struct {
+		tag string
+		q   float64
+	}
+	var langs []language
+	for _, part := range strings.Split(header, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if tag = strings.TrimSpace(tag); tag == "" {
+			continue
+		}
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if parsed, err := strconv.ParseFloat(v, 64); err == nil {
+				q = parsed
+			}
+		}
+		if q > 0 {
+			langs = append(langs, language{tag, q})
+		}
+	}
+	sort.SliceStable(langs, func(i, j int) bool { return langs[i].q > langs[j].q })
+	tags := make([]string, len(langs))
+	for i, l := range langs {
+		tags[i] = l.tag
+	}
+	return tags
+}
+
+// maxListLimit bounds one page of the listing
+const maxListLimit = 1000
+
+// ListFiles handles file listing requests. ?offset= and ?limit= page
+// through it; without a limit every matching file is returned.
 func (h *Handlers) ListFiles(w http.ResponseWriter, r *http.Request) {
-	files, err := h.fileService.ListFiles()
+	// ?tag=x&attr=key=value&uploader=name narrows the listing; every filter must match
+	q := r.URL.Query()
+	attrs, err := services.ParseAttributes(q["attr"])
+	if err != nil {
+		h.sendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	v := h.validator()
+	query := services.FileQuery{Category: q.Get("category")}
+	if query.Category != "" && !h.cfg.IsValidCategory(query.Category) {
+		v.fail("category", "%q is not a category", query.Category)
+	}
+	if s := q.Get("offset"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 {
+			v.fail("offset", "must be zero or a positive number")
+		}
+		query.Offset = n
+	}
+	if s := q.Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 {
+			v.fail("limit", "must be a positive number")
+		}
+		query.Limit = min(n, maxListLimit)
+	}
+	if h.sendInvalid(w, v) {
+		return
+	}
+
+	viewer, tags, uploader := h.viewer(r), q["tag"], q.Get("uploader")
+	query.Match = func(f models.FileInfo) bool {
+		return viewer.sees(h, f.Category) && services.MatchFile(f, tags, attrs, uploader)
+	}
+	files, total, err := h.fileService.QueryFiles(query)
 	if err != nil {
 		h.logger.Printf("Error listing files: %v", err)
-		h.sendError(w, http.StatusInternalServerError, h.cfg.Text.ServerError)
+		h.sendError(w, http.StatusInternalServerError, h.cfg.GetText().ServerError)
 		return
 	}
+	files = h.visibleFiles(viewer, files)
+	h.ratings.Fill(files)
 
 	resp := models.ListResponse{
 		Files:      files,
-		TotalCount: len(files),
+		TotalCount: total,
+		Offset:     query.Offset,
+		Limit:      query.Limit,
+	}
+	h.sendCachedJSON(w, r, resp)
+}
+
+// FileDetails returns the listing entry of one published build
+func (h *Handlers) FileDetails(w http.ResponseWriter, r *http.Request) {
+	category, filename := r.PathValue("category"), services.NormalizeFilename(r.PathValue("filename"))
+	v := h.viewer(r)
+	if !h.cfg.IsValidCategory(category) || !v.sees(h, category) {
+		h.sendError(w, http.StatusNotFound, "Unknown category")
+		return
+	}
+
+	found, ok, err := h.findFile(v, category, filename)
+	if err != nil {
+		h.logger.Printf("Error listing files: %v", err)
+		h.sendError(w, http.StatusInternalServerError, h.cfg.GetText().ServerError)
+		return
+	}
+	if !ok {
+		h.sendError(w, http.StatusNotFound, "File not found")
+		return
+	}
+	h.sendCachedJSON(w, r, found)
+}
+
+// findFile looks up a published file as the viewer sees it in /list; the
+// caller has checked the viewer sees the category
+func (h *Handlers) findFile(v viewer, category, filename string) (models.FileInfo, bool, error) {
+	files, _, err := h.fileService.QueryFiles(services.FileQuery{
+		Category: category,
+		Match:    func(f models.FileInfo) bool { return f.Filename == filename },
+		Limit:    1,
+	})
+	if err != nil || len(files) == 0 {
+		return models.FileInfo{}, false, err
+	}
+	found := h.visibleFiles(v, files)
+	h.ratings.Fill(found)
+	return found[0], true, nil
+}
+
+// AdminStats returns the raw per-client download breakdown, with the
+// approved feedback on each file
+func (h *Handlers) AdminStats(w http.ResponseWriter, r *http.Request) {
+	resp := models.AdminStatsResponse{
+		Files:       h.fileService.GetDownloadBreakdown(),
+		ExcludeBots: h.cfg.Analytics.ExcludeBots,
+	}
+	tally := h.feedback.Tally(func(category, filename string) string {
+		sums, _ := h.fileService.Checksums(category, filename)
+		return sums.SHA256
+	})
+	for i, f := range resp.Files {
+		resp.Files[i].Feedback = tally[f.Category+"/"+f.Filename]
+	}
+	h.sendJSON(w, http.StatusOK, resp)
+}
+
+// SetCounter sets or resets (value omitted) the public download counter of a file
+func (h *Handlers) SetCounter(w http.ResponseWriter, r *http.Request) {
+	category := r.URL.Query().Get("category")
+	filename := services.NormalizeFilename(r.URL.Query().Get("filename"))
+
+	v := h.validator()
+	v.target(category, filename)
+	var value int64
+	if s := r.URL.Query().Get("value"); s != "" {
+		parsed, err := strconv.ParseInt(s, 10, 64)
+		if err != nil || parsed < 0 {
+			v.fail("value", "must be a non-negative integer")
+		}
+		value = parsed
+	}
+	if h.sendInvalid(w, v) {
+		return
+	}
+
+	previous, err := h.fileService.SetDownloadCount(category, filename, value)
+	if err != nil {
+		h.sendError(w, http.StatusNotFound, "File not found")
+		return
+	}
+
+	target := category + "/" + filename
+	details := fmt.Sprintf("downloads %d -> %d", previous, value)
+	h.recordAudit(r, "counter.set", target, details)
+	h.logger.Printf("Counter: %s set from %d to %d", target, previous, value)
+
+	h.sendJSON(w, http.StatusOK, map[string]interface{}{
+		"category":  category,
+		"filename":  filename,
+		"previous":  previous,
+		"downloads": value,
+	})
+}
+
+// ExportStats streams per-file, per-day download data as CSV or NDJSON
+func (h *Handlers) ExportStats(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	// Default to the last 30 days
+	now := time.Now()
+	v := h.validator()
+	from := v.date("from", query.Get("from"), now.AddDate(0, 0, -30))
+	to := v.date("to", query.Get("to"), now)
+	if v.err() == nil && to.Before(from) {
+		v.fail("to", "is before from")
+	}
+	if h.sendInvalid(w, v) {
+		return
+	}
+
+	stats := h.fileService.GetDailyStats(from, to)
+
+	switch format := query.Get("format"); format {
+	case "", "csv":
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", `attachment; filename="stats.csv"`)
+		cw := csv.NewWriter(w)
+		cw.Write([]string{"date", "category", "filename", "downloads"})
+		for _, s := range stats {
+			cw.Write([]string{s.Date, s.Category, s.Filename, strconv.FormatInt(s.Downloads, 10)})
+		}
+		cw.Flush()
+	case "ndjson", "json":
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		enc := json.NewEncoder(w)
+		for _, s := range stats {
+			enc.Encode(s)
+		}
+	default:
+		h.sendError(w, http.StatusBadRequest, "Unsupported format (use csv or ndjson)")
+	}
+}
+
+// DownloadBadge serves /badge/downloads/{category}.json in the shields.io endpoint schema
+func (h *Handlers) DownloadBadge(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimSuffix(r.PathValue("name"), ".json")
+
+	label := "downloads"
+	var total int64
+	switch {
+	case h.cfg.IsValidCategory(name) && h.viewer(r).sees(h, name):
+		total = h.fileService.GetDownloadTotal(name)
+		label = h.cfg.GetCategories()[name].DisplayName + " downloads"
+	case name == "total":
+		total = h.fileService.GetDownloadTotal("")
+	default:
+		h.sendError(w, http.StatusNotFound, "Unknown category")
+		return
+	}
+
+	// Shields caches on its side too; keep ours short so badges stay live
+	w.Header().Set("Cache-Control", "public, max-age=300")
+
+	resp := models.BadgeResponse{
+		SchemaVersion: 1,
+		Label:         label,
+		Message:       services.FormatCount(total),
+		Color:         "brightgreen",
 	}
 	h.sendJSON(w, http.StatusOK, resp)
 }
 
 // Upload handles file upload requests
 func (h *Handlers) Upload(w http.ResponseWriter, r *http.Request) {
-	// Only POST allowed
-	if r.Method != http.MethodPost {
-		h.sendError(w, http.StatusMethodNotAllowed, "Method Not Allowed")
+	// Direct-to-bucket uploads get a presigned PUT instead of sending the body
+	if r.URL.Query().Get("presign") != "" {
+		h.presignUpload(w, r)
 		return
 	}
 
-	// Acquire upload slot (blocks if at limit)
-	h.fileService.AcquireUploadSlot()
+	if !h.acquireUploadSlot(w, r) {
+		return
+	}
 	defer h.fileService.ReleaseUploadSlot()
 
-	// Limit body size
-	r.Body = http.MaxBytesReader(w, r.Body, h.cfg.GetMaxUploadSize())
-
 	// Validate category from Query Param (Fail Fast)
 	// We prefer query param for category to avoid parsing the whole body
 	// just to find out the category is invalid.
 	category := r.URL.Query().Get("category")
-	
+
+	// Limit body size; the category's own limit applies when it's known up front
+	limit := h.cfg.MaxUploadSizeFor(category)
+	if r.ContentLength > limit {
+		h.sendTooLarge(w, limit)
+		return
+	}
+	slow, done := h.limitUploadBody(w, r, limit)
+	defer done()
+
 	// Fallback to FormValue if not in query (forces body read, but supports legacy clients)
 	if category == "" {
 		category = r.FormValue("category")
+		if slow.tooSlow() {
+			h.uploadTooSlow(w, r, category, slow.total)
+			return
+		}
 	}
 
-	if !h.cfg.IsValidCategory(category) {
-		h.sendError(w, http.StatusBadRequest, "Invalid category (use ?category= param)")
+	if v := h.validator(); !v.category("category", category) {
+		h.sendInvalid(w, v)
 		return
 	}
 
+	transfer := h.fileService.StartTransfer(services.TransferUpload, category, "", middleware.LoggedIP(r), middleware.Identity(r), r.ContentLength, slow.abortFunc(w))
+	defer transfer.Done()
+	r.Body = transfer.Reader(r.Body)
+
 	// Parse multipart form with 32MB memory buffer
 	if err := r.ParseMultipartForm(32 << 20); err != nil {
+		if slow.tooSlow() {
+			h.uploadTooSlow(w, r, category, slow.total)
+			return
+		}
+		if r.Context().Err() != nil {
+			h.uploadAborted(w, r, category, transfer)
+			return
+		}
 		h.logger.Printf("Upload parse error: %v", err)
-		h.sendError(w, http.StatusRequestEntityTooLarge, h.cfg.Text.FileTooLarge)
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			h.sendTooLarge(w, tooLarge.Limit)
+			return
+		}
+		h.sendError(w, http.StatusBadRequest, "Malformed multipart body (send the build as the zipfile field)")
 		return
 	}
 
 	// Get file
 	file, handler, err := r.FormFile("zipfile")
 	if err != nil {
-		h.sendError(w, http.StatusBadRequest, h.cfg.Text.InvalidFile)
+		h.sendFieldErrors(w, fieldErrors{{Field: "zipfile", Message: h.cfg.GetText().InvalidFile}})
 		return
 	}
 	defer file.Close()
 
+	// Legacy clients sending the category in the form skipped the early limit
+	if limit := h.cfg.MaxUploadSizeFor(category); handler.Size > limit {
+		h.sendTooLarge(w, limit)
+		return
+	}
+
 	// Sanitize filename
 	safeFilename := services.SanitizeFilename(handler.Filename)
-	ext := filepath.Ext(safeFilename)
-	if !h.cfg.IsAllowedExtension(ext) {
-		h.sendError(w, http.StatusBadRequest, "File type not allowed. Allowed: "+h.cfg.AllowedExts[0])
-		return
+	transfer.SetFilename(safeFilename)
+	v := h.validator()
+	v.filename("zipfile", category, safeFilename)
+
+	// Optional labels: repeated tag= and attr=key=value fields plus notes= (form or query)
+	tags := r.Form["tag"]
+	v.check("tag", services.ValidateLabels(tags, nil))
+	attrs, err := services.ParseAttributes(r.Form["attr"])
+	if v.check("attr", err) {
+		v.check("attr", services.ValidateLabels(nil, attrs))
 	}
+	notes, err := services.NormalizeNotes(r.Form.Get("notes"))
+	v.check("notes", err)
 
-	// Validate ZIP magic bytes
-	header := make([]byte, 4)
-	if _, err := file.Read(header); err != nil {
-		h.sendError(w, http.StatusBadRequest, h.cfg.Text.InvalidFile)
+	// Optional release metadata: a JSON "metadata" field or file part
+	release, err := releaseInfoFromForm(r.MultipartForm)
+	v.check("metadata", err)
+
+	// Optional embargo: the file stays hidden until publish_at, or until an
+	// explicit publish call with stage=1 (form or query)
+	publishAt, err := services.ParsePublishAt(r.Form.Get("publish_at"))
+	v.check("publish_at", err)
+	if !publishAt.After(time.Now()) {
+		publishAt = time.Time{} // Already due: publish now
+	}
+	stage, _ := strconv.ParseBool(r.Form.Get("stage"))
+	// Optional safety net: keep_previous=1 holds on to the build this one
+	// replaces until it has been downloaded in full or confirmed
+	keepPrevious, _ := strconv.ParseBool(r.Form.Get("keep_previous"))
+	// Optional release transaction: held until the whole transaction is
+	// published, so a ROM and its companions go live together
+	transaction := r.Form.Get("transaction")
+	v.check("transaction", services.ValidateTransaction(transaction))
+
+	// Optional end-to-end check against a Digest or Content-MD5 header
+	expected, err := uploadDigest(handler.Header, r.Header)
+	v.check("Digest", err)
+	if h.sendInvalid(w, v) {
 		return
 	}
-	file.Seek(0, io.SeekStart)
 
-	if !services.ValidateZipMagicBytes(header) {
-		h.logger.Printf("Security Alert: Invalid ZIP signature for %s", safeFilename)
-		h.sendError(w, http.StatusBadRequest, "Invalid file format (Not a real ZIP)")
+	image, apk, err := h.checkUploadContent(category, safeFilename, file, handler.Size)
+	if err != nil {
+		h.quarantineUpload(w, r, category, safeFilename, file, handler.Size, err)
 		return
 	}
 
 	// Save file
-	if err := h.fileService.SaveFile(category, safeFilename, file); err != nil {
-		h.logger.Printf("Save error: %v", err)
-		h.sendError(w, http.StatusInternalServerError, h.cfg.Text.UploadFailed)
+	opts := services.UploadOptions{
+		ExpectedSHA256: expected.SHA256,
+		ExpectedMD5:    expected.MD5,
+		Uploader:       middleware.Identity(r),
+		Notes:          notes,
+		Release:        release,
+		Tags:           tags,
+		Attributes:     attrs,
+		PublishAt:      publishAt,
+		Stage:          stage,
+		KeepPrevious:   keepPrevious,
+		Transaction:    transaction,
+		Image:          image,
+		APK:            apk,
+		Context:        r.Context(),
+	}
+	sums, err := h.fileService.SaveUpload(category, safeFilename, file, handler.Size, opts)
+	if err != nil {
+		h.sendSaveError(w, r, category, safeFilename, transfer, sums, err)
 		return
 	}
 
-	h.logger.Printf("Success: Uploaded %s to [%s]", safeFilename, category)
-	
 	resp := models.UploadResponse{
 		Success:  true,
-		Message:  h.cfg.Text.UploadSuccess,
+		Message:  h.cfg.GetText().UploadSuccess,
 		Filename: safeFilename,
 		Category: category,
+		SHA256:   sums.SHA256,
+		SHA1:     sums.SHA1,
+		MD5:      sums.MD5,
+	}
+	if opts.Held() {
+		if pending, ok := h.fileService.PendingFile(category, safeFilename); ok {
+			resp.PreviewURL = pending.PreviewURL
+		}
+		resp.Transaction = transaction
+		if !publishAt.IsZero() {
+			resp.PublishAt = publishAt.UTC().Format(time.RFC3339)
+			h.logger.Printf("Success: Scheduled %s for [%s] at %s", safeFilename, category, resp.PublishAt)
+			h.recordAudit(r, "file.schedule", category+"/"+safeFilename, resp.PublishAt)
+		} else {
+			h.logger.Printf("Success: Staged %s for [%s]", safeFilename, category)
+			h.recordAudit(r, "file.stage", category+"/"+safeFilename, resp.Transaction)
+		}
+		h.sendJSON(w, http.StatusOK, resp)
+		return
 	}
+
+	resp.URL = services.DownloadPath(category, safeFilename)
+	resp.ShortURL = h.fileService.ShortURL(category, safeFilename)
+	h.logger.Printf("Success: Uploaded %s to [%s]", safeFilename, category)
+	h.recordAudit(r, "file.upload", category+"/"+safeFilename, "")
 	h.sendJSON(w, http.StatusOK, resp)
 }
 
-// Delete handles file deletion requests
-func (h *Handlers) Delete(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodDelete && r.Method != http.MethodPost {
-		h.sendError(w, http.StatusMethodNotAllowed, "Method Not Allowed")
+// statusClientClosed is nginx's "client closed request", so access logs
+// show hang-ups instead of a 200 nobody received
+const statusClientClosed = 499
+
+// uploadDigest reads the checksums a client announced for an upload: an
+// RFC 3230 Digest or RFC 1864 Content-MD5 on the zipfile part, or else on
+// the request. Either way they describe the build, not its multipart wrapping.
+func uploadDigest(headers ...interface{ Get(string) string }) (models.Checksums, error) {
+	for _, header := range headers {
+		digest, contentMD5 := header.Get("Digest"), header.Get("Content-MD5")
+		if digest == "" && contentMD5 == "" {
+			continue
+		}
+		sums, err := services.ParseDigest(digest)
+		if err == nil && contentMD5 != "" && sums.MD5 == "" {
+			sums.MD5, err = services.ParseContentMD5(contentMD5)
+		}
+		return sums, err
+	}
+	return models.Checksums{}, nil
+}
+
+// uploadAborted records an upload whose client hung up. Nobody is left to
+// read the answer; the deferred cleanup releases the slot and spooled parts.
+func (h *Handlers) uploadAborted(w http.ResponseWriter, r *http.Request, category string, transfer *services.Transfer) {
+	name := category
+	if transfer.Filename() != "" {
+		name += "/" + transfer.Filename()
+	}
+	h.logger.Printf("Upload aborted: %s from %s disconnected after %s", name, middleware.LoggedIP(r), services.FormatSize(transfer.Bytes()))
+	h.metrics.Add("uploads_aborted_total", 1)
+	w.WriteHeader(statusClientClosed)
+}
+
+// acquireUploadSlot takes an upload slot, queueing only briefly so overload
+// fails fast; if none comes free it answers and returns false
+func (h *Handlers) acquireUploadSlot(w http.ResponseWriter, r *http.Request) bool {
+	err := h.fileService.AcquireUploadSlot(r.Context())
+	if err == nil {
+		return true
+	}
+	if !errors.Is(err, services.ErrUploadsBusy) {
+		w.WriteHeader(statusClientClosed) // Gave up while queued
+		return false
+	}
+	h.metrics.Add("uploads_rejected_busy_total", 1)
+	w.Header().Set("Retry-After", strconv.Itoa(h.cfg.Concurrency.UploadQueueTimeoutSeconds))
+	h.sendError(w, http.StatusServiceUnavailable, "Too many uploads in progress, try again shortly")
+	return false
+}
+
+// sendSaveError answers an upload that SaveUpload refused
+func (h *Handlers) sendSaveError(w http.ResponseWriter, r *http.Request, category, filename string, transfer *services.Transfer, sums models.Checksums, err error) {
+	if errors.Is(err, services.ErrUploadAborted) {
+		h.uploadAborted(w, r, category, transfer)
+		return
+	}
+	if errors.Is(err, services.ErrManifestMismatch) {
+		h.logger.Printf("Checksum manifest mismatch for %s in [%s]: got sha256 %s", filename, category, sums.SHA256)
+		h.sendJSON(w, http.StatusBadRequest, models.ErrorResponse{
+			Error:   "Upload doesn't match the SHA-256 in the imported checksum manifest",
+			Code:    http.StatusBadRequest,
+			Details: fmt.Sprintf("Received SHA-256 %s", sums.SHA256),
+		})
+		return
+	}
+	if errors.Is(err, services.ErrChecksumMismatch) {
+		h.logger.Printf("Checksum mismatch for %s in [%s]: got sha256 %s", filename, category, sums.SHA256)
+		h.sendJSON(w, http.StatusBadRequest, models.ErrorResponse{
+			Error:   "Upload doesn't match its Digest or Content-MD5 header",
+			Code:    http.StatusBadRequest,
+			Details: fmt.Sprintf("Received SHA-256 %s, MD5 %s", sums.SHA256, sums.MD5),
+		})
 		return
 	}
+	var quarantined *services.QuarantineError
+	if errors.As(err, &quarantined) {
+		h.sendQuarantined(w, r, http.StatusUnprocessableEntity, "Upload refused: "+quarantined.File.Details, quarantined.File)
+		return
+	}
+	h.logger.Printf("Save error: %v", err)
+	if errors.Is(err, services.ErrScanFailed) {
+		h.sendError(w, http.StatusServiceUnavailable, "Upload could not be screened for malware, try again later")
+		return
+	}
+	if errors.Is(err, services.ErrInsufficientSpace) {
+		h.sendError(w, http.StatusInsufficientStorage, "Insufficient storage space")
+		return
+	}
+	h.sendError(w, http.StatusInternalServerError, h.cfg.GetText().UploadFailed)
+}
 
-	category := r.URL.Query().Get("category")
-	filename := r.URL.Query().Get("filename")
+// limitUploadBody applies the size limit, the minimum rate and the client's
+// bandwidth budget to an upload body; done must be called once the upload
+// is over, and may be called again
+func (h *Handlers) limitUploadBody(w http.ResponseWriter, r *http.Request, limit int64) (slow *minRateReader, done func()) {
+	// Slow clients give their slot back instead of holding it for the whole read timeout
+	if kbps := h.cfg.Concurrency.UploadMinKBps; kbps > 0 {
+		window := time.Duration(h.cfg.Concurrency.UploadMinRateMinutes) * time.Minute
+		slow = newMinRateReader(w, r.Body, kbps, window, time.Duration(h.cfg.Server.ReadTimeoutMinutes)*time.Minute)
+		r.Body = slow
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, limit)
+
+	// One client's uploads share its bandwidth, leaving the uplink to downloads
+	release := func() {}
+	if kbps := h.cfg.UploadKBpsFor(middleware.Identity(r)); kbps > 0 {
+		client := "key:" + middleware.Identity(r)
+		if h.cfg.Concurrency.UploadThrottleBy == "ip" {
+			client = "ip:" + clientHost(r)
+		}
+		r.Body, release = h.uploads.reader(r.Context(), client, int64(kbps)*1024, r.Body)
+		h.metrics.Add("uploads_throttled_total", 1)
+	}
+	var once sync.Once
+	return slow, func() {
+		once.Do(func() {
+			release()
+			if slow != nil {
+				slow.stop()
+			}
+		})
+	}
+}
+
+// checkUploadContent checks that an upload is what its name and category
+// say: a whole ZIP, a well-formed Android image or a readable APK. The
+// error says what is wrong, fit to show the client.
+func (h *Handlers) checkUploadContent(category, filename string, file io.ReaderAt, size int64) (image *models.ImageInfo, apk *models.APKInfo, err error) {
+	// Validate ZIP magic bytes
+	header := make([]byte, 4)
+	if _, err := file.ReadAt(header, 0); err != nil {
+		return nil, nil, errors.New(h.cfg.GetText().InvalidFile)
+	}
+
+	ext := filepath.Ext(filename)
+	// Only zips have a structure to check; other types (e.g. .img) pass as-is
+	if strings.EqualFold(ext, ".zip") && services.ValidateZip(file, size) != nil {
+		h.logger.Printf("Security Alert: Invalid ZIP signature for %s", filename)
+		return nil, nil, errors.New("Invalid file format (Not a real ZIP)")
+	}
+	// Boot, recovery, vendor_boot and vbmeta images must match their header
+	if strings.EqualFold(ext, ".img") {
+		if image, err = services.InspectImage(file, size); err != nil {
+			h.logger.Printf("Rejected image %s: %v", filename, err)
+			return nil, nil, err
+		}
+	}
+	// Everything in an APK category must be an APK we can read
+	if h.cfg.IsAPKCategory(category) {
+		if apk, err = services.InspectAPK(file, size); err != nil {
+			h.logger.Printf("Rejected APK %s: %v", filename, err)
+			return nil, nil, err
+		}
+	}
+	return image, apk, nil
+}
+
+// quarantineUpload sets aside an upload that failed checkUploadContent and
+// answers 400 with why and where it went
+func (h *Handlers) quarantineUpload(w http.ResponseWriter, r *http.Request, category, filename string, file io.ReaderAt, size int64, reason error) {
+	item, err := h.fileService.QuarantineUpload(category, filename, io.NewSectionReader(file, 0, size), middleware.Identity(r), services.QuarantineInvalid, reason.Error())
+	if err != nil {
+		h.logger.Printf("Failed to quarantine %s/%s: %v", category, filename, err)
+		h.sendError(w, http.StatusBadRequest, reason.Error())
+		return
+	}
+	h.sendQuarantined(w, r, http.StatusBadRequest, reason.Error(), item)
+}
+
+// sendQuarantined answers an upload that went to quarantine
+func (h *Handlers) sendQuarantined(w http.ResponseWriter, r *http.Request, status int, message string, item models.QuarantinedFile) {
+	h.logger.Printf("Quarantined %s/%s as %s (%s): %s", item.Category, item.Filename, item.ID, item.Reason, item.Details)
+	h.metrics.Add("uploads_quarantined_total", 1)
+	h.recordAudit(r, "file.quarantine", item.Category+"/"+item.Filename, item.ID+": "+item.Reason)
+	h.sendJSON(w, status, models.ErrorResponse{
+		Error:        message,
+		Code:         status,
+		Details:      "The upload was quarantined for review by an admin",
+		QuarantineID: item.ID,
+	})
+}
+
+// uploadTooSlow answers an upload cut off for sending under
+// concurrency.upload_min_kbps. The connection is closed, since the rest of
+// the body is still in flight.
+func (h *Handlers) uploadTooSlow(w http.ResponseWriter, r *http.Request, category string, received int64) {
+	h.logger.Printf("Upload too slow: %s from %s sent %s, under %d KB/s", category, middleware.LoggedIP(r), services.FormatSize(received), h.cfg.Concurrency.UploadMinKBps)
+	h.metrics.Add("uploads_too_slow_total", 1)
+	w.Header().Set("Connection", "close")
+	h.sendError(w, http.StatusRequestTimeout, fmt.Sprintf("Upload sent less than %d KB/s over %d min and was cut off", h.cfg.Concurrency.UploadMinKBps, h.cfg.Concurrency.UploadMinRateMinutes))
+}
+
+// releaseInfoFromForm reads the optional "metadata" part of an upload, sent
+// either as a plain field or as a JSON file (curl -F metadata=@release.json)
+func releaseInfoFromForm(form *multipart.Form) (*models.ReleaseInfo, error) {
+	if form == nil {
+		return nil, nil
+	}
+
+	var data []byte
+	if values := form.Value["metadata"]; len(values) > 0 {
+		data = []byte(values[0])
+	} else if files := form.File["metadata"]; len(files) > 0 {
+		f, err := files[0].Open()
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		if data, err = io.ReadAll(io.LimitReader(f, services.MaxReleaseInfoSize+1)); err != nil {
+			return nil, err
+		}
+	} else {
+		return nil, nil
+	}
+
+	if len(data) > services.MaxReleaseInfoSize {
+		return nil, fmt.Errorf("release metadata is larger than %d KB", services.MaxReleaseInfoSize>>10)
+	}
+	return services.ParseReleaseInfo(data)
+}
+
+// presignUpload returns a presigned PUT URL and the matching finalize callback
+func (h *Handlers) presignUpload(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	category := q.Get("category")
+	safeFilename := services.SanitizeFilename(q.Get("filename"))
+	v := h.validator()
+	if v.category("category", category) {
+		v.filename("filename", category, safeFilename)
+	}
+	if h.sendInvalid(w, v) {
+		return
+	}
+
+	resp, err := h.fileService.PresignUpload(category, safeFilename, q.Get("sha256"))
+	if err != nil {
+		if errors.Is(err, services.ErrNoObjectStore) {
+			h.sendError(w, http.StatusNotImplemented, "Direct uploads are not enabled")
+			return
+		}
+		h.sendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	finalize := url.Values{}
+	finalize.Set("category", category)
+	finalize.Set("filename", safeFilename)
+	finalize.Set("key", resp.ObjectKey)
+	if sum := q.Get("sha256"); sum != "" {
+		finalize.Set("sha256", sum)
+	}
+	resp.FinalizeURL = "/upload/finalize?" + finalize.Encode()
+
+	h.sendJSON(w, http.StatusOK, resp)
+}
+
+// FinalizeUpload publishes a file the client uploaded to a presigned URL
+func (h *Handlers) FinalizeUpload(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	category := q.Get("category")
+	safeFilename := services.SanitizeFilename(q.Get("filename"))
+	v := h.validator()
+	if v.category("category", category) {
+		v.filename("filename", category, safeFilename)
+	}
+	v.required("key", q.Get("key"))
+	if h.sendInvalid(w, v) {
+		return
+	}
+
+	inspect := func(file io.ReaderAt, size int64) (*models.ImageInfo, *models.APKInfo, error) {
+		return h.checkUploadContent(category, safeFilename, file, size)
+	}
+	sums, err := h.fileService.FinalizeUpload(category, safeFilename, q.Get("key"), q.Get("sha256"), middleware.Identity(r), inspect)
+	if err != nil {
+		var quarantined *services.QuarantineError
+		switch {
+		case errors.Is(err, services.ErrNoObjectStore):
+			h.sendError(w, http.StatusNotImplemented, "Direct uploads are not enabled")
+		case errors.As(err, &quarantined) && quarantined.File.Reason == services.QuarantineInvalid:
+			h.sendQuarantined(w, r, http.StatusBadRequest, quarantined.File.Details, quarantined.File)
+		case errors.Is(err, services.ErrManifestMismatch), errors.As(err, &quarantined),
+			errors.Is(err, services.ErrScanFailed), errors.Is(err, services.ErrInsufficientSpace):
+			h.sendSaveError(w, r, category, safeFilename, nil, sums, err)
+		case errors.Is(err, services.ErrChecksumMismatch):
+			h.logger.Printf("Checksum mismatch for %s in [%s]: got sha256 %s", safeFilename, category, sums.SHA256)
+			h.sendJSON(w, http.StatusBadRequest, models.ErrorResponse{
+				Error:   "Uploaded object doesn't match the sha256 given",
+				Code:    http.StatusBadRequest,
+				Details: fmt.Sprintf("Received SHA-256 %s", sums.SHA256),
+			})
+		default:
+			status, err := h.fileError(err)
+			h.sendError(w, status, err.Error())
+		}
+		return
+	}
+
+	h.logger.Printf("Success: Published %s to [%s] from object store", safeFilename, category)
+	h.recordAudit(r, "file.upload", category+"/"+safeFilename, "object_store")
+
+	h.sendJSON(w, http.StatusOK, models.UploadResponse{
+		Success:  true,
+		Message:  h.cfg.GetText().UploadSuccess,
+		Filename: safeFilename,
+		Category: category,
+		SHA256:   sums.SHA256,
+	})
+}
+
+// AdminConfig shows the runtime settings: categories, allowed extensions,
+// rate limits, text and maintenance mode
+func (h *Handlers) AdminConfig(w http.ResponseWriter, r *http.Request) {
+	h.sendJSON(w, http.StatusOK, h.cfg.Runtime())
+}
+
+// PatchConfig partially updates the runtime settings
+func (h *Handlers) PatchConfig(w http.ResponseWriter, r *http.Request) {
+	patch, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+	if err != nil {
+		h.sendError(w, http.StatusBadRequest, "Failed to read body")
+		return
+	}
+
+	settings, err := h.cfg.PatchRuntime(patch)
+	if err != nil {
+		h.sendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := h.fileService.ApplyConfigChange(); err != nil {
+		h.logger.Printf("Failed to apply config change: %v", err)
+	}
+
+	h.logger.Printf("Runtime config updated")
+	h.recordAudit(r, "config.update", "config", string(patch))
+	h.sendJSON(w, http.StatusOK, settings)
+}
+
+// ReadOnly rejects write endpoints on a read-only mirror
+func (h *Handlers) ReadOnly(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		h.sendError(w, http.StatusForbidden, "This instance is a read-only mirror")
+	}
+}
+
+// Activity feed page sizes
+const (
+	defaultActivityLimit = 50
+	maxActivityLimit     = 500
+)
+
+// AdminActivity returns recent uploads, deletes, config changes and failed
+// logins in one feed, newest first (?limit=, ?since= RFC 3339)
+func (h *Handlers) AdminActivity(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	v := h.validator()
+	limit := defaultActivityLimit
+	if s := q.Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 {
+			v.fail("limit", "must be a positive number")
+		}
+		limit = min(n, maxActivityLimit)
+	}
+	since := v.timestamp("since", q.Get("since"))
+	if h.sendInvalid(w, v) {
+		return
+	}
+
+	events, err := h.activity.Recent(limit, since)
+	if err != nil {
+		h.logger.Printf("Failed to read activity: %v", err)
+		h.sendError(w, http.StatusInternalServerError, h.cfg.GetText().ServerError)
+		return
+	}
+	h.sendJSON(w, http.StatusOK, events)
+}
+
+// maxBackupUpload bounds a backup archive sent for restore
+const maxBackupUpload = 4 << 30
+
+// ExportBackup sends server state as a tar.gz
+func (h *Handlers) ExportBackup(w http.ResponseWriter, r *http.Request) {
+	name := "photon-backup-" + time.Now().UTC().Format("20060102-150405") + ".tar.gz"
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Content-Disposition", attachment(name))
+	w.Header().Set("Cache-Control", "no-store")
+	if err := h.fileService.WriteBackup(w); err != nil {
+		// Headers are gone already; the client gets a truncated archive
+		h.logger.Printf("Backup failed: %v", err)
+		return
+	}
+	h.recordAudit(r, "backup.export", name, "")
+}
+
+// RestoreBackup replaces server state with a backup sent as the request body
+func (h *Handlers) RestoreBackup(w http.ResponseWriter, r *http.Request) {
+	restored, err := h.fileService.RestoreBackup(http.MaxBytesReader(w, r.Body, maxBackupUpload), services.BackupStores{
+		Announcements: h.announce,
+		Feedback:      h.feedback,
+		Pages:         h.pages,
+		Ratings:       h.ratings,
+		Keys:          h.keys,
+		Testers:       h.testers,
+		Audit:         h.audit,
+	})
+	if err != nil {
+		h.logger.Printf("Restore failed after %v: %v", restored, err)
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			h.sendTooLarge(w, tooLarge.Limit)
+			return
+		}
+		status := http.StatusBadRequest
+		if errors.Is(err, services.ErrClusterRestore) {
+			status = http.StatusConflict
+		}
+		h.sendError(w, status, err.Error())
+		return
+	}
+
+	h.logger.Printf("Restored backup: %s", strings.Join(restored, ", "))
+	h.recordAudit(r, "backup.restore", "backup", strings.Join(restored, ","))
+	h.sendJSON(w, http.StatusOK, map[string]interface{}{"restored": restored})
+}
+
+// ListAnnouncements returns all download page banners, expired included
+func (h *Handlers) ListAnnouncements(w http.ResponseWriter, r *http.Request) {
+	items, err := h.announce.All()
+	if err != nil {
+		h.logger.Printf("Failed to read announcements: %v", err)
+		h.sendError(w, http.StatusInternalServerError, h.cfg.GetText().ServerError)
+		return
+	}
+	h.sendJSON(w, http.StatusOK, items)
+}
+
+// CreateAnnouncement adds a download page banner
+func (h *Handlers) CreateAnnouncement(w http.ResponseWriter, r *http.Request) {
+	h.saveAnnouncement(w, r, "announcement.create", h.announce.Create)
+}
+
+// UpdateAnnouncement replaces the banner at /{id} (or ?id=)
+func (h *Handlers) UpdateAnnouncement(w http.ResponseWriter, r *http.Request) {
+	id := pathID(r)
+	h.saveAnnouncement(w, r, "announcement.update", func(req models.AnnouncementRequest) (models.Announcement, error) {
+		return h.announce.Update(id, req)
+	})
+}
 
-	if category == "" || filename == "" {
-		h.sendError(w, http.StatusBadRequest, "Category and filename required")
+// saveAnnouncement decodes a banner and stores it with save
+func (h *Handlers) saveAnnouncement(w http.ResponseWriter, r *http.Request, action string, save func(models.AnnouncementRequest) (models.Announcement, error)) {
+	var req models.AnnouncementRequest
+	if err := json.NewDecoder(io.LimitReader(r.Body, 1<<20)).Decode(&req); err != nil {
+		h.sendError(w, http.StatusBadRequest, "Invalid JSON body")
+		return
+	}
+
+	item, err := save(req)
+	if errors.Is(err, services.ErrNotFound) {
+		h.sendError(w, http.StatusNotFound, "Announcement not found")
+		return
+	}
+	var invalid *services.InvalidField
+	if errors.As(err, &invalid) {
+		h.sendFieldErrors(w, fieldErrors{{Field: invalid.Field, Message: invalid.Message}})
+		return
+	}
+	if err != nil {
+		h.sendError(w, http.StatusBadRequest, err.Error())
 		return
 	}
 
-	if !h.cfg.IsValidCategory(category) {
-		h.sendError(w, http.StatusBadRequest, "Invalid category")
+	h.recordAudit(r, action, item.ID, item.Severity+": "+item.Message)
+	h.sendJSON(w, http.StatusOK, item)
+}
+
+// DeleteAnnouncement removes the banner at /{id} (or ?id=)
+func (h *Handlers) DeleteAnnouncement(w http.ResponseWriter, r *http.Request) {
+	id := pathID(r)
+	if err := h.announce.Delete(id); err != nil {
+		if errors.Is(err, services.ErrNotFound) {
+			h.sendError(w, http.StatusNotFound, "Announcement not found")
+			return
+		}
+		h.logger.Printf("Failed to delete announcement: %v", err)
+		h.sendError(w, http.StatusInternalServerError, h.cfg.GetText().ServerError)
+		return
+	}
+	h.recordAudit(r, "announcement.delete", id, "")
+	h.sendJSON(w, http.StatusOK, map[string]string{"message": "Announcement deleted"})
+}
+
+// Maintenance answers 503 with the configured message while maintenance
+// mode is on. Checked per request, so toggling it needs no restart.
+func (h *Handlers) Maintenance(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m := h.cfg.GetMaintenance()
+		if !m.Enabled {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if m.RetryAfterSeconds > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(m.RetryAfterSeconds))
+		}
+		message := m.Message
+		if message == "" {
+			message = "Down for maintenance"
+		}
+		h.sendError(w, http.StatusServiceUnavailable, message)
+	})
+}
+
+// Delete handles file deletion requests
+func (h *Handlers) Delete(w http.ResponseWriter, r *http.Request) {
+	category := r.URL.Query().Get("category")
+	filename := services.NormalizeFilename(r.URL.Query().Get("filename"))
+
+	v := h.validator()
+	v.target(category, filename)
+	if h.sendInvalid(w, v) {
 		return
 	}
 
@@ -193,39 +1137,583 @@ func (h *Handlers) Delete(w http.ResponseWriter, r *http.Request) {
 	}
 
 	h.logger.Printf("Deleted: %s from [%s]", filename, category)
+	h.recordAudit(r, "file.delete", category+"/"+filename, "")
 	h.sendJSON(w, http.StatusOK, map[string]string{"message": "File deleted"})
 }
 
+// MoveFile moves a file to another category and/or renames it
+func (h *Handlers) MoveFile(w http.ResponseWriter, r *http.Request) {
+	var req models.MoveRequest
+	if err := json.NewDecoder(io.LimitReader(r.Body, 1<<20)).Decode(&req); err != nil {
+		h.sendError(w, http.StatusBadRequest, "Invalid JSON body")
+		return
+	}
+
+	status, err := h.moveFile(&req)
+	var fields fieldErrors
+	if errors.As(err, &fields) {
+		h.sendFieldErrors(w, fields)
+		return
+	}
+	if err != nil {
+		h.sendError(w, status, err.Error())
+		return
+	}
+
+	from := req.Category + "/" + req.Filename
+	to := req.ToCategory + "/" + req.ToFilename
+	h.logger.Printf("Moved: %s -> %s", from, to)
+	h.recordAudit(r, "file.move", from, to)
+	h.sendJSON(w, http.StatusOK, map[string]string{
+		"message":  "File moved",
+		"category": req.ToCategory,
+		"filename": req.ToFilename,
+	})
+}
+
+// moveFile validates a move request, filling in defaulted destination fields,
+// and performs it. The returned status applies when err is non-nil.
+func (h *Handlers) moveFile(req *models.MoveRequest) (int, error) {
+	if status, err := h.validateMove(req); err != nil {
+		return status, err
+	}
+	return h.fileError(h.fileService.MoveFile(req.Category, req.Filename, req.ToCategory, req.ToFilename))
+}
+
+// validateMove checks a move request and fills in defaulted destination
+// fields. Problems come back as fieldErrors.
+func (h *Handlers) validateMove(req *models.MoveRequest) (int, error) {
+	req.Filename = services.NormalizeFilename(req.Filename)
+	req.ToFilename = services.NormalizeFilename(req.ToFilename)
+	if req.ToCategory == "" {
+		req.ToCategory = req.Category
+	}
+	if req.ToFilename == "" {
+		req.ToFilename = req.Filename
+	}
+
+	v := h.validator()
+	v.target(req.Category, req.Filename)
+	if v.category("to_category", req.ToCategory) && req.Filename != "" {
+		v.filename("to_filename", req.ToCategory, req.ToFilename)
+	}
+	if err := v.err(); err != nil {
+		return http.StatusBadRequest, err
+	}
+	return http.StatusOK, nil
+}
+
+// fileError maps a file operation error to a status and client message
+func (h *Handlers) fileError(err error) (int, error) {
+	switch {
+	case err == nil:
+		return http.StatusOK, nil
+	case errors.Is(err, services.ErrNotFound):
+		return http.StatusNotFound, errors.New("File not found")
+	case errors.Is(err, services.ErrFileExists), errors.Is(err, services.ErrInTransaction):
+		return http.StatusConflict, err
+	case errors.Is(err, services.ErrInvalid), errors.As(err, new(*services.InvalidField)):
+		return http.StatusBadRequest, err
+	default:
+		h.logger.Printf("File operation error: %v", err)
+		return http.StatusInternalServerError, errors.New(h.cfg.GetText().ServerError)
+	}
+}
+
+// maxBulkOperations bounds a single bulk request
+const maxBulkOperations = 1000
+
+// UpdateFileMetadata changes a file's tags and attributes
+func (h *Handlers) UpdateFileMetadata(w http.ResponseWriter, r *http.Request) {
+	var patch models.LabelPatch
+	if err := json.NewDecoder(io.LimitReader(r.Body, 1<<20)).Decode(&patch); err != nil {
+		h.sendError(w, http.StatusBadRequest, "Invalid JSON body")
+		return
+	}
+	v := h.validator()
+	patch.Filename = services.NormalizeFilename(patch.Filename)
+	v.target(patch.Category, patch.Filename)
+	if h.sendInvalid(w, v) {
+		return
+	}
+
+	meta, err := h.fileService.UpdateLabels(patch.Category, patch.Filename, patch)
+	if status, err := h.fileError(err); err != nil {
+		h.sendError(w, status, err.Error())
+		return
+	}
+
+	h.recordAudit(r, "file.metadata", patch.Category+"/"+patch.Filename, "")
+	h.sendJSON(w, http.StatusOK, map[string]interface{}{
+		"category":   patch.Category,
+		"filename":   patch.Filename,
+		"tags":       meta.Tags,
+		"attributes": meta.Attributes,
+		"notes":      meta.Notes,
+	})
+}
+
+// PendingFiles lists uploads that aren't public yet
+func (h *Handlers) PendingFiles(w http.ResponseWriter, r *http.Request) {
+	files := h.fileService.PendingFiles()
+	h.sendJSON(w, http.StatusOK, map[string]interface{}{"files": files, "total_count": len(files)})
+}
+
+// DiscardPending deletes an upload that isn't public yet, or with
+// ?transaction= every upload held in that transaction
+func (h *Handlers) DiscardPending(w http.ResponseWriter, r *http.Request) {
+	if name := r.URL.Query().Get("transaction"); name != "" {
+		h.discardTransaction(w, r, name)
+		return
+	}
+	category := r.URL.Query().Get("category")
+	filename := services.NormalizeFilename(r.URL.Query().Get("filename"))
+	v := h.validator()
+	v.target(category, filename)
+	if h.sendInvalid(w, v) {
+		return
+	}
+
+	if status, err := h.fileError(h.fileService.CancelPending(category, filename)); err != nil {
+		h.sendError(w, status, err.Error())
+		return
+	}
+	h.logger.Printf("Cancelled pending %s in [%s]", filename, category)
+	h.recordAudit(r, "file.cancel", category+"/"+filename, "")
+	h.sendJSON(w, http.StatusOK, map[string]string{"message": "Pending upload discarded"})
+}
+
+// PublishFile makes a staged or scheduled upload public now, atomically
+// replacing the live file of the same name, or a whole transaction of them
+func (h *Handlers) PublishFile(w http.ResponseWriter, r *http.Request) {
+	var req models.PublishRequest
+	if err := json.NewDecoder(io.LimitReader(r.Body, 1<<20)).Decode(&req); err != nil {
+		h.sendError(w, http.StatusBadRequest, "Invalid JSON body")
+		return
+	}
+	if req.Transaction != "" {
+		h.publishTransaction(w, r, req.Transaction)
+		return
+	}
+	v := h.validator()
+	req.Filename = services.NormalizeFilename(req.Filename)
+	v.target(req.Category, req.Filename)
+	if h.sendInvalid(w, v) {
+		return
+	}
+
+	if status, err := h.fileError(h.fileService.PublishPending(req.Category, req.Filename)); err != nil {
+		h.sendError(w, status, err.Error())
+		return
+	}
+
+	h.logger.Printf("Published %s to [%s]", req.Filename, req.Category)
+	h.recordAudit(r, "file.publish", req.Category+"/"+req.Filename, "")
+	h.sendJSON(w, http.StatusOK, req)
+}
+
+// Preview serves a held upload to whoever has its preview link
+// (/preview/{token}/{filename}). Previews aren't counted or cached.
+func (h *Handlers) Preview() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		filename := services.NormalizeFilename(r.PathValue("filename"))
+		if !validPathName(filename) {
+			http.NotFound(w, r)
+			return
+		}
+
+		path, ok := h.fileService.PreviewPath(r.PathValue("token"), filename)
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		defer f.Close()
+		info, err := f.Stat()
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		defer h.fileService.ReleaseDownloadSlot(h.fileService.AcquireDownloadSlot(info.Size()))
+
+		w.Header().Set("Cache-Control", "private, no-store")
+		w.Header().Set("X-Robots-Tag", "noindex")
+		w.Header().Set("Content-Disposition", attachment(filename))
+		http.ServeContent(w, r, filename, info.ModTime(), f)
+	})
+}
+
+// PinFile pins or unpins a file so automatic cleanup never removes it
+func (h *Handlers) PinFile(w http.ResponseWriter, r *http.Request) {
+	var req models.PinRequest
+	if err := json.NewDecoder(io.LimitReader(r.Body, 1<<20)).Decode(&req); err != nil {
+		h.sendError(w, http.StatusBadRequest, "Invalid JSON body")
+		return
+	}
+	v := h.validator()
+	req.Filename = services.NormalizeFilename(req.Filename)
+	v.target(req.Category, req.Filename)
+	if h.sendInvalid(w, v) {
+		return
+	}
+
+	if status, err := h.fileError(h.fileService.SetPinned(req.Category, req.Filename, req.Pinned)); err != nil {
+		h.sendError(w, status, err.Error())
+		return
+	}
+
+	action := "file.unpin"
+	if req.Pinned {
+		action = "file.pin"
+	}
+	h.recordAudit(r, action, req.Category+"/"+req.Filename, "")
+	h.sendJSON(w, http.StatusOK, req)
+}
+
+// Bulk runs several delete/move/pin operations in one request and one lock,
+// reporting a result per item
+func (h *Handlers) Bulk(w http.ResponseWriter, r *http.Request) {
+	var req models.BulkRequest
+	if err := json.NewDecoder(io.LimitReader(r.Body, 4<<20)).Decode(&req); err != nil {
+		h.sendError(w, http.StatusBadRequest, "Invalid JSON body")
+		return
+	}
+	if len(req.Operations) == 0 || len(req.Operations) > maxBulkOperations {
+		h.sendFieldErrors(w, fieldErrors{{Field: "operations", Message: fmt.Sprintf("must have between 1 and %d items", maxBulkOperations)}})
+		return
+	}
+
+	// Validate everything up front; only valid items reach the file service
+	results := make([]models.BulkResult, len(req.Operations))
+	var valid []models.BulkOperation
+	var index []int
+	for i, op := range req.Operations {
+		status, err := h.validateBulkOp(&op)
+		results[i] = models.BulkResult{BulkOperation: op, Status: status}
+		if err != nil {
+			results[i].Error = err.Error()
+			var fields fieldErrors
+			if errors.As(err, &fields) {
+				results[i].Fields = fields
+			}
+			continue
+		}
+		valid = append(valid, op)
+		index = append(index, i)
+	}
+
+	for j, err := range h.fileService.Bulk(valid) {
+		res := &results[index[j]]
+		if status, msg := h.fileError(err); msg != nil {
+			res.Status, res.Error = status, msg.Error()
+			continue
+		}
+		res.Success = true
+		target := res.Category + "/" + res.Filename
+		switch res.Op {
+		case services.BulkDelete:
+			h.recordAudit(r, "file.delete", target, "bulk")
+		case services.BulkMove:
+			h.recordAudit(r, "file.move", target, res.ToCategory+"/"+res.ToFilename)
+		case services.BulkPin, services.BulkUnpin:
+			h.recordAudit(r, "file."+res.Op, target, "bulk")
+		}
+	}
+
+	resp := models.BulkResponse{Results: results}
+	for _, res := range results {
+		if res.Success {
+			resp.Succeeded++
+		} else {
+			resp.Failed++
+		}
+	}
+	h.logger.Printf("Bulk: %d succeeded, %d failed", resp.Succeeded, resp.Failed)
+	h.sendJSON(w, http.StatusOK, resp)
+}
+
+// validateBulkOp checks one bulk item, filling in move defaults
+func (h *Handlers) validateBulkOp(op *models.BulkOperation) (int, error) {
+	v := h.validator()
+	switch op.Op {
+	case services.BulkDelete, services.BulkPin, services.BulkUnpin:
+		op.Filename = services.NormalizeFilename(op.Filename)
+		v.target(op.Category, op.Filename)
+	case services.BulkMove:
+		move := models.MoveRequest{Category: op.Category, Filename: op.Filename, ToCategory: op.ToCategory, ToFilename: op.ToFilename}
+		status, err := h.validateMove(&move)
+		op.Filename, op.ToCategory, op.ToFilename = move.Filename, move.ToCategory, move.ToFilename
+		return status, err
+	default:
+		v.fail("op", "unknown operation %q (use delete, move, pin or unpin)", op.Op)
+	}
+	if err := v.err(); err != nil {
+		return http.StatusBadRequest, err
+	}
+	return http.StatusOK, nil
+}
+
 // ServeDownload serves files with concurrency control
-func (h *Handlers) ServeDownload(baseDir string) http.Handler {
-	fileServer := http.FileServer(http.Dir(baseDir))
-	
+func (h *Handlers) ServeDownload() http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Acquire download slot
-		h.fileService.AcquireDownloadSlot()
-		defer h.fileService.ReleaseDownloadSlot()
-
-		// Track download stats (Best effort, ignore errors)
-		// URL is /downloads/category/filename
-		parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/downloads/"), "/")
-		if len(parts) >= 2 {
-			category := parts[0]
-			filename := parts[1]
-			// Handle potential URL encoding
-			if decoded, err := url.QueryUnescape(filename); err == nil {
-				filename = decoded
+		category, filename := r.PathValue("category"), services.NormalizeFilename(r.PathValue("filename"))
+		if !h.cfg.IsValidCategory(category) || !validPathName(filename) {
+			http.NotFound(w, r)
+			return
+		}
+		// Beta builds don't exist for anyone off the allowlist
+		if !h.viewer(r).sees(h, category) {
+			http.NotFound(w, r)
+			return
+		}
+
+		// Only published builds are reachable (not stats.json, audit.log, ...)
+		if !h.cfg.IsAllowedExtensionFor(category, filepath.Ext(filename)) {
+			http.NotFound(w, r)
+			return
+		}
+
+		// Once the monthly cap is spent, send users to the mirror instead
+		capReached := h.fileService.TrafficCapReached()
+		if capReached && h.cfg.Traffic.CapAction == "redirect" {
+			target := strings.TrimSuffix(h.cfg.Traffic.MirrorURL, "/") + "/" + url.PathEscape(category) + "/" + url.PathEscape(filename)
+			http.Redirect(w, r, target, http.StatusFound)
+			return
+		}
+
+		// Builds uploaded straight to the bucket are downloaded from it too
+		if target, ok := h.fileService.RemoteURL(category, filename); ok {
+			if firstSegment(r) {
+				client := services.ClassifyUserAgent(r.UserAgent(), h.cfg.Analytics)
+				h.fileService.IncrementDownloadCount(category, filename, client)
 			}
-			h.fileService.IncrementDownloadCount(category, filename)
+			http.Redirect(w, r, target, http.StatusFound)
+			return
+		}
+
+		stat, err := h.fileService.StatFile(category, filename)
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+
+		// Segmented downloaders open many connections at once. Each address
+		// gets max_segments_per_client, before taking a download slot, and
+		// is told to retry the rest.
+		ip := clientHost(r)
+		if !h.fileService.AcquireSegment(ip) {
+			h.metrics.Add("downloads_rejected_segments_total", 1)
+			w.Header().Set("Retry-After", "5")
+			h.sendError(w, http.StatusServiceUnavailable, "Too many parallel connections; retry this segment later")
+			return
+		}
+		defer h.fileService.ReleaseSegment(ip)
+
+		// Acquire a download slot; small files have their own, so they never
+		// wait behind builds
+		defer h.fileService.ReleaseDownloadSlot(h.fileService.AcquireDownloadSlot(stat.Size))
+
+		f, err := os.Open(stat.Path)
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		defer f.Close()
+
+		// Track download stats (Best effort, ignore errors). A segmented
+		// download counts once, for the segment at the start of the file.
+		if firstSegment(r) {
+			client := services.ClassifyUserAgent(r.UserAgent(), h.cfg.Analytics)
+			h.fileService.IncrementDownloadCount(category, filename, client)
+		}
+
+		// Add download-specific headers (edge TTLs when fronted by a CDN)
+		if h.cfg.IsRestricted(category) {
+			w.Header().Set("Cache-Control", "private, no-store") // Shared caches can't check tokens
+		} else {
+			h.cdn.SetCacheHeaders(w.Header(), h.cfg.IsImmutable(category, filename))
+		}
+		// Keep the exact (e.g. CJK) name when saved, whatever the URL looked like
+		w.Header().Set("Content-Disposition", attachment(filename))
+
+		// Instance digest (RFC 3230) for end-to-end verification, and an ETag
+		// from the same hash so If-Range and If-None-Match don't depend on mtime
+		if sums, ok := h.fileService.Checksums(category, filename); ok {
+			h.setDigestHeaders(w.Header(), sums)
+			w.Header().Set("ETag", services.ContentETag(sums))
+		} else {
+			w.Header().Set("ETag", services.StatETag(stat.Size, stat.ModTime))
+		}
+		// Advertised on every answer, HEAD and 304 included, so downloaders
+		// know up front that they may split the file
+		w.Header().Set("Accept-Ranges", "bytes")
+
+		transfer := h.fileService.StartTransfer(services.TransferDownload, category, filename, middleware.LoggedIP(r), "", stat.Size, abortFunc(w))
+		defer transfer.Done()
+
+		counter := &countingWriter{ResponseWriter: w, status: http.StatusOK, transfer: transfer}
+		var out http.ResponseWriter = counter
+		if capReached {
+			out = newThrottledWriter(counter, int64(h.cfg.Traffic.ThrottleKBps)*1024)
+		}
+
+		// Serve the file (ranges, conditional requests and sendfile handled by net/http)
+		http.ServeContent(out, r, filename, stat.ModTime, f)
+
+		h.fileService.AddTraffic(category, counter.written)
+		// One complete download proves the build; a kept previous one can go
+		if counter.status == http.StatusOK && counter.written == stat.Size {
+			h.fileService.ConfirmBuild(category, filename)
 		}
 
-		// Add download-specific headers
-		w.Header().Set("Cache-Control", "public, max-age=3600")
-		
-		// Serve the file
-		http.StripPrefix("/downloads/", fileServer).ServeHTTP(w, r)
+		// Record which copy path served the body
+		switch {
+		case !counter.served():
+		case counter.buffered:
+			h.metrics.Add("downloads_buffered_total", 1)
+		case counter.zeroCopy:
+			h.metrics.Add("downloads_zero_copy_total", 1)
+		}
+		h.metrics.Add("download_bytes_total", counter.written)
 	})
 }
 
+// firstSegment reports whether a download request fetches the start of the
+// file: a plain GET, or a range from byte 0. Later segments of a segmented
+// download and resumes aren't counted again.
+func firstSegment(r *http.Request) bool {
+	spec := strings.TrimSpace(r.Header.Get("Range"))
+	return spec == "" || strings.HasPrefix(spec, "bytes=0-")
+}
+
+// clientHost is the client address without the port RemoteAddr carries, so
+// all connections from one machine add up
+func clientHost(r *http.Request) string {
+	addr := middleware.ClientIP(r)
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return addr
+}
+
+// ShortLink redirects /d/{code} to the build it was made for, counting the
+// visit by referring site. Link preview fetchers go to its landing page.
+func (h *Handlers) ShortLink(w http.ResponseWriter, r *http.Request) {
+	category, filename, ok := h.fileService.ResolveShortCode(r.PathValue("code"))
+	v := h.viewer(r)
+	if !ok || !v.sees(h, category) {
+		http.NotFound(w, r)
+		return
+	}
+	// A chat app fetching a preview gets the landing page, uncounted
+	if isPreviewAgent(r) {
+		http.Redirect(w, r, v.link(services.PreviewPath(category, filename)), http.StatusFound)
+		return
+	}
+	h.fileService.RecordShortLinkVisit(category, filename, services.ReferrerSite(r.Referer()))
+	w.Header().Set("Cache-Control", "no-store") // Every visit must reach us to be counted
+	http.Redirect(w, r, v.link(services.DownloadPath(category, filename)), http.StatusFound)
+}
+
+// Metrics exposes internal counters in the Prometheus text format
+func (h *Handlers) Metrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	active, queued := h.fileService.UploadQueue()
+	h.metrics.Set("uploads_active", active)
+	h.metrics.Set("upload_queue_depth", queued)
+	for _, class := range config.DownloadClasses {
+		active, queued := h.fileService.DownloadQueue(class)
+		h.metrics.Set("downloads_active_"+class, active)
+		h.metrics.Set("download_queue_depth_"+class, queued)
+	}
+	h.metrics.WritePrometheus(w)
+}
+
+// AdminTraffic reports monthly bytes served and the transfer cap status
+func (h *Handlers) AdminTraffic(w http.ResponseWriter, r *http.Request) {
+	h.sendJSON(w, http.StatusOK, h.fileService.GetTrafficReport())
+}
+
+// AdminTransfers lists in-flight uploads and downloads
+func (h *Handlers) AdminTransfers(w http.ResponseWriter, r *http.Request) {
+	h.sendJSON(w, http.StatusOK, h.fileService.Transfers())
+}
+
+// CancelTransfer cuts off the in-flight upload or download at /{id} (or ?id=)
+func (h *Handlers) CancelTransfer(w http.ResponseWriter, r *http.Request) {
+	info, err := h.fileService.CancelTransfer(pathID(r))
+	if errors.Is(err, services.ErrNotFound) {
+		h.sendError(w, http.StatusNotFound, "Transfer not found (it may have finished)")
+		return
+	}
+	if err != nil {
+		h.sendError(w, http.StatusConflict, err.Error())
+		return
+	}
+	target := info.Category
+	if info.Filename != "" {
+		target += "/" + info.Filename
+	}
+	h.recordAudit(r, "transfer.cancel", target,
+		fmt.Sprintf("%s from %s after %d bytes", info.Kind, info.Client, info.Bytes))
+	h.sendJSON(w, http.StatusOK, info)
+}
+
+// recordAudit writes an audit entry, logging rather than failing the request on error
+func (h *Handlers) recordAudit(r *http.Request, action, target, details string) {
+	actor := middleware.Anonymize(r, r.RemoteAddr)
+	if name := middleware.Identity(r); name != "" {
+		actor = name + "@" + actor
+	}
+	if err := h.audit.Record(action, actor, target, details); err != nil {
+		h.logger.Printf("Audit log error: %v", err)
+	}
+}
+
+// pathID returns the {id} path segment, falling back to ?id= for clients
+// of the older query form
+func pathID(r *http.Request) string {
+	if id := r.PathValue("id"); id != "" {
+		return id
+	}
+	return r.URL.Query().Get("id")
+}
+
+// validPathName reports whether a {filename} path value names a single file.
+// The mux unescapes it, so an encoded slash would otherwise reach the service.
+func validPathName(name string) bool {
+	return name != "" && name != "." && name != ".." && !strings.ContainsAny(name, "/\\")
+}
+
+// attachment builds a Content-Disposition for filename: a quoted ASCII
+// fallback plus, for other names, the RFC 5987 filename* browsers prefer
+func attachment(filename string) string {
+	fallback := strings.Map(func(r rune) rune {
+		if r < 0x20 || r >= 0x7f || r == '"' || r == '\\' {
+			return '_'
+		}
+		return r
+	}, filename)
+	if fallback == filename {
+		return `attachment; filename="` + filename + `"`
+	}
+
+	var enc strings.Builder
+	for _, c := range []byte(filename) {
+		switch {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9', strings.IndexByte("!#$&+-.^_`|~", c) >= 0:
+			enc.WriteByte(c)
+		default:
+			fmt.Fprintf(&enc, "%%%02X", c)
+		}
+	}
+	return `attachment; filename="` + fallback + `"; filename*=UTF-8''` + enc.String()
+}
+
 // sendJSON sends a JSON response
 func (h *Handlers) sendJSON(w http.ResponseWriter, status int, data interface{}) {
 	w.Header().Set("Content-Type", "application/json")
@@ -233,6 +1721,39 @@ func (h *Handlers) sendJSON(w http.ResponseWriter, status int, data interface{})
 	json.NewEncoder(w).Encode(data)
 }
 
+// sendTooLarge answers 413 with the limit the request body exceeded
+func (h *Handlers) sendTooLarge(w http.ResponseWriter, limit int64) {
+	h.sendJSON(w, http.StatusRequestEntityTooLarge, models.ErrorResponse{
+		Error:      h.cfg.GetText().FileTooLarge,
+		Code:       http.StatusRequestEntityTooLarge,
+		Details:    fmt.Sprintf("The limit is %s", services.FormatSize(limit)),
+		LimitBytes: limit,
+	})
+}
+
+// sendCachedJSON sends a JSON response with an ETag, answering 304 if the client copy is current
+func (h *Handlers) sendCachedJSON(w http.ResponseWriter, r *http.Request, data interface{}) {
+	body, err := json.Marshal(data)
+	if err != nil {
+		h.sendError(w, http.StatusInternalServerError, h.cfg.GetText().ServerError)
+		return
+	}
+
+	hash := fnv.New64a()
+	hash.Write(body)
+	etag := fmt.Sprintf(`W/"%x"`, hash.Sum64())
+	w.Header().Set("ETag", etag)
+
+	if middleware.ETagMatches(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(append(body, '\n'))
+}
+
 // sendError sends an error response
 func (h *Handlers) sendError(w http.ResponseWriter, status int, message string) {
 	resp := models.ErrorResponse{
@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"time"
+
+	"rom-server/internal/models"
+	"rom-server/internal/services"
+)
+
+// ListPages returns the device pages without their content
+func (h *Handlers) ListPages(w http.ResponseWriter, r *http.Request) {
+	index, err := h.pageIndex()
+	if err != nil {
+		h.logger.Printf("Failed to read pages: %v", err)
+		h.sendError(w, http.StatusInternalServerError, h.cfg.GetText().ServerError)
+		return
+	}
+	h.sendCachedJSON(w, r, index)
+}
+
+// pageIndex summarizes the device pages
+func (h *Handlers) pageIndex() ([]models.PageSummary, error) {
+	pages, err := h.pages.List()
+	if err != nil {
+		return nil, err
+	}
+	index := make([]models.PageSummary, 0, len(pages))
+	for _, p := range pages {
+		index = append(index, models.PageSummary{Device: p.Device, Title: p.Title, UpdatedAt: p.UpdatedAt, URL: "/api/v1/pages/" + p.Device})
+	}
+	return index, nil
+}
+
+// GetPage returns the page at /{device} with its Markdown rendered to HTML,
+// or the Markdown alone with ?format=markdown
+func (h *Handlers) GetPage(w http.ResponseWriter, r *http.Request) {
+	format := r.URL.Query().Get("format")
+	if format != "" && format != "json" && format != "markdown" {
+		h.sendFieldErrors(w, fieldErrors{{Field: "format", Message: "must be json or markdown"}})
+		return
+	}
+
+	page, err := h.pages.Get(r.PathValue("device"))
+	if err != nil {
+		h.sendPageError(w, err)
+		return
+	}
+	if format == "markdown" {
+		w.Header().Set("Content-Type", "text/markdown; charset=utf-8")
+		if updated, err := time.Parse(time.RFC3339, page.UpdatedAt); err == nil {
+			w.Header().Set("Last-Modified", updated.UTC().Format(http.TimeFormat))
+		}
+		io.WriteString(w, page.Content+"\n")
+		return
+	}
+	page.HTML = services.RenderMarkdown(page.Content)
+	h.sendCachedJSON(w, r, page)
+}
+
+// SavePage creates or replaces the page at /{device}. The body is JSON
+// ({"title","content"}) or, sent as text/markdown, the page itself with the
+// title in ?title=.
+func (h *Handlers) SavePage(w http.ResponseWriter, r *http.Request) {
+	device := r.PathValue("device")
+	var req models.PageRequest
+	body := io.LimitReader(r.Body, 1<<20)
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == "text/markdown" || mediaType == "text/plain" {
+		content, err := io.ReadAll(body)
+		if err != nil {
+			h.sendError(w, http.StatusBadRequest, "Failed to read body")
+			return
+		}
+		req = models.PageRequest{Title: r.URL.Query().Get("title"), Content: string(content)}
+	} else if err := json.NewDecoder(body).Decode(&req); err != nil {
+		h.sendError(w, http.StatusBadRequest, "Invalid JSON body")
+		return
+	}
+
+	page, created, err := h.pages.Save(device, req)
+	var invalid *services.InvalidField
+	if errors.As(err, &invalid) {
+		h.sendFieldErrors(w, fieldErrors{{Field: invalid.Field, Message: invalid.Message}})
+		return
+	}
+	if err != nil {
+		h.logger.Printf("Failed to save page %s: %v", device, err)
+		h.sendError(w, http.StatusInternalServerError, h.cfg.GetText().ServerError)
+		return
+	}
+
+	status, action := http.StatusOK, "page.update"
+	if created {
+		status, action = http.StatusCreated, "page.create"
+	}
+	h.recordAudit(r, action, device, page.Title)
+	page.HTML = services.RenderMarkdown(page.Content)
+	h.sendJSON(w, status, page)
+}
+
+// DeletePage removes the page at /{device}
+func (h *Handlers) DeletePage(w http.ResponseWriter, r *http.Request) {
+	device := r.PathValue("device")
+	if err := h.pages.Delete(device); err != nil {
+		h.sendPageError(w, err)
+		return
+	}
+	h.recordAudit(r, "page.delete", device, "")
+	h.sendJSON(w, http.StatusOK, map[string]string{"message": "Page deleted"})
+}
+
+// sendPageError answers a failed page lookup or change
+func (h *Handlers) sendPageError(w http.ResponseWriter, err error) {
+	if errors.Is(err, services.ErrNotFound) {
+		h.sendError(w, http.StatusNotFound, "Page not found")
+		return
+	}
+	h.logger.Printf("Failed to access pages: %v", err)
+	h.sendError(w, http.StatusInternalServerError, h.cfg.GetText().ServerError)
+}
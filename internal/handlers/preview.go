@@ -0,0 +1,224 @@
+package handlers
+
+import (
+	"bytes"
+	"html/template"
+	"net/http"
+	"path"
+	"strings"
+
+	"rom-server/internal/models"
+	"rom-server/internal/services"
+)
+
+// previewAgents identifies the fetchers that chat apps, forums and social
+// sites send to build link previews. Short links send them to the landing
+// page instead of the download.
+var previewAgents = []string{
+	"telegrambot", "discordbot", "twitterbot", "facebookexternalhit",
+	"slackbot", "whatsapp", "linkedinbot", "redditbot", "skypeuripreview",
+	"mastodon", "embedly", "iframely", "vkshare",
+}
+
+// previewPage is the landing page of a build
+var previewPage = template.Must(template.New("preview").Parse(`<!DOCTYPE html>
+<html lang="{{.Lang}}">
+<head>
+  <meta charset="utf-8" />
+  <meta name="viewport" content="width=device-width, initial-scale=1" />
+  <link rel="icon" type="image/png" href="/static/favicon.png">
+  <link rel="canonical" href="{{.URL}}">
+  <title>{{.Title}}</title>
+  <meta name="description" content="{{.Description}}" />
+
+  <meta property="og:type" content="website" />
+  <meta property="og:site_name" content="{{.SiteName}}" />
+  <meta property="og:title" content="{{.Title}}" />
+  <meta property="og:description" content="{{.Description}}" />
+  <meta property="og:url" content="{{.URL}}" />
+  <meta property="og:image" content="{{.Image}}" />
+
+  <meta name="twitter:card" content="{{.Card}}" />
+  <meta name="twitter:title" content="{{.Title}}" />
+  <meta name="twitter:description" content="{{.Description}}" />
+  <meta name="twitter:image" content="{{.Image}}" />
+
+  <style>
+    body { margin: 0; min-height: 100vh; display: flex; align-items: center; justify-content: center; background: #000; color: #fff; font-family: Inter, system-ui, sans-serif; }
+    main { max-width: 32rem; margin: 1.5rem; padding: 2rem; border: 1px solid #262626; border-radius: 1rem; background: #0f0f0f; text-align: center; }
+    img { max-width: 8rem; max-height: 8rem; }
+    h1 { font-size: 1.125rem; word-break: break-all; }
+    p { color: #a3a3a3; }
+    a { color: #7DF9FF; }
+    .download { display: inline-block; margin: 1rem 0; padding: 0.75rem 1.5rem; border-radius: 0.5rem; background: #8B5CF6; color: #fff; font-weight: 600; text-decoration: none; }
+    .download:hover { background: #7C3AED; }
+  </style>
+</head>
+<body>
+  <main>
+    <img src="{{.Image}}" alt="" />
+    <h1>{{.Title}}</h1>
+    <p>{{.Description}}</p>
+    {{with .Notes}}<p>{{.}}</p>{{end}}
+    <a class="download" href="{{.Download}}">Download ({{.Size}})</a>
+    <p><a href="/">All builds</a></p>
+  </main>
+</body>
+</html>
+`))
+
+// previewData fills previewPage
+type previewData struct {
+	Lang        string
+	SiteName    string
+	Title       string
+	Description string
+	Notes       string
+	Size        string
+	URL         string // Absolute, for og:url
+	Image       string // Absolute, for og:image
+	Card        string // Twitter Card type
+	Download    string
+}
+
+// BuildPreview serves the landing page of the build at
+// /builds/{category}/{filename}: its name, version, size and device image,
+// as Open Graph and Twitter Card tags for link previews and as a page with
+// a download button for people
+func (h *Handlers) BuildPreview(w http.ResponseWriter, r *http.Request) {
+	category, filename := r.PathValue("category"), services.NormalizeFilename(r.PathValue("filename"))
+	v := h.viewer(r)
+	if !h.cfg.IsValidCategory(category) || !v.sees(h, category) {
+		http.NotFound(w, r)
+		return
+	}
+	f, ok, err := h.findFile(v, category, filename)
+	if err != nil {
+		h.logger.Printf("Error listing files: %v", err)
+		http.Error(w, h.cfg.GetText().ServerError, http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	previews := h.cfg.GetPreviews()
+	text := h.cfg.GetText()
+	device := h.previewDevice(f, previews.DeviceImages)
+	data := previewData{
+		Lang:        "en",
+		SiteName:    text.AppTitle,
+		Title:       f.Filename,
+		Description: strings.Join(h.previewFacts(f, device), " · "),
+		Notes:       f.Notes,
+		Size:        f.Size,
+		URL:         absoluteURL(r, previews.PublicURL, v.link(services.PreviewPath(category, f.Filename))),
+		Image:       absoluteURL(r, previews.PublicURL, previews.Image),
+		Card:        "summary",
+		Download:    f.URL,
+	}
+	if text.Locale != "" {
+		data.Lang = strings.ReplaceAll(text.Locale, "_", "-")
+	}
+	if image := previews.DeviceImages[device]; image != "" {
+		data.Image, data.Card = absoluteURL(r, previews.PublicURL, image), "summary_large_image"
+	}
+
+	var body bytes.Buffer
+	if err := previewPage.Execute(&body, data); err != nil {
+		h.logger.Printf("Failed to render preview of %s/%s: %v", category, f.Filename, err)
+		http.Error(w, text.ServerError, http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if h.cfg.IsRestricted(category) {
+		w.Header().Set("Cache-Control", "private, no-store")
+	} else {
+		w.Header().Set("Cache-Control", "public, max-age=300")
+	}
+	w.Write(body.Bytes())
+}
+
+// previewFacts describes a build in a few short phrases: its version,
+// Android version, size, device and category
+func (h *Handlers) previewFacts(f models.FileInfo, device string) []string {
+	var facts []string
+	if version := attribute(f, "version"); version != "" {
+		facts = append(facts, "Version "+version)
+	}
+	if f.Release != nil && f.Release.AndroidVersion != "" {
+		facts = append(facts, "Android "+f.Release.AndroidVersion)
+	}
+	facts = append(facts, f.Size)
+	if device != "" {
+		facts = append(facts, device)
+	}
+	if cat, ok := h.cfg.GetCategories()[f.Category]; ok && cat.DisplayName != "" {
+		facts = append(facts, cat.DisplayName)
+	}
+	if f.Release != nil && f.Release.SecurityPatch != "" {
+		facts = append(facts, "Security patch "+f.Release.SecurityPatch)
+	}
+	return facts
+}
+
+// previewDevice finds the device codename of a build: its "device"
+// attribute, or the first part of its file name that has a preview image
+// or a device page
+func (h *Handlers) previewDevice(f models.FileInfo, images map[string]string) string {
+	if device := attribute(f, "device"); device != "" {
+		return strings.ToLower(device)
+	}
+	pages, _ := h.pages.List()
+	name := strings.ToLower(strings.TrimSuffix(f.Filename, path.Ext(f.Filename)))
+	for _, part := range strings.FieldsFunc(name, func(c rune) bool { return strings.ContainsRune("-_.+ ", c) }) {
+		if _, ok := images[part]; ok {
+			return part
+		}
+		for _, p := range pages {
+			if p.Device == part {
+				return part
+			}
+		}
+	}
+	return ""
+}
+
+// attribute returns a build's attribute by key, ignoring case like the
+// /list filters do
+func attribute(f models.FileInfo, key string) string {
+	for k, value := range f.Attributes {
+		if strings.EqualFold(k, key) {
+			return value
+		}
+	}
+	return ""
+}
+
+// isPreviewAgent reports whether a request comes from a link preview fetcher
+func isPreviewAgent(r *http.Request) bool {
+	ua := strings.ToLower(r.UserAgent())
+	for _, agent := range previewAgents {
+		if strings.Contains(ua, agent) {
+			return true
+		}
+	}
+	return false
+}
+
+// absoluteURL resolves a path against the public origin, or the request's
+// own without one; link previews need absolute URLs. Full URLs are kept.
+func absoluteURL(r *http.Request, origin, target string) string {
+	if !strings.HasPrefix(target, "/") || strings.HasPrefix(target, "//") {
+		return target
+	}
+	if origin == "" {
+		scheme := "http"
+		if r.TLS != nil || strings.EqualFold(r.Header.Get("X-Forwarded-Proto"), "https") {
+			scheme = "https"
+		}
+		origin = scheme + "://" + r.Host
+	}
+	return origin + target
+}
@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"rom-server/internal/models"
+	"rom-server/internal/services"
+)
+
+// fallbackRequest reads and checks the body of the fallback endpoints;
+// false once an error has been sent
+func (h *Handlers) fallbackRequest(w http.ResponseWriter, r *http.Request) (models.FallbackRequest, bool) {
+	var req models.FallbackRequest
+	if err := json.NewDecoder(io.LimitReader(r.Body, 1<<20)).Decode(&req); err != nil {
+		h.sendError(w, http.StatusBadRequest, "Invalid JSON body")
+		return req, false
+	}
+	v := h.validator()
+	req.Filename = services.NormalizeFilename(req.Filename)
+	v.target(req.Category, req.Filename)
+	return req, !h.sendInvalid(w, v)
+}
+
+// ConfirmBuild tells the server a build uploaded with keep_previous works,
+// so the build it replaced can go
+func (h *Handlers) ConfirmBuild(w http.ResponseWriter, r *http.Request) {
+	req, ok := h.fallbackRequest(w, r)
+	if !ok {
+		return
+	}
+	if err := h.fileService.ConfirmBuild(req.Category, req.Filename); err != nil {
+		if status, err := h.fileError(err); status == http.StatusNotFound {
+			h.sendError(w, status, "No previous build is kept for this file")
+		} else {
+			h.sendError(w, status, err.Error())
+		}
+		return
+	}
+
+	h.logger.Printf("Confirmed %s in [%s]; previous build dropped", req.Filename, req.Category)
+	h.recordAudit(r, "file.confirm", req.Category+"/"+req.Filename, "")
+	h.sendJSON(w, http.StatusOK, req)
+}
+
+// RestorePrevious rolls a build uploaded with keep_previous back to the
+// build it replaced
+func (h *Handlers) RestorePrevious(w http.ResponseWriter, r *http.Request) {
+	req, ok := h.fallbackRequest(w, r)
+	if !ok {
+		return
+	}
+	if err := h.fileService.RestorePrevious(req.Category, req.Filename); err != nil {
+		if status, err := h.fileError(err); status == http.StatusNotFound {
+			h.sendError(w, status, "No previous build is kept for this file")
+		} else {
+			h.sendError(w, status, err.Error())
+		}
+		return
+	}
+
+	h.logger.Printf("Restored the previous %s in [%s]", req.Filename, req.Category)
+	h.recordAudit(r, "file.restore", req.Category+"/"+req.Filename, "")
+	h.sendJSON(w, http.StatusOK, req)
+}
@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"regexp"
+	"time"
+
+	"rom-server/internal/middleware"
+	"rom-server/internal/models"
+)
+
+// pseudonymPattern matches the pseudonyms privacy mode logs instead of addresses
+var pseudonymPattern = regexp.MustCompile(`^anon-[0-9a-f]{16}$`)
+
+// PurgeClient deletes what the server keeps about one client, named by
+// address and/or pseudonym, and answers with a report of every store it
+// searched. Made for deletion requests; the audit entry for the purge
+// itself leaves the client out.
+func (h *Handlers) PurgeClient(w http.ResponseWriter, r *http.Request) {
+	var req models.PurgeRequest
+	if err := json.NewDecoder(io.LimitReader(r.Body, 64<<10)).Decode(&req); err != nil {
+		h.sendError(w, http.StatusBadRequest, "Invalid JSON body")
+		return
+	}
+
+	v := h.validator()
+	if req.IP == "" && req.IPHash == "" {
+		v.fail("ip", "or ip_hash is required")
+	}
+	if req.IP != "" && net.ParseIP(req.IP) == nil {
+		v.fail("ip", "%q is not an IP address", req.IP)
+	}
+	if req.IPHash != "" && !pseudonymPattern.MatchString(req.IPHash) {
+		v.fail("ip_hash", "must look like anon-5f0c2e9a1b7d3c4e")
+	}
+	if h.sendInvalid(w, v) {
+		return
+	}
+
+	m := middleware.NewAddressMatcher(r, req.IP, req.IPHash)
+	report := models.PurgeReport{Subjects: m.Subjects(), PurgedAt: time.Now().UTC().Format(time.RFC3339)}
+
+	audit := models.PurgeResult{Store: "audit_log"}
+	if h.audit == nil {
+		audit.Note = "audit_log flag is off"
+	}
+	var err error
+	if audit.Removed, audit.Redacted, err = h.audit.Purge(m, middleware.PurgedAddress); err != nil {
+		h.logger.Printf("Purge failed on the audit log: %v", err)
+		h.sendError(w, http.StatusInternalServerError, h.cfg.GetText().ServerError)
+		return
+	}
+	report.Results = append(report.Results, audit,
+		models.PurgeResult{Store: "auth_failures", Removed: h.activity.PurgeAuthFailures(m)})
+
+	feedback := models.PurgeResult{Store: "feedback"}
+	if h.feedback == nil {
+		feedback.Note = "feedback flag is off"
+	}
+	if feedback.Removed, err = h.feedback.Purge(m); err != nil {
+		h.logger.Printf("Purge failed on feedback: %v", err)
+		h.sendError(w, http.StatusInternalServerError, h.cfg.GetText().ServerError)
+		return
+	}
+	report.Results = append(report.Results, feedback)
+
+	ratings := models.PurgeResult{Store: "ratings"}
+	if h.ratings == nil {
+		ratings.Note = "ratings flag is off"
+	}
+	if ratings.Removed, err = h.ratings.Purge(m); err != nil {
+		h.logger.Printf("Purge failed on ratings: %v", err)
+		h.sendError(w, http.StatusInternalServerError, h.cfg.GetText().ServerError)
+		return
+	}
+	// Voters are rate limited under their hash, not their address
+	voters := make(map[string]bool)
+	if h.ratings != nil {
+		for _, subject := range m.Subjects() {
+			if voter, err := h.ratings.Voter(subject); err == nil {
+				voters[voter] = true
+			}
+		}
+	}
+	forgotten := h.limiter.Forget(m.Match) + h.submitLimiter.Forget(m.Match) +
+		h.voteLimiter.Forget(func(key string) bool { return voters[key] })
+	report.Results = append(report.Results, ratings,
+		models.PurgeResult{Store: "rate_limiter", Removed: forgotten})
+
+	if h.cfg.Cluster.Enabled {
+		report.Results = append(report.Results, models.PurgeResult{Store: "shared_rate_limiter",
+			Note: "per-minute counters in Redis expire on their own within two minutes"})
+	}
+	report.Results = append(report.Results,
+		models.PurgeResult{Store: "request_log", Note: "written to stdout and not kept by the server; purge it where logs are collected"},
+		models.PurgeResult{Store: "backups", Note: "backups made before now still hold the old records"})
+
+	removed, redacted := 0, 0
+	for _, result := range report.Results {
+		removed += result.Removed
+		redacted += result.Redacted
+	}
+	h.logger.Printf("Privacy purge: %d records removed, %d redacted", removed, redacted)
+	h.recordAudit(r, "privacy.purge", "", fmt.Sprintf("%d removed, %d redacted", removed, redacted))
+	h.sendJSON(w, http.StatusOK, report)
+}
@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"os"
+
+	"rom-server/internal/models"
+	"rom-server/internal/services"
+)
+
+// AdminQuarantine lists the uploads held in quarantine, newest first
+func (h *Handlers) AdminQuarantine(w http.ResponseWriter, r *http.Request) {
+	items, err := h.fileService.ListQuarantine()
+	if err != nil {
+		h.logger.Printf("Failed to read quarantine: %v", err)
+		h.sendError(w, http.StatusInternalServerError, h.cfg.GetText().ServerError)
+		return
+	}
+	h.sendJSON(w, http.StatusOK, items)
+}
+
+// QuarantinedFile describes the quarantined upload at /{id}
+func (h *Handlers) QuarantinedFile(w http.ResponseWriter, r *http.Request) {
+	item, _, err := h.fileService.QuarantinedFile(r.PathValue("id"))
+	if err != nil {
+		h.sendQuarantineError(w, err)
+		return
+	}
+	h.sendJSON(w, http.StatusOK, item)
+}
+
+// DownloadQuarantined sends the file of the quarantined upload at /{id} as
+// an attachment, for inspecting it offline. It isn't counted.
+func (h *Handlers) DownloadQuarantined(w http.ResponseWriter, r *http.Request) {
+	item, path, err := h.fileService.QuarantinedFile(r.PathValue("id"))
+	if err != nil {
+		h.sendQuarantineError(w, err)
+		return
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		h.sendQuarantineError(w, services.ErrNotFound)
+		return
+	}
+	defer f.Close()
+
+	h.recordAudit(r, "quarantine.download", item.Category+"/"+item.Filename, item.ID)
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", attachment(item.Filename))
+	w.Header().Set("Cache-Control", "private, no-store")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	http.ServeContent(w, r, "", item.QuarantinedAt, f)
+}
+
+// ReleaseQuarantined publishes the quarantined upload at /{id}/release
+// under its original name, overriding the check that held it
+func (h *Handlers) ReleaseQuarantined(w http.ResponseWriter, r *http.Request) {
+	item, err := h.fileService.ReleaseQuarantined(r.PathValue("id"))
+	if err != nil {
+		h.sendQuarantineError(w, err)
+		return
+	}
+	h.logger.Printf("Released %s/%s from quarantine", item.Category, item.Filename)
+	h.recordAudit(r, "quarantine.release", item.Category+"/"+item.Filename, item.ID+": "+item.Reason)
+	h.sendJSON(w, http.StatusOK, models.UploadResponse{
+		Success:  true,
+		Message:  "Released from quarantine",
+		Filename: item.Filename,
+		Category: item.Category,
+		URL:      services.DownloadPath(item.Category, item.Filename),
+		SHA256:   item.SHA256,
+	})
+}
+
+// PurgeQuarantined deletes the quarantined upload at /{id} for good
+func (h *Handlers) PurgeQuarantined(w http.ResponseWriter, r *http.Request) {
+	item, err := h.fileService.PurgeQuarantined(r.PathValue("id"))
+	if err != nil {
+		h.sendQuarantineError(w, err)
+		return
+	}
+	h.recordAudit(r, "quarantine.purge", item.Category+"/"+item.Filename, item.ID+": "+item.Reason)
+	h.sendJSON(w, http.StatusOK, map[string]string{"message": "Quarantined file purged"})
+}
+
+// sendQuarantineError answers a failed quarantine action
+func (h *Handlers) sendQuarantineError(w http.ResponseWriter, err error) {
+	if errors.Is(err, services.ErrNotFound) {
+		h.sendError(w, http.StatusNotFound, "Quarantined file not found")
+		return
+	}
+	h.logger.Printf("Quarantine action failed: %v", err)
+	if errors.Is(err, services.ErrInsufficientSpace) {
+		h.sendError(w, http.StatusInsufficientStorage, "Insufficient storage space")
+		return
+	}
+	h.sendError(w, http.StatusConflict, err.Error())
+}
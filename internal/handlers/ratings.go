@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"path/filepath"
+
+	"rom-server/internal/middleware"
+	"rom-server/internal/models"
+	"rom-server/internal/services"
+)
+
+// Votes are limited per voter on top of the global rate limit, generously
+// enough to rate a page of builds
+const (
+	votesPerMinute = 10
+	voteBurst      = 10
+)
+
+// RateBuild records a thumbs up or down on the build at
+// /{category}/{filename}/rating and answers with its new tally. Voting
+// again replaces the earlier vote.
+func (h *Handlers) RateBuild(w http.ResponseWriter, r *http.Request) {
+	category, filename := r.PathValue("category"), services.NormalizeFilename(r.PathValue("filename"))
+	if !h.cfg.IsValidCategory(category) || !validPathName(filename) || !h.cfg.IsAllowedExtensionFor(category, filepath.Ext(filename)) || !h.viewer(r).sees(h, category) {
+		h.sendError(w, http.StatusNotFound, "File not found")
+		return
+	}
+
+	// In hash privacy mode voters are known by the day's pseudonym
+	voter, err := h.ratings.Voter(middleware.Anonymize(r, clientHost(r)))
+	if err != nil {
+		h.logger.Printf("Failed to read ratings: %v", err)
+		h.sendError(w, http.StatusInternalServerError, h.cfg.GetText().ServerError)
+		return
+	}
+	if !h.voteLimiter.Allow(voter) {
+		w.Header().Set("Retry-After", "60")
+		h.sendError(w, http.StatusTooManyRequests, "Too many votes; try again in a minute")
+		return
+	}
+
+	var req models.RatingRequest
+	if err := json.NewDecoder(io.LimitReader(r.Body, 64<<10)).Decode(&req); err != nil {
+		h.sendError(w, http.StatusBadRequest, "Invalid JSON body")
+		return
+	}
+	file, ok := h.publishedFile(category, filename)
+	if !ok {
+		h.sendError(w, http.StatusNotFound, "File not found")
+		return
+	}
+
+	rating, err := h.ratings.Vote(category, filename, file.SHA256, voter, req.Vote)
+	var invalid *services.InvalidField
+	switch {
+	case errors.As(err, &invalid):
+		h.sendFieldErrors(w, fieldErrors{{Field: invalid.Field, Message: invalid.Message}})
+		return
+	case err != nil:
+		h.logger.Printf("Failed to store rating: %v", err)
+		h.sendError(w, http.StatusInternalServerError, h.cfg.GetText().ServerError)
+		return
+	}
+	h.metrics.Add("ratings_total", 1)
+	h.sendJSON(w, http.StatusOK, rating)
+}
@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"rom-server/internal/middleware"
+	"rom-server/internal/models"
+	"rom-server/internal/services"
+)
+
+// reportReasons are the kinds of problem a build can be reported for
+var reportReasons = []string{"broken", "mislabeled", "abuse", "other"}
+
+// maxReportMessage bounds the details a reporter can send
+const maxReportMessage = 1000
+
+// Reports and feedback are limited per client on top of the global rate
+// limit: a few in a row, then one a minute
+const (
+	submitsPerMinute = 1
+	submitBurst      = 3
+)
+
+// Report lets anyone flag a published build as broken, mislabeled or
+// abusive. Reports land in the admin activity feed as report.<reason>
+// entries and, with webhooks.notify_reports, as a build.reported webhook.
+func (h *Handlers) Report(w http.ResponseWriter, r *http.Request) {
+	if !h.submitLimiter.Allow(clientHost(r)) {
+		w.Header().Set("Retry-After", "60")
+		h.sendError(w, http.StatusTooManyRequests, "Too many reports; try again in a minute")
+		return
+	}
+
+	var req models.ReportRequest
+	if err := json.NewDecoder(io.LimitReader(r.Body, 64<<10)).Decode(&req); err != nil {
+		h.sendError(w, http.StatusBadRequest, "Invalid JSON body")
+		return
+	}
+	req.Filename = services.NormalizeFilename(req.Filename)
+	req.Message = strings.TrimSpace(req.Message)
+
+	v := h.validator()
+	v.required("category", req.Category)
+	v.required("filename", req.Filename)
+	if v.required("reason", req.Reason) && !slices.Contains(reportReasons, req.Reason) {
+		v.fail("reason", "must be one of %s", strings.Join(reportReasons, ", "))
+	}
+	if utf8.RuneCountInString(req.Message) > maxReportMessage || !utf8.ValidString(req.Message) {
+		v.fail("message", "must be at most %d characters", maxReportMessage)
+	}
+	if h.sendInvalid(w, v) {
+		return
+	}
+
+	// Only builds the reporter can see can be reported
+	if !h.cfg.IsValidCategory(req.Category) || !h.viewer(r).sees(h, req.Category) || !h.published(req.Category, req.Filename) {
+		h.sendError(w, http.StatusNotFound, "File not found")
+		return
+	}
+
+	target := req.Category + "/" + req.Filename
+	client := middleware.Anonymize(r, clientHost(r))
+	if err := h.audit.Record("report."+req.Reason, client, target, req.Message); err != nil {
+		h.logger.Printf("Audit log error: %v", err)
+	}
+	h.logger.Printf("Report from %s: %s is %s", client, target, req.Reason)
+	h.fileService.NotifyReport(req.Category, req.Filename, req.Reason, req.Message)
+	h.metrics.Add("reports_total", 1)
+	h.sendJSON(w, http.StatusAccepted, map[string]string{"message": "Thanks, the maintainers will take a look"})
+}
+
+// published reports whether a build is live, on disk or in the bucket
+func (h *Handlers) published(category, filename string) bool {
+	_, ok := h.publishedFile(category, filename)
+	return ok
+}
+
+// publishedFile looks up a live build
+func (h *Handlers) publishedFile(category, filename string) (models.FileInfo, bool) {
+	files, err := h.fileService.ListFiles()
+	if err != nil {
+		return models.FileInfo{}, false
+	}
+	for _, f := range files {
+		if f.Category == category && f.Filename == filename {
+			return f, true
+		}
+	}
+	return models.FileInfo{}, false
+}
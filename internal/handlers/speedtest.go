@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"time"
+	"unicode/utf8"
+
+	"rom-server/internal/models"
+	"rom-server/internal/services"
+)
+
+// speedTestOrigin is the source name of results measured against this server
+const speedTestOrigin = "origin"
+
+// maxSpeedTestMbps rejects reports no real link could produce
+const maxSpeedTestMbps = 100000
+
+// SpeedTestIndex lists the speed test payloads and where to report results
+func (h *Handlers) SpeedTestIndex(w http.ResponseWriter, r *http.Request) {
+	index := models.SpeedTestIndex{ResultsURL: "/speedtest/results"}
+	for _, p := range services.SpeedTestPayloads {
+		index.Payloads = append(index.Payloads, models.SpeedTestPayload{Name: p.Name, Bytes: p.Bytes, URL: "/speedtest/" + p.Name})
+	}
+	h.sendJSON(w, http.StatusOK, index)
+}
+
+// SpeedTestPayload serves /speedtest/{payload}: incompressible test data of
+// a fixed size, generated on the fly and never cached
+func (h *Handlers) SpeedTestPayload(w http.ResponseWriter, r *http.Request) {
+	size, ok := services.SpeedTestSize(r.PathValue("payload"))
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	// Test traffic counts against the cap like any other
+	if h.fileService.TrafficCapReached() {
+		h.sendError(w, http.StatusServiceUnavailable, "Speed tests are unavailable until the monthly transfer cap resets")
+		return
+	}
+
+	defer h.fileService.ReleaseDownloadSlot(h.fileService.AcquireDownloadSlot(size))
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Cache-Control", "no-store, no-transform")
+	counter := &countingWriter{ResponseWriter: w, status: http.StatusOK}
+	http.ServeContent(counter, r, "", time.Time{}, services.SpeedTestContent(size))
+	h.fileService.AddTraffic(services.SpeedTestTraffic, counter.written)
+}
+
+// ReportSpeedTest accepts a client's timing of a payload download, from
+// this server or (with source) a mirror, and answers with the speed
+func (h *Handlers) ReportSpeedTest(w http.ResponseWriter, r *http.Request) {
+	var report models.SpeedTestReport
+	if err := json.NewDecoder(io.LimitReader(r.Body, 1<<20)).Decode(&report); err != nil {
+		h.sendError(w, http.StatusBadRequest, "Invalid JSON body")
+		return
+	}
+
+	v := h.validator()
+	size, ok := services.SpeedTestSize(report.Payload)
+	if v.required("payload", report.Payload) && !ok {
+		v.fail("payload", "unknown payload %q", report.Payload)
+	}
+	if report.DurationMs < 1 {
+		v.fail("duration_ms", "must be at least 1")
+	}
+	if report.Source == "" {
+		report.Source = speedTestOrigin
+	}
+	if len(report.Source) > 64 || !utf8.ValidString(report.Source) {
+		v.fail("source", "must be at most 64 characters")
+	}
+	if h.sendInvalid(w, v) {
+		return
+	}
+
+	result := models.SpeedTestResult{
+		Time:   time.Now().UTC(),
+		Source: report.Source,
+		Bytes:  size,
+		Mbps:   services.SpeedTestMbps(size, time.Duration(report.DurationMs)*time.Millisecond),
+	}
+	if result.Mbps > maxSpeedTestMbps {
+		h.sendFieldErrors(w, fieldErrors{{Field: "duration_ms", Message: "is too short to be real"}})
+		return
+	}
+	h.speedTests.Record(result)
+	h.sendJSON(w, http.StatusOK, result)
+}
+
+// AdminSpeedTests summarizes recent speed test reports per source
+func (h *Handlers) AdminSpeedTests(w http.ResponseWriter, r *http.Request) {
+	h.sendJSON(w, http.StatusOK, h.speedTests.Summary())
+}
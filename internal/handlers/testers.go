@@ -0,0 +1,160 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"rom-server/internal/models"
+	"rom-server/internal/services"
+)
+
+// viewer is who a request is as far as restricted categories go: an API key
+// holder sees all of them, a beta tester those on their allowlist entry.
+// Both are read from the query (?key=, ?token=) and never from headers, so
+// the response cache, keyed on the URL, can't hand a tester's listing to
+// the public.
+type viewer struct {
+	trusted bool
+	tester  *models.Tester
+	token   string
+}
+
+// viewer identifies the request's caller
+func (h *Handlers) viewer(r *http.Request) viewer {
+	q := r.URL.Query()
+	if key := q.Get("key"); key != "" {
+		if _, ok := h.cfg.Authenticate(key); ok {
+			return viewer{trusted: true}
+		}
+		if _, ok := h.keys.Authenticate(key); ok {
+			return viewer{trusted: true}
+		}
+	}
+	if token := q.Get("token"); token != "" {
+		if tester, ok := h.testers.Lookup(token); ok {
+			return viewer{tester: &tester, token: token}
+		}
+	}
+	return viewer{}
+}
+
+// sees reports whether the viewer may see category's builds
+func (v viewer) sees(h *Handlers, category string) bool {
+	switch {
+	case !h.cfg.IsRestricted(category), v.trusted:
+		return true
+	case v.tester == nil:
+		return false
+	}
+	return services.TesterSees(*v.tester, category)
+}
+
+// link carries a tester's token over to a download or short link, which
+// they open without the page that had it
+func (v viewer) link(target string) string {
+	if v.tester == nil || target == "" {
+		return target
+	}
+	sep := "?"
+	if strings.Contains(target, "?") {
+		sep = "&"
+	}
+	return target + sep + "token=" + url.QueryEscape(v.token)
+}
+
+// visibleFiles drops the builds of restricted categories the viewer may not
+// see, and puts a tester's token on the links of the ones they may
+func (h *Handlers) visibleFiles(v viewer, files []models.FileInfo) []models.FileInfo {
+	visible := files[:0:0]
+	for _, f := range files {
+		if !v.sees(h, f.Category) {
+			continue
+		}
+		if h.cfg.IsRestricted(f.Category) {
+			f.URL, f.ShortURL = v.link(f.URL), v.link(f.ShortURL)
+		}
+		visible = append(visible, f)
+	}
+	return visible
+}
+
+// testerResponse describes a tester to admins
+func testerResponse(t models.Tester, token string) models.TesterResponse {
+	return models.TesterResponse{Name: t.Name, Prefix: t.Prefix, Categories: t.Categories, CreatedAt: t.CreatedAt, Token: token}
+}
+
+// ListTesters returns the beta tester allowlist
+func (h *Handlers) ListTesters(w http.ResponseWriter, r *http.Request) {
+	testers, err := h.testers.List()
+	if err != nil {
+		h.logger.Printf("Failed to read testers: %v", err)
+		h.sendError(w, http.StatusInternalServerError, h.cfg.GetText().ServerError)
+		return
+	}
+	resp := make([]models.TesterResponse, 0, len(testers))
+	for _, t := range testers {
+		resp = append(resp, testerResponse(t, ""))
+	}
+	h.sendJSON(w, http.StatusOK, resp)
+}
+
+// AddTester puts a beta tester on the allowlist and answers with their
+// token, which is not shown again
+func (h *Handlers) AddTester(w http.ResponseWriter, r *http.Request) {
+	var req models.TesterRequest
+	if err := json.NewDecoder(io.LimitReader(r.Body, 1<<20)).Decode(&req); err != nil {
+		h.sendError(w, http.StatusBadRequest, "Invalid JSON body")
+		return
+	}
+
+	v := h.validator()
+	if v.required("name", req.Name) && !services.ValidTesterName(req.Name) {
+		v.fail("name", "must be an email address or handle without spaces, at most 254 characters")
+	}
+	for _, category := range req.Categories {
+		if !h.cfg.IsValidCategory(category) {
+			v.fail("categories", "unknown category %q", category)
+		}
+	}
+	if h.sendInvalid(w, v) {
+		return
+	}
+
+	token, tester, err := h.testers.Add(req.Name, req.Categories)
+	if errors.Is(err, services.ErrTesterExists) {
+		h.sendError(w, http.StatusConflict, err.Error())
+		return
+	}
+	if err != nil {
+		h.logger.Printf("Failed to add tester: %v", err)
+		h.sendError(w, http.StatusInternalServerError, h.cfg.GetText().ServerError)
+		return
+	}
+
+	scope := "all restricted categories"
+	if len(tester.Categories) > 0 {
+		scope = strings.Join(tester.Categories, ", ")
+	}
+	h.recordAudit(r, "tester.add", tester.Name, scope)
+	h.sendJSON(w, http.StatusCreated, testerResponse(tester, token))
+}
+
+// RemoveTester takes the tester at /{name} off the allowlist
+func (h *Handlers) RemoveTester(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	if err := h.testers.Remove(name); err != nil {
+		if errors.Is(err, services.ErrNotFound) {
+			h.sendError(w, http.StatusNotFound, "Tester not found")
+			return
+		}
+		h.logger.Printf("Failed to remove tester: %v", err)
+		h.sendError(w, http.StatusInternalServerError, h.cfg.GetText().ServerError)
+		return
+	}
+	h.recordAudit(r, "tester.remove", name, "")
+	h.sendJSON(w, http.StatusOK, map[string]string{"message": "Tester removed"})
+}
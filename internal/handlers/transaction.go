@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+
+	"rom-server/internal/models"
+	"rom-server/internal/services"
+)
+
+// publishTransaction makes every upload held in a transaction public at
+// once, or none of them
+func (h *Handlers) publishTransaction(w http.ResponseWriter, r *http.Request, name string) {
+	v := h.validator()
+	v.check("transaction", services.ValidateTransaction(name))
+	if h.sendInvalid(w, v) {
+		return
+	}
+
+	files, err := h.fileService.PublishTransaction(name)
+	if status, err := h.fileError(err); err != nil {
+		if status == http.StatusNotFound {
+			h.sendError(w, status, "No uploads are held in this transaction")
+		} else {
+			h.sendError(w, status, err.Error())
+		}
+		return
+	}
+
+	h.logger.Printf("Published transaction %s: %s", name, strings.Join(files, ", "))
+	h.recordAudit(r, "transaction.publish", name, strings.Join(files, " "))
+	h.sendJSON(w, http.StatusOK, models.TransactionResponse{Transaction: name, Files: files, Count: len(files)})
+}
+
+// discardTransaction deletes every upload held in a transaction
+func (h *Handlers) discardTransaction(w http.ResponseWriter, r *http.Request, name string) {
+	v := h.validator()
+	v.check("transaction", services.ValidateTransaction(name))
+	if h.sendInvalid(w, v) {
+		return
+	}
+
+	n, err := h.fileService.CancelTransaction(name)
+	if status, err := h.fileError(err); err != nil {
+		if status == http.StatusNotFound {
+			h.sendError(w, status, "No uploads are held in this transaction")
+		} else {
+			h.sendError(w, status, err.Error())
+		}
+		return
+	}
+
+	h.logger.Printf("Discarded transaction %s (%d files)", name, n)
+	h.recordAudit(r, "transaction.cancel", name, "")
+	h.sendJSON(w, http.StatusOK, models.TransactionResponse{Transaction: name, Count: n})
+}
@@ -0,0 +1,310 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"rom-server/internal/services"
+
+	"golang.org/x/time/rate"
+)
+
+// sendfileChunk bounds each zero-copy call so transfer progress stays current
+const sendfileChunk = 4 << 20
+
+// countingWriter tracks bytes written to the client and which copy path was used
+type countingWriter struct {
+	http.ResponseWriter
+	status   int
+	written  int64
+	zeroCopy bool               // Body went through ReadFrom, letting net/http use sendfile
+	buffered bool               // Body went through Write with userspace buffers
+	transfer *services.Transfer // Optional progress reporting
+}
+
+func (cw *countingWriter) WriteHeader(code int) {
+	cw.status = code
+	cw.ResponseWriter.WriteHeader(code)
+}
+
+// served reports whether file content (full or ranged) was sent
+func (cw *countingWriter) served() bool {
+	return cw.status == http.StatusOK || cw.status == http.StatusPartialContent
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	cw.buffered = true
+	n, err := cw.ResponseWriter.Write(p)
+	cw.written += int64(n)
+	cw.transfer.Add(int64(n))
+	return n, err
+}
+
+// ReadFrom delegates to the wrapped writer so net/http can keep using sendfile.
+// Ranged bodies arrive as a LimitedReader; they are fed through in chunks so
+// progress is reported while a large file is still going out.
+func (cw *countingWriter) ReadFrom(r io.Reader) (int64, error) {
+	rf, ok := cw.ResponseWriter.(io.ReaderFrom)
+	if !ok {
+		return io.Copy(writerOnly{cw}, r)
+	}
+	cw.zeroCopy = true
+
+	lr, ok := r.(*io.LimitedReader)
+	if !ok {
+		n, err := rf.ReadFrom(r)
+		cw.written += n
+		cw.transfer.Add(n)
+		return n, err
+	}
+
+	var total int64
+	for lr.N > 0 {
+		n, err := rf.ReadFrom(&io.LimitedReader{R: lr.R, N: min(lr.N, sendfileChunk)})
+		lr.N -= n
+		total += n
+		cw.written += n
+		cw.transfer.Add(n)
+		if err != nil {
+			return total, err
+		}
+		if n == 0 {
+			break
+		}
+	}
+	return total, nil
+}
+
+// abortFunc returns a function that cuts off the request's connection by
+// expiring its read and write deadlines. Blocked body reads and response
+// writes (sendfile included) fail at once, so the handler unwinds and
+// releases its slot.
+func abortFunc(w http.ResponseWriter) func() {
+	rc := http.NewResponseController(w)
+	return func() {
+		now := time.Now()
+		rc.SetReadDeadline(now)
+		rc.SetWriteDeadline(now)
+	}
+}
+
+// writerOnly hides ReadFrom to avoid recursing into it from io.Copy
+type writerOnly struct {
+	io.Writer
+}
+
+// throttledWriter caps the transfer rate of a response
+type throttledWriter struct {
+	http.ResponseWriter
+	bytesPerSec int64
+	start       time.Time
+	written     int64
+}
+
+func newThrottledWriter(w http.ResponseWriter, bytesPerSec int64) *throttledWriter {
+	return &throttledWriter{ResponseWriter: w, bytesPerSec: bytesPerSec, start: time.Now()}
+}
+
+func (tw *throttledWriter) Write(p []byte) (int, error) {
+	// Write in ~100ms chunks so the rate stays smooth
+	chunk := int(tw.bytesPerSec / 10)
+	if chunk < 1 {
+		chunk = 1
+	}
+
+	total := 0
+	for len(p) > 0 {
+		n := chunk
+		if n > len(p) {
+			n = len(p)
+		}
+		written, err := tw.ResponseWriter.Write(p[:n])
+		total += written
+		tw.written += int64(written)
+		if err != nil {
+			return total, err
+		}
+		p = p[n:]
+
+		// Sleep until we're back on schedule
+		expected := time.Duration(float64(tw.written) / float64(tw.bytesPerSec) * float64(time.Second))
+		if ahead := expected - time.Since(tw.start); ahead > 0 {
+			time.Sleep(ahead)
+		}
+	}
+	return total, nil
+}
+
+// uploadThrottle shares an upload bandwidth budget between the uploads of
+// each client, so parallel pushes from one CI runner add up to its limit
+type uploadThrottle struct {
+	mu      sync.Mutex
+	clients map[string]*uploadBudget
+}
+
+// uploadBudget is one client's bandwidth, kept while it has uploads running
+type uploadBudget struct {
+	limiter *rate.Limiter
+	active  int
+}
+
+func newUploadThrottle() *uploadThrottle {
+	return &uploadThrottle{clients: make(map[string]*uploadBudget)}
+}
+
+// reader limits body to bytesPerSec shared with the client's other uploads;
+// done must be called once the upload is over
+func (t *uploadThrottle) reader(ctx context.Context, client string, bytesPerSec int64, body io.ReadCloser) (limited io.ReadCloser, done func()) {
+	// Reads are cut to ~100ms of budget so the rate stays smooth
+	burst := max(int(bytesPerSec/10), 4096)
+
+	t.mu.Lock()
+	b := t.clients[client]
+	if b == nil {
+		b = &uploadBudget{limiter: rate.NewLimiter(rate.Limit(bytesPerSec), burst)}
+		t.clients[client] = b
+	} else if b.limiter.Limit() != rate.Limit(bytesPerSec) {
+		// The limit was reconfigured
+		b.limiter.SetLimit(rate.Limit(bytesPerSec))
+		b.limiter.SetBurst(burst)
+	}
+	b.active++
+	t.mu.Unlock()
+
+	return &throttledReader{ReadCloser: body, ctx: ctx, limiter: b.limiter}, func() {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		if b.active--; b.active == 0 {
+			delete(t.clients, client)
+		}
+	}
+}
+
+// throttledReader caps the rate a request body is read at
+type throttledReader struct {
+	io.ReadCloser
+	ctx     context.Context
+	limiter *rate.Limiter
+}
+
+func (tr *throttledReader) Read(p []byte) (int, error) {
+	if burst := tr.limiter.Burst(); len(p) > burst {
+		p = p[:burst]
+	}
+	n, err := tr.ReadCloser.Read(p)
+	if n > 0 {
+		if werr := tr.limiter.WaitN(tr.ctx, n); werr != nil && err == nil {
+			err = werr // Client went away while waiting
+		}
+	}
+	return n, err
+}
+
+// minRateReader cuts off an upload whose client sends fewer than need bytes
+// in a window of time spent waiting on it. The window is enforced with the
+// connection's read deadline, so a client that stalls outright is cut off
+// too, not just one that trickles. Time the server spends throttling between
+// reads doesn't count against the client.
+type minRateReader struct {
+	io.ReadCloser
+	rc     *http.ResponseController
+	need   int64         // Bytes due per window
+	window time.Duration // Time spent waiting on the client to send them
+	cutoff time.Time     // server.read_timeout_minutes still caps the whole body
+
+	mu      sync.Mutex // Orders deadline updates against abort and stop
+	stopped bool
+	aborted bool
+
+	got    int64 // Bytes received in the current window
+	waited time.Duration
+	total  int64
+	slow   bool
+}
+
+func newMinRateReader(w http.ResponseWriter, body io.ReadCloser, kbps int, window, readTimeout time.Duration) *minRateReader {
+	mr := &minRateReader{
+		ReadCloser: body,
+		rc:         http.NewResponseController(w),
+		need:       int64(kbps) * 1024 * int64(window/time.Second),
+		window:     window,
+	}
+	if readTimeout > 0 {
+		mr.cutoff = time.Now().Add(readTimeout)
+	}
+	return mr
+}
+
+func (mr *minRateReader) Read(p []byte) (int, error) {
+	mr.mu.Lock()
+	if !mr.stopped {
+		deadline := time.Now().Add(mr.window - mr.waited)
+		if !mr.cutoff.IsZero() && deadline.After(mr.cutoff) {
+			deadline = mr.cutoff
+		}
+		mr.rc.SetReadDeadline(deadline)
+	}
+	mr.mu.Unlock()
+
+	start := time.Now()
+	n, err := mr.ReadCloser.Read(p)
+	mr.waited += time.Since(start)
+	mr.total += int64(n)
+	if mr.got += int64(n); mr.got >= mr.need {
+		mr.got, mr.waited = 0, 0 // On pace; a new window starts
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() && mr.waited >= mr.window {
+		mr.mu.Lock()
+		mr.slow = !mr.aborted
+		mr.mu.Unlock()
+	}
+	if err == io.EOF {
+		mr.stop()
+	}
+	return n, err
+}
+
+// stop hands the connection back its usual read deadline once the body is
+// in, so the server's idle read of the connection can't time out while the
+// upload is still being saved
+func (mr *minRateReader) stop() {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+	if !mr.stopped {
+		mr.stopped = true
+		mr.rc.SetReadDeadline(mr.cutoff)
+	}
+}
+
+// tooSlow reports whether the body was cut off for arriving too slowly
+func (mr *minRateReader) tooSlow() bool {
+	if mr == nil {
+		return false
+	}
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+	return mr.slow
+}
+
+// abortFunc is abortFunc for a body being watched, keeping later reads from
+// pushing the expired deadline back out
+func (mr *minRateReader) abortFunc(w http.ResponseWriter) func() {
+	if mr == nil {
+		return abortFunc(w)
+	}
+	return func() {
+		mr.mu.Lock()
+		defer mr.mu.Unlock()
+		mr.stopped, mr.aborted = true, true
+		now := time.Now()
+		mr.rc.SetReadDeadline(now)
+		mr.rc.SetWriteDeadline(now)
+	}
+}
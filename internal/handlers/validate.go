@@ -0,0 +1,157 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"rom-server/internal/config"
+	"rom-server/internal/models"
+	"rom-server/internal/services"
+)
+
+// fieldErrors lists what is wrong with each field of a request. Handlers
+// that validate through a service (bulk items, moves) get it back as an error.
+type fieldErrors []models.FieldError
+
+// Error joins the field errors, e.g. "category: unknown category"
+func (e fieldErrors) Error() string {
+	parts := make([]string, len(e))
+	for i, f := range e {
+		parts[i] = f.Field + ": " + f.Message
+	}
+	return strings.Join(parts, "; ")
+}
+
+// validator collects every problem with a request before the handler
+// answers, so clients can point at each bad field instead of fixing them
+// one round trip at a time
+type validator struct {
+	cfg    *config.Config
+	errors fieldErrors
+}
+
+// validator starts a validation against the current config
+func (h *Handlers) validator() *validator {
+	return &validator{cfg: h.cfg}
+}
+
+// fail records a problem with field
+func (v *validator) fail(field, format string, args ...interface{}) {
+	v.errors = append(v.errors, models.FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+// check records err, if any, against field, or against the field a service
+// named in it
+func (v *validator) check(field string, err error) bool {
+	var invalid *services.InvalidField
+	switch {
+	case err == nil:
+		return true
+	case errors.As(err, &invalid):
+		v.fail(invalid.Field, "%s", invalid.Message)
+	default:
+		v.fail(field, "%s", err.Error())
+	}
+	return false
+}
+
+// required checks that field was given
+func (v *validator) required(field, value string) bool {
+	if value == "" {
+		v.fail(field, "is required")
+		return false
+	}
+	return true
+}
+
+// category checks that field names a configured category
+func (v *validator) category(field, value string) bool {
+	if !v.required(field, value) {
+		return false
+	}
+	if !v.cfg.IsValidCategory(value) {
+		v.fail(field, "unknown category %q", value)
+		return false
+	}
+	return true
+}
+
+// target checks a category and filename pair addressing an existing file
+func (v *validator) target(category, filename string) {
+	v.category("category", category)
+	v.required("filename", filename)
+}
+
+// filename checks that field is a safe name with an extension category
+// accepts; the category is assumed valid
+func (v *validator) filename(field, category, value string) bool {
+	if !v.required(field, value) {
+		return false
+	}
+	if value != services.SanitizeFilename(value) {
+		v.fail(field, "must be a plain file name without paths or special characters")
+		return false
+	}
+	if !v.cfg.IsAllowedExtensionFor(category, filepath.Ext(value)) {
+		v.fail(field, "file type not allowed (allowed: %s)", strings.Join(v.cfg.AllowedExtsFor(category), ", "))
+		return false
+	}
+	return true
+}
+
+// date parses an optional YYYY-MM-DD field, returning def when it is empty
+func (v *validator) date(field, value string, def time.Time) time.Time {
+	if value == "" {
+		return def
+	}
+	t, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		v.fail(field, "must be a date like 2024-06-01")
+		return def
+	}
+	return t
+}
+
+// timestamp parses an optional RFC 3339 field
+func (v *validator) timestamp(field, value string) time.Time {
+	if value == "" {
+		return time.Time{}
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		v.fail(field, "must be RFC 3339 (2024-06-01T18:00:00Z)")
+	}
+	return t
+}
+
+// err returns the collected problems, or nil if there were none
+func (v *validator) err() error {
+	if len(v.errors) == 0 {
+		return nil
+	}
+	return v.errors
+}
+
+// sendInvalid answers 400 listing every field error, if there are any, and
+// reports whether it did
+func (h *Handlers) sendInvalid(w http.ResponseWriter, v *validator) bool {
+	if len(v.errors) == 0 {
+		return false
+	}
+	h.sendFieldErrors(w, v.errors)
+	return true
+}
+
+// sendFieldErrors answers 400 with fields both in the message, for clients
+// that only show that, and as a list
+func (h *Handlers) sendFieldErrors(w http.ResponseWriter, fields fieldErrors) {
+	h.sendJSON(w, http.StatusBadRequest, models.ErrorResponse{
+		Error:  fields.Error(),
+		Code:   http.StatusBadRequest,
+		Fields: fields,
+	})
+}
@@ -0,0 +1,616 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"rom-server/internal/middleware"
+	"rom-server/internal/models"
+	"rom-server/internal/services"
+)
+
+// davPrefix is where the storage tree is mounted for WebDAV clients
+const davPrefix = "/dav"
+
+// davMethods are the methods answered under davPrefix
+const davMethods = "OPTIONS, GET, HEAD, PUT, DELETE, MKCOL, COPY, MOVE, PROPFIND, PROPPATCH, LOCK, UNLOCK"
+
+// davLockTimeout is what LOCK grants; locks are advisory, see davLock
+const davLockTimeout = "Second-3600"
+
+// davLockToken finds a token davLock handed out in an If header sent to
+// refresh a lock
+var davLockToken = regexp.MustCompile(`<(opaquelocktoken:[0-9a-f]{32})>`)
+
+// WebDAV serves the storage tree under /dav/ to maintainers: a collection
+// per category holding its published builds. Changes go through the same
+// service calls as the API (PUT is an upload, MOVE a move, DELETE a delete),
+// so metadata, caches, download counters and the audit log stay consistent.
+func (h *Handlers) WebDAV(w http.ResponseWriter, r *http.Request) {
+	category, filename, ok := davPath(r.URL.Path)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method == http.MethodOptions {
+		w.Header().Set("DAV", "1, 2")
+		w.Header().Set("MS-Author-Via", "DAV")
+		w.Header().Set("Allow", davMethods)
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	// Categories come from the config, so there is nothing to create
+	if r.Method == "MKCOL" {
+		if category != "" && filename == "" && h.cfg.IsValidCategory(category) {
+			h.sendError(w, http.StatusMethodNotAllowed, "Category already exists")
+			return
+		}
+		h.sendError(w, http.StatusForbidden, "Categories are set up in the config, and they can't hold folders")
+		return
+	}
+	if category != "" && !h.cfg.IsValidCategory(category) {
+		http.NotFound(w, r)
+		return
+	}
+
+	switch r.Method {
+	case "PROPFIND":
+		h.davPropfind(w, r, category, filename)
+		return
+	case http.MethodGet, http.MethodHead:
+		h.davGet(w, r, category, filename)
+		return
+	}
+
+	// Everything else changes the tree
+	if h.cfg.Mirror.Enabled {
+		h.sendError(w, http.StatusForbidden, "This instance is a read-only mirror")
+		return
+	}
+	if filename == "" && r.Method != "LOCK" && r.Method != "UNLOCK" && r.Method != "PROPPATCH" {
+		h.sendError(w, http.StatusForbidden, "Categories are set up in the config")
+		return
+	}
+	switch r.Method {
+	case http.MethodPut:
+		h.davPut(w, r, category, filename)
+	case http.MethodDelete:
+		h.davDelete(w, r, category, filename)
+	case "COPY", "MOVE":
+		h.davCopyMove(w, r, category, filename)
+	case "PROPPATCH":
+		h.davProppatch(w, r)
+	case "LOCK":
+		h.davLock(w, r)
+	case "UNLOCK":
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.Header().Set("Allow", davMethods)
+		h.sendError(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// davPath splits a path under davPrefix into a category and a file name,
+// both empty for the root; false for anything deeper
+func davPath(p string) (category, filename string, ok bool) {
+	rest := strings.Trim(strings.TrimPrefix(p, davPrefix), "/")
+	if rest == "" {
+		return "", "", true
+	}
+	parts := strings.Split(rest, "/")
+	switch len(parts) {
+	case 1:
+		return parts[0], "", validPathName(parts[0])
+	case 2:
+		filename = services.NormalizeFilename(parts[1])
+		return parts[0], filename, validPathName(parts[0]) && validPathName(filename)
+	}
+	return "", "", false
+}
+
+// davHref is the escaped path of a category (collection) or one of its files
+func davHref(category, filename string) string {
+	href := davPrefix + "/"
+	if category != "" {
+		href += url.PathEscape(category) + "/"
+	}
+	if filename != "" {
+		href += url.PathEscape(filename)
+	}
+	return href
+}
+
+// davLookup finds a published file; WebDAV shows what /list shows, so held
+// uploads and kept previous builds stay out of sight
+func (h *Handlers) davLookup(category, filename string) (models.FileInfo, bool) {
+	files, err := h.fileService.ListFilesByCategory(category)
+	if err != nil {
+		return models.FileInfo{}, false
+	}
+	for _, f := range files {
+		if f.Filename == filename {
+			return f, true
+		}
+	}
+	return models.FileInfo{}, false
+}
+
+// davMultistatus is a 207 Multi-Status body (RFC 4918 section 13)
+type davMultistatus struct {
+	XMLName   xml.Name      `xml:"D:multistatus"`
+	NS        string        `xml:"xmlns:D,attr"`
+	Responses []davResponse `xml:"D:response"`
+}
+
+type davResponse struct {
+	Href     string        `xml:"D:href"`
+	Propstat []davPropstat `xml:"D:propstat"`
+}
+
+type davPropstat struct {
+	Prop   davProp `xml:"D:prop"`
+	Status string  `xml:"D:status"`
+}
+
+// davProp holds the live properties of a resource, or for PROPPATCH the
+// names of the properties that were refused
+type davProp struct {
+	DisplayName  string           `xml:"D:displayname,omitempty"`
+	ResourceType *davResourceType `xml:"D:resourcetype,omitempty"`
+	Length       *int64           `xml:"D:getcontentlength,omitempty"`
+	ContentType  string           `xml:"D:getcontenttype,omitempty"`
+	LastModified string           `xml:"D:getlastmodified,omitempty"`
+	ETag         string           `xml:"D:getetag,omitempty"`
+	Refused      []davName
+}
+
+type davResourceType struct {
+	Collection *struct{} `xml:"D:collection"`
+}
+
+// davName is an empty element standing for a property by name
+type davName struct {
+	XMLName xml.Name
+}
+
+// davStatus formats the status line of a propstat
+func davStatus(code int) string {
+	return fmt.Sprintf("HTTP/1.1 %d %s", code, http.StatusText(code))
+}
+
+// davCollection describes the root or a category
+func davCollection(category string, modified time.Time) davResponse {
+	prop := davProp{DisplayName: category, ResourceType: &davResourceType{Collection: &struct{}{}}}
+	if !modified.IsZero() {
+		prop.LastModified = modified.UTC().Format(http.TimeFormat)
+	}
+	return davResponse{Href: davHref(category, ""), Propstat: []davPropstat{{Prop: prop, Status: davStatus(http.StatusOK)}}}
+}
+
+// davFile describes a published file
+func davFile(f models.FileInfo) davResponse {
+	size := f.SizeBytes
+	contentType := mime.TypeByExtension(filepath.Ext(f.Filename))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	etag := fmt.Sprintf(`"%x-%x"`, f.ModTime.UnixNano(), size)
+	if f.SHA256 != "" {
+		etag = `"` + f.SHA256 + `"`
+	}
+	prop := davProp{
+		DisplayName:  f.Filename,
+		ResourceType: &davResourceType{},
+		Length:       &size,
+		ContentType:  contentType,
+		LastModified: f.ModTime.UTC().Format(http.TimeFormat),
+		ETag:         etag,
+	}
+	return davResponse{Href: davHref(f.Category, f.Filename), Propstat: []davPropstat{{Prop: prop, Status: davStatus(http.StatusOK)}}}
+}
+
+// sendMultistatus writes a 207 Multi-Status answer
+func (h *Handlers) sendMultistatus(w http.ResponseWriter, responses []davResponse) {
+	w.Header().Set("Content-Type", `application/xml; charset="utf-8"`)
+	w.WriteHeader(http.StatusMultiStatus)
+	io.WriteString(w, xml.Header)
+	if err := xml.NewEncoder(w).Encode(davMultistatus{NS: "DAV:", Responses: responses}); err != nil {
+		h.logger.Printf("WebDAV response error: %v", err)
+	}
+}
+
+// davPropfind lists a resource and, unless Depth is 0, what it holds. Every
+// live property is returned whatever the request body asked for.
+func (h *Handlers) davPropfind(w http.ResponseWriter, r *http.Request, category, filename string) {
+	depth := r.Header.Get("Depth")
+
+	if filename != "" {
+		f, ok := h.davLookup(category, filename)
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		h.sendMultistatus(w, []davResponse{davFile(f)})
+		return
+	}
+
+	var categories []string
+	if category != "" {
+		categories = []string{category}
+	} else {
+		for name := range h.cfg.GetCategories() {
+			if h.cfg.IsValidCategory(name) {
+				categories = append(categories, name)
+			}
+		}
+		sort.Strings(categories)
+	}
+
+	var responses []davResponse
+	if category == "" {
+		responses = append(responses, davCollection("", time.Time{}))
+	}
+	for _, name := range categories {
+		// The root with Depth 1 lists the categories but not their files
+		if category == "" && depth == "0" {
+			break
+		}
+		files, err := h.fileService.ListFilesByCategory(name)
+		if err != nil {
+			h.logger.Printf("Error listing files: %v", err)
+			h.sendError(w, http.StatusInternalServerError, h.cfg.GetText().ServerError)
+			return
+		}
+		var modified time.Time
+		if len(files) > 0 {
+			modified = files[0].ModTime // Newest first
+		}
+		responses = append(responses, davCollection(name, modified))
+		if depth == "0" || (category == "" && depth == "1") {
+			continue
+		}
+		for _, f := range files {
+			responses = append(responses, davFile(f))
+		}
+	}
+	h.sendMultistatus(w, responses)
+}
+
+// davGet sends a file. Maintainers fetching builds aren't counted as
+// downloads; builds in the bucket are fetched from it.
+func (h *Handlers) davGet(w http.ResponseWriter, r *http.Request, category, filename string) {
+	if filename == "" {
+		w.Header().Set("Allow", davMethods)
+		h.sendError(w, http.StatusMethodNotAllowed, "Use PROPFIND to list a collection")
+		return
+	}
+	f, ok := h.davLookup(category, filename)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	if target, ok := h.fileService.RemoteURL(category, filename); ok {
+		http.Redirect(w, r, target, http.StatusFound)
+		return
+	}
+	path, err := h.fileService.GetFilePath(category, filename)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer file.Close()
+	defer h.fileService.ReleaseDownloadSlot(h.fileService.AcquireDownloadSlot(f.SizeBytes))
+
+	if sums, ok := h.fileService.Checksums(category, filename); ok {
+		h.setDigestHeaders(w.Header(), sums)
+	}
+	w.Header().Set("Cache-Control", "private, no-store")
+	http.ServeContent(w, r, filename, f.ModTime, file)
+}
+
+// davPut uploads a file. The body is spooled first so it gets the same
+// checks as an upload through the API before anything is replaced.
+func (h *Handlers) davPut(w http.ResponseWriter, r *http.Request, category, filename string) {
+	v := h.validator()
+	v.filename("filename", category, filename)
+	expected, err := uploadDigest(r.Header)
+	v.check("Digest", err)
+	if h.sendInvalid(w, v) {
+		return
+	}
+
+	if !h.acquireUploadSlot(w, r) {
+		return
+	}
+	defer h.fileService.ReleaseUploadSlot()
+
+	limit := h.cfg.MaxUploadSizeFor(category)
+	if r.ContentLength > limit {
+		h.sendTooLarge(w, limit)
+		return
+	}
+	slow, done := h.limitUploadBody(w, r, limit)
+	defer done()
+
+	transfer := h.fileService.StartTransfer(services.TransferUpload, category, filename, middleware.LoggedIP(r), middleware.Identity(r), r.ContentLength, slow.abortFunc(w))
+	defer transfer.Done()
+
+	spool, size, err := h.fileService.SpoolUpload(transfer.Reader(r.Body))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		switch {
+		case slow.tooSlow():
+			h.uploadTooSlow(w, r, category, size)
+		case errors.As(err, &tooLarge):
+			h.sendTooLarge(w, tooLarge.Limit)
+		case r.Context().Err() != nil:
+			h.uploadAborted(w, r, category, transfer)
+		default:
+			h.logger.Printf("WebDAV upload of %s/%s failed: %v", category, filename, err)
+			h.sendError(w, http.StatusBadRequest, h.cfg.GetText().UploadFailed)
+		}
+		return
+	}
+	defer os.Remove(spool.Name())
+	defer spool.Close()
+	done() // The body is in; the rate no longer matters
+
+	image, apk, err := h.checkUploadContent(category, filename, spool, size)
+	if err != nil {
+		h.quarantineUpload(w, r, category, filename, spool, size, err)
+		return
+	}
+
+	_, replaced := h.davLookup(category, filename)
+	sums, err := h.fileService.SaveUpload(category, filename, spool, size, services.UploadOptions{
+		ExpectedSHA256: expected.SHA256,
+		ExpectedMD5:    expected.MD5,
+		Uploader:       middleware.Identity(r),
+		Image:          image,
+		APK:            apk,
+		Context:        r.Context(),
+	})
+	if err != nil {
+		h.sendSaveError(w, r, category, filename, transfer, sums, err)
+		return
+	}
+
+	h.logger.Printf("Success: Uploaded %s to [%s] over WebDAV", filename, category)
+	h.recordAudit(r, "file.upload", category+"/"+filename, "webdav")
+	w.Header().Set("ETag", `"`+sums.SHA256+`"`)
+	if replaced {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+}
+
+// davDelete deletes a file
+func (h *Handlers) davDelete(w http.ResponseWriter, r *http.Request, category, filename string) {
+	if _, ok := h.davLookup(category, filename); !ok {
+		http.NotFound(w, r)
+		return
+	}
+	if err := h.fileService.DeleteFile(category, filename); err != nil {
+		status, err := h.fileError(err)
+		h.sendError(w, status, err.Error())
+		return
+	}
+	h.logger.Printf("Deleted: %s from [%s] over WebDAV", filename, category)
+	h.recordAudit(r, "file.delete", category+"/"+filename, "webdav")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// davCopyMove copies or moves a file to its Destination. A move keeps the
+// file's metadata and download counts, like /api/v1/files/move; a copy is
+// a new upload of the same build.
+func (h *Handlers) davCopyMove(w http.ResponseWriter, r *http.Request, category, filename string) {
+	dest, err := url.Parse(r.Header.Get("Destination"))
+	if err != nil || r.Header.Get("Destination") == "" {
+		h.sendError(w, http.StatusBadRequest, "Missing or malformed Destination header")
+		return
+	}
+	toCategory, toFilename, ok := davPath(dest.Path)
+	if !ok || !strings.HasPrefix(dest.Path, davPrefix+"/") || toFilename == "" {
+		h.sendError(w, http.StatusForbidden, "Files can only go to a file in a category")
+		return
+	}
+	if !h.cfg.IsValidCategory(toCategory) {
+		h.sendError(w, http.StatusConflict, "No such category: "+toCategory)
+		return
+	}
+	if toCategory == category && toFilename == filename {
+		h.sendError(w, http.StatusForbidden, "Source and destination are the same")
+		return
+	}
+	source, ok := h.davLookup(category, filename)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	_, exists := h.davLookup(toCategory, toFilename)
+	if exists && r.Header.Get("Overwrite") == "F" {
+		h.sendError(w, http.StatusPreconditionFailed, toCategory+"/"+toFilename+" already exists")
+		return
+	}
+
+	from, to := category+"/"+filename, toCategory+"/"+toFilename
+	if r.Method == "COPY" {
+		if !h.davCopy(w, r, source, toCategory, toFilename) {
+			return
+		}
+		h.logger.Printf("Copied: %s -> %s over WebDAV", from, to)
+		h.recordAudit(r, "file.upload", to, "webdav copy of "+from)
+	} else {
+		req := models.MoveRequest{Category: category, Filename: filename, ToCategory: toCategory, ToFilename: toFilename}
+		if status, err := h.validateMove(&req); err != nil {
+			h.davSendError(w, status, err)
+			return
+		}
+		// Overwrite: T replaces the destination, which MoveFile won't do itself
+		move := h.fileService.MoveFile
+		if exists {
+			move = h.fileService.ReplaceFile
+		}
+		if status, err := h.fileError(move(category, filename, toCategory, toFilename)); err != nil {
+			h.davSendError(w, status, err)
+			return
+		}
+		if exists {
+			h.recordAudit(r, "file.delete", to, "webdav overwrite")
+		}
+		h.logger.Printf("Moved: %s -> %s over WebDAV", from, to)
+		h.recordAudit(r, "file.move", from, to)
+	}
+
+	if exists {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+}
+
+// davCopy saves a copy of a local build under another name; it answers
+// and returns false if that isn't possible
+func (h *Handlers) davCopy(w http.ResponseWriter, r *http.Request, source models.FileInfo, toCategory, toFilename string) bool {
+	v := h.validator()
+	v.filename("Destination", toCategory, toFilename)
+	if h.sendInvalid(w, v) {
+		return false
+	}
+	if _, remote := h.fileService.RemoteURL(source.Category, source.Filename); remote {
+		h.sendError(w, http.StatusForbidden, "Builds stored in the bucket can't be copied")
+		return false
+	}
+	if limit := h.cfg.MaxUploadSizeFor(toCategory); source.SizeBytes > limit {
+		h.sendTooLarge(w, limit)
+		return false
+	}
+	path, err := h.fileService.GetFilePath(source.Category, source.Filename)
+	if err != nil {
+		http.NotFound(w, r)
+		return false
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		http.NotFound(w, r)
+		return false
+	}
+	defer file.Close()
+
+	// The source is already public, so a copy that fails is refused, not quarantined
+	image, apk, err := h.checkUploadContent(toCategory, toFilename, file, source.SizeBytes)
+	if err != nil {
+		h.sendError(w, http.StatusBadRequest, err.Error())
+		return false
+	}
+	sums, err := h.fileService.SaveUpload(toCategory, toFilename, file, source.SizeBytes, services.UploadOptions{
+		Uploader: middleware.Identity(r),
+		Image:    image,
+		APK:      apk,
+	})
+	if err != nil {
+		h.sendSaveError(w, r, toCategory, toFilename, nil, sums, err)
+		return false
+	}
+	return true
+}
+
+// davSendError answers with field errors when there are some
+func (h *Handlers) davSendError(w http.ResponseWriter, status int, err error) {
+	var fields fieldErrors
+	if errors.As(err, &fields) {
+		h.sendFieldErrors(w, fields)
+		return
+	}
+	h.sendError(w, status, err.Error())
+}
+
+// davProppatch refuses every property change: all properties here are
+// live ones kept by the server. Clients like Windows Explorer try to set
+// timestamps after a PUT and carry on when told no.
+func (h *Handlers) davProppatch(w http.ResponseWriter, r *http.Request) {
+	var refused []davName
+	dec := xml.NewDecoder(io.LimitReader(r.Body, 1<<20))
+	depth, inProp := 0, 0
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			break
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			depth++
+			if inProp > 0 && depth == inProp+1 {
+				refused = append(refused, davName{XMLName: t.Name})
+			}
+			if t.Name.Space == "DAV:" && t.Name.Local == "prop" {
+				inProp = depth
+			}
+		case xml.EndElement:
+			if depth == inProp {
+				inProp = 0
+			}
+			depth--
+		}
+	}
+	h.sendMultistatus(w, []davResponse{{
+		Href:     r.URL.EscapedPath(),
+		Propstat: []davPropstat{{Prop: davProp{Refused: refused}, Status: davStatus(http.StatusForbidden)}},
+	}})
+}
+
+// davLock grants an exclusive write lock. Finder and Windows only mount a
+// share writable if it supports locking, so locks are handed out, but
+// they're advisory: nothing stops another client writing the same file.
+func (h *Handlers) davLock(w http.ResponseWriter, r *http.Request) {
+	token := ""
+	if m := davLockToken.FindStringSubmatch(r.Header.Get("If")); m != nil {
+		token = m[1] // A refresh keeps its token
+	} else {
+		b := make([]byte, 16)
+		rand.Read(b)
+		token = "opaquelocktoken:" + hex.EncodeToString(b)
+	}
+
+	depth := r.Header.Get("Depth")
+	if depth != "0" {
+		depth = "infinity"
+	}
+	w.Header().Set("Content-Type", `application/xml; charset="utf-8"`)
+	w.Header().Set("Lock-Token", "<"+token+">")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, `%s<D:prop xmlns:D="DAV:"><D:lockdiscovery><D:activelock>`+
+		`<D:locktype><D:write/></D:locktype><D:lockscope><D:exclusive/></D:lockscope>`+
+		`<D:depth>%s</D:depth><D:timeout>%s</D:timeout>`+
+		`<D:locktoken><D:href>%s</D:href></D:locktoken>`+
+		`<D:lockroot><D:href>%s</D:href></D:lockroot>`+
+		`</D:activelock></D:lockdiscovery></D:prop>`,
+		xml.Header, depth, davLockTimeout, xmlEscape(token), xmlEscape(r.URL.EscapedPath()))
+}
+
+// xmlEscape escapes text for an XML element
+func xmlEscape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
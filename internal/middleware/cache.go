@@ -0,0 +1,230 @@
+package middleware
+
+import (
+	"bytes"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxCacheEntries bounds memory use when clients vary query params
+const maxCacheEntries = 1000
+
+// ResponseCache keeps short-lived copies of hot GET responses so polling
+// spikes after a release don't reach FileService for every request
+type ResponseCache struct {
+	mu       sync.Mutex
+	ttl      time.Duration
+	prefixes []string
+	entries  map[string]*cachedResponse
+	inflight map[string]chan struct{}
+}
+
+type cachedResponse struct {
+	status  int
+	header  http.Header
+	body    []byte
+	expires time.Time
+	vary    []string // Request headers the response varies on; see variantKey
+}
+
+// NewResponseCache creates a cache for GET requests under the given path prefixes
+func NewResponseCache(ttl time.Duration, prefixes ...string) *ResponseCache {
+	return &ResponseCache{
+		ttl:      ttl,
+		prefixes: prefixes,
+		entries:  make(map[string]*cachedResponse),
+		inflight: make(map[string]chan struct{}),
+	}
+}
+
+// Purge drops all cached responses
+func (c *ResponseCache) Purge() {
+	c.mu.Lock()
+	c.entries = make(map[string]*cachedResponse)
+	c.mu.Unlock()
+}
+
+// Middleware serves cacheable GETs from memory. Nothing here purges it:
+// the services whose data it holds call Purge when they change, so public
+// POSTs (feedback, ratings, speed tests) can't keep it cold.
+func (c *ResponseCache) Middleware(next http.Handler) http.Handler {
+	if c.ttl <= 0 {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet || !c.cacheable(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		url := r.URL.Path + "?" + r.URL.RawQuery
+		for {
+			c.mu.Lock()
+			key := c.key(url, r)
+			if entry, ok := c.entries[key]; ok && entry.vary == nil && time.Now().Before(entry.expires) {
+				c.mu.Unlock()
+				entry.replay(w, r)
+				return
+			}
+			// Only one request per key rebuilds the entry; the rest wait for it
+			if wait, ok := c.inflight[key]; ok {
+				c.mu.Unlock()
+				<-wait
+				continue
+			}
+			done := make(chan struct{})
+			c.inflight[key] = done
+			c.mu.Unlock()
+
+			// Record the full response, even for clients holding an ETag
+			fresh := r.Clone(r.Context())
+			fresh.Header.Del("If-None-Match")
+			rec := &recordingWriter{header: make(http.Header), status: http.StatusOK}
+			next.ServeHTTP(rec, fresh)
+			entry := c.store(url, r, rec)
+
+			c.mu.Lock()
+			delete(c.inflight, key)
+			c.mu.Unlock()
+			close(done)
+
+			entry.replay(w, r)
+			return
+		}
+	})
+}
+
+// cacheable reports whether a path falls under one of the cached prefixes
+func (c *ResponseCache) cacheable(path string) bool {
+	for _, prefix := range c.prefixes {
+		if path == prefix || (strings.HasSuffix(prefix, "/") && strings.HasPrefix(path, prefix)) {
+			return true
+		}
+	}
+	return false
+}
+
+// key is the cache key of a request for url. A response that varies on
+// request headers leaves an entry holding only those headers under the bare
+// URL, expiring like the variants, and is kept per variant; caller holds c.mu.
+func (c *ResponseCache) key(url string, r *http.Request) string {
+	if e, ok := c.entries[url]; ok && e.vary != nil && time.Now().Before(e.expires) {
+		return variantKey(url, e.vary, r)
+	}
+	return url
+}
+
+// variantKey is the cache key of a request for url, given the request
+// headers the response varies on (e.g. Accept-Language)
+func variantKey(url string, vary []string, r *http.Request) string {
+	key := url
+	for _, name := range vary {
+		key += "\n" + name + ": " + r.Header.Get(name)
+	}
+	return key
+}
+
+// store saves a successful response to a request for url, evicting expired
+// entries when full. A response with a Vary header is kept per variant.
+func (c *ResponseCache) store(url string, r *http.Request, rec *recordingWriter) *cachedResponse {
+	now := time.Now()
+	entry := &cachedResponse{
+		status:  rec.status,
+		header:  rec.header,
+		body:    rec.body.Bytes(),
+		expires: now.Add(c.ttl),
+	}
+	if rec.status != http.StatusOK {
+		return entry
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var vary []string
+	for _, value := range rec.header.Values("Vary") {
+		for _, name := range strings.Split(value, ",") {
+			if name = http.CanonicalHeaderKey(strings.TrimSpace(name)); name == "*" {
+				return entry // Varies on more than headers
+			} else if name != "" {
+				vary = append(vary, name)
+			}
+		}
+	}
+	key := variantKey(url, vary, r)
+
+	if len(c.entries) >= maxCacheEntries {
+		for k, e := range c.entries {
+			if now.After(e.expires) {
+				delete(c.entries, k)
+			}
+		}
+		if len(c.entries) >= maxCacheEntries {
+			return entry
+		}
+	}
+
+	if len(vary) > 0 {
+		c.entries[url] = &cachedResponse{expires: entry.expires, vary: vary}
+	}
+	c.entries[key] = entry
+	return entry
+}
+
+// replay writes a cached response, honouring If-None-Match
+func (e *cachedResponse) replay(w http.ResponseWriter, r *http.Request) {
+	for k, v := range e.header {
+		w.Header()[k] = v
+	}
+
+	if etag := e.header.Get("ETag"); etag != "" && ETagMatches(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.WriteHeader(e.status)
+	w.Write(e.body)
+}
+
+// ETagMatches checks an If-None-Match header (possibly a list) against an
+// ETag, comparing weakly as RFC 9110 asks for GET
+func ETagMatches(header, etag string) bool {
+	if header == "" {
+		return false
+	}
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
+
+// recordingWriter captures a response in memory so it can be cached and replayed
+type recordingWriter struct {
+	header      http.Header
+	status      int
+	body        bytes.Buffer
+	wroteHeader bool
+}
+
+func (rw *recordingWriter) Header() http.Header {
+	return rw.header
+}
+
+func (rw *recordingWriter) WriteHeader(code int) {
+	if rw.wroteHeader {
+		return
+	}
+	rw.wroteHeader = true
+	rw.status = code
+}
+
+func (rw *recordingWriter) Write(p []byte) (int, error) {
+	rw.WriteHeader(http.StatusOK)
+	return rw.body.Write(p)
+}
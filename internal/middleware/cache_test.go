@@ -0,0 +1,96 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestResponseCacheVariants(t *testing.T) {
+	calls := 0
+	c := NewResponseCache(time.Minute, "/list")
+	h := c.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Vary", "accept-language")
+		w.Write([]byte(r.Header.Get("Accept-Language")))
+	}))
+
+	tests := []struct {
+		lang      string
+		wantCalls int
+	}{
+		{"de", 1},
+		{"de", 1},
+		{"pt-BR", 2},
+		{"de", 2},
+		{"pt-BR", 2},
+		{"", 3},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/list", nil)
+		if tt.lang != "" {
+			r.Header.Set("Accept-Language", tt.lang)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Body.String() != tt.lang || calls != tt.wantCalls {
+			t.Errorf("GET /list in %q = %q after %d calls, want %q after %d", tt.lang, w.Body.String(), calls, tt.lang, tt.wantCalls)
+		}
+	}
+
+	// The headers varied on are cached with the responses, and go with them
+	if len(c.entries) != 4 {
+		t.Errorf("cache holds %d entries, want 3 variants and their vary list", len(c.entries))
+	}
+	c.Purge()
+	if len(c.entries) != 0 {
+		t.Errorf("cache holds %d entries after a purge", len(c.entries))
+	}
+}
+
+func TestResponseCacheKeptAcrossPublicWrites(t *testing.T) {
+	calls := 0
+	c := NewResponseCache(time.Minute, "/list")
+	h := c.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			calls++
+		}
+	}))
+
+	get := func() {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/list", nil))
+	}
+	get()
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/api/v1/ratings", nil))
+	get()
+	if calls != 1 {
+		t.Errorf("listing built %d times across a POST, want 1", calls)
+	}
+	c.Purge()
+	get()
+	if calls != 2 {
+		t.Errorf("listing built %d times after a purge, want 2", calls)
+	}
+}
+
+func TestETagMatches(t *testing.T) {
+	tests := []struct {
+		header string
+		etag   string
+		want   bool
+	}{
+		{`"abc"`, `"abc"`, true},
+		{`"abc"`, `W/"abc"`, true},
+		{`W/"abc"`, `"abc"`, true},
+		{`"x", "abc"`, `"abc"`, true},
+		{`*`, `"abc"`, true},
+		{`"abcd"`, `"abc"`, false},
+		{``, `"abc"`, false},
+	}
+	for _, tt := range tests {
+		if got := ETagMatches(tt.header, tt.etag); got != tt.want {
+			t.Errorf("ETagMatches(%q, %q) = %v, want %v", tt.header, tt.etag, got, tt.want)
+		}
+	}
+}
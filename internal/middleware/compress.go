@@ -0,0 +1,149 @@
+package middleware
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// Content types worth compressing; everything else (zips, images) passes through
+var compressibleTypes = []string{
+	"application/json",
+	"application/x-ndjson",
+	"text/",
+	"application/javascript",
+	"image/svg+xml",
+}
+
+var gzipPool = sync.Pool{
+	New: func() interface{} {
+		w, _ := gzip.NewWriterLevel(nil, gzip.DefaultCompression)
+		return w
+	},
+}
+
+// Compress gzips text and JSON responses for clients that accept it.
+// Downloads (WebDAV ones too) are skipped since ROM zips are already
+// compressed and must keep their byte-range and sendfile behaviour.
+func Compress(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/downloads/") || strings.HasPrefix(r.URL.Path, "/dav/") ||
+			r.Header.Get("Range") != "" ||
+			!acceptsGzip(r.Header.Get("Accept-Encoding")) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Add("Vary", "Accept-Encoding")
+
+		cw := &compressWriter{ResponseWriter: w}
+		defer cw.Close()
+
+		next.ServeHTTP(cw, r)
+	})
+}
+
+// acceptsGzip checks an Accept-Encoding header for gzip support
+func acceptsGzip(header string) bool {
+	for _, part := range strings.Split(header, ",") {
+		coding := strings.TrimSpace(strings.SplitN(part, ";", 2)[0])
+		if coding == "gzip" && !strings.Contains(strings.ReplaceAll(part, " ", ""), ";q=0") {
+			return true
+		}
+	}
+	return false
+}
+
+// compressWriter decides on the first write whether the response is compressible
+type compressWriter struct {
+	http.ResponseWriter
+	gz          *gzip.Writer
+	wroteHeader bool
+}
+
+func (cw *compressWriter) WriteHeader(code int) {
+	if cw.wroteHeader {
+		return
+	}
+	cw.wroteHeader = true
+
+	h := cw.Header()
+	if code != http.StatusNoContent && code != http.StatusNotModified &&
+		h.Get("Content-Encoding") == "" && isCompressible(h.Get("Content-Type")) {
+		h.Del("Content-Length")
+		h.Set("Content-Encoding", "gzip")
+
+		cw.gz = gzipPool.Get().(*gzip.Writer)
+		cw.gz.Reset(cw.ResponseWriter)
+	}
+
+	cw.ResponseWriter.WriteHeader(code)
+}
+
+func (cw *compressWriter) Write(p []byte) (int, error) {
+	if !cw.wroteHeader {
+		if cw.Header().Get("Content-Type") == "" {
+			cw.Header().Set("Content-Type", http.DetectContentType(p))
+		}
+		cw.WriteHeader(http.StatusOK)
+	}
+	if cw.gz != nil {
+		return cw.gz.Write(p)
+	}
+	return cw.ResponseWriter.Write(p)
+}
+
+// ReadFrom hands responses that aren't compressed (extracted zips, previews,
+// bundles) to the underlying writer, so copying a file keeps using sendfile
+func (cw *compressWriter) ReadFrom(src io.Reader) (int64, error) {
+	if !cw.wroteHeader && cw.Header().Get("Content-Type") != "" {
+		cw.WriteHeader(http.StatusOK)
+	}
+	if rf, ok := cw.ResponseWriter.(io.ReaderFrom); ok && cw.wroteHeader && cw.gz == nil {
+		return rf.ReadFrom(src)
+	}
+	// Sniffs the type on the first write, or compresses
+	return io.Copy(writerOnly{cw}, src)
+}
+
+// writerOnly hides ReadFrom so io.Copy doesn't call back into it
+type writerOnly struct {
+	io.Writer
+}
+
+// Flush pushes buffered compressed data to the client
+func (cw *compressWriter) Flush() {
+	if cw.gz != nil {
+		cw.gz.Flush()
+	}
+	if f, ok := cw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap exposes the underlying writer to http.ResponseController
+func (cw *compressWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+// Close finishes the gzip stream and returns the writer to the pool
+func (cw *compressWriter) Close() {
+	if cw.gz == nil {
+		return
+	}
+	cw.gz.Close()
+	gzipPool.Put(cw.gz)
+	cw.gz = nil
+}
+
+// isCompressible reports whether a content type benefits from compression
+func isCompressible(contentType string) bool {
+	for _, t := range compressibleTypes {
+		if strings.HasPrefix(contentType, t) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,66 @@
+package middleware
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// readFromRecorder notes whether a response was sent through ReadFrom
+type readFromRecorder struct {
+	*httptest.ResponseRecorder
+	readFrom bool
+}
+
+func (r *readFromRecorder) ReadFrom(src io.Reader) (int64, error) {
+	r.readFrom = true
+	return io.Copy(r.ResponseRecorder, src)
+}
+
+func TestCompressForwardsReadFrom(t *testing.T) {
+	tests := []struct {
+		name         string
+		contentType  string
+		wantReadFrom bool
+		wantEncoding string
+	}{
+		{"zip", "application/zip", true, ""},
+		{"json", "application/json", false, "gzip"},
+		{"sniffed", "", false, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := Compress(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tt.contentType != "" {
+					w.Header().Set("Content-Type", tt.contentType)
+				}
+				io.Copy(w, struct{ io.Reader }{strings.NewReader("PK\x03\x04 body")})
+			}))
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/files/vanilla/rom.zip/extract", nil)
+			req.Header.Set("Accept-Encoding", "gzip")
+			rec := &readFromRecorder{ResponseRecorder: httptest.NewRecorder()}
+			h.ServeHTTP(rec, req)
+
+			if rec.readFrom != tt.wantReadFrom {
+				t.Errorf("ReadFrom used = %v, want %v", rec.readFrom, tt.wantReadFrom)
+			}
+			if got := rec.Header().Get("Content-Encoding"); got != tt.wantEncoding {
+				t.Fatalf("Content-Encoding = %q, want %q", got, tt.wantEncoding)
+			}
+			body := io.Reader(rec.Body)
+			if tt.wantEncoding == "gzip" {
+				gz, err := gzip.NewReader(rec.Body)
+				if err != nil {
+					t.Fatal(err)
+				}
+				body = gz
+			}
+			if got, _ := io.ReadAll(body); string(got) != "PK\x03\x04 body" {
+				t.Errorf("body = %q", got)
+			}
+		})
+	}
+}
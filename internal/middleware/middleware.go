@@ -1,13 +1,23 @@
 package middleware
 
 import (
-	"crypto/subtle"
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"io"
 	"log"
 	"net/http"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"golang.org/x/time/rate"
+
+	"rom-server/internal/cluster"
 	"rom-server/internal/config"
+	"rom-server/internal/models"
 )
 
 // SecurityHeaders adds security headers to all responses
@@ -21,55 +31,130 @@ func SecurityHeaders(next http.Handler) http.Handler {
 	})
 }
 
-// Auth creates an authentication middleware
-func Auth(cfg *config.Config, logger *log.Logger) func(http.HandlerFunc) http.HandlerFunc {
-	apiKey := cfg.Security.DefaultAPIKey
+// writeError answers with the JSON error body handlers use, so clients parse
+// middleware rejections the same way as handler errors
+func writeError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(models.ErrorResponse{Error: message, Code: status})
+}
+
+// identityKey is the request context key holding the authenticated key owner
+type identityKey struct{}
+
+// Identity returns who authenticated the request (config.AdminName or a
+// maintainer's name), or "" if it didn't pass through Auth
+func Identity(r *http.Request) string {
+	name, _ := r.Context().Value(identityKey{}).(string)
+	return name
+}
+
+// KeyLookup identifies the owner of an API key kept outside the config
+type KeyLookup interface {
+	Authenticate(key string) (string, bool)
+}
 
+// Auth creates an authentication middleware. Keys are checked against the
+// config first, then keys (optional); onFailure (optional) is told about
+// every rejected request.
+func Auth(cfg *config.Config, keys KeyLookup, logger *log.Logger, onFailure func(*http.Request)) func(http.HandlerFunc) http.HandlerFunc {
 	return func(next http.HandlerFunc) http.HandlerFunc {
 		return func(w http.ResponseWriter, r *http.Request) {
-			// Get key from header (preferred) or query parameter (never read body)
+			// Get key from header (preferred) or query parameter (never read body).
+			// WebDAV clients can only send it as a Basic password.
 			userKey := r.Header.Get("X-API-Key")
 			if userKey == "" {
 				userKey = r.URL.Query().Get("key")
 			}
+			if _, password, ok := r.BasicAuth(); ok && userKey == "" {
+				userKey = password
+			}
 
-			// Constant time comparison to prevent timing attacks
-			if subtle.ConstantTimeCompare([]byte(userKey), []byte(apiKey)) != 1 {
+			// Constant time comparison against the main key and every maintainer key
+			name, ok := cfg.Authenticate(userKey)
+			if !ok && keys != nil {
+				name, ok = keys.Authenticate(userKey)
+			}
+			if !ok {
 				if logger != nil {
-					logger.Printf("Unauthorized access attempt from %s", r.RemoteAddr)
+					logger.Printf("Unauthorized access attempt from %s", Anonymize(r, r.RemoteAddr))
 				}
-				http.Error(w, cfg.Text.Unauthorized, http.StatusUnauthorized)
+				if onFailure != nil {
+					onFailure(r)
+				}
+				writeError(w, http.StatusUnauthorized, cfg.GetText().Unauthorized)
 				return
 			}
 
-			next(w, r)
+			next(w, r.WithContext(context.WithValue(r.Context(), identityKey{}, name)))
+		}
+	}
+}
+
+// Challenge asks for Basic credentials whenever next answers 401, so WebDAV
+// clients prompt for the API key instead of giving up
+func Challenge(realm string) func(http.HandlerFunc) http.HandlerFunc {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			next(&challengeWriter{responseWriter: responseWriter{ResponseWriter: w}, realm: realm}, r)
 		}
 	}
 }
 
-// RateLimiter implements a token bucket rate limiter
+// challengeWriter adds the WWW-Authenticate header to a 401
+type challengeWriter struct {
+	responseWriter
+	realm string
+}
+
+func (cw *challengeWriter) WriteHeader(code int) {
+	if code == http.StatusUnauthorized {
+		cw.Header().Set("WWW-Authenticate", fmt.Sprintf("Basic realm=%q, charset=\"UTF-8\"", cw.realm))
+	}
+	cw.responseWriter.WriteHeader(code)
+}
+
+// RateLimiter implements per-IP token buckets (golang.org/x/time/rate) in a
+// sharded map so concurrent requests don't serialize on a single mutex
 type RateLimiter struct {
-	mu       sync.Mutex
-	clients  map[string]*clientBucket
-	rate     int           // Tokens per interval
-	burst    int           // Max burst size
-	interval time.Duration // Token refill interval
-	cleanup  time.Duration // Cleanup interval for old entries
+	shards      []*limiterShard
+	mu          sync.RWMutex  // Guards limit, burst and rangeFactor, which change on config reload
+	limit       rate.Limit    // Tokens per second, refilled continuously
+	burst       int           // Max burst size
+	rangeFactor int           // Multiple of the limits allowed for ranged downloads
+	cleanup     time.Duration // Idle time after which a client is forgotten
 }
 
-type clientBucket struct {
-	tokens     int
-	lastRefill time.Time
+type limiterShard struct {
+	mu      sync.Mutex
+	clients map[string]*clientLimiter
 }
 
+type clientLimiter struct {
+	limiter  *rate.Limiter
+	ranges   *rate.Limiter // Ranged downloads; created on the first one
+	lastSeen time.Time
+}
+
+// defaultShards is used when the configured shard count is not positive
+const defaultShards = 32
+
 // NewRateLimiter creates a new rate limiter
-func NewRateLimiter(requestsPerMinute, burstSize int) *RateLimiter {
+func NewRateLimiter(requestsPerMinute, burstSize, shards int) *RateLimiter {
+	if shards < 1 {
+		shards = defaultShards
+	}
+
 	rl := &RateLimiter{
-		clients:  make(map[string]*clientBucket),
-		rate:     requestsPerMinute,
-		burst:    burstSize,
-		interval: time.Minute,
-		cleanup:  5 * time.Minute,
+		shards:      make([]*limiterShard, shards),
+		limit:       rate.Limit(float64(requestsPerMinute) / 60),
+		burst:       burstSize,
+		rangeFactor: 1,
+		cleanup:     5 * time.Minute,
+	}
+	for i := range rl.shards {
+		rl.shards[i] = &limiterShard{clients: make(map[string]*clientLimiter)}
 	}
 
 	// Start cleanup goroutine
@@ -78,77 +163,256 @@ func NewRateLimiter(requestsPerMinute, burstSize int) *RateLimiter {
 	return rl
 }
 
+// shard picks the shard owning an IP
+func (rl *RateLimiter) shard(ip string) *limiterShard {
+	h := fnv.New32a()
+	h.Write([]byte(ip))
+	return rl.shards[h.Sum32()%uint32(len(rl.shards))]
+}
+
 // Allow checks if a request from the given IP should be allowed
 func (rl *RateLimiter) Allow(ip string) bool {
-	rl.mu.Lock()
-	defer rl.mu.Unlock()
+	// rate.Limiter is safe for concurrent use
+	return rl.client(ip, false).Allow()
+}
+
+// AllowRange checks a ranged download from the given IP against its own
+// budget, rangeFactor times the request limits
+func (rl *RateLimiter) AllowRange(ip string) bool {
+	return rl.client(ip, true).Allow()
+}
 
-	now := time.Now()
-	bucket, exists := rl.clients[ip]
+// client returns the request or ranged download bucket of an IP, creating
+// it on first use
+func (rl *RateLimiter) client(ip string, ranges bool) *rate.Limiter {
+	shard := rl.shard(ip)
 
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+	client, exists := shard.clients[ip]
 	if !exists {
-		rl.clients[ip] = &clientBucket{
-			tokens:     rl.burst - 1, // Use one token for this request
-			lastRefill: now,
-		}
-		return true
+		rl.mu.RLock()
+		client = &clientLimiter{limiter: rate.NewLimiter(rl.limit, rl.burst)}
+		rl.mu.RUnlock()
+		shard.clients[ip] = client
 	}
-
-	// Refill tokens based on time passed
-	elapsed := now.Sub(bucket.lastRefill)
-	tokensToAdd := int(elapsed.Minutes() * float64(rl.rate))
-	
-	if tokensToAdd > 0 {
-		bucket.tokens = min(bucket.tokens+tokensToAdd, rl.burst)
-		bucket.lastRefill = now
+	client.lastSeen = time.Now()
+	if !ranges {
+		return client.limiter
+	}
+	if client.ranges == nil {
+		rl.mu.RLock()
+		client.ranges = rate.NewLimiter(rl.limit*rate.Limit(rl.rangeFactor), rl.burst*rl.rangeFactor)
+		rl.mu.RUnlock()
 	}
+	return client.ranges
+}
+
+// SetLimits changes the rate for new and already tracked clients
+func (rl *RateLimiter) SetLimits(requestsPerMinute, burstSize int) {
+	limit := rate.Limit(float64(requestsPerMinute) / 60)
 
-	// Check if we have tokens available
-	if bucket.tokens > 0 {
-		bucket.tokens--
-		return true
+	rl.mu.Lock()
+	rl.limit, rl.burst = limit, burstSize
+	factor := rl.rangeFactor
+	rl.mu.Unlock()
+
+	for _, shard := range rl.shards {
+		shard.mu.Lock()
+		for _, client := range shard.clients {
+			client.limiter.SetLimit(limit)
+			client.limiter.SetBurst(burstSize)
+			if client.ranges != nil {
+				client.ranges.SetLimit(limit * rate.Limit(factor))
+				client.ranges.SetBurst(burstSize * factor)
+			}
+		}
+		shard.mu.Unlock()
 	}
+}
 
-	return false
+// SetRangeFactor sets how many times the request limits ranged downloads
+// get, e.g. the segments one download may use; it applies to clients seen
+// from now on
+func (rl *RateLimiter) SetRangeFactor(factor int) {
+	rl.mu.Lock()
+	rl.rangeFactor = max(factor, 1)
+	rl.mu.Unlock()
+}
+
+// Forget drops the state of every client whose key matches and returns how
+// many there were
+func (rl *RateLimiter) Forget(match func(key string) bool) int {
+	forgotten := 0
+	for _, shard := range rl.shards {
+		shard.mu.Lock()
+		for ip := range shard.clients {
+			if match(ip) {
+				delete(shard.clients, ip)
+				forgotten++
+			}
+		}
+		shard.mu.Unlock()
+	}
+	return forgotten
 }
 
-// cleanupLoop removes old entries periodically
+// cleanupLoop removes idle clients periodically
 func (rl *RateLimiter) cleanupLoop() {
 	ticker := time.NewTicker(rl.cleanup)
 	defer ticker.Stop()
 
 	for range ticker.C {
-		rl.mu.Lock()
 		cutoff := time.Now().Add(-rl.cleanup)
-		for ip, bucket := range rl.clients {
-			if bucket.lastRefill.Before(cutoff) {
-				delete(rl.clients, ip)
+		for _, shard := range rl.shards {
+			shard.mu.Lock()
+			for ip, client := range shard.clients {
+				if client.lastSeen.Before(cutoff) {
+					delete(shard.clients, ip)
+				}
 			}
+			shard.mu.Unlock()
 		}
-		rl.mu.Unlock()
 	}
 }
 
-// RateLimit creates a rate limiting middleware
-func RateLimit(cfg *config.Config, logger *log.Logger) func(http.Handler) http.Handler {
-	if !cfg.Security.RateLimit.Enabled {
-		return func(next http.Handler) http.Handler { return next }
+// Limiter decides whether a client may make another request
+type Limiter interface {
+	Allow(ip string) bool
+	AllowRange(ip string) bool
+	SetLimits(requestsPerMinute, burstSize int)
+	SetRangeFactor(factor int)
+}
+
+// SharedRateLimiter enforces per-IP limits across all cluster instances
+// using fixed one-minute windows in the shared store. If the store is
+// unreachable it falls back to the local limiter rather than failing open.
+type SharedRateLimiter struct {
+	store    cluster.Store
+	perMin   int64
+	factor   int64 // Multiple of perMin allowed for ranged downloads
+	fallback *RateLimiter
+	logger   *log.Logger
+	warnedAt int64 // Unix minute of the last fallback warning
+}
+
+// NewSharedRateLimiter creates a fleet-wide limiter
+func NewSharedRateLimiter(store cluster.Store, requestsPerMinute, burstSize int, fallback *RateLimiter, logger *log.Logger) *SharedRateLimiter {
+	sl := &SharedRateLimiter{
+		store:    store,
+		factor:   1,
+		fallback: fallback,
+		logger:   logger,
+	}
+	sl.SetLimits(requestsPerMinute, burstSize)
+	return sl
+}
+
+// SetLimits changes the per-minute allowance (and the local fallback)
+func (sl *SharedRateLimiter) SetLimits(requestsPerMinute, burstSize int) {
+	perMin := requestsPerMinute
+	if burstSize > perMin {
+		perMin = burstSize
+	}
+	atomic.StoreInt64(&sl.perMin, int64(perMin))
+	if sl.fallback != nil {
+		sl.fallback.SetLimits(requestsPerMinute, burstSize)
+	}
+}
+
+// SetRangeFactor sets how many times the per-minute allowance ranged
+// downloads get (and for the local fallback)
+func (sl *SharedRateLimiter) SetRangeFactor(factor int) {
+	atomic.StoreInt64(&sl.factor, int64(max(factor, 1)))
+	if sl.fallback != nil {
+		sl.fallback.SetRangeFactor(factor)
+	}
+}
+
+// Allow checks if a request from the given IP should be allowed
+func (sl *SharedRateLimiter) Allow(ip string) bool {
+	return sl.allow("ratelimit:"+ip, atomic.LoadInt64(&sl.perMin), func() bool { return sl.fallback.Allow(ip) })
+}
+
+// AllowRange checks a ranged download from the given IP against its own,
+// larger allowance
+func (sl *SharedRateLimiter) AllowRange(ip string) bool {
+	perMin := atomic.LoadInt64(&sl.perMin) * atomic.LoadInt64(&sl.factor)
+	return sl.allow("ratelimit:range:"+ip, perMin, func() bool { return sl.fallback.AllowRange(ip) })
+}
+
+// allow counts a request under prefix in this minute's window, or asks
+// fallback if the store can't be reached
+func (sl *SharedRateLimiter) allow(prefix string, perMin int64, fallback func() bool) bool {
+	window := time.Now().Unix() / 60
+	key := fmt.Sprintf("%s:%d", prefix, window)
+
+	count, err := sl.store.IncrWithTTL(key, 2*time.Minute)
+	if err != nil {
+		// Warn at most once a minute instead of once per request
+		if sl.logger != nil && atomic.SwapInt64(&sl.warnedAt, window) != window {
+			sl.logger.Printf("Shared rate limiter unavailable, using local limits: %v", err)
+		}
+		return fallback()
 	}
+	return count <= perMin
+}
 
-	limiter := NewRateLimiter(
-		cfg.Security.RateLimit.RequestsPerMinute,
-		cfg.Security.RateLimit.BurstSize,
-	)
+// RateLimit creates a rate limiting middleware over local; with a shared
+// store the limits apply across the whole fleet instead of per instance and
+// local is the fallback. Settings are re-read per request so a config reload
+// takes effect immediately.
+func RateLimit(cfg *config.Config, local *RateLimiter, shared cluster.Store, logger *log.Logger) func(http.Handler) http.Handler {
+	current := cfg.GetRateLimit()
+
+	var limiter Limiter = local
+	if shared != nil {
+		limiter = NewSharedRateLimiter(shared, current.RequestsPerMinute, current.BurstSize, local, logger)
+	}
+	// Segmented downloaders open up to max_segments_per_client ranged
+	// requests per file, so ranges get that many times the budget
+	limiter.SetRangeFactor(cfg.Concurrency.MaxSegmentsPerClient)
+
+	// Limits currently applied, packed as rpm<<32 | burst so the hot path is a
+	// single atomic load; the mutex only serializes the rare update
+	var applied int64 = limitsKey(current)
+	var updating sync.Mutex
 
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			ip := getClientIP(r)
-			
-			if !limiter.Allow(ip) {
+			settings := cfg.GetRateLimit()
+			if !settings.Enabled {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if key := limitsKey(settings); atomic.LoadInt64(&applied) != key {
+				updating.Lock()
+				if atomic.LoadInt64(&applied) != key {
+					limiter.SetLimits(settings.RequestsPerMinute, settings.BurstSize)
+					atomic.StoreInt64(&applied, key)
+				}
+				updating.Unlock()
+			}
+
+			key := ClientIP(r)
+			if shared != nil {
+				// The shared store is storage too, so it only sees pseudonyms
+				if a, _ := r.Context().Value(anonymizerKey{}).(*Anonymizer); a != nil {
+					key = a.Pseudonym(key)
+				}
+			}
+
+			// Segments of one download come in bursts that would cut aria2c
+			// off mid-file, so ranged downloads are counted on their own
+			allow := limiter.Allow
+			if r.Header.Get("Range") != "" && strings.HasPrefix(r.URL.Path, "/downloads/") {
+				allow = limiter.AllowRange
+			}
+			if !allow(key) {
 				if logger != nil {
-					logger.Printf("Rate limit exceeded for %s", ip)
+					logger.Printf("Rate limit exceeded for %s", LoggedIP(r))
 				}
-				http.Error(w, "Too Many Requests", http.StatusTooManyRequests)
+				writeError(w, http.StatusTooManyRequests, "Too Many Requests")
 				return
 			}
 
@@ -157,6 +421,11 @@ func RateLimit(cfg *config.Config, logger *log.Logger) func(http.Handler) http.H
 	}
 }
 
+// limitsKey packs the rate and burst into one comparable value
+func limitsKey(rl config.RateLimitConfig) int64 {
+	return int64(rl.RequestsPerMinute)<<32 | int64(uint32(rl.BurstSize))
+}
+
 // RequestLogger logs all incoming requests
 func RequestLogger(logger *log.Logger, enabled bool) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
@@ -166,10 +435,10 @@ func RequestLogger(logger *log.Logger, enabled bool) func(http.Handler) http.Han
 
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			start := time.Now()
-			
+
 			// Wrap response writer to capture status code
 			wrapped := &responseWriter{ResponseWriter: w, statusCode: http.StatusOK}
-			
+
 			next.ServeHTTP(wrapped, r)
 
 			logger.Printf("%s %s %d %s %s",
@@ -177,7 +446,7 @@ func RequestLogger(logger *log.Logger, enabled bool) func(http.Handler) http.Han
 				r.URL.Path,
 				wrapped.statusCode,
 				time.Since(start),
-				getClientIP(r),
+				LoggedIP(r),
 			)
 		})
 	}
@@ -194,14 +463,30 @@ func (rw *responseWriter) WriteHeader(code int) {
 	rw.ResponseWriter.WriteHeader(code)
 }
 
+// ReadFrom passes through to the underlying writer so downloads keep the
+// sendfile fast path; hiding it here would force userspace copies
+func (rw *responseWriter) ReadFrom(r io.Reader) (int64, error) {
+	if rf, ok := rw.ResponseWriter.(io.ReaderFrom); ok {
+		return rf.ReadFrom(r)
+	}
+	return io.Copy(rw.ResponseWriter, r)
+}
+
+// Unwrap lets http.ResponseController reach the connection, e.g. to abort a
+// transfer by moving its deadlines
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
 // CORS adds CORS headers for API endpoints
 func CORS(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, DELETE, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PATCH, DELETE, OPTIONS")
 		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, X-API-Key")
 
-		if r.Method == "OPTIONS" {
+		// WebDAV clients send OPTIONS to discover the share, not as a preflight
+		if r.Method == "OPTIONS" && !strings.HasPrefix(r.URL.Path, "/dav/") {
 			w.WriteHeader(http.StatusOK)
 			return
 		}
@@ -210,8 +495,8 @@ func CORS(next http.Handler) http.Handler {
 	})
 }
 
-// getClientIP extracts the client IP from request
-func getClientIP(r *http.Request) string {
+// ClientIP extracts the client IP from request
+func ClientIP(r *http.Request) string {
 	// Check X-Forwarded-For header (for reverse proxy)
 	if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
 		return xff
@@ -223,10 +508,3 @@ func getClientIP(r *http.Request) string {
 	// Fall back to RemoteAddr
 	return r.RemoteAddr
 }
-
-func min(a, b int) int {
-	if a < b {
-		return a
-	}
-	return b
-}
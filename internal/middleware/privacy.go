@@ -0,0 +1,219 @@
+package middleware
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"rom-server/internal/cluster"
+)
+
+// saltKey is the shared store key of a day's salt, so every node of a
+// cluster hashes an address the same way
+const saltKey = "privacy:salt:"
+
+// Anonymizer replaces client addresses with something that can be logged
+// and stored without identifying anyone: a salted hash, or the address with
+// its host part zeroed. The salt is random, changes at midnight UTC and is
+// never written anywhere but memory (and the shared store in cluster mode,
+// where it expires after two days), so yesterday's hashes can't be reversed
+// or linked to today's.
+type Anonymizer struct {
+	truncate bool
+	shared   cluster.Store // Optional
+	mu       sync.Mutex
+	day      string
+	salt     []byte
+}
+
+// NewAnonymizer creates an anonymizer for mode "hash" or "truncate"
+func NewAnonymizer(mode string, shared cluster.Store) *Anonymizer {
+	return &Anonymizer{truncate: mode == "truncate", shared: shared}
+}
+
+// Anonymize hides every address in addr, which may carry a port or be an
+// X-Forwarded-For list. A nil Anonymizer returns addr as it is.
+func (a *Anonymizer) Anonymize(addr string) string {
+	if a == nil {
+		return addr
+	}
+	parts := strings.Split(addr, ",")
+	for i, part := range parts {
+		host := hostOf(part)
+		if a.truncate {
+			parts[i] = truncateIP(host)
+		} else {
+			parts[i] = a.Pseudonym(host)
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Pseudonym returns the salted hash of an address, the same for the same
+// address until the salt changes
+func (a *Anonymizer) Pseudonym(addr string) string {
+	mac := hmac.New(sha256.New, a.currentSalt())
+	mac.Write([]byte(addr))
+	return "anon-" + hex.EncodeToString(mac.Sum(nil))[:16]
+}
+
+// currentSalt returns today's salt, picking a new one after midnight UTC
+func (a *Anonymizer) currentSalt() []byte {
+	day := time.Now().UTC().Format("2006-01-02")
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if day == a.day {
+		return a.salt
+	}
+
+	buf := make([]byte, 32)
+	rand.Read(buf)
+	salt := hex.EncodeToString(buf)
+	if a.shared != nil {
+		// First node to need one today sets it; the rest adopt it
+		if _, err := a.shared.SetNX(saltKey+day, salt, 48*time.Hour); err == nil {
+			if stored, err := a.shared.Get(saltKey + day); err == nil && stored != "" {
+				salt = stored
+			}
+		}
+	}
+	a.day, a.salt = day, []byte(salt)
+	return a.salt
+}
+
+// truncateIP zeroes the host part of an address: the last octet of IPv4,
+// all but the first 48 bits of IPv6
+func truncateIP(host string) string {
+	ip := net.ParseIP(host)
+	switch {
+	case ip == nil:
+		return "unknown"
+	case ip.To4() != nil:
+		return ip.Mask(net.CIDRMask(24, 32)).String()
+	default:
+		return ip.Mask(net.CIDRMask(48, 128)).String()
+	}
+}
+
+// hostOf strips the port and surrounding space from a recorded address and
+// spells IPs the canonical way, so one address always hashes the same
+func hostOf(addr string) string {
+	host := strings.TrimSpace(addr)
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		return ip.String()
+	}
+	return host
+}
+
+// anonymizerKey is the request context key holding the Anonymizer
+type anonymizerKey struct{}
+
+// Privacy makes a (optional) available to Anonymize and LoggedIP for every
+// request. It must wrap everything that logs or stores client addresses.
+func Privacy(a *Anonymizer) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if a == nil {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), anonymizerKey{}, a)))
+		})
+	}
+}
+
+// Anonymize returns addr as it may be logged or stored for this request:
+// anonymized in privacy mode, unchanged otherwise
+func Anonymize(r *http.Request, addr string) string {
+	a, _ := r.Context().Value(anonymizerKey{}).(*Anonymizer)
+	return a.Anonymize(addr)
+}
+
+// LoggedIP is ClientIP as it may be logged or stored. Limits and other
+// in-memory bookkeeping keep using ClientIP.
+func LoggedIP(r *http.Request) string {
+	return Anonymize(r, ClientIP(r))
+}
+
+// AddressMatcher picks out one client's addresses in stored records for a
+// privacy purge. Recorded addresses may carry a port, a key owner's name
+// ("alice@203.0.113.7:51234") or be a forwarded-for list. In hash privacy
+// mode an address also matches today's pseudonym of it and the other way
+// round; older pseudonyms have to be given as they are.
+type AddressMatcher struct {
+	subjects map[string]bool
+	anon     *Anonymizer
+}
+
+// NewAddressMatcher matches the given addresses and pseudonyms, using the
+// request's Anonymizer if privacy mode is on
+func NewAddressMatcher(r *http.Request, subjects ...string) *AddressMatcher {
+	a, _ := r.Context().Value(anonymizerKey{}).(*Anonymizer)
+	if a != nil && a.truncate {
+		a = nil // Networks are shared; never purge by them
+	}
+	m := &AddressMatcher{subjects: make(map[string]bool), anon: a}
+	for _, s := range subjects {
+		if s = hostOf(s); s == "" {
+			continue
+		}
+		m.subjects[s] = true
+		if a != nil && net.ParseIP(s) != nil {
+			m.subjects[a.Pseudonym(s)] = true
+		}
+	}
+	return m
+}
+
+// Subjects lists what is searched for, addresses and pseudonyms
+func (m *AddressMatcher) Subjects() []string {
+	subjects := make([]string, 0, len(m.subjects))
+	for s := range m.subjects {
+		subjects = append(subjects, s)
+	}
+	sort.Strings(subjects)
+	return subjects
+}
+
+// Match reports whether a recorded address belongs to the client
+func (m *AddressMatcher) Match(recorded string) bool {
+	if i := strings.LastIndex(recorded, "@"); i >= 0 {
+		recorded = recorded[i+1:]
+	}
+	for _, part := range strings.Split(recorded, ",") {
+		host := hostOf(part)
+		if m.subjects[host] {
+			return true
+		}
+		if m.anon != nil && net.ParseIP(host) != nil && m.subjects[m.anon.Pseudonym(host)] {
+			return true
+		}
+	}
+	return false
+}
+
+// Redact replaces the client's addresses in free text with "purged"
+func (m *AddressMatcher) Redact(text string) (string, bool) {
+	words := strings.Split(text, " ")
+	changed := false
+	for i, word := range words {
+		if m.Match(strings.TrimRight(word, ",;.")) {
+			words[i] = PurgedAddress + word[len(strings.TrimRight(word, ",;.")):]
+			changed = true
+		}
+	}
+	return strings.Join(words, " "), changed
+}
+
+// PurgedAddress stands in for a client address removed by a purge
+const PurgedAddress = "purged"
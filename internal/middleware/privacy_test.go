@@ -0,0 +1,95 @@
+package middleware
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAddressMatcherRedact(t *testing.T) {
+	hashed := NewAnonymizer("hash", nil)
+	tests := []struct {
+		name        string
+		anon        *Anonymizer
+		subjects    []string
+		text        string
+		want        string
+		wantChanged bool
+	}{
+		{
+			name:        "plain address",
+			subjects:    []string{"203.0.113.7"},
+			text:        "download from 203.0.113.7 failed",
+			want:        "download from purged failed",
+			wantChanged: true,
+		},
+		{
+			name:        "port, owner and punctuation",
+			subjects:    []string{"203.0.113.7"},
+			text:        "key used by alice@203.0.113.7:51234, then revoked.",
+			want:        "key used by purged, then revoked.",
+			wantChanged: true,
+		},
+		{
+			name:        "forwarded-for list",
+			subjects:    []string{"203.0.113.7"},
+			text:        "via 10.0.0.1,203.0.113.7;",
+			want:        "via purged;",
+			wantChanged: true,
+		},
+		{
+			name:        "ipv6 spelled differently",
+			subjects:    []string{"2001:DB8:0::1"},
+			text:        "from [2001:db8::1]:443",
+			want:        "from purged",
+			wantChanged: true,
+		},
+		{
+			name:     "other client",
+			subjects: []string{"203.0.113.7"},
+			text:     "download from 203.0.113.70 and 198.51.100.7",
+			want:     "download from 203.0.113.70 and 198.51.100.7",
+		},
+		{
+			name:     "no subjects",
+			subjects: []string{" "},
+			text:     "download from 203.0.113.7",
+			want:     "download from 203.0.113.7",
+		},
+		{
+			name:        "today's pseudonym of an address",
+			anon:        hashed,
+			subjects:    []string{"203.0.113.7"},
+			text:        "download from " + hashed.Pseudonym("203.0.113.7"),
+			want:        "download from purged",
+			wantChanged: true,
+		},
+		{
+			name:        "address of a pseudonym given",
+			anon:        hashed,
+			subjects:    []string{hashed.Pseudonym("203.0.113.7")},
+			text:        "download from 203.0.113.7",
+			want:        "download from purged",
+			wantChanged: true,
+		},
+		{
+			name:     "truncated networks are shared",
+			anon:     NewAnonymizer("truncate", nil),
+			subjects: []string{"203.0.113.7"},
+			text:     "download from 203.0.113.0",
+			want:     "download from 203.0.113.0",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			if tt.anon != nil {
+				r = r.WithContext(context.WithValue(r.Context(), anonymizerKey{}, tt.anon))
+			}
+			got, changed := NewAddressMatcher(r, tt.subjects...).Redact(tt.text)
+			if got != tt.want || changed != tt.wantChanged {
+				t.Errorf("Redact(%q) = %q, %v, want %q, %v", tt.text, got, changed, tt.want, tt.wantChanged)
+			}
+		})
+	}
+}
@@ -4,14 +4,169 @@ import "time"
 
 // FileInfo represents a file in the storage
 type FileInfo struct {
+	Category   string            `json:"category"`
+	Filename   string            `json:"filename"`
+	Size       string            `json:"size"`
+	SizeBytes  int64             `json:"size_bytes"`
+	UpdatedAt  string            `json:"updated_at"`
+	Downloads  int64             `json:"downloads"`
+	SHA256     string            `json:"sha256,omitempty"`
+	SHA1       string            `json:"sha1,omitempty"`
+	MD5        string            `json:"md5,omitempty"`
+	URL        string            `json:"url,omitempty"` // Percent-encoded download URL: the CDN's (signed if configured) or /downloads/...
+	Pinned     bool              `json:"pinned,omitempty"`
+	Tags       []string          `json:"tags,omitempty"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+	Release    *ReleaseInfo      `json:"release,omitempty"`
+	Notes      string            `json:"notes,omitempty"`
+	Uploader   string            `json:"uploader,omitempty"`
+	ShortURL   string            `json:"short_url,omitempty"` // /d/{code}, redirecting to url
+	Rating     *Rating           `json:"rating,omitempty"`    // Thumbs up/down from users
+	ModTime    time.Time         `json:"-"`                   // Parsed UpdatedAt, for sorting
+	Fallback   bool              `json:"fallback,omitempty"`  // The build it replaced is kept until this one proves good
+	Image      *ImageInfo        `json:"image,omitempty"`     // Set for boot, recovery, vendor_boot and vbmeta images
+	APK        *APKInfo          `json:"apk,omitempty"`       // Set in APK categories
+
+	Verification *Verification `json:"verification,omitempty"` // Checked against an imported checksum manifest
+}
+
+// FileMetadata is the persisted per-file metadata
+type FileMetadata struct {
+	SHA256     string            `json:"sha256,omitempty"`
+	SHA1       string            `json:"sha1,omitempty"`
+	MD5        string            `json:"md5,omitempty"`
+	ObjectKey  string            `json:"object_key,omitempty"`  // Set when the file lives in the object store
+	Size       int64             `json:"size,omitempty"`        // Object size (remote files only)
+	UploadedAt int64             `json:"uploaded_at,omitempty"` // Unix time of finalize (remote files only)
+	Pinned     bool              `json:"pinned,omitempty"`      // Never removed by automatic cleanup
+	Tags       []string          `json:"tags,omitempty"`
+	Attributes map[string]string `json:"attributes,omitempty"` // Free-form key/value pairs, e.g. android_version
+	Release    *ReleaseInfo      `json:"release,omitempty"`    // Structured build info supplied at upload
+	Notes      string            `json:"notes,omitempty"`      // Short release notes, e.g. "First build with working VoLTE"
+	Uploader   string            `json:"uploader,omitempty"`   // Owner of the API key that uploaded the file
+	PublishAt  int64             `json:"publish_at,omitempty"` // Unix time a held upload goes public
+	Preview    string            `json:"preview,omitempty"`    // Token for downloading a held upload
+	ShortCode  string            `json:"short_code,omitempty"` // Code of the /d/{code} short link
+	// Held uploads only: keep the build this one replaces until it proves good
+	KeepPrevious bool `json:"keep_previous,omitempty"`
+	// Held uploads only: the release transaction it goes public with
+	Transaction string `json:"transaction,omitempty"`
+	// Read from the header of an Android image upload
+	Image *ImageInfo `json:"image,omitempty"`
+	// Read from the manifest and signature of an APK upload
+	APK *APKInfo `json:"apk,omitempty"`
+	// Outcome of checking the build against an imported checksum manifest
+	Verification *Verification `json:"verification,omitempty"`
+}
+
+// Verification records how a build compared to the SHA-256 its build
+// system listed in a checksum manifest
+type Verification struct {
+	Status     string    `json:"status"`             // "verified" or "mismatch"
+	Expected   string    `json:"expected,omitempty"` // Manifest SHA-256, set on a mismatch
+	VerifiedAt time.Time `json:"verified_at"`
+}
+
+// ManifestReport is the outcome of importing a checksum manifest
+type ManifestReport struct {
+	Category   string             `json:"category"`
+	Verified   []string           `json:"verified"`
+	Mismatched []ManifestMismatch `json:"mismatched"`
+	Pending    []string           `json:"pending"` // Not uploaded yet; checked when they arrive
+}
+
+// ManifestMismatch is a build whose SHA-256 differs from its manifest entry
+type ManifestMismatch struct {
+	Filename string `json:"filename"`
+	Expected string `json:"expected"`
+	Actual   string `json:"actual"`
+}
+
+// ExpectedChecksum is a manifest entry waiting for its build to be uploaded
+type ExpectedChecksum struct {
+	Category   string    `json:"category"`
+	Filename   string    `json:"filename"`
+	SHA256     string    `json:"sha256"`
+	ImportedAt time.Time `json:"imported_at"`
+}
+
+// APKInfo describes an Android app package
+type APKInfo struct {
+	Package       string `json:"package"`
+	VersionCode   int64  `json:"version_code"`
+	VersionName   string `json:"version_name,omitempty"`
+	MinSDK        int    `json:"min_sdk,omitempty"`
+	CertSHA256    string `json:"cert_sha256,omitempty"`    // SHA-256 of the signing certificate
+	SigningScheme string `json:"signing_scheme,omitempty"` // v3, v2 or v1 (JAR)
+}
+
+// ImageInfo describes an Android boot, recovery, vendor_boot or vbmeta image
+type ImageInfo struct {
+	Type          string `json:"type"`           // boot, vendor_boot or vbmeta
+	HeaderVersion int    `json:"header_version"` // Boot image header version, or AVB major version
+	PageSize      int64  `json:"page_size,omitempty"`
+	KernelVersion string `json:"kernel_version,omitempty"` // From the kernel's version banner, e.g. "5.10.177-android12-9"
+	RamdiskSize   int64  `json:"ramdisk_size,omitempty"`
+	OSVersion     string `json:"os_version,omitempty"`     // e.g. "14.0.0"
+	OSPatchLevel  string `json:"os_patch_level,omitempty"` // YYYY-MM
+	AVBVersion    string `json:"avb_version,omitempty"`    // libavb version a vbmeta image needs, e.g. "1.0"
+}
+
+// ReleaseInfo describes a build, sent as the "metadata" part of an upload
+type ReleaseInfo struct {
+	Maintainer     string `json:"maintainer,omitempty"`
+	AndroidVersion string `json:"android_version,omitempty"` // e.g. "14" or "13.0"
+	BuildType      string `json:"build_type,omitempty"`      // user, userdebug or eng
+	SecurityPatch  string `json:"security_patch,omitempty"`  // YYYY-MM-DD
+
+	// What has to be in place before flashing, so updaters can warn first
+	RequiredFirmware string `json:"required_firmware,omitempty"` // Minimum firmware, e.g. "V14.0.6.0.TKHMIXM"
+	RequiredRecovery string `json:"required_recovery,omitempty"` // e.g. "TWRP 3.7.0" or "OrangeFox"
+	WipeData         bool   `json:"wipe_data,omitempty"`         // Needs a clean flash (data wiped)
+	WipeCache        bool   `json:"wipe_cache,omitempty"`        // Needs cache and ART cache wiped
+}
+
+// Checksums holds the digests computed while a file is written
+type Checksums struct {
+	SHA256 string `json:"sha256"`
+	SHA1   string `json:"sha1,omitempty"`
+	MD5    string `json:"md5"`
+}
+
+// FileStats represents the raw download breakdown of a file for admins
+type FileStats struct {
+	Category  string           `json:"category"`
+	Filename  string           `json:"filename"`
+	Downloads int64            `json:"downloads"`
+	Total     int64            `json:"total"`
+	Clients   map[string]int64 `json:"clients"`
+	Referrers map[string]int64 `json:"referrers,omitempty"` // Short link visits per referring site
+	Feedback  map[string]int64 `json:"feedback,omitempty"`  // Approved feedback per outcome
+}
+
+// DailyStat represents the downloads of a file on a single day
+type DailyStat struct {
+	Date      string `json:"date"`
 	Category  string `json:"category"`
 	Filename  string `json:"filename"`
-	Size      string `json:"size"`
-	SizeBytes int64  `json:"size_bytes"`
-	UpdatedAt string `json:"updated_at"`
 	Downloads int64  `json:"downloads"`
 }
 
+// AdminStatsResponse wraps the download breakdown for admins
+type AdminStatsResponse struct {
+	Files       []FileStats `json:"files"`
+	ExcludeBots bool        `json:"exclude_bots"`
+}
+
+// AuditEntry represents a single administrative action
+type AuditEntry struct {
+	Time    time.Time `json:"time"`
+	Action  string    `json:"action"`
+	Actor   string    `json:"actor"`
+	Target  string    `json:"target"`
+	Details string    `json:"details,omitempty"`
+}
+
 // UploadRequest represents an upload request
 type UploadRequest struct {
 	Category string
@@ -21,29 +176,247 @@ type UploadRequest struct {
 
 // UploadResponse represents the response after upload
 type UploadResponse struct {
-	Success  bool   `json:"success"`
-	Message  string `json:"message"`
-	Filename string `json:"filename,omitempty"`
-	Category string `json:"category,omitempty"`
+	Success     bool   `json:"success"`
+	Message     string `json:"message"`
+	Filename    string `json:"filename,omitempty"`
+	Category    string `json:"category,omitempty"`
+	SHA256      string `json:"sha256,omitempty"`
+	SHA1        string `json:"sha1,omitempty"`
+	MD5         string `json:"md5,omitempty"`
+	PublishAt   string `json:"publish_at,omitempty"`  // Set when the file is held until then
+	PreviewURL  string `json:"preview_url,omitempty"` // Set for held uploads
+	Transaction string `json:"transaction,omitempty"` // Set for uploads held in a transaction
+	URL         string `json:"url,omitempty"`         // Set once the file is public
+	ShortURL    string `json:"short_url,omitempty"`   // Short link to url
+}
+
+// PendingFile is an upload that isn't public yet
+type PendingFile struct {
+	Category    string `json:"category"`
+	Filename    string `json:"filename"`
+	Size        string `json:"size"`
+	SizeBytes   int64  `json:"size_bytes"`
+	SHA256      string `json:"sha256,omitempty"`
+	Uploader    string `json:"uploader,omitempty"`
+	PublishAt   string `json:"publish_at,omitempty"`  // RFC 3339; empty for staged uploads
+	PreviewURL  string `json:"preview_url"`           // Downloads the file before it is public
+	Transaction string `json:"transaction,omitempty"` // Goes public together with the rest of it
+}
+
+// QuarantinedFile is an upload set aside for review instead of published:
+// it failed deep validation, the virus scanner flagged it or its hash is
+// on the blocklist
+type QuarantinedFile struct {
+	ID            string    `json:"id"`
+	Category      string    `json:"category"`
+	Filename      string    `json:"filename"`
+	Size          string    `json:"size"`
+	SizeBytes     int64     `json:"size_bytes"`
+	SHA256        string    `json:"sha256"`
+	Uploader      string    `json:"uploader,omitempty"`
+	Reason        string    `json:"reason"` // "invalid", "malware" or "blocklist"
+	Details       string    `json:"details,omitempty"`
+	QuarantinedAt time.Time `json:"quarantined_at"`
+}
+
+// PresignedUploadResponse tells a client where to PUT a file directly
+type PresignedUploadResponse struct {
+	UploadURL   string            `json:"upload_url"`
+	Method      string            `json:"method"`
+	Headers     map[string]string `json:"headers,omitempty"` // Must be sent with the PUT
+	ObjectKey   string            `json:"object_key"`
+	ExpiresAt   time.Time         `json:"expires_at"`
+	FinalizeURL string            `json:"finalize_url"` // POST here once the PUT succeeded
 }
 
 // CategoryInfo represents category details for API
 type CategoryInfo struct {
-	Name        string `json:"name"`
-	DisplayName string `json:"display_name"`
-	Description string `json:"description"`
-	MaxFiles    int    `json:"max_files"`
-	FileCount   int    `json:"file_count"`
+	Name           string   `json:"name"`
+	DisplayName    string   `json:"display_name"`
+	Description    string   `json:"description"`
+	MaxFiles       int      `json:"max_files"`
+	FileCount      int      `json:"file_count"`
+	AllowedExts    []string `json:"allowed_extensions"`
+	MaxUploadBytes int64    `json:"max_upload_bytes"`
+	Restricted     bool     `json:"restricted,omitempty"` // Beta: shown to testers and API keys only
 }
 
 // ConfigResponse represents public configuration for frontend
 type ConfigResponse struct {
-	AppName     string         `json:"app_name"`
-	AppTitle    string         `json:"app_title"`
-	AppSubtitle string         `json:"app_subtitle"`
-	DeviceName  string         `json:"device_name"`
-	Categories  []CategoryInfo `json:"categories"`
-	Text        TextMessages   `json:"text"`
+	AppName       string         `json:"app_name"`
+	AppTitle      string         `json:"app_title"`
+	AppSubtitle   string         `json:"app_subtitle"`
+	DeviceName    string         `json:"device_name"`
+	Categories    []CategoryInfo `json:"categories"`
+	Text          TextMessages   `json:"text"`
+	Announcements []Announcement `json:"announcements"`
+	MaxSegments   int            `json:"max_segments_per_client"` // Parallel connections a download may use
+	Links         []Link         `json:"links"`                   // Donation, forum and source links
+	Lang          string         `json:"lang"`                    // Locale of the text, e.g. "pt_BR"
+	Languages     []string       `json:"languages"`               // Locales the text is available in
+}
+
+// BootstrapResponse is everything the download page loads on start, in one
+// response
+type BootstrapResponse struct {
+	Config ConfigResponse `json:"config"` // As /api/config, with category stats and announcements
+	Files  []FileInfo     `json:"files"`  // As /list
+	Pages  []PageSummary  `json:"pages"`  // As /api/v1/pages
+}
+
+// Link is a support or project link of the maintainers
+type Link struct {
+	Label string `json:"label"`
+	URL   string `json:"url"`
+	Type  string `json:"type"` // donate, sponsor, forum, source, chat, website or other
+}
+
+// Announcement is a banner shown on the download page until it expires
+type Announcement struct {
+	ID        string `json:"id"`
+	Message   string `json:"message"`
+	Severity  string `json:"severity"`             // "info", "warning" or "critical"
+	ExpiresAt string `json:"expires_at,omitempty"` // RFC 3339; empty = until deleted
+	CreatedAt string `json:"created_at"`
+}
+
+// Feedback is a field report on one build. It stays hidden until a
+// moderator approves it; Client is only shown to admins.
+type Feedback struct {
+	ID        string `json:"id"`
+	Category  string `json:"category"`
+	Filename  string `json:"filename"`
+	SHA256    string `json:"sha256,omitempty"` // Build the report was made against
+	Outcome   string `json:"outcome"`
+	Device    string `json:"device,omitempty"`
+	Message   string `json:"message,omitempty"`
+	Approved  bool   `json:"approved"`
+	Client    string `json:"client,omitempty"`
+	CreatedAt string `json:"created_at"`
+}
+
+// FeedbackSummary is the approved feedback on a build with a tally per outcome
+type FeedbackSummary struct {
+	Category string           `json:"category"`
+	Filename string           `json:"filename"`
+	Outcomes map[string]int64 `json:"outcomes"`
+	Feedback []Feedback       `json:"feedback"` // Newest first
+}
+
+// Rating is the users' thumbs up/down tally on a build
+type Rating struct {
+	Up   int64 `json:"up"`
+	Down int64 `json:"down"`
+}
+
+// Page is a maintainer-written Markdown page for a device: flashing
+// instructions, known issues, firmware requirements
+type Page struct {
+	Device    string `json:"device"` // Codename, e.g. "beryllium"
+	Title     string `json:"title"`
+	Content   string `json:"content"`        // Markdown
+	HTML      string `json:"html,omitempty"` // Content rendered for display; not stored
+	UpdatedAt string `json:"updated_at"`
+}
+
+// PageSummary is a page in the page index, without its content
+type PageSummary struct {
+	Device    string `json:"device"`
+	Title     string `json:"title"`
+	UpdatedAt string `json:"updated_at"`
+	URL       string `json:"url"`
+}
+
+// PurgeResult is what a purge did to one store
+type PurgeResult struct {
+	Store    string `json:"store"`
+	Removed  int    `json:"removed"`
+	Redacted int    `json:"redacted,omitempty"`
+	Note     string `json:"note,omitempty"`
+}
+
+// PurgeReport lists what a purge searched for and what it deleted
+type PurgeReport struct {
+	Subjects []string      `json:"subjects"` // Addresses and pseudonyms matched
+	Results  []PurgeResult `json:"results"`
+	PurgedAt string        `json:"purged_at"`
+}
+
+// APIKey is a named key from the key store. Only a hash of the key is kept;
+// Prefix (its first characters) tells keys apart in listings.
+type APIKey struct {
+	Name      string `json:"name"`
+	Hash      string `json:"hash"` // Hex SHA-256 of the key
+	Prefix    string `json:"prefix"`
+	CreatedAt string `json:"created_at"`
+}
+
+// Tester is a beta tester on the allowlist of restricted categories. Only a
+// hash of their token is kept.
+type Tester struct {
+	Name       string   `json:"name"` // Email address or handle
+	Hash       string   `json:"hash"` // Hex SHA-256 of the token
+	Prefix     string   `json:"prefix"`
+	Categories []string `json:"categories,omitempty"` // Restricted categories they see; empty = all
+	CreatedAt  string   `json:"created_at"`
+}
+
+// TesterRequest adds a beta tester
+type TesterRequest struct {
+	Name       string   `json:"name"`
+	Categories []string `json:"categories"`
+}
+
+// TesterResponse describes a beta tester to admins. Token is only set in the
+// answer to adding them.
+type TesterResponse struct {
+	Name       string   `json:"name"`
+	Prefix     string   `json:"prefix"`
+	Categories []string `json:"categories,omitempty"`
+	CreatedAt  string   `json:"created_at"`
+	Token      string   `json:"token,omitempty"`
+}
+
+// ReportRequest flags a published build as broken, mislabeled or abusive
+type ReportRequest struct {
+	Category string `json:"category"`
+	Filename string `json:"filename"`
+	Reason   string `json:"reason"`  // broken, mislabeled, abuse or other
+	Message  string `json:"message"` // Optional details from the reporter
+}
+
+// FeedbackRequest is a user's field report on a published build
+type FeedbackRequest struct {
+	Category string `json:"category"`
+	Filename string `json:"filename"`
+	Outcome  string `json:"outcome"` // works, issues or bootloop
+	Device   string `json:"device"`  // Optional device or firmware, e.g. "beryllium, MIUI 12 fw"
+	Message  string `json:"message"` // Optional details, e.g. "bootloops after flashing Magisk"
+}
+
+// RatingRequest is a user's vote on a build
+type RatingRequest struct {
+	Vote string `json:"vote"` // up or down
+}
+
+// PageRequest creates or replaces a device page
+type PageRequest struct {
+	Title   string `json:"title"` // Defaults to the device codename
+	Content string `json:"content"`
+}
+
+// PurgeRequest names a client whose records are to be deleted: an address,
+// a privacy-mode pseudonym ("anon-..."), or both
+type PurgeRequest struct {
+	IP     string `json:"ip"`
+	IPHash string `json:"ip_hash"`
+}
+
+// AnnouncementRequest creates or replaces an announcement
+type AnnouncementRequest struct {
+	Message   string `json:"message"`
+	Severity  string `json:"severity"`   // Defaults to "info"
+	ExpiresAt string `json:"expires_at"` // RFC 3339, optional
 }
 
 // TextMessages contains all UI text messages
@@ -62,15 +435,233 @@ type HealthResponse struct {
 	Version   string    `json:"version"`
 }
 
+// VersionResponse describes the running build
+type VersionResponse struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildDate string `json:"build_date"`
+	GoVersion string `json:"go_version"`
+	Modified  bool   `json:"modified,omitempty"` // Built from a tree with uncommitted changes
+}
+
+// BadgeResponse follows the shields.io endpoint schema
+type BadgeResponse struct {
+	SchemaVersion int    `json:"schemaVersion"`
+	Label         string `json:"label"`
+	Message       string `json:"message"`
+	Color         string `json:"color"`
+}
+
+// WebhookEvent is the payload posted to the configured webhook
+type WebhookEvent struct {
+	Event     string    `json:"event"`
+	Text      string    `json:"text"`
+	Category  string    `json:"category,omitempty"`
+	Filename  string    `json:"filename,omitempty"`
+	Downloads int64     `json:"downloads,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// TrafficResponse reports bytes served per month and the cap status
+type TrafficResponse struct {
+	Months       map[string]map[string]int64 `json:"months"`
+	CurrentMonth string                      `json:"current_month"`
+	CurrentBytes int64                       `json:"current_bytes"`
+	CapBytes     int64                       `json:"cap_bytes"`
+	CapReached   bool                        `json:"cap_reached"`
+}
+
 // ErrorResponse for standardized error responses
 type ErrorResponse struct {
-	Error   string `json:"error"`
-	Code    int    `json:"code"`
-	Details string `json:"details,omitempty"`
+	Error        string       `json:"error"`
+	Code         int          `json:"code"`
+	Details      string       `json:"details,omitempty"`
+	LimitBytes   int64        `json:"limit_bytes,omitempty"`   // Size limit a 413 refers to
+	QuarantineID string       `json:"quarantine_id,omitempty"` // Where a refused upload was set aside
+	Fields       []FieldError `json:"fields,omitempty"`        // Every invalid field of a 400
+}
+
+// FieldError names a request field (query, form or JSON key) and what is
+// wrong with it
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
 }
 
 // ListResponse wraps file list with metadata
 type ListResponse struct {
 	Files      []FileInfo `json:"files"`
-	TotalCount int        `json:"total_count"`
+	TotalCount int        `json:"total_count"`      // Matching files on every page
+	Offset     int        `json:"offset,omitempty"` // As requested with ?offset=
+	Limit      int        `json:"limit,omitempty"`  // As requested with ?limit=, capped
+}
+
+// FileChecksums is one published build in the checksum listing
+type FileChecksums struct {
+	Category  string `json:"category"`
+	Filename  string `json:"filename"`
+	SizeBytes int64  `json:"size_bytes"`
+	SHA256    string `json:"sha256,omitempty"`
+	SHA1      string `json:"sha1,omitempty"`
+	MD5       string `json:"md5,omitempty"`
+	URL       string `json:"url"`
+}
+
+// ChecksumsResponse lists the checksums of published builds
+type ChecksumsResponse struct {
+	Files      []FileChecksums `json:"files"`
+	TotalCount int             `json:"total_count"`
+}
+
+// MoveRequest relocates and/or renames a published file; omitted destination
+// fields keep the current category or name
+type MoveRequest struct {
+	Category   string `json:"category"`
+	Filename   string `json:"filename"`
+	ToCategory string `json:"to_category,omitempty"`
+	ToFilename string `json:"to_filename,omitempty"`
+}
+
+// LabelPatch updates a file's tags, attributes and notes. Tags replaces the
+// set when present; attributes are merged and a null value removes the key;
+// notes replaces the text when present ("" clears it).
+type LabelPatch struct {
+	Category   string             `json:"category"`
+	Filename   string             `json:"filename"`
+	Tags       []string           `json:"tags,omitempty"`
+	Attributes map[string]*string `json:"attributes,omitempty"`
+	Notes      *string            `json:"notes,omitempty"`
+}
+
+// TransferInfo describes an in-flight upload or download
+type TransferInfo struct {
+	ID             string  `json:"id"`
+	Kind           string  `json:"kind"` // "upload" or "download"
+	Category       string  `json:"category"`
+	Filename       string  `json:"filename"`
+	Client         string  `json:"client"`
+	User           string  `json:"user,omitempty"` // Key owner, for uploads
+	Bytes          int64   `json:"bytes"`
+	TotalBytes     int64   `json:"total_bytes,omitempty"` // Expected size when known
+	BytesPerSecond int64   `json:"bytes_per_second"`      // Average since the start
+	StartedAt      string  `json:"started_at"`
+	ElapsedSeconds float64 `json:"elapsed_seconds"`
+	IdleSeconds    float64 `json:"idle_seconds"` // Since bytes last moved; high values mean a stalled client
+}
+
+// PublishRequest makes a held upload, or a whole transaction of them, public
+type PublishRequest struct {
+	Category    string `json:"category,omitempty"`
+	Filename    string `json:"filename,omitempty"`
+	Transaction string `json:"transaction,omitempty"` // Instead of category and filename
+}
+
+// TransactionResponse lists the files a transaction published or discarded
+type TransactionResponse struct {
+	Transaction string   `json:"transaction"`
+	Files       []string `json:"files,omitempty"` // category/filename, when published
+	Count       int      `json:"count"`
+}
+
+// FallbackRequest names a build whose kept previous build is confirmed
+// away or restored
+type FallbackRequest struct {
+	Category string `json:"category"`
+	Filename string `json:"filename"`
+}
+
+// PinRequest pins or unpins a published file
+type PinRequest struct {
+	Category string `json:"category"`
+	Filename string `json:"filename"`
+	Pinned   bool   `json:"pinned"`
+}
+
+// BulkOperation is one item of a bulk request. Op is "delete", "move", "pin"
+// or "unpin"; the destination fields only apply to moves.
+type BulkOperation struct {
+	Op         string `json:"op"`
+	Category   string `json:"category"`
+	Filename   string `json:"filename"`
+	ToCategory string `json:"to_category,omitempty"`
+	ToFilename string `json:"to_filename,omitempty"`
+}
+
+// BulkRequest batches file operations into one call
+type BulkRequest struct {
+	Operations []BulkOperation `json:"operations"`
+}
+
+// BulkResult reports the outcome of one bulk operation
+type BulkResult struct {
+	BulkOperation
+	Success bool         `json:"success"`
+	Status  int          `json:"status"`
+	Error   string       `json:"error,omitempty"`
+	Fields  []FieldError `json:"fields,omitempty"`
+}
+
+// BulkResponse lists per-item results in request order
+type BulkResponse struct {
+	Results   []BulkResult `json:"results"`
+	Succeeded int          `json:"succeeded"`
+	Failed    int          `json:"failed"`
+}
+
+// ZipEntryInfo describes one file inside a zip build
+type ZipEntryInfo struct {
+	Path           string `json:"path"`
+	Size           int64  `json:"size"`            // Uncompressed bytes
+	CompressedSize int64  `json:"compressed_size"` // Bytes in the archive
+	CRC32          string `json:"crc32"`           // Hex, as unzip -v shows it
+	Method         string `json:"method"`          // "store", "deflate" or "method-<n>"
+	Modified       string `json:"modified,omitempty"`
+}
+
+// ZipContentsResponse lists the entries of a zip build in archive order
+type ZipContentsResponse struct {
+	Category   string         `json:"category"`
+	Filename   string         `json:"filename"`
+	Entries    []ZipEntryInfo `json:"entries"`
+	TotalCount int            `json:"total_count"`
+	TotalSize  int64          `json:"total_size"` // Sum of uncompressed sizes
+}
+
+// SpeedTestPayload is one test download offered under /speedtest/
+type SpeedTestPayload struct {
+	Name  string `json:"name"` // e.g. "10mb"
+	Bytes int64  `json:"bytes"`
+	URL   string `json:"url"`
+}
+
+// SpeedTestIndex lists the test payloads and where to report results
+type SpeedTestIndex struct {
+	Payloads   []SpeedTestPayload `json:"payloads"`
+	ResultsURL string             `json:"results_url"`
+}
+
+// SpeedTestReport is a client's measurement of one test payload. Source
+// names what was measured, e.g. this server or a mirror the client tried.
+type SpeedTestReport struct {
+	Payload    string `json:"payload"`
+	DurationMs int64  `json:"duration_ms"`
+	Source     string `json:"source,omitempty"`
+}
+
+// SpeedTestResult is a recorded measurement
+type SpeedTestResult struct {
+	Time   time.Time `json:"time"`
+	Source string    `json:"source"`
+	Bytes  int64     `json:"bytes"`
+	Mbps   float64   `json:"mbps"`
+}
+
+// SpeedTestSummary aggregates recent results of one source
+type SpeedTestSummary struct {
+	Source     string    `json:"source"`
+	Tests      int       `json:"tests"`
+	MedianMbps float64   `json:"median_mbps"`
+	P10Mbps    float64   `json:"p10_mbps"` // Slowest tenth of clients are below this
+	P90Mbps    float64   `json:"p90_mbps"`
+	LastAt     time.Time `json:"last_at"`
 }
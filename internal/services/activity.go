@@ -0,0 +1,84 @@
+package services
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"rom-server/internal/models"
+)
+
+// authFailureHistory is how many failed logins the activity feed remembers
+const authFailureHistory = 200
+
+// ActionAuthFailure marks a rejected API key in the activity feed
+const ActionAuthFailure = "auth.failure"
+
+// ActivityFeed merges the audit log with recent failed logins. Failures are
+// kept in memory only, so a burst of bad keys can't flood the audit log.
+type ActivityFeed struct {
+	audit    *AuditLog
+	mu       sync.Mutex
+	failures []models.AuditEntry // Oldest first
+}
+
+// NewActivityFeed creates a feed over audit (which may be nil)
+func NewActivityFeed(audit *AuditLog) *ActivityFeed {
+	return &ActivityFeed{audit: audit}
+}
+
+// RecordAuthFailure notes a request rejected for a missing or wrong API key
+func (f *ActivityFeed) RecordAuthFailure(client, path string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.failures = append(f.failures, models.AuditEntry{
+		Time:   time.Now(),
+		Action: ActionAuthFailure,
+		Actor:  client,
+		Target: path,
+	})
+	if len(f.failures) > authFailureHistory {
+		f.failures = append([]models.AuditEntry(nil), f.failures[len(f.failures)-authFailureHistory:]...)
+	}
+}
+
+// Recent returns up to limit events newer than since, newest first
+func (f *ActivityFeed) Recent(limit int, since time.Time) ([]models.AuditEntry, error) {
+	events, err := f.audit.Recent(limit)
+	if err != nil {
+		return nil, err
+	}
+
+	f.mu.Lock()
+	events = append(events, f.failures...)
+	f.mu.Unlock()
+
+	sort.SliceStable(events, func(i, j int) bool { return events[i].Time.After(events[j].Time) })
+
+	feed := make([]models.AuditEntry, 0, limit)
+	for _, e := range events {
+		if len(feed) == limit || !e.Time.After(since) {
+			break
+		}
+		feed = append(feed, e)
+	}
+	return feed, nil
+}
+
+// PurgeAuthFailures forgets the failed logins from one client and returns
+// how many there were
+func (f *ActivityFeed) PurgeAuthFailures(m AddressMatcher) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	kept := f.failures[:0]
+	for _, e := range f.failures {
+		if !m.Match(e.Actor) {
+			kept = append(kept, e)
+		}
+	}
+	purged := len(f.failures) - len(kept)
+	f.failures = kept
+	return purged
+}
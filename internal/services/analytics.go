@@ -0,0 +1,56 @@
+package services
+
+import (
+	"strings"
+
+	"rom-server/internal/config"
+)
+
+// Client classes used to break down download statistics
+const (
+	ClientBrowser = "browser"
+	ClientAria2   = "aria2"
+	ClientCLI     = "cli"
+	ClientUpdater = "updater"
+	ClientBot     = "bot"
+	ClientUnknown = "unknown"
+)
+
+// Built-in substrings identifying crawlers and link-preview fetchers
+var defaultBotAgents = []string{
+	"bot", "crawler", "spider", "slurp", "facebookexternalhit",
+	"embedly", "preview", "headlesschrome", "python-requests", "go-http-client",
+	"photon-serve-mirror",
+}
+
+// ClassifyUserAgent maps a User-Agent header to a client class
+func ClassifyUserAgent(ua string, cfg config.AnalyticsConfig) string {
+	lower := strings.ToLower(ua)
+	if lower == "" {
+		return ClientUnknown
+	}
+
+	// Updater apps are checked first so a custom agent containing "bot" isn't misfiled
+	for _, agent := range cfg.UpdaterAgents {
+		if agent != "" && strings.Contains(lower, strings.ToLower(agent)) {
+			return ClientUpdater
+		}
+	}
+
+	for _, agent := range append(defaultBotAgents, cfg.BotAgents...) {
+		if agent != "" && strings.Contains(lower, strings.ToLower(agent)) {
+			return ClientBot
+		}
+	}
+
+	switch {
+	case strings.Contains(lower, "aria2"):
+		return ClientAria2
+	case strings.HasPrefix(lower, "curl/"), strings.HasPrefix(lower, "wget/"):
+		return ClientCLI
+	case strings.HasPrefix(lower, "mozilla/"):
+		return ClientBrowser
+	}
+
+	return ClientUnknown
+}
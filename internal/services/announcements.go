@@ -0,0 +1,196 @@
+package services
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"rom-server/internal/models"
+)
+
+// maxAnnouncementLen bounds a banner message
+const maxAnnouncementLen = 500
+
+// Announcement severities, in display order
+var severities = map[string]int{"critical": 0, "warning": 1, "info": 2}
+
+// AnnouncementStore keeps download page banners in a JSON file, so every
+// node sharing the upload dir in cluster mode shows the same banners.
+type AnnouncementStore struct {
+	mu sync.Mutex
+	jsonFile[[]models.Announcement]
+}
+
+// NewAnnouncementStore loads the announcements file at path (missing file is fine)
+func NewAnnouncementStore(path string) (*AnnouncementStore, error) {
+	a := &AnnouncementStore{jsonFile: jsonFile[[]models.Announcement]{path: path, name: "announcements", perm: 0644}}
+	if err := a.refresh(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// Restore replaces the announcements with a file unpacked from a backup
+func (a *AnnouncementStore) Restore(src string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.restore(src)
+}
+
+// All returns every announcement, expired ones included, most severe first
+func (a *AnnouncementStore) All() ([]models.Announcement, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if err := a.refresh(); err != nil {
+		return nil, err
+	}
+	items := append([]models.Announcement{}, a.data...)
+	sortAnnouncements(items)
+	return items, nil
+}
+
+// Active returns the announcements that haven't expired, most severe
+// first. A nil store or an unreadable file yields none.
+func (a *AnnouncementStore) Active() []models.Announcement {
+	if a == nil {
+		return []models.Announcement{}
+	}
+	items, err := a.All()
+	if err != nil {
+		return []models.Announcement{}
+	}
+
+	now := time.Now()
+	active := items[:0]
+	for _, item := range items {
+		if !announcementExpired(item, now) {
+			active = append(active, item)
+		}
+	}
+	return active
+}
+
+// Create adds an announcement
+func (a *AnnouncementStore) Create(req models.AnnouncementRequest) (models.Announcement, error) {
+	item, err := announcementFromRequest(req)
+	if err != nil {
+		return models.Announcement{}, err
+	}
+	if item.ID, err = newAnnouncementID(); err != nil {
+		return models.Announcement{}, err
+	}
+	item.CreatedAt = time.Now().UTC().Format(time.RFC3339)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if err := a.refresh(); err != nil {
+		return models.Announcement{}, err
+	}
+	items := append(append([]models.Announcement{}, a.data...), item)
+	return item, a.save(items)
+}
+
+// Update replaces the message, severity and expiry of an announcement
+func (a *AnnouncementStore) Update(id string, req models.AnnouncementRequest) (models.Announcement, error) {
+	next, err := announcementFromRequest(req)
+	if err != nil {
+		return models.Announcement{}, err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if err := a.refresh(); err != nil {
+		return models.Announcement{}, err
+	}
+	items := append([]models.Announcement{}, a.data...)
+	for i := range items {
+		if items[i].ID == id {
+			next.ID, next.CreatedAt = id, items[i].CreatedAt
+			items[i] = next
+			return next, a.save(items)
+		}
+	}
+	return models.Announcement{}, ErrNotFound
+}
+
+// Delete removes an announcement
+func (a *AnnouncementStore) Delete(id string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if err := a.refresh(); err != nil {
+		return err
+	}
+	items := make([]models.Announcement, 0, len(a.data))
+	for _, item := range a.data {
+		if item.ID != id {
+			items = append(items, item)
+		}
+	}
+	if len(items) == len(a.data) {
+		return ErrNotFound
+	}
+	return a.save(items)
+}
+
+// announcementFromRequest validates and normalizes a create or update
+func announcementFromRequest(req models.AnnouncementRequest) (models.Announcement, error) {
+	item := models.Announcement{
+		Message:  strings.TrimSpace(req.Message),
+		Severity: strings.ToLower(strings.TrimSpace(req.Severity)),
+	}
+	if item.Message == "" {
+		return item, &InvalidField{Field: "message", Message: "is required"}
+	}
+	if utf8.RuneCountInString(item.Message) > maxAnnouncementLen {
+		return item, &InvalidField{Field: "message", Message: fmt.Sprintf("is longer than %d characters", maxAnnouncementLen)}
+	}
+	if item.Severity == "" {
+		item.Severity = "info"
+	}
+	if _, ok := severities[item.Severity]; !ok {
+		return item, &InvalidField{Field: "severity", Message: fmt.Sprintf("%q must be info, warning or critical", item.Severity)}
+	}
+	if req.ExpiresAt != "" {
+		expires, err := time.Parse(time.RFC3339, req.ExpiresAt)
+		if err != nil {
+			return item, &InvalidField{Field: "expires_at", Message: fmt.Sprintf("%q must be RFC 3339 (2024-06-01T18:00:00Z)", req.ExpiresAt)}
+		}
+		item.ExpiresAt = expires.UTC().Format(time.RFC3339)
+	}
+	return item, nil
+}
+
+// announcementExpired reports whether an announcement's expiry has passed
+func announcementExpired(item models.Announcement, now time.Time) bool {
+	if item.ExpiresAt == "" {
+		return false
+	}
+	expires, err := time.Parse(time.RFC3339, item.ExpiresAt)
+	return err == nil && !now.Before(expires)
+}
+
+// sortAnnouncements orders by severity, then newest first
+func sortAnnouncements(items []models.Announcement) {
+	sort.SliceStable(items, func(i, j int) bool {
+		if si, sj := severities[items[i].Severity], severities[items[j].Severity]; si != sj {
+			return si < sj
+		}
+		return items[i].CreatedAt > items[j].CreatedAt
+	})
+}
+
+// newAnnouncementID returns a short random identifier
+func newAnnouncementID() (string, error) {
+	token, err := newPreviewToken()
+	if err != nil {
+		return "", err
+	}
+	return token[:12], nil
+}
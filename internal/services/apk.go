@@ -0,0 +1,421 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/asn1"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+
+	"rom-server/internal/models"
+)
+
+// ErrInvalidAPK means an upload to an APK category isn't an APK we can read
+var ErrInvalidAPK = errors.New("invalid APK")
+
+const (
+	maxManifestSize = 4 << 20 // Binary AndroidManifest.xml read at most
+	maxSignerSize   = 1 << 20 // v1 signature block read at most
+)
+
+// Binary XML chunk types (frameworks/base/libs/androidfw ResourceTypes.h)
+const (
+	axmlStringPool   = 0x0001
+	axmlResourceMap  = 0x0180
+	axmlStartElement = 0x0102
+	axmlUTF8Flag     = 1 << 8
+	axmlTypeString   = 0x03
+	axmlTypeIntDec   = 0x10
+	axmlTypeIntHex   = 0x11
+)
+
+// Attribute resource IDs, for manifests whose attribute names are stripped
+const (
+	attrVersionCode   = 0x0101021b
+	attrVersionName   = 0x0101021c
+	attrMinSdkVersion = 0x0101020c
+)
+
+// APK Signature Scheme v2/v3 block (source.android.com/docs/security/features/apksigning)
+var apkSigBlockMagic = []byte("APK Sig Block 42")
+
+const (
+	apkSigV2 = 0x7109871a
+	apkSigV3 = 0xf05368c0
+)
+
+// InspectAPK reads the package name, version and minimum SDK from an APK's
+// manifest and the SHA-256 of its signing certificate, preferring the v3
+// and v2 signing blocks over v1 (JAR) signatures. An APK that isn't signed
+// is accepted without a certificate digest.
+func InspectAPK(r io.ReaderAt, size int64) (*models.APKInfo, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidAPK, err)
+	}
+	manifest := zipEntry(zr, "AndroidManifest.xml")
+	if manifest == nil {
+		return nil, fmt.Errorf("%w: no AndroidManifest.xml", ErrInvalidAPK)
+	}
+	data, err := readZipEntry(manifest, maxManifestSize)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidAPK, err)
+	}
+	info, err := parseManifest(data)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidAPK, err)
+	}
+
+	if cert, scheme := signingBlockCert(r, size); cert != nil {
+		info.CertSHA256, info.SigningScheme = certDigest(cert), scheme
+	} else if cert := jarSignerCert(zr); cert != nil {
+		info.CertSHA256, info.SigningScheme = certDigest(cert), "v1"
+	}
+	return info, nil
+}
+
+// zipEntry finds a file in an archive by name
+func zipEntry(zr *zip.Reader, name string) *zip.File {
+	for _, f := range zr.File {
+		if f.Name == name {
+			return f
+		}
+	}
+	return nil
+}
+
+// readZipEntry reads a whole archive entry, refusing ones over limit
+func readZipEntry(f *zip.File, limit int64) ([]byte, error) {
+	if f.UncompressedSize64 > uint64(limit) {
+		return nil, fmt.Errorf("%s is larger than %d bytes", f.Name, limit)
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return io.ReadAll(io.LimitReader(rc, limit))
+}
+
+// certDigest is the SHA-256 of a DER certificate, as apksigner prints it
+func certDigest(der []byte) string {
+	sum := sha256.Sum256(der)
+	return hex.EncodeToString(sum[:])
+}
+
+// parseManifest reads the <manifest> and <uses-sdk> attributes out of a
+// binary AndroidManifest.xml
+func parseManifest(data []byte) (*models.APKInfo, error) {
+	le := binary.LittleEndian
+	if len(data) < 8 || le.Uint16(data) != 0x0003 {
+		return nil, errors.New("AndroidManifest.xml isn't binary XML")
+	}
+
+	var strs []string
+	var resIDs []uint32
+	info := &models.APKInfo{}
+	for off := int(le.Uint16(data[2:])); off+8 <= len(data); {
+		chunkType, headerSize := le.Uint16(data[off:]), int(le.Uint16(data[off+2:]))
+		chunkSize := int(le.Uint32(data[off+4:]))
+		if chunkSize < 8 || off+chunkSize > len(data) || headerSize < 8 || headerSize > chunkSize {
+			return nil, errors.New("AndroidManifest.xml is truncated")
+		}
+		chunk := data[off : off+chunkSize]
+		switch chunkType {
+		case axmlStringPool:
+			var err error
+			if strs, err = parseStringPool(chunk); err != nil {
+				return nil, err
+			}
+		case axmlResourceMap:
+			for i := headerSize; i+4 <= len(chunk); i += 4 {
+				resIDs = append(resIDs, le.Uint32(chunk[i:]))
+			}
+		case axmlStartElement:
+			if err := readManifestElement(chunk, headerSize, strs, resIDs, info); err != nil {
+				return nil, err
+			}
+		}
+		off += chunkSize
+	}
+	if info.Package == "" {
+		return nil, errors.New("manifest has no package name")
+	}
+	return info, nil
+}
+
+// parseStringPool decodes a binary XML string pool, UTF-8 or UTF-16
+func parseStringPool(chunk []byte) ([]string, error) {
+	le := binary.LittleEndian
+	if len(chunk) < 28 {
+		return nil, errors.New("string pool is truncated")
+	}
+	headerSize := int(le.Uint16(chunk[2:]))
+	count, flags := int(le.Uint32(chunk[8:])), le.Uint32(chunk[16:])
+	stringsStart := int(le.Uint32(chunk[20:]))
+	if headerSize+count*4 > len(chunk) || stringsStart > len(chunk) {
+		return nil, errors.New("string pool is truncated")
+	}
+
+	strs := make([]string, count)
+	for i := range strs {
+		at := stringsStart + int(le.Uint32(chunk[headerSize+i*4:]))
+		if at >= len(chunk) {
+			return nil, errors.New("string pool is truncated")
+		}
+		if flags&axmlUTF8Flag != 0 {
+			strs[i] = utf8PoolString(chunk[at:])
+		} else {
+			strs[i] = utf16PoolString(chunk[at:])
+		}
+	}
+	return strs, nil
+}
+
+// utf8PoolString reads a string pool entry: UTF-16 length, UTF-8 length
+// (each one or two bytes), then the bytes
+func utf8PoolString(b []byte) string {
+	skipLen := func(b []byte) (int, []byte) {
+		if len(b) == 0 {
+			return 0, b
+		}
+		if b[0]&0x80 != 0 && len(b) > 1 {
+			return int(b[0]&0x7f)<<8 | int(b[1]), b[2:]
+		}
+		return int(b[0]), b[1:]
+	}
+	_, b = skipLen(b)
+	n, b := skipLen(b)
+	if n > len(b) {
+		n = len(b)
+	}
+	return string(b[:n])
+}
+
+// utf16PoolString reads a string pool entry: UTF-16 length (one or two
+// units), then the units
+func utf16PoolString(b []byte) string {
+	le := binary.LittleEndian
+	if len(b) < 2 {
+		return ""
+	}
+	n := int(le.Uint16(b))
+	b = b[2:]
+	if n&0x8000 != 0 && len(b) >= 2 {
+		n = (n&0x7fff)<<16 | int(le.Uint16(b))
+		b = b[2:]
+	}
+	if n*2 > len(b) {
+		n = len(b) / 2
+	}
+	units := make([]uint16, n)
+	for i := range units {
+		units[i] = le.Uint16(b[i*2:])
+	}
+	return string(utf16.Decode(units))
+}
+
+// readManifestElement fills info from a <manifest> or <uses-sdk> element
+func readManifestElement(chunk []byte, headerSize int, strs []string, resIDs []uint32, info *models.APKInfo) error {
+	le := binary.LittleEndian
+	if headerSize < 8 || headerSize > len(chunk) {
+		return errors.New("element is truncated")
+	}
+	ext := chunk[headerSize:]
+	if len(ext) < 20 {
+		return errors.New("element is truncated")
+	}
+	str := func(i uint32) string {
+		if int(i) < len(strs) {
+			return strs[i]
+		}
+		return ""
+	}
+	element := str(le.Uint32(ext[4:]))
+	if element != "manifest" && element != "uses-sdk" {
+		return nil
+	}
+
+	attrStart, attrSize, attrCount := int(le.Uint16(ext[8:])), int(le.Uint16(ext[10:])), int(le.Uint16(ext[12:]))
+	if attrSize < 20 || attrStart+attrCount*attrSize > len(ext) {
+		return errors.New("element is truncated")
+	}
+	for i := 0; i < attrCount; i++ {
+		a := ext[attrStart+i*attrSize:]
+		nameIdx, raw := le.Uint32(a[4:]), le.Uint32(a[8:])
+		dataType, value := a[15], le.Uint32(a[16:])
+		name := str(nameIdx)
+		if int(nameIdx) < len(resIDs) {
+			switch resIDs[nameIdx] {
+			case attrVersionCode:
+				name = "versionCode"
+			case attrVersionName:
+				name = "versionName"
+			case attrMinSdkVersion:
+				name = "minSdkVersion"
+			}
+		}
+		text := func() string {
+			if raw != 0xffffffff {
+				return str(raw)
+			}
+			if dataType == axmlTypeString {
+				return str(value)
+			}
+			return ""
+		}
+		number := func() int64 {
+			if dataType == axmlTypeIntDec || dataType == axmlTypeIntHex {
+				return int64(value)
+			}
+			n, _ := strconv.ParseInt(text(), 10, 64)
+			return n
+		}
+
+		switch {
+		case element == "manifest" && name == "package":
+			info.Package = text()
+		case element == "manifest" && name == "versionCode":
+			info.VersionCode = number()
+		case element == "manifest" && name == "versionName":
+			info.VersionName = text() // A resource reference stays empty
+		case element == "uses-sdk" && name == "minSdkVersion":
+			info.MinSDK = int(number())
+		}
+	}
+	return nil
+}
+
+// signingBlockCert returns the first signer's certificate from the APK
+// Signing Block in front of the central directory, preferring v3 to v2
+func signingBlockCert(r io.ReaderAt, size int64) ([]byte, string) {
+	cdStart, err := zipDirectory(r, size)
+	if err != nil || cdStart < 32 {
+		return nil, ""
+	}
+	footer := make([]byte, 24)
+	if _, err := r.ReadAt(footer, cdStart-24); err != nil || !bytes.Equal(footer[8:], apkSigBlockMagic) {
+		return nil, ""
+	}
+	blockSize := int64(binary.LittleEndian.Uint64(footer))
+	if blockSize < 24 || blockSize > cdStart-8 || blockSize > maxSignerSize*16 {
+		return nil, ""
+	}
+	// The pairs sit between the leading size and the footer
+	pairs := make([]byte, blockSize-24)
+	if _, err := r.ReadAt(pairs, cdStart-blockSize); err != nil {
+		return nil, ""
+	}
+
+	found := make(map[uint32][]byte)
+	for len(pairs) >= 12 {
+		n := binary.LittleEndian.Uint64(pairs)
+		if n < 4 || n > uint64(len(pairs)-8) {
+			break
+		}
+		id := binary.LittleEndian.Uint32(pairs[8:])
+		found[id] = pairs[12 : 8+n]
+		pairs = pairs[8+n:]
+	}
+	for _, scheme := range []struct {
+		id   uint32
+		name string
+	}{{apkSigV3, "v3"}, {apkSigV2, "v2"}} {
+		if value, ok := found[scheme.id]; ok {
+			if cert := firstSignerCert(value); cert != nil {
+				return cert, scheme.name
+			}
+		}
+	}
+	return nil, ""
+}
+
+// lengthPrefixed splits a uint32 length-prefixed field off b
+func lengthPrefixed(b []byte) (field, rest []byte, ok bool) {
+	if len(b) < 4 {
+		return nil, nil, false
+	}
+	n := binary.LittleEndian.Uint32(b)
+	if uint64(n) > uint64(len(b)-4) {
+		return nil, nil, false
+	}
+	return b[4 : 4+n], b[4+n:], true
+}
+
+// firstSignerCert digs the first certificate out of a v2/v3 signature
+// value: signers → signer → signed data → digests, certificates → cert
+func firstSignerCert(value []byte) []byte {
+	signers, _, ok := lengthPrefixed(value)
+	if !ok {
+		return nil
+	}
+	signer, _, ok := lengthPrefixed(signers)
+	if !ok {
+		return nil
+	}
+	signedData, _, ok := lengthPrefixed(signer)
+	if !ok {
+		return nil
+	}
+	_, rest, ok := lengthPrefixed(signedData) // Digests
+	if !ok {
+		return nil
+	}
+	certs, _, ok := lengthPrefixed(rest)
+	if !ok {
+		return nil
+	}
+	cert, _, ok := lengthPrefixed(certs)
+	if !ok || len(cert) == 0 {
+		return nil
+	}
+	return cert
+}
+
+// pkcs7 is as much of a PKCS #7 SignedData (RFC 2315) as it takes to reach
+// the certificates
+type pkcs7 struct {
+	ContentType asn1.ObjectIdentifier
+	Content     pkcs7SignedData `asn1:"explicit,tag:0"`
+}
+
+type pkcs7SignedData struct {
+	Version          int
+	DigestAlgorithms asn1.RawValue
+	ContentInfo      asn1.RawValue
+	Certificates     asn1.RawValue `asn1:"optional,tag:0"`
+	CRLs             asn1.RawValue `asn1:"optional,tag:1"`
+	SignerInfos      asn1.RawValue
+}
+
+// jarSignerCert returns the first certificate of a v1 (JAR) signature
+func jarSignerCert(zr *zip.Reader) []byte {
+	for _, f := range zr.File {
+		dir, name := path.Split(f.Name)
+		ext := strings.ToUpper(path.Ext(name))
+		if dir != "META-INF/" || (ext != ".RSA" && ext != ".DSA" && ext != ".EC") {
+			continue
+		}
+		data, err := readZipEntry(f, maxSignerSize)
+		if err != nil {
+			continue
+		}
+		var p pkcs7
+		if _, err := asn1.Unmarshal(data, &p); err != nil || len(p.Content.Certificates.Bytes) == 0 {
+			continue
+		}
+		var cert asn1.RawValue
+		if _, err := asn1.Unmarshal(p.Content.Certificates.Bytes, &cert); err == nil {
+			return cert.FullBytes
+		}
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+package services
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+// axmlChunk builds a binary XML chunk header followed by body
+func axmlChunk(chunkType uint16, headerSize int, chunkSize int, body ...byte) []byte {
+	b := make([]byte, 8, 8+len(body))
+	binary.LittleEndian.PutUint16(b, chunkType)
+	binary.LittleEndian.PutUint16(b[2:], uint16(headerSize))
+	binary.LittleEndian.PutUint32(b[4:], uint32(chunkSize))
+	return append(b, body...)
+}
+
+func TestParseManifestRejectsMalformedChunks(t *testing.T) {
+	tests := []struct {
+		name  string
+		chunk []byte
+	}{
+		{"header bigger than chunk", axmlChunk(axmlStartElement, 0xFFFF, 8)},
+		{"header smaller than its fields", axmlChunk(axmlStartElement, 4, 8)},
+		{"resource map header past chunk", axmlChunk(axmlResourceMap, 64, 8)},
+		{"chunk past end of file", axmlChunk(axmlStartElement, 16, 64)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := append(axmlChunk(0x0003, 8, 8+len(tt.chunk)), tt.chunk...)
+			if _, err := parseManifest(data); err == nil {
+				t.Error("parseManifest accepted a malformed manifest")
+			}
+		})
+	}
+}
+
+func TestReadManifestElementChecksHeaderSize(t *testing.T) {
+	chunk := axmlChunk(axmlStartElement, 0xFFFF, 8)
+	if err := readManifestElement(chunk, 0xFFFF, nil, nil, nil); err == nil {
+		t.Error("readManifestElement accepted a header past the chunk")
+	}
+}
@@ -0,0 +1,188 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"rom-server/internal/models"
+)
+
+// AuditLog records administrative actions as append-only JSON lines
+type AuditLog struct {
+	mu   sync.Mutex
+	path string
+}
+
+// NewAuditLog creates an audit log writing to the given file
+func NewAuditLog(path string) *AuditLog {
+	return &AuditLog{path: path}
+}
+
+// Record appends an entry to the audit log; a nil log (audit_log flag off)
+// records nothing
+func (a *AuditLog) Record(action, actor, target, details string) error {
+	if a == nil {
+		return nil
+	}
+	entry := models.AuditEntry{
+		Time:    time.Now(),
+		Action:  action,
+		Actor:   actor,
+		Target:  target,
+		Details: details,
+	}
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	f, err := os.OpenFile(a.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open audit log: %w", err)
+	}
+	defer f.Close()
+
+	_, err = f.Write(append(data, '\n'))
+	return err
+}
+
+// Restore moves a log unpacked from a backup over the audit log
+func (a *AuditLog) Restore(src string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if err := os.Chmod(src, 0644); err != nil {
+		return err
+	}
+	return os.Rename(src, a.path)
+}
+
+// auditTailBlock is how much of the log Recent reads per step, from the end
+const auditTailBlock = 64 << 10
+
+// Recent returns up to n of the newest entries, newest first, reading only
+// the tail of the file. A nil log or a missing file yields none.
+func (a *AuditLog) Recent(n int) ([]models.AuditEntry, error) {
+	if a == nil || n <= 0 {
+		return nil, nil
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	f, err := os.Open(a.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log: %w", err)
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	// Step back until the buffer holds n complete lines (or the whole file)
+	var buf []byte
+	offset := info.Size()
+	for offset > 0 && bytes.Count(buf, []byte{'\n'}) <= n {
+		size := min(int64(auditTailBlock), offset)
+		offset -= size
+		chunk := make([]byte, size, size+int64(len(buf)))
+		if _, err := f.ReadAt(chunk, offset); err != nil {
+			return nil, fmt.Errorf("failed to read audit log: %w", err)
+		}
+		buf = append(chunk, buf...)
+	}
+
+	lines := bytes.Split(bytes.TrimRight(buf, "\n"), []byte{'\n'})
+	if offset > 0 {
+		lines = lines[1:] // Starts mid-line
+	}
+	entries := make([]models.AuditEntry, 0, n)
+	for i := len(lines) - 1; i >= 0 && len(entries) < n; i-- {
+		var entry models.AuditEntry
+		if err := json.Unmarshal(lines[i], &entry); err == nil {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, nil
+}
+
+// AddressMatcher finds one client's addresses in stored records, for a
+// privacy purge
+type AddressMatcher interface {
+	Match(recorded string) bool        // Whether a recorded address is the client's
+	Redact(text string) (string, bool) // Text with the client's addresses replaced
+	Subjects() []string                // The addresses and pseudonyms searched for
+}
+
+// Purge rewrites the log without the client's addresses. Entries the client
+// made (reports, anonymous actions) are removed; entries a key owner made
+// from the address keep the name, and addresses in details are redacted.
+// A nil log or a missing file purges nothing.
+func (a *AuditLog) Purge(m AddressMatcher, purged string) (removed, redacted int, err error) {
+	if a == nil {
+		return 0, 0, nil
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	data, err := os.ReadFile(a.path)
+	if os.IsNotExist(err) {
+		return 0, 0, nil
+	}
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to read audit log: %w", err)
+	}
+
+	var out bytes.Buffer
+	for _, line := range bytes.Split(bytes.TrimRight(data, "\n"), []byte{'\n'}) {
+		var entry models.AuditEntry
+		if json.Unmarshal(line, &entry) != nil {
+			out.Write(append(line, '\n'))
+			continue
+		}
+		changed := false
+		if m.Match(entry.Actor) {
+			name, _, named := strings.Cut(entry.Actor, "@")
+			if !named {
+				removed++
+				continue
+			}
+			entry.Actor, changed = name+"@"+purged, true
+		}
+		if details, ok := m.Redact(entry.Details); ok {
+			entry.Details, changed = details, true
+		}
+		if changed {
+			redacted++
+			if line, err = json.Marshal(entry); err != nil {
+				return 0, 0, err
+			}
+		}
+		out.Write(append(line, '\n'))
+	}
+	if removed+redacted == 0 {
+		return 0, 0, nil
+	}
+
+	tmpPath := a.path + ".tmp"
+	if err := os.WriteFile(tmpPath, out.Bytes(), 0644); err != nil {
+		return 0, 0, fmt.Errorf("failed to write audit log: %w", err)
+	}
+	if err := os.Rename(tmpPath, a.path); err != nil {
+		return 0, 0, err
+	}
+	return removed, redacted, nil
+}
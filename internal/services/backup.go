@@ -0,0 +1,364 @@
+package services
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"rom-server/internal/models"
+)
+
+// backupFormat is bumped when the archive layout changes incompatibly
+const backupFormat = 1
+
+// maxBackupSize bounds the files inside an uploaded backup, together
+const maxBackupSize = 1 << 30
+
+// Files a backup carries besides its manifest. Stats and metadata are taken
+// from memory; the others are copied from the upload dir as they are.
+const (
+	backupStats         = "stats.json"
+	backupMetadata      = "metadata.json"
+	backupAnnouncements = "announcements.json"
+	backupFeedback      = "feedback.json"
+	backupPages         = "pages.json"
+	backupRatings       = "ratings.json"
+	backupKeys          = "keys.json"
+	backupTesters       = "testers.json"
+	backupExpected      = expectedSumsFile
+	backupAudit         = "audit.log"
+	backupManifest      = "manifest.json"
+)
+
+// backupCopied lists the files copied from the upload dir, in archive order
+var backupCopied = []string{backupAnnouncements, backupFeedback, backupPages, backupRatings, backupKeys, backupTesters, backupExpected, backupAudit}
+
+// backupPrivate are restored readable by the owner only, like their stores
+// write them
+var backupPrivate = map[string]bool{backupKeys: true, backupTesters: true}
+
+// ErrClusterRestore is returned when restoring into a node of a cluster
+var ErrClusterRestore = errors.New("restore is not supported in cluster mode; restore on a single node and let it seed the cluster")
+
+// backupManifestData describes a backup archive
+type backupManifestData struct {
+	Format    int      `json:"format"`
+	CreatedAt string   `json:"created_at"`
+	Files     []string `json:"files"`
+}
+
+// WriteBackup writes every piece of server state that isn't a build (download
+// counts, daily stats, traffic, checksums, tags, release details,
+// announcements, feedback, device pages, ratings, API key and tester hashes,
+// expected checksums and the audit log) to w as a gzipped tar archive
+func (s *FileService) WriteBackup(w io.Writer) error {
+	s.mu.RLock()
+	stats, err := json.MarshalIndent(statsData{
+		Downloads: s.downloadCounts,
+		Clients:   s.clientCounts,
+		Daily:     s.dailyCounts,
+		Traffic:   s.traffic,
+		Referrers: s.referrers,
+	}, "", "  ")
+	s.mu.RUnlock()
+	if err != nil {
+		return err
+	}
+	meta, err := json.MarshalIndent(s.meta.All(), "", "  ")
+	if err != nil {
+		return err
+	}
+
+	entries := map[string][]byte{backupStats: stats, backupMetadata: meta}
+	for _, name := range backupCopied {
+		data, err := os.ReadFile(filepath.Join(s.cfg.Storage.UploadDir, name))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", name, err)
+		}
+		entries[name] = data
+	}
+
+	manifest := backupManifestData{Format: backupFormat, CreatedAt: time.Now().UTC().Format(time.RFC3339)}
+	for _, name := range append([]string{backupStats, backupMetadata}, backupCopied...) {
+		if _, ok := entries[name]; ok {
+			manifest.Files = append(manifest.Files, name)
+		}
+	}
+	manifestData, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	now := time.Now()
+	write := func(name string, data []byte) error {
+		hdr := &tar.Header{Name: name, Mode: 0644, Size: int64(len(data)), ModTime: now}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		_, err := tw.Write(data)
+		return err
+	}
+	if err := write(backupManifest, manifestData); err != nil {
+		return err
+	}
+	for _, name := range manifest.Files {
+		if err := write(name, entries[name]); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// BackupStores are the stores that own files a backup carries. Each file is
+// restored through its store, under the store's lock, so it can't race a
+// write; a nil store (its feature is off) has its file replaced directly.
+type BackupStores struct {
+	Announcements *AnnouncementStore
+	Feedback      *FeedbackStore
+	Pages         *PageStore
+	Ratings       *RatingStore
+	Keys          *KeyStore
+	Testers       *TesterStore
+	Audit         *AuditLog
+}
+
+// restorers maps the copied files to the Restore of their store
+func (b BackupStores) restorers() map[string]func(string) error {
+	r := make(map[string]func(string) error)
+	if b.Announcements != nil {
+		r[backupAnnouncements] = b.Announcements.Restore
+	}
+	if b.Feedback != nil {
+		r[backupFeedback] = b.Feedback.Restore
+	}
+	if b.Pages != nil {
+		r[backupPages] = b.Pages.Restore
+	}
+	if b.Ratings != nil {
+		r[backupRatings] = b.Ratings.Restore
+	}
+	if b.Keys != nil {
+		r[backupKeys] = b.Keys.Restore
+	}
+	if b.Testers != nil {
+		r[backupTesters] = b.Testers.Restore
+	}
+	if b.Audit != nil {
+		r[backupAudit] = b.Audit.Restore
+	}
+	return r
+}
+
+// RestoreBackup replaces server state with the contents of an archive made by
+// WriteBackup and returns the files it restored. The whole archive is
+// unpacked to the temp dir and validated before anything is changed; state
+// missing from the archive is left alone.
+func (s *FileService) RestoreBackup(r io.Reader, stores BackupStores) ([]string, error) {
+	if s.shared != nil {
+		return nil, ErrClusterRestore
+	}
+
+	dir, err := os.MkdirTemp(filepath.Join(s.cfg.Storage.UploadDir, s.cfg.Storage.TempDir), "restore-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	entries, err := readBackup(r, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var stats statsData
+	if entries[backupStats] {
+		if err := decodeBackupEntry(dir, backupStats, &stats); err != nil || stats.Downloads == nil {
+			return nil, fmt.Errorf("invalid %s in backup", backupStats)
+		}
+	}
+	var meta map[string]*models.FileMetadata
+	if entries[backupMetadata] {
+		if err := decodeBackupEntry(dir, backupMetadata, &meta); err != nil {
+			return nil, fmt.Errorf("invalid %s in backup: %w", backupMetadata, err)
+		}
+	}
+	validate := map[string]func() any{
+		backupAnnouncements: func() any { return new([]models.Announcement) },
+		backupFeedback:      func() any { return new([]models.Feedback) },
+		backupPages:         func() any { return new([]models.Page) },
+		backupRatings:       func() any { return new(ratingsFile) },
+		backupKeys:          func() any { return new([]models.APIKey) },
+		backupTesters:       func() any { return new([]models.Tester) },
+		backupExpected:      func() any { return new(map[string]models.ExpectedChecksum) },
+	}
+	for _, name := range backupCopied {
+		newValue, ok := validate[name]
+		if !ok || !entries[name] {
+			continue
+		}
+		if err := decodeBackupEntry(dir, name, newValue()); err != nil {
+			return nil, fmt.Errorf("invalid %s in backup: %w", name, err)
+		}
+	}
+
+	var restored []string
+	if entries[backupStats] {
+		s.mu.Lock()
+		s.downloadCounts = stats.Downloads
+		s.clientCounts = orEmpty(stats.Clients)
+		s.dailyCounts = orEmpty(stats.Daily)
+		s.traffic = orEmpty(stats.Traffic)
+		s.referrers = orEmpty(stats.Referrers)
+		s.invalidateListing()
+		s.mu.Unlock()
+		if err := s.saveStats(); err != nil {
+			return restored, fmt.Errorf("failed to write stats: %w", err)
+		}
+		restored = append(restored, backupStats)
+	}
+	if meta != nil {
+		if err := s.meta.Replace(meta); err != nil {
+			return restored, err
+		}
+		s.mu.Lock()
+		s.invalidateListing()
+		s.mu.Unlock()
+		restored = append(restored, backupMetadata)
+	}
+	restorers := stores.restorers()
+	for _, name := range backupCopied {
+		if !entries[name] {
+			continue
+		}
+		src := filepath.Join(dir, name)
+		restore, ok := restorers[name]
+		if !ok {
+			restore = func(src string) error { return s.restoreFile(name, src) }
+		}
+		if err := restore(src); err != nil {
+			return restored, fmt.Errorf("failed to restore %s: %w", name, err)
+		}
+		restored = append(restored, name)
+	}
+	return restored, nil
+}
+
+// restoreFile moves a file unpacked from a backup over its copy in the
+// upload dir, for files no running store owns
+func (s *FileService) restoreFile(name, src string) error {
+	if name == backupExpected {
+		// Uploads settle their manifest entries meanwhile
+		s.manifestMu.Lock()
+		defer s.manifestMu.Unlock()
+	}
+	perm := os.FileMode(0644)
+	if backupPrivate[name] {
+		perm = 0600
+	}
+	if err := os.Chmod(src, perm); err != nil {
+		return err
+	}
+	return os.Rename(src, filepath.Join(s.cfg.Storage.UploadDir, name))
+}
+
+// decodeBackupEntry parses a JSON file unpacked from a backup into v
+func decodeBackupEntry(dir, name string, v any) error {
+	f, err := os.Open(filepath.Join(dir, name))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	dec := json.NewDecoder(f)
+	if err := dec.Decode(v); err != nil {
+		return err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return errors.New("unexpected data after the document")
+	}
+	return nil
+}
+
+// readBackup unpacks a backup archive into dir, checking its manifest, and
+// returns the names of the files it holds. Entries go straight to disk; their
+// total size is capped at maxBackupSize.
+func readBackup(r io.Reader, dir string) (map[string]bool, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("backup is not a gzipped tar archive: %w", err)
+	}
+	defer gz.Close()
+
+	known := map[string]bool{backupManifest: true, backupStats: true, backupMetadata: true}
+	for _, name := range backupCopied {
+		known[name] = true
+	}
+	entries := make(map[string]bool)
+	remaining := int64(maxBackupSize)
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read backup: %w", err)
+		}
+		if hdr.Typeflag != tar.TypeReg || !known[hdr.Name] || entries[hdr.Name] {
+			return nil, fmt.Errorf("unexpected entry %q in backup", hdr.Name)
+		}
+		if hdr.Size > remaining {
+			return nil, fmt.Errorf("backup is larger than %d bytes unpacked", int64(maxBackupSize))
+		}
+		if err := unpackBackupEntry(filepath.Join(dir, hdr.Name), tr); err != nil {
+			return nil, fmt.Errorf("failed to read backup: %w", err)
+		}
+		remaining -= hdr.Size
+		entries[hdr.Name] = true
+	}
+
+	var manifest backupManifestData
+	if !entries[backupManifest] {
+		return nil, fmt.Errorf("backup has no %s", backupManifest)
+	}
+	if err := decodeBackupEntry(dir, backupManifest, &manifest); err != nil {
+		return nil, fmt.Errorf("invalid %s in backup: %w", backupManifest, err)
+	}
+	if manifest.Format != backupFormat {
+		return nil, fmt.Errorf("unsupported backup format %d (expected %d)", manifest.Format, backupFormat)
+	}
+	delete(entries, backupManifest)
+	return entries, nil
+}
+
+// unpackBackupEntry writes the current archive entry to path
+func unpackBackupEntry(path string, tr *tar.Reader) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, tr); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// orEmpty returns m, or an empty map if m is nil
+func orEmpty(m map[string]map[string]int64) map[string]map[string]int64 {
+	if m == nil {
+		return make(map[string]map[string]int64)
+	}
+	return m
+}
@@ -0,0 +1,220 @@
+package services
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+
+	"rom-server/internal/models"
+)
+
+// Image types recognised by InspectImage
+const (
+	ImageBoot       = "boot" // boot.img and recovery.img share a format
+	ImageVendorBoot = "vendor_boot"
+	ImageVBMeta     = "vbmeta"
+)
+
+// Android image magics (system/tools/mkbootimg, external/avb)
+var (
+	bootMagic       = []byte("ANDROID!")
+	vendorBootMagic = []byte("VNDRBOOT")
+	vbmetaMagic     = []byte("AVB0")
+)
+
+const (
+	bootHeaderV3PageSize = 4096 // v3+ headers drop page_size for a fixed 4 KiB
+	vbmetaHeaderSize     = 256
+	maxBootHeaderVersion = 4
+	maxKernelScan        = 64 << 20 // Decompressed kernel bytes searched for its version
+)
+
+// kernelBanner matches the version string every Linux kernel carries
+var kernelBanner = regexp.MustCompile(`Linux version ([0-9]+\.[0-9]+[0-9A-Za-z.+_-]*)`)
+
+// ErrInvalidImage means an .img upload claims to be an Android image but its
+// header doesn't add up, e.g. it was truncated
+var ErrInvalidImage = errors.New("invalid Android image")
+
+// InspectImage reads the header of a boot, recovery, vendor_boot or vbmeta
+// image and describes it. Images of other kinds (super, dtbo, raw
+// partitions) return nil without an error; a recognised image whose header
+// doesn't fit the file returns ErrInvalidImage.
+func InspectImage(r io.ReaderAt, size int64) (*models.ImageInfo, error) {
+	header := make([]byte, 4096)
+	n, err := r.ReadAt(header, 0)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	header = header[:n]
+
+	switch {
+	case bytes.HasPrefix(header, bootMagic):
+		return inspectBoot(r, size, header)
+	case bytes.HasPrefix(header, vendorBootMagic):
+		return inspectVendorBoot(size, header)
+	case bytes.HasPrefix(header, vbmetaMagic):
+		return inspectVBMeta(size, header)
+	}
+	return nil, nil
+}
+
+// invalidImage wraps ErrInvalidImage with what is wrong
+func invalidImage(format string, args ...interface{}) error {
+	return fmt.Errorf("%w: %s", ErrInvalidImage, fmt.Sprintf(format, args...))
+}
+
+// pages rounds n up to whole pages
+func pages(n, pageSize int64) int64 {
+	return (n + pageSize - 1) / pageSize * pageSize
+}
+
+// inspectBoot reads a boot or recovery image header (versions 0 to 4)
+func inspectBoot(r io.ReaderAt, size int64, header []byte) (*models.ImageInfo, error) {
+	if len(header) < 1660 {
+		return nil, invalidImage("boot image header is truncated")
+	}
+	le := binary.LittleEndian
+	version := le.Uint32(header[40:])
+	if version > maxBootHeaderVersion {
+		return nil, invalidImage("unknown boot image header version %d", version)
+	}
+
+	info := &models.ImageInfo{Type: ImageBoot, HeaderVersion: int(version)}
+	var kernelSize, ramdiskSize, osVersion uint32
+	var pageSize, extra int64
+	if version >= 3 {
+		kernelSize, ramdiskSize, osVersion = le.Uint32(header[8:]), le.Uint32(header[12:]), le.Uint32(header[16:])
+		pageSize = bootHeaderV3PageSize
+		if version == 4 {
+			extra = pages(int64(le.Uint32(header[1580:])), pageSize) // Boot signature
+		}
+	} else {
+		kernelSize, ramdiskSize, osVersion = le.Uint32(header[8:]), le.Uint32(header[16:]), le.Uint32(header[44:])
+		pageSize = int64(le.Uint32(header[36:]))
+		if pageSize < 2048 || pageSize > 65536 || pageSize&(pageSize-1) != 0 {
+			return nil, invalidImage("bad page size %d", pageSize)
+		}
+		extra = pages(int64(le.Uint32(header[24:])), pageSize) // Second stage
+		if version >= 1 {
+			extra += pages(int64(le.Uint32(header[1632:])), pageSize) // Recovery DTBO
+		}
+		if version == 2 {
+			extra += pages(int64(le.Uint32(header[1648:])), pageSize) // DTB
+		}
+	}
+
+	kernelOffset := pageSize
+	need := kernelOffset + pages(int64(kernelSize), pageSize) + pages(int64(ramdiskSize), pageSize) + extra
+	// The last section needn't be padded to a whole page
+	if need > size+pageSize-1 {
+		return nil, invalidImage("header describes %d bytes but the file has %d", need, size)
+	}
+
+	info.PageSize = pageSize
+	info.RamdiskSize = int64(ramdiskSize)
+	info.OSVersion, info.OSPatchLevel = decodeOSVersion(osVersion)
+	info.KernelVersion = kernelVersion(io.NewSectionReader(r, kernelOffset, int64(kernelSize)))
+	return info, nil
+}
+
+// inspectVendorBoot reads a vendor_boot image header (versions 3 and 4)
+func inspectVendorBoot(size int64, header []byte) (*models.ImageInfo, error) {
+	if len(header) < 2112 {
+		return nil, invalidImage("vendor_boot header is truncated")
+	}
+	le := binary.LittleEndian
+	version := le.Uint32(header[8:])
+	if version < 3 || version > maxBootHeaderVersion {
+		return nil, invalidImage("unknown vendor_boot header version %d", version)
+	}
+	pageSize := int64(le.Uint32(header[12:]))
+	if pageSize < 2048 || pageSize > 65536 || pageSize&(pageSize-1) != 0 {
+		return nil, invalidImage("bad page size %d", pageSize)
+	}
+	ramdiskSize := int64(le.Uint32(header[24:]))
+	headerSize := int64(le.Uint32(header[2096:]))
+	if pages(headerSize, pageSize)+ramdiskSize > size {
+		return nil, invalidImage("header describes more data than the file has")
+	}
+	return &models.ImageInfo{
+		Type:          ImageVendorBoot,
+		HeaderVersion: int(version),
+		PageSize:      pageSize,
+		RamdiskSize:   ramdiskSize,
+	}, nil
+}
+
+// inspectVBMeta reads a vbmeta image header
+func inspectVBMeta(size int64, header []byte) (*models.ImageInfo, error) {
+	if len(header) < vbmetaHeaderSize {
+		return nil, invalidImage("vbmeta header is truncated")
+	}
+	be := binary.BigEndian
+	major, minor := be.Uint32(header[4:]), be.Uint32(header[8:])
+	authSize, auxSize := be.Uint64(header[12:]), be.Uint64(header[20:])
+	if authSize > uint64(size) || auxSize > uint64(size) || vbmetaHeaderSize+authSize+auxSize > uint64(size) {
+		return nil, invalidImage("header describes more data than the file has")
+	}
+	return &models.ImageInfo{
+		Type:          ImageVBMeta,
+		HeaderVersion: int(major),
+		AVBVersion:    fmt.Sprintf("%d.%d", major, minor),
+	}, nil
+}
+
+// decodeOSVersion unpacks os_version: A.B.C in the top 21 bits and the
+// security patch year and month in the low 11
+func decodeOSVersion(v uint32) (version, patchLevel string) {
+	if v == 0 {
+		return "", ""
+	}
+	ver, patch := v>>11, v&0x7ff
+	if ver != 0 {
+		version = fmt.Sprintf("%d.%d.%d", ver>>14&0x7f, ver>>7&0x7f, ver&0x7f)
+	}
+	if patch != 0 {
+		patchLevel = fmt.Sprintf("%04d-%02d", 2000+patch>>4, patch&0xf)
+	}
+	return version, patchLevel
+}
+
+// kernelVersion finds the Linux version banner in a kernel, plain or gzip
+// compressed; "" if there is none (e.g. an LZ4 kernel or a recovery
+// without one)
+func kernelVersion(kernel *io.SectionReader) string {
+	var src io.Reader = kernel
+	magic := make([]byte, 2)
+	if _, err := kernel.ReadAt(magic, 0); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		zr, err := gzip.NewReader(kernel)
+		if err != nil {
+			return ""
+		}
+		defer zr.Close()
+		src = zr
+	}
+
+	// Search in chunks, keeping an overlap so a banner split between two
+	// reads is still found
+	const chunk, overlap = 1 << 20, 128
+	buf := make([]byte, 0, chunk+overlap)
+	var scanned int64
+	for scanned < maxKernelScan {
+		n, err := io.ReadFull(src, buf[len(buf):cap(buf)])
+		buf = buf[:len(buf)+n]
+		if m := kernelBanner.FindSubmatch(buf); m != nil {
+			return string(m[1])
+		}
+		if err != nil {
+			return ""
+		}
+		scanned += int64(n)
+		keep := copy(buf, buf[len(buf)-overlap:])
+		buf = buf[:keep]
+	}
+	return ""
+}
@@ -0,0 +1,152 @@
+package services
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"rom-server/internal/models"
+)
+
+// Files a bundle carries besides the builds
+const (
+	bundleSums      = "SHA256SUMS"
+	bundleChangelog = "CHANGELOG.txt"
+)
+
+// BundleFiles keeps the builds of a listing that can go into a bundle: the
+// ones on local disk. Bucket-backed builds would have to be fetched first,
+// so they are only downloadable on their own.
+func (s *FileService) BundleFiles(files []models.FileInfo) []models.FileInfo {
+	var out []models.FileInfo
+	for _, f := range files {
+		if meta, ok := s.meta.Get(filepath.Join(f.Category, f.Filename)); ok && meta.ObjectKey != "" {
+			continue
+		}
+		out = append(out, f)
+	}
+	return out
+}
+
+// WriteBundle streams files (from BundleFiles) to w as one zip, followed by
+// a SHA256SUMS file and a CHANGELOG.txt built from their metadata. Builds
+// are stored rather than recompressed and read straight from disk, so
+// nothing is staged and the first bytes go out at once. A build removed
+// since the listing is skipped.
+func (s *FileService) WriteBundle(w io.Writer, files []models.FileInfo) error {
+	zw := zip.NewWriter(w)
+	var sums, changelog strings.Builder
+	for _, f := range files {
+		path, err := s.GetFilePath(f.Category, f.Filename)
+		if err != nil {
+			continue
+		}
+		modified, err := s.bundleEntry(zw, path, f.Filename)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to add %s: %w", f.Filename, err)
+		}
+
+		if f.SHA256 != "" {
+			fmt.Fprintf(&sums, "%s  %s\n", f.SHA256, f.Filename)
+		}
+		writeChangelogEntry(&changelog, f, modified)
+	}
+
+	now := time.Now()
+	for _, extra := range []struct{ name, body string }{{bundleSums, sums.String()}, {bundleChangelog, changelog.String()}} {
+		if extra.body == "" {
+			continue
+		}
+		entry, err := zw.CreateHeader(&zip.FileHeader{Name: extra.name, Method: zip.Deflate, Modified: now})
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(entry, extra.body); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+// bundleEntry copies the file at path into zw as name and returns its
+// modification time
+func (s *FileService) bundleEntry(zw *zip.Writer, path, name string) (time.Time, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	entry, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Store, Modified: info.ModTime()})
+	if err != nil {
+		return time.Time{}, err
+	}
+	_, err = io.Copy(entry, f)
+	return info.ModTime(), err
+}
+
+// writeChangelogEntry describes one build: name, date and size, then its
+// release details and notes when it has them
+func writeChangelogEntry(b *strings.Builder, f models.FileInfo, modified time.Time) {
+	if b.Len() > 0 {
+		b.WriteString("\n")
+	}
+	fmt.Fprintf(b, "%s (%s, %s)\n", f.Filename, modified.UTC().Format("2006-01-02"), f.Size)
+
+	var details []string
+	if r := f.Release; r != nil {
+		if r.AndroidVersion != "" {
+			details = append(details, "Android "+r.AndroidVersion)
+		}
+		if r.BuildType != "" {
+			details = append(details, r.BuildType)
+		}
+		if r.SecurityPatch != "" {
+			details = append(details, "security patch "+r.SecurityPatch)
+		}
+		if r.Maintainer != "" {
+			details = append(details, "by "+r.Maintainer)
+		}
+	}
+	if len(details) > 0 {
+		fmt.Fprintf(b, "  %s\n", strings.Join(details, ", "))
+	}
+	if needs := flashRequirements(f.Release); len(needs) > 0 {
+		fmt.Fprintf(b, "  Before flashing: %s\n", strings.Join(needs, ", "))
+	}
+	if f.Notes != "" {
+		fmt.Fprintf(b, "  %s\n", f.Notes)
+	}
+}
+
+// flashRequirements lists what a build needs before it is flashed
+func flashRequirements(r *models.ReleaseInfo) []string {
+	var needs []string
+	if r == nil {
+		return needs
+	}
+	if r.RequiredFirmware != "" {
+		needs = append(needs, "firmware "+r.RequiredFirmware+" or newer")
+	}
+	if r.RequiredRecovery != "" {
+		needs = append(needs, "recovery "+r.RequiredRecovery)
+	}
+	if r.WipeData {
+		needs = append(needs, "wipe data")
+	}
+	if r.WipeCache {
+		needs = append(needs, "wipe cache")
+	}
+	return needs
+}
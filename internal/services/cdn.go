@@ -0,0 +1,170 @@
+package services
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"rom-server/internal/config"
+)
+
+// CDN builds public download URLs on the CDN and purges replaced files from it
+type CDN struct {
+	cfg     *config.Config
+	client  *http.Client
+	workers *WorkerPool
+	logger  *log.Logger
+	apiURL  string // Provider API base
+}
+
+// NewCDN creates a CDN client, or returns nil when no CDN is configured
+func NewCDN(cfg *config.Config, workers *WorkerPool, logger *log.Logger) *CDN {
+	if !cfg.CDN.Enabled {
+		return nil
+	}
+
+	apiURL := "https://api.cloudflare.com/client/v4"
+	if cfg.CDN.Provider == "fastly" {
+		apiURL = "https://api.fastly.com"
+	}
+	return &CDN{
+		cfg:     cfg,
+		client:  &http.Client{Timeout: 15 * time.Second},
+		workers: workers,
+		logger:  logger,
+		apiURL:  apiURL,
+	}
+}
+
+// URL returns the CDN URL of a file, signed when a signing key is configured.
+// Expiry is rounded up to a multiple of the TTL so listings stay cacheable.
+func (c *CDN) URL(category, filename string) string {
+	if c == nil {
+		return ""
+	}
+	fileURL := c.fileURL(category, filename)
+
+	key := c.cfg.GetSecrets().CDNSigningKey
+	ttl := int64(c.cfg.CDN.SignedURLTTLSeconds)
+	if key == "" || ttl <= 0 {
+		return fileURL
+	}
+
+	u, err := url.Parse(fileURL)
+	if err != nil {
+		return fileURL
+	}
+	expires := (time.Now().Unix()/ttl + 2) * ttl
+	q := u.Query()
+	q.Set("verify", SignCDNPath(key, u.EscapedPath(), expires))
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+// SignCDNPath produces a "<expires>-<mac>" token over path+expires, the format
+// used by Cloudflare token authentication and easily checked in Fastly VCL
+func SignCDNPath(key, path string, expires int64) string {
+	ts := strconv.FormatInt(expires, 10)
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write([]byte(path + ts))
+	return ts + "-" + base64.URLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// fileURL is the unsigned CDN URL of a file
+func (c *CDN) fileURL(category, filename string) string {
+	return strings.TrimRight(c.cfg.CDN.BaseURL, "/") + "/" + url.PathEscape(category) + "/" + url.PathEscape(filename)
+}
+
+// Purge evicts a file from the CDN asynchronously; failures are only logged
+func (c *CDN) Purge(category, filename string) {
+	if c == nil {
+		return
+	}
+	token := c.cfg.GetSecrets().CDNAPIToken
+	if token == "" {
+		return
+	}
+	fileURL := c.fileURL(category, filename)
+
+	c.workers.Submit("cdn-purge "+fileURL, func() error {
+		return c.purge(fileURL, token)
+	})
+}
+
+// purge calls the provider's single-URL purge API
+func (c *CDN) purge(fileURL, token string) error {
+	var req *http.Request
+	var err error
+
+	switch c.cfg.CDN.Provider {
+	case "fastly":
+		// Fastly purges by cached URL without the scheme
+		target := strings.TrimPrefix(strings.TrimPrefix(fileURL, "https://"), "http://")
+		req, err = http.NewRequest(http.MethodPost, c.apiURL+"/purge/"+target, nil)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Fastly-Key", token)
+	default:
+		body, merr := json.Marshal(map[string][]string{"files": {fileURL}})
+		if merr != nil {
+			return merr
+		}
+		endpoint := fmt.Sprintf("%s/zones/%s/purge_cache", c.apiURL, url.PathEscape(c.cfg.CDN.ZoneID))
+		req, err = http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// immutableMaxAge is how long versioned builds may be cached (a year)
+const immutableMaxAge = 31536000
+
+// SetCacheHeaders marks a download as cacheable at the edge. Browsers revalidate
+// hourly while the CDN keeps it longer, relying on purge-on-replace for freshness.
+// Immutable (versioned) builds are cached for a year everywhere.
+func (c *CDN) SetCacheHeaders(h http.Header, immutable bool) {
+	if immutable {
+		h.Set("Cache-Control", fmt.Sprintf("public, max-age=%d, immutable", immutableMaxAge))
+		if c != nil {
+			h.Set("Surrogate-Control", fmt.Sprintf("max-age=%d", immutableMaxAge))
+			h.Set("CDN-Cache-Control", fmt.Sprintf("max-age=%d", immutableMaxAge))
+		}
+		return
+	}
+	if c == nil {
+		h.Set("Cache-Control", "public, max-age=3600")
+		return
+	}
+
+	edge := c.cfg.CDN.EdgeMaxAgeSeconds
+	if edge <= 0 {
+		edge = 86400
+	}
+	h.Set("Cache-Control", fmt.Sprintf("public, max-age=3600, s-maxage=%d", edge))
+	h.Set("Surrogate-Control", fmt.Sprintf("max-age=%d", edge)) // Fastly
+	h.Set("CDN-Cache-Control", fmt.Sprintf("max-age=%d", edge)) // Cloudflare
+}
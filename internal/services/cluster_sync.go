@@ -0,0 +1,221 @@
+package services
+
+import (
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"rom-server/internal/models"
+)
+
+// Shared store hashes and keys used in cluster mode
+const (
+	sharedDownloads  = "downloads"
+	sharedMetadata   = "metadata"
+	sharedGeneration = "generation"
+	sharedSeeded     = "seeded"
+	sharedDailyHash  = "daily:"   // + YYYY-MM-DD
+	sharedTraffic    = "traffic:" // + YYYY-MM
+)
+
+// seedCluster uploads this instance's existing counters and metadata the
+// first time any instance joins an empty shared store
+func (s *FileService) seedCluster() error {
+	first, err := s.shared.Incr(sharedSeeded)
+	if err != nil || first != 1 {
+		return err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for key, count := range s.downloadCounts {
+		if err := s.shared.HashIncrBy(sharedDownloads, key, count); err != nil {
+			return err
+		}
+	}
+	for day, files := range s.dailyCounts {
+		for key, count := range files {
+			if err := s.shared.HashIncrBy(sharedDailyHash+day, key, count); err != nil {
+				return err
+			}
+		}
+	}
+	for month, cats := range s.traffic {
+		for cat, bytes := range cats {
+			if err := s.shared.HashIncrBy(sharedTraffic+month, cat, bytes); err != nil {
+				return err
+			}
+		}
+	}
+	return s.meta.publishAll()
+}
+
+// recordDelta queues a counter change for the shared store; caller holds s.mu
+func (s *FileService) recordDelta(hash, field string, delta int64) {
+	if s.shared == nil {
+		return
+	}
+	if s.deltas[hash] == nil {
+		s.deltas[hash] = make(map[string]int64)
+	}
+	s.deltas[hash][field] += delta
+}
+
+// bumpGeneration tells other instances that the published file set changed
+func (s *FileService) bumpGeneration() {
+	if s.shared == nil {
+		return
+	}
+	if gen, err := s.shared.Incr(sharedGeneration); err == nil {
+		s.mu.Lock()
+		s.generation = strconv.FormatInt(gen, 10)
+		s.mu.Unlock()
+	}
+}
+
+// syncCluster pushes local counter deltas to the shared store and pulls the
+// fleet-wide totals back, so every instance reports the same /list and stats
+func (s *FileService) syncCluster() error {
+	// 1. Take ownership of pending deltas
+	s.mu.Lock()
+	pending := s.deltas
+	s.deltas = make(map[string]map[string]int64)
+	s.mu.Unlock()
+
+	// 2. Push them; anything that fails is re-queued for the next round
+	for hash, fields := range pending {
+		for field, delta := range fields {
+			if err := s.shared.HashIncrBy(hash, field, delta); err != nil {
+				s.requeue(pending)
+				return err
+			}
+			delete(fields, field)
+		}
+	}
+
+	// 3. Pull fleet-wide totals
+	now := time.Now()
+	day := now.Format(dateLayout)
+	month := now.Format(monthLayout)
+
+	downloads, err := s.fetchCounts(sharedDownloads)
+	if err != nil {
+		return err
+	}
+	daily, err := s.fetchCounts(sharedDailyHash + day)
+	if err != nil {
+		return err
+	}
+	traffic, err := s.fetchCounts(sharedTraffic + month)
+	if err != nil {
+		return err
+	}
+	generation, err := s.shared.Get(sharedGeneration)
+	if err != nil {
+		return err
+	}
+
+	// 4. Merge, keeping increments that arrived while we were syncing
+	s.mu.Lock()
+	addPending(downloads, s.deltas[sharedDownloads])
+	addPending(daily, s.deltas[sharedDailyHash+day])
+	addPending(traffic, s.deltas[sharedTraffic+month])
+	s.downloadCounts = downloads
+	s.dailyCounts[day] = daily
+	s.traffic[month] = traffic
+
+	changed := generation != s.generation
+	if changed {
+		// Another instance published or deleted files
+		s.generation = generation
+		s.invalidateListing()
+	}
+	s.mu.Unlock()
+
+	if changed {
+		s.statCache.Purge()
+		if err := s.meta.Refresh(); err != nil {
+			return err
+		}
+	}
+
+	// Keep a local snapshot in stats.json as well
+	s.markStatsDirty()
+	return nil
+}
+
+// requeue merges deltas that could not be pushed back into the pending set
+func (s *FileService) requeue(pending map[string]map[string]int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for hash, fields := range pending {
+		for field, delta := range fields {
+			s.recordDelta(hash, field, delta)
+		}
+	}
+}
+
+// fetchCounts reads a shared hash of integer counters
+func (s *FileService) fetchCounts(hash string) (map[string]int64, error) {
+	raw, err := s.shared.HashGetAll(hash)
+	if err != nil {
+		return nil, err
+	}
+	counts := make(map[string]int64, len(raw))
+	for field, value := range raw {
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err == nil {
+			counts[field] = n
+		}
+	}
+	return counts, nil
+}
+
+// addPending adds not-yet-pushed deltas on top of shared totals
+func addPending(counts, pending map[string]int64) {
+	for field, delta := range pending {
+		counts[field] += delta
+	}
+}
+
+// Refresh reloads all metadata from the shared store (cluster mode only)
+func (m *MetadataStore) Refresh() error {
+	if m.shared == nil {
+		return nil
+	}
+
+	raw, err := m.shared.HashGetAll(sharedMetadata)
+	if err != nil {
+		return err
+	}
+
+	files := make(map[string]*models.FileMetadata, len(raw))
+	for key, value := range raw {
+		var meta models.FileMetadata
+		if err := json.Unmarshal([]byte(value), &meta); err == nil {
+			files[key] = &meta
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.files = files
+	return m.save()
+}
+
+// publishAll copies every local metadata entry into the shared store
+func (m *MetadataStore) publishAll() error {
+	if m.shared == nil {
+		return nil
+	}
+	for key, meta := range m.All() {
+		data, err := json.Marshal(meta)
+		if err != nil {
+			return err
+		}
+		if err := m.shared.HashSet(sharedMetadata, key, string(data)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+package services
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"rom-server/internal/models"
+)
+
+// ParseDigest reads the SHA-256 and MD5 values of an RFC 3230 Digest header
+// ("SHA-256=<base64>, MD5=<base64>") as hex. Other algorithms are ignored,
+// as the RFC asks.
+func ParseDigest(header string) (models.Checksums, error) {
+	var sums models.Checksums
+	for _, item := range strings.Split(header, ",") {
+		alg, value, ok := strings.Cut(strings.TrimSpace(item), "=")
+		if !ok {
+			if item = strings.TrimSpace(item); item != "" {
+				return sums, &InvalidField{Field: "Digest", Message: fmt.Sprintf("%q must be algorithm=value", item)}
+			}
+			continue
+		}
+		var size int
+		var dst *string
+		switch strings.ToLower(alg) {
+		case "sha-256":
+			size, dst = 32, &sums.SHA256
+		case "md5":
+			size, dst = 16, &sums.MD5
+		default:
+			continue
+		}
+		sum, err := decodeDigest(value, size)
+		if err != nil {
+			return sums, &InvalidField{Field: "Digest", Message: fmt.Sprintf("%s value %v", alg, err)}
+		}
+		*dst = sum
+	}
+	return sums, nil
+}
+
+// ParseContentMD5 reads an RFC 1864 Content-MD5 header as hex
+func ParseContentMD5(header string) (string, error) {
+	sum, err := decodeDigest(strings.TrimSpace(header), 16)
+	if err != nil {
+		return "", &InvalidField{Field: "Content-MD5", Message: err.Error()}
+	}
+	return sum, nil
+}
+
+// decodeDigest turns a base64 digest of size bytes into hex
+func decodeDigest(value string, size int) (string, error) {
+	raw, err := base64.StdEncoding.DecodeString(value)
+	if err != nil || len(raw) != size {
+		return "", fmt.Errorf("must be the base64 of a %d-byte digest", size)
+	}
+	return hex.EncodeToString(raw), nil
+}
+
+// DigestHeader formats checksums as an RFC 3230 Digest header, or "" if
+// none are known
+func DigestHeader(sums models.Checksums) string {
+	var parts []string
+	for _, d := range []struct{ alg, sum string }{{"SHA-256", sums.SHA256}, {"MD5", sums.MD5}} {
+		if raw, err := hex.DecodeString(d.sum); err == nil && len(raw) > 0 {
+			parts = append(parts, d.alg+"="+base64.StdEncoding.EncodeToString(raw))
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// StructuredDigest formats a SHA-256 as an RFC 9530 Repr-Digest or
+// Content-Digest value (sha-256=:base64:), or "" if it isn't known. MD5
+// isn't offered: RFC 9530 marks it insecure.
+func StructuredDigest(sums models.Checksums) string {
+	raw, err := hex.DecodeString(sums.SHA256)
+	if err != nil || len(raw) == 0 {
+		return ""
+	}
+	return "sha-256=:" + base64.StdEncoding.EncodeToString(raw) + ":"
+}
+
+// ContentETag returns a strong ETag derived from a file's content hash, or ""
+// if none is known. Unlike modtime and size it survives a restore, a move
+// between categories and mirroring, so resumes and revalidation keep working.
+func ContentETag(sums models.Checksums) string {
+	switch {
+	case sums.SHA256 != "":
+		return `"sha256-` + strings.ToLower(sums.SHA256) + `"`
+	case sums.MD5 != "":
+		return `"md5-` + strings.ToLower(sums.MD5) + `"`
+	}
+	return ""
+}
+
+// StatETag returns a strong ETag for a file without recorded checksums, from
+// its size and modtime. It stays put as long as the file does, which is all
+// a segmented download needs to stitch its ranges together safely.
+func StatETag(size int64, modTime time.Time) string {
+	return fmt.Sprintf(`"%x-%x"`, modTime.UnixNano(), size)
+}
+
+// Checksums returns the recorded checksums of a published file
+func (s *FileService) Checksums(category, filename string) (models.Checksums, bool) {
+	meta, ok := s.meta.Get(filepath.Join(category, filepath.Base(filename)))
+	if !ok || (meta.SHA256 == "" && meta.MD5 == "") {
+		return models.Checksums{}, false
+	}
+	return models.Checksums{SHA256: meta.SHA256, MD5: meta.MD5}, true
+}
@@ -0,0 +1,272 @@
+package services
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"rom-server/internal/models"
+)
+
+// ErrNoObjectStore is returned for direct uploads when no bucket is configured
+var ErrNoObjectStore = errors.New("no object store configured")
+
+// PresignUpload reserves an object key for a new build and returns a presigned
+// PUT for it. If sha256Hex is given the bucket rejects bodies that don't match.
+func (s *FileService) PresignUpload(category, filename, sha256Hex string) (models.PresignedUploadResponse, error) {
+	var resp models.PresignedUploadResponse
+	if s.objects == nil {
+		return resp, ErrNoObjectStore
+	}
+
+	headers := make(map[string]string)
+	if sha256Hex != "" {
+		raw, err := hex.DecodeString(sha256Hex)
+		if err != nil || len(raw) != 32 {
+			return resp, fmt.Errorf("invalid sha256")
+		}
+		headers["x-amz-checksum-sha256"] = base64.StdEncoding.EncodeToString(raw)
+	}
+
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return resp, err
+	}
+	key := "uploads/" + category + "/" + hex.EncodeToString(id) + "/" + filename
+
+	ttl := s.objects.PresignTTL()
+	uploadURL, err := s.objects.Presign(http.MethodPut, key, ttl, headers)
+	if err != nil {
+		return resp, err
+	}
+
+	resp = models.PresignedUploadResponse{
+		UploadURL: uploadURL,
+		Method:    http.MethodPut,
+		ObjectKey: key,
+		ExpiresAt: time.Now().Add(ttl),
+	}
+	if len(headers) > 0 {
+		resp.Headers = headers
+	}
+	return resp, nil
+}
+
+// ContentCheck inspects the content of an upload, returning the details of
+// boot images and APKs; an error rejects it
+type ContentCheck func(file io.ReaderAt, size int64) (*models.ImageInfo, *models.APKInfo, error)
+
+// FinalizeUpload publishes an object the client PUT to a presigned URL. The
+// object stays in the bucket; downloads are redirected to it. It is read
+// back once and checked like an upload through SaveUpload: against the
+// sha256 the client claims, by inspect, against an imported manifest and by
+// the blocklist and virus scanner. A failing object is deleted from the
+// bucket, and quarantined unless only its checksum was wrong.
+func (s *FileService) FinalizeUpload(category, filename, objectKey, sha256Hex, uploader string, inspect ContentCheck) (models.Checksums, error) {
+	var sums models.Checksums
+	if s.objects == nil {
+		return sums, ErrNoObjectStore
+	}
+	prefix := "uploads/" + category + "/"
+	if !strings.HasPrefix(objectKey, prefix) || !strings.HasSuffix(objectKey, "/"+filename) {
+		return sums, invalid(fmt.Errorf("object key does not match category and filename"))
+	}
+
+	size, err := s.objects.Head(objectKey)
+	if errors.Is(err, errObjectNotFound) {
+		return sums, invalid(fmt.Errorf("uploaded object not found"))
+	}
+	if err != nil {
+		return sums, fmt.Errorf("failed to check uploaded object: %w", err)
+	}
+	// The presigned PUT can't enforce a size, so oversized objects are dropped here
+	if size > s.cfg.MaxUploadSizeFor(category) {
+		s.removeObject(objectKey)
+		return sums, invalid(fmt.Errorf("uploaded object exceeds the %s size limit", category))
+	}
+
+	tempPath, size, sums, err := s.fetchObject(objectKey, size)
+	if err != nil {
+		return sums, err
+	}
+	defer os.Remove(tempPath) // No-op once quarantined
+	verification, image, apk, err := s.checkObject(category, filename, tempPath, size, sums.SHA256, sha256Hex, uploader, inspect)
+	if err != nil {
+		if !errors.Is(err, ErrScanFailed) && !errors.Is(err, ErrInsufficientSpace) {
+			s.removeObject(objectKey)
+		}
+		return sums, err
+	}
+
+	s.mu.Lock()
+
+	// A local copy under the same name is superseded by the bucket one
+	replaced := s.fileExists(category, filename)
+	localPath := filepath.Join(s.cfg.Storage.UploadDir, category, filename)
+	if err := os.Remove(localPath); err != nil && !os.IsNotExist(err) {
+		s.mu.Unlock()
+		return sums, fmt.Errorf("failed to replace local file: %w", err)
+	}
+
+	key := filepath.Join(category, filename)
+	var previous string
+	if err := s.meta.Update(key, func(m *models.FileMetadata) {
+		previous = m.ObjectKey
+		m.SHA256, m.SHA1, m.MD5 = sums.SHA256, sums.SHA1, sums.MD5
+		m.ObjectKey = objectKey
+		m.Size = size
+		m.UploadedAt = time.Now().Unix()
+		m.Release, m.Notes, m.Uploader = nil, "", uploader
+		m.Image, m.APK, m.Verification = image, apk, verification
+	}); err != nil {
+		s.mu.Unlock()
+		return sums, fmt.Errorf("failed to record upload: %w", err)
+	}
+	if previous != "" && previous != objectKey {
+		s.removeObject(previous)
+	}
+
+	s.invalidateListing(category)
+	s.statCache.Invalidate(key)
+	go s.bumpGeneration()
+	if replaced {
+		s.cdn.Purge(category, filename)
+	}
+	s.assignShortCode(key)
+	// Older builds go only once this one is live
+	if _, err := s.enforceFileLimit(category, filename); err != nil {
+		s.logf("Failed to enforce the file limit of %s: %v", category, err)
+	}
+	s.mu.Unlock()
+
+	if verification != nil {
+		s.settleExpected(category, filename)
+	}
+	return sums, nil
+}
+
+// fetchObject reads an uploaded object into a temp file, hashing it on the
+// way, and returns the file's path and size
+func (s *FileService) fetchObject(objectKey string, size int64) (string, int64, models.Checksums, error) {
+	var sums models.Checksums
+	body, err := s.objects.Get(objectKey)
+	if err != nil {
+		return "", 0, sums, fmt.Errorf("failed to read uploaded object: %w", err)
+	}
+	defer body.Close()
+
+	tempFile, err := os.CreateTemp(filepath.Join(s.cfg.Storage.UploadDir, s.cfg.Storage.TempDir), "object-*.tmp")
+	if err != nil {
+		return "", 0, sums, fmt.Errorf("failed to create temp file: %w", err)
+	}
+	if size > 0 {
+		if err := preallocate(tempFile, size); err != nil {
+			tempFile.Close()
+			os.Remove(tempFile.Name())
+			return "", 0, sums, fmt.Errorf("failed to preallocate %d bytes: %w", size, err)
+		}
+	}
+	sha, sha1Sum, md := sha256.New(), sha1.New(), md5.New()
+	written, err := io.Copy(io.MultiWriter(tempFile, sha, sha1Sum, md), body)
+	if err == nil && written < size {
+		err = tempFile.Truncate(written)
+	}
+	if closeErr := tempFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tempFile.Name())
+		return "", 0, sums, fmt.Errorf("failed to read uploaded object: %w", err)
+	}
+	sums.SHA256 = hex.EncodeToString(sha.Sum(nil))
+	sums.SHA1 = hex.EncodeToString(sha1Sum.Sum(nil))
+	sums.MD5 = hex.EncodeToString(md.Sum(nil))
+	return tempFile.Name(), written, sums, nil
+}
+
+// checkObject runs the SaveUpload checks on a fetched object at path whose
+// real SHA-256 is sum; claimed is the one the client gave, if any
+func (s *FileService) checkObject(category, filename, path string, size int64, sum, claimed, uploader string, inspect ContentCheck) (verification *models.Verification, image *models.ImageInfo, apk *models.APKInfo, err error) {
+	if claimed != "" && !strings.EqualFold(sum, claimed) {
+		return nil, nil, nil, ErrChecksumMismatch
+	}
+	if inspect != nil {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		image, apk, err = inspect(f, size)
+		f.Close()
+		if err != nil {
+			item, qErr := s.quarantine(category, filename, path, size, sum, uploader, QuarantineInvalid, err.Error())
+			if qErr != nil {
+				return nil, nil, nil, fmt.Errorf("%w (not quarantined: %v)", err, qErr)
+			}
+			return nil, nil, nil, &QuarantineError{File: item}
+		}
+	}
+	if verification, err = s.checkExpected(category, filename, sum); err != nil {
+		return nil, nil, nil, err
+	}
+	reason, details, err := s.screen(path, sum)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if reason != "" {
+		item, err := s.quarantine(category, filename, path, size, sum, uploader, reason, details)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		return nil, nil, nil, &QuarantineError{File: item}
+	}
+	return verification, image, apk, nil
+}
+
+// RemoteURL returns a presigned download URL if a file lives in the bucket
+func (s *FileService) RemoteURL(category, filename string) (string, bool) {
+	if s.objects == nil {
+		return "", false
+	}
+	meta, ok := s.meta.Get(filepath.Join(category, filepath.Base(filename)))
+	if !ok || meta.ObjectKey == "" {
+		return "", false
+	}
+
+	target, err := s.objects.Presign(http.MethodGet, meta.ObjectKey, s.objects.PresignTTL(), nil)
+	if err != nil {
+		return "", false
+	}
+	return target, true
+}
+
+// remoteFiles lists bucket-backed files of a category from metadata
+func (s *FileService) remoteFiles(category string) map[string]models.FileMetadata {
+	remote := make(map[string]models.FileMetadata)
+	for key, meta := range s.meta.All() {
+		if meta.ObjectKey != "" && filepath.Dir(key) == category {
+			remote[filepath.Base(key)] = meta
+		}
+	}
+	return remote
+}
+
+// removeObject deletes a superseded object in the background (best effort)
+func (s *FileService) removeObject(objectKey string) {
+	if s.objects == nil {
+		return
+	}
+	s.workers.Submit("object-delete "+objectKey, func() error {
+		return s.objects.Delete(objectKey)
+	})
+}
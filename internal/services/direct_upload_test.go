@@ -0,0 +1,43 @@
+package services
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"rom-server/internal/config"
+)
+
+func TestFinalizeUploadErrors(t *testing.T) {
+	tests := []struct {
+		name        string
+		key         string
+		status      int
+		wantInvalid bool
+	}{
+		{"key outside category", "uploads/other/abc/a.zip", http.StatusOK, true},
+		{"object missing", "uploads/vanilla/abc/a.zip", http.StatusNotFound, true},
+		{"bucket failing", "uploads/vanilla/abc/a.zip", http.StatusInternalServerError, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bucket := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+			}))
+			defer bucket.Close()
+
+			s := newTestService(t, "vanilla")
+			s.cfg.ObjectStore = config.ObjectStoreConfig{Enabled: true, Endpoint: bucket.URL, Bucket: "b", PathStyle: true, AccessKeyID: "id", SecretAccessKey: "secret"}
+			s.objects = NewObjectStore(s.cfg)
+
+			_, err := s.FinalizeUpload("vanilla", "a.zip", tt.key, "", "", nil)
+			if err == nil {
+				t.Fatal("FinalizeUpload succeeded")
+			}
+			if got := errors.Is(err, ErrInvalid); got != tt.wantInvalid {
+				t.Errorf("errors.Is(%v, ErrInvalid) = %v, want %v", err, got, tt.wantInvalid)
+			}
+		})
+	}
+}
@@ -0,0 +1,240 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"rom-server/internal/models"
+)
+
+// FeedbackOutcomes are the results a user can report for a build
+var FeedbackOutcomes = []string{"works", "issues", "bootloop"}
+
+// Bounds on what a feedback entry can carry
+const (
+	maxFeedbackDevice  = 100
+	maxFeedbackMessage = 500
+)
+
+// maxPendingFeedback bounds the moderation queue, so a flood of submissions
+// can't grow the file without limit
+const maxPendingFeedback = 500
+
+// ErrFeedbackQueueFull is returned when the moderation queue is full
+var ErrFeedbackQueueFull = errors.New("too much feedback is waiting for moderation")
+
+// FeedbackStore keeps user feedback on builds in a JSON file. New entries
+// wait for a moderator; only approved ones are shown publicly.
+type FeedbackStore struct {
+	mu sync.Mutex
+	jsonFile[[]models.Feedback]
+}
+
+// NewFeedbackStore loads the feedback file at path (missing file is fine)
+func NewFeedbackStore(path string) (*FeedbackStore, error) {
+	f := &FeedbackStore{jsonFile: jsonFile[[]models.Feedback]{path: path, name: "feedback", perm: 0600}} // Holds client addresses
+	if err := f.refresh(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Restore replaces the feedback with a file unpacked from a backup
+func (f *FeedbackStore) Restore(src string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.restore(src)
+}
+
+// All returns every entry, pending and approved, newest first
+func (f *FeedbackStore) All() ([]models.Feedback, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.refresh(); err != nil {
+		return nil, err
+	}
+	items := append([]models.Feedback{}, f.data...)
+	sort.SliceStable(items, func(i, j int) bool { return items[i].CreatedAt > items[j].CreatedAt })
+	return items, nil
+}
+
+// Submit validates an entry from a user and queues it for moderation
+func (f *FeedbackStore) Submit(req models.FeedbackRequest, sha256, client string) (models.Feedback, error) {
+	item, err := feedbackFromRequest(req)
+	if err != nil {
+		return models.Feedback{}, err
+	}
+	if item.ID, err = newAnnouncementID(); err != nil {
+		return models.Feedback{}, err
+	}
+	item.SHA256, item.Client = sha256, client
+	item.CreatedAt = time.Now().UTC().Format(time.RFC3339)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.refresh(); err != nil {
+		return models.Feedback{}, err
+	}
+	pending := 0
+	for _, existing := range f.data {
+		if !existing.Approved {
+			pending++
+		}
+	}
+	if pending >= maxPendingFeedback {
+		return models.Feedback{}, ErrFeedbackQueueFull
+	}
+	items := append(append([]models.Feedback{}, f.data...), item)
+	return item, f.save(items)
+}
+
+// Approve makes an entry public
+func (f *FeedbackStore) Approve(id string) (models.Feedback, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.refresh(); err != nil {
+		return models.Feedback{}, err
+	}
+	items := append([]models.Feedback{}, f.data...)
+	for i := range items {
+		if items[i].ID == id {
+			items[i].Approved = true
+			return items[i], f.save(items)
+		}
+	}
+	return models.Feedback{}, ErrNotFound
+}
+
+// Delete removes an entry, pending or approved
+func (f *FeedbackStore) Delete(id string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.refresh(); err != nil {
+		return err
+	}
+	items := make([]models.Feedback, 0, len(f.data))
+	for _, item := range f.data {
+		if item.ID != id {
+			items = append(items, item)
+		}
+	}
+	if len(items) == len(f.data) {
+		return ErrNotFound
+	}
+	return f.save(items)
+}
+
+// Purge removes every entry, pending or approved, sent by one client and
+// returns how many there were. A nil store purges nothing.
+func (f *FeedbackStore) Purge(m AddressMatcher) (int, error) {
+	if f == nil {
+		return 0, nil
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.refresh(); err != nil {
+		return 0, err
+	}
+	items := make([]models.Feedback, 0, len(f.data))
+	for _, item := range f.data {
+		if !m.Match(item.Client) {
+			items = append(items, item)
+		}
+	}
+	purged := len(f.data) - len(items)
+	if purged == 0 {
+		return 0, nil
+	}
+	return purged, f.save(items)
+}
+
+// Approved returns the approved entries on a build, newest first, without
+// client addresses. Feedback on an earlier upload under the same name
+// (another sha256) is left out. A nil store or an unreadable file yields none.
+func (f *FeedbackStore) Approved(category, filename, sha256 string) []models.Feedback {
+	approved := []models.Feedback{}
+	if f == nil {
+		return approved
+	}
+	items, err := f.All()
+	if err != nil {
+		return approved
+	}
+	for _, item := range items {
+		if item.Approved && item.Category == category && item.Filename == filename && feedbackOnBuild(item, sha256) {
+			item.Client = ""
+			approved = append(approved, item)
+		}
+	}
+	return approved
+}
+
+// Tally counts approved entries per outcome, keyed by category/filename.
+// Like Approved it leaves out feedback on an earlier upload, comparing
+// against the sha256 the callback returns for a file ("" if unknown). A nil
+// store yields none.
+func (f *FeedbackStore) Tally(sha256 func(category, filename string) string) map[string]map[string]int64 {
+	tally := make(map[string]map[string]int64)
+	if f == nil {
+		return tally
+	}
+	items, err := f.All()
+	if err != nil {
+		return tally
+	}
+	for _, item := range items {
+		if !item.Approved || !feedbackOnBuild(item, sha256(item.Category, item.Filename)) {
+			continue
+		}
+		key := item.Category + "/" + item.Filename
+		if tally[key] == nil {
+			tally[key] = make(map[string]int64)
+		}
+		tally[key][item.Outcome]++
+	}
+	return tally
+}
+
+// feedbackOnBuild reports whether an entry was left on the upload with this
+// sha256; entries or files without one match anything
+func feedbackOnBuild(item models.Feedback, sha256 string) bool {
+	return item.SHA256 == "" || sha256 == "" || item.SHA256 == sha256
+}
+
+// feedbackFromRequest validates and normalizes a submission
+func feedbackFromRequest(req models.FeedbackRequest) (models.Feedback, error) {
+	item := models.Feedback{
+		Category: req.Category,
+		Filename: req.Filename,
+		Outcome:  strings.ToLower(strings.TrimSpace(req.Outcome)),
+		Device:   strings.TrimSpace(req.Device),
+		Message:  strings.TrimSpace(req.Message),
+	}
+	known := false
+	for _, outcome := range FeedbackOutcomes {
+		known = known || item.Outcome == outcome
+	}
+	if item.Outcome == "" {
+		return item, &InvalidField{Field: "outcome", Message: "is required"}
+	}
+	if !known {
+		return item, &InvalidField{Field: "outcome", Message: fmt.Sprintf("%q must be one of %s", item.Outcome, strings.Join(FeedbackOutcomes, ", "))}
+	}
+	if utf8.RuneCountInString(item.Device) > maxFeedbackDevice || !utf8.ValidString(item.Device) {
+		return item, &InvalidField{Field: "device", Message: fmt.Sprintf("must be at most %d characters", maxFeedbackDevice)}
+	}
+	if utf8.RuneCountInString(item.Message) > maxFeedbackMessage || !utf8.ValidString(item.Message) {
+		return item, &InvalidField{Field: "message", Message: fmt.Sprintf("must be at most %d characters", maxFeedbackMessage)}
+	}
+	return item, nil
+}
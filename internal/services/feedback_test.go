@@ -0,0 +1,56 @@
+package services
+
+import (
+	"path/filepath"
+	"testing"
+
+	"rom-server/internal/models"
+)
+
+func TestFeedbackTallySkipsEarlierUploads(t *testing.T) {
+	f, err := NewFeedbackStore(filepath.Join(t.TempDir(), "feedback.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	submit := func(outcome, sha256 string, approve bool) {
+		item, err := f.Submit(models.FeedbackRequest{Category: "vanilla", Filename: "a.zip", Outcome: outcome}, sha256, "1.2.3.4")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if approve {
+			if _, err := f.Approve(item.ID); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	submit("works", "new", true)
+	submit("works", "", true)
+	submit("bootloop", "old", true)
+	submit("issues", "new", false)
+
+	tests := []struct {
+		name   string
+		sha256 string
+		want   map[string]int64
+	}{
+		{"current upload", "new", map[string]int64{"works": 2}},
+		{"unknown checksum", "", map[string]int64{"works": 2, "bootloop": 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tally := f.Tally(func(category, filename string) string { return tt.sha256 })
+			got := tally["vanilla/a.zip"]
+			if len(got) != len(tt.want) {
+				t.Fatalf("tally = %v, want %v", got, tt.want)
+			}
+			for outcome, n := range tt.want {
+				if got[outcome] != n {
+					t.Errorf("tally[%s] = %d, want %d", outcome, got[outcome], n)
+				}
+			}
+			if approved := f.Approved("vanilla", "a.zip", tt.sha256); int64(len(approved)) != tt.want["works"]+tt.want["bootloop"] {
+				t.Errorf("Approved returned %d entries, Tally counted %v", len(approved), got)
+			}
+		})
+	}
+}
@@ -1,47 +1,210 @@
 package services
 
 import (
+	"context"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"log"
+	"net/url"
 	"os"
 	"path/filepath"
+	"slices"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
+	"rom-server/internal/cluster"
 	"rom-server/internal/config"
 	"rom-server/internal/models"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// ErrInsufficientSpace is returned when the disk can't hold an upload
+var ErrInsufficientSpace = errors.New("insufficient disk space")
+
+// ErrChecksumMismatch is returned when a file doesn't match its expected digest
+var ErrChecksumMismatch = errors.New("checksum mismatch")
+
+// ErrNotFound is returned for operations on a file that isn't published
+var ErrNotFound = errors.New("file not found")
+
+// ErrUploadAborted is returned when an upload's context ends mid-copy,
+// typically because the client hung up
+var ErrUploadAborted = errors.New("upload aborted")
+
+// ErrUploadsBusy is returned when no upload slot frees up within the queue
+// timeout
+var ErrUploadsBusy = errors.New("all upload slots are busy")
+
+// ErrFileExists is returned when a move would overwrite another build
+var ErrFileExists = errors.New("a file with that name already exists")
+
+// InvalidField is returned when one field of a request fails validation, so
+// handlers can report which one
+type InvalidField struct {
+	Field   string // Request field, e.g. "expires_at"
+	Message string // What is wrong with it, e.g. "is required"
+}
+
+func (e *InvalidField) Error() string {
+	return e.Field + " " + e.Message
+}
+
+// ErrInvalid matches the errors of requests a service turns down as asked,
+// like a malformed tag or moving a file onto itself. Their text is meant for
+// the client; any other error is the server's own failure.
+var ErrInvalid = errors.New("invalid request")
+
+// invalidRequest marks err as matching ErrInvalid, keeping its text
+type invalidRequest struct{ error }
+
+func invalid(err error) error { return invalidRequest{err} }
+
+func (e invalidRequest) Is(target error) bool { return target == ErrInvalid }
+
+func (e invalidRequest) Unwrap() error { return e.error }
+
+// statsFlushInterval is how often pending counter updates are written to disk
+const statsFlushInterval = 5 * time.Second
+
+// statCacheTTL bounds how stale a cached stat can get if files change behind our back
+const statCacheTTL = 30 * time.Second
+
+// Date formats used for daily statistics and monthly traffic accounting
+const (
+	dateLayout  = "2006-01-02"
+	monthLayout = "2006-01"
 )
 
 // FileService handles all file operations with concurrency control
 type FileService struct {
 	cfg            *config.Config
-	uploadSem      chan struct{} // Semaphore for upload concurrency
-	downloadSem    chan struct{} // Semaphore for download concurrency
-	mu             sync.RWMutex  // Mutex for file operations
-	downloadCounts map[string]int64
+	notifier       *Notifier
+	cdn            *CDN         // Purged when a published file is replaced or removed (nil without a CDN)
+	objects        *ObjectStore // Bucket for direct uploads (nil if not configured)
+	workers        *WorkerPool  // Runs object deletes (nil runs them on their own goroutine)
+	meta           *MetadataStore
+	statCache      *StatCache
+	transfers      *TransferTracker
+	shared         cluster.Store               // Shared backend in cluster mode (nil otherwise)
+	logger         *log.Logger                 // For failures nobody waits on (nil = silent)
+	deltas         map[string]map[string]int64 // Counter changes not yet pushed to shared
+	generation     string                      // Last seen shared file-set generation
+	uploadSem      chan struct{}               // Semaphore for upload concurrency
+	uploadsQueued  int64                       // Uploads waiting for a slot (atomic)
+	downloadSlots  map[string]*downloadSlots   // Download concurrency per priority class
+	segmentsMu     sync.Mutex
+	segments       map[string]int              // Open download connections per client IP
+	mu             sync.RWMutex                // Mutex for file operations
+	downloadCounts map[string]int64            // Public counts (bots excluded if configured)
+	clientCounts   map[string]map[string]int64 // Raw per-client breakdown for admins
+	dailyCounts    map[string]map[string]int64 // Public counts per day (YYYY-MM-DD) per file
+	traffic        map[string]map[string]int64 // Bytes served per month (YYYY-MM) per category
+	referrers      map[string]map[string]int64 // Short link visits per file per referring site
 	statsPath      string
-	
-	// Cache for file listing (reduces disk IO)
-	cachedFiles []models.FileInfo
-	cacheValid  bool
+	statsDirty     chan struct{} // Signals the stats writer that counters changed
+	statsDone      chan struct{} // Closed to stop the stats writer
+	statsStopped   chan struct{} // Closed once the final flush completed
+	statsErr       error         // Result of the final flush
+	closeOnce      sync.Once
+	blocklist      *hashBlocklist // quarantine.blocklist_file (nil without one)
+	quarantineMu   sync.Mutex     // Serializes changes to the quarantine dir
+	manifestMu     sync.Mutex     // Guards expected_checksums.json
+
+	// Cache for file listing (reduces disk IO); see listing.go
+	listing     map[string][]models.FileInfo // Per category, newest first
+	cachedFiles []models.FileInfo            // Every category merged, newest first
+	cacheValid  bool                         // False while some category needs reading
+	onChange    []func()                     // Run whenever the listing is invalidated
 }
 
 // NewFileService creates a new FileService with concurrency limits
-func NewFileService(cfg *config.Config) *FileService {
+func NewFileService(cfg *config.Config, notifier *Notifier, cdn *CDN, objects *ObjectStore, workers *WorkerPool, meta *MetadataStore, shared cluster.Store, logger *log.Logger) *FileService {
 	fs := &FileService{
 		cfg:            cfg,
+		notifier:       notifier,
+		cdn:            cdn,
+		objects:        objects,
+		workers:        workers,
+		meta:           meta,
+		statCache:      NewStatCache(cfg.Concurrency.StatCacheSize, statCacheTTL),
+		transfers:      NewTransferTracker(),
+		shared:         shared,
+		logger:         logger,
+		deltas:         make(map[string]map[string]int64),
 		uploadSem:      make(chan struct{}, cfg.Concurrency.MaxConcurrentUploads),
-		downloadSem:    make(chan struct{}, cfg.Concurrency.MaxConcurrentDownloads),
+		downloadSlots:  newDownloadSlots(cfg),
+		segments:       make(map[string]int),
 		downloadCounts: make(map[string]int64),
+		clientCounts:   make(map[string]map[string]int64),
+		dailyCounts:    make(map[string]map[string]int64),
+		traffic:        make(map[string]map[string]int64),
+		referrers:      make(map[string]map[string]int64),
 		statsPath:      filepath.Join(cfg.Storage.UploadDir, "stats.json"),
+		statsDirty:     make(chan struct{}, 1),
+		statsDone:      make(chan struct{}),
+		statsStopped:   make(chan struct{}),
+	}
+	if cfg.Quarantine.BlocklistFile != "" {
+		fs.blocklist = &hashBlocklist{path: cfg.Quarantine.BlocklistFile}
 	}
 	// Try to load existing stats (ignore error on first run)
 	_ = fs.loadStats()
+
+	// First instance in a fresh cluster carries its history over (best effort)
+	if shared != nil {
+		_ = fs.seedCluster()
+	}
+
+	// Single writer goroutine owns stats.json
+	go fs.statsWriter()
 	return fs
 }
 
+// logf logs a failure that doesn't fail the operation it happened in
+func (s *FileService) logf(format string, args ...interface{}) {
+	if s.logger != nil {
+		s.logger.Printf(format, args...)
+	}
+}
+
+// Close flushes pending stats to disk and stops background workers
+func (s *FileService) Close() error {
+	s.closeOnce.Do(func() {
+		close(s.statsDone)
+	})
+	<-s.statsStopped
+	return s.statsErr
+}
+
+// Ping checks the service can take its lock and reach the upload dir; it
+// blocks if the lock is wedged
+func (s *FileService) Ping() error {
+	s.mu.Lock()
+	s.mu.Unlock()
+	_, err := os.Stat(s.cfg.Storage.UploadDir)
+	return err
+}
+
+// statsData is the on-disk layout of stats.json
+type statsData struct {
+	Downloads map[string]int64            `json:"downloads"`
+	Clients   map[string]map[string]int64 `json:"clients,omitempty"`
+	Daily     map[string]map[string]int64 `json:"daily,omitempty"`
+	Traffic   map[string]map[string]int64 `json:"traffic,omitempty"`
+	Referrers map[string]map[string]int64 `json:"referrers,omitempty"`
+}
+
 // loadStats loads download counts from JSON file
 func (s *FileService) loadStats() error {
 	s.mu.Lock()
@@ -51,37 +214,380 @@ func (s *FileService) loadStats() error {
 	if err != nil {
 		return err
 	}
+
+	var stats statsData
+	if err := json.Unmarshal(data, &stats); err == nil && stats.Downloads != nil {
+		s.downloadCounts = stats.Downloads
+		if stats.Clients != nil {
+			s.clientCounts = stats.Clients
+		}
+		if stats.Daily != nil {
+			s.dailyCounts = stats.Daily
+		}
+		if stats.Traffic != nil {
+			s.traffic = stats.Traffic
+		}
+		if stats.Referrers != nil {
+			s.referrers = stats.Referrers
+		}
+		return nil
+	}
+
+	// Legacy format: flat map of file key to count
 	return json.Unmarshal(data, &s.downloadCounts)
 }
 
-// saveStats saves download counts to JSON file
+// markStatsDirty schedules a stats flush without blocking the caller
+func (s *FileService) markStatsDirty() {
+	select {
+	case s.statsDirty <- struct{}{}:
+	default: // A flush is already pending
+	}
+}
+
+// statsWriter batches counter updates into periodic writes of stats.json
+func (s *FileService) statsWriter() {
+	defer close(s.statsStopped)
+
+	ticker := time.NewTicker(statsFlushInterval)
+	defer ticker.Stop()
+
+	// Cluster mode syncs counters with the shared store on its own schedule
+	var syncC <-chan time.Time
+	if s.shared != nil {
+		interval := time.Duration(s.cfg.Cluster.SyncIntervalSeconds) * time.Second
+		if interval <= 0 {
+			interval = statsFlushInterval
+		}
+		syncTicker := time.NewTicker(interval)
+		defer syncTicker.Stop()
+		syncC = syncTicker.C
+	}
+
+	dirty := false
+	flush := func() {
+		if err := s.saveStats(); err != nil {
+			// Keep the dirty flag so the next tick retries
+			return
+		}
+		dirty = false
+	}
+
+	for {
+		select {
+		case <-s.statsDirty:
+			dirty = true
+		case <-ticker.C:
+			if dirty {
+				flush()
+			}
+		case <-syncC:
+			// Errors are retried on the next tick with deltas re-queued
+			_ = s.syncCluster()
+		case <-s.statsDone:
+			if s.shared != nil {
+				_ = s.syncCluster()
+			}
+			// Pick up a signal that raced with shutdown
+			select {
+			case <-s.statsDirty:
+				dirty = true
+			default:
+			}
+			if dirty {
+				s.statsErr = s.saveStats()
+			}
+			return
+		}
+	}
+}
+
+// saveStats atomically writes download counts to JSON file (temp file + rename)
 func (s *FileService) saveStats() error {
 	s.mu.RLock()
-	data, err := json.MarshalIndent(s.downloadCounts, "", "  ")
+	data, err := json.MarshalIndent(statsData{
+		Downloads: s.downloadCounts,
+		Clients:   s.clientCounts,
+		Daily:     s.dailyCounts,
+		Traffic:   s.traffic,
+		Referrers: s.referrers,
+	}, "", "  ")
 	s.mu.RUnlock()
-	
+
 	if err != nil {
 		return err
 	}
-	return os.WriteFile(s.statsPath, data, 0644)
+
+	tmpPath := s.statsPath + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, s.statsPath)
 }
 
-// IncrementDownloadCount increments the count for a file
-func (s *FileService) IncrementDownloadCount(category, filename string) {
+// IncrementDownloadCount records a download of a file by the given client class
+func (s *FileService) IncrementDownloadCount(category, filename, client string) {
 	key := filepath.Join(category, filename)
-	
+	var count int64
+
+	s.mu.Lock()
+	if s.clientCounts[key] == nil {
+		s.clientCounts[key] = make(map[string]int64)
+	}
+	s.clientCounts[key][client]++
+	// Bots still show up in the raw breakdown but not in public counts
+	if client != ClientBot || !s.cfg.Analytics.ExcludeBots {
+		s.downloadCounts[key]++
+
+		day := time.Now().Format(dateLayout)
+		if s.dailyCounts[day] == nil {
+			s.dailyCounts[day] = make(map[string]int64)
+		}
+		s.dailyCounts[day][key]++
+
+		s.recordDelta(sharedDownloads, key, 1)
+		s.recordDelta(sharedDailyHash+day, key, 1)
+		count = s.downloadCounts[key]
+	}
+	s.mu.Unlock()
+
+	s.checkMilestone(category, filename, count)
+
+	// Persisted in batches by the stats writer
+	s.markStatsDirty()
+}
+
+// SetDownloadCount overrides the public counter of a file and returns the previous value
+func (s *FileService) SetDownloadCount(category, filename string, value int64) (int64, error) {
+	if value < 0 {
+		return 0, fmt.Errorf("download count cannot be negative")
+	}
+	if _, err := s.GetFilePath(category, filename); err != nil {
+		return 0, err
+	}
+
+	key := filepath.Join(category, filepath.Base(filename))
+
 	s.mu.Lock()
-	s.downloadCounts[key]++
+	previous := s.downloadCounts[key]
+	s.downloadCounts[key] = value
+	delete(s.deltas[sharedDownloads], key)
 	s.mu.Unlock()
 
-	// Persist asynchronously to avoid blocking download
-	// In a real high-scale app, we'd batch this. For this usage, it's fine.
-	go s.saveStats()
+	// Absolute values bypass delta batching in cluster mode
+	if s.shared != nil {
+		if err := s.shared.HashSet(sharedDownloads, key, strconv.FormatInt(value, 10)); err != nil {
+			return previous, fmt.Errorf("failed to update shared counter: %w", err)
+		}
+	}
+
+	s.markStatsDirty()
+	return previous, nil
 }
 
-// AcquireUploadSlot blocks until an upload slot is available
-func (s *FileService) AcquireUploadSlot() {
-	s.uploadSem <- struct{}{}
+// GetDownloadTotal sums public download counts for a category, or all categories if empty
+func (s *FileService) GetDownloadTotal(category string) int64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var total int64
+	for key, count := range s.downloadCounts {
+		if category == "" || filepath.Dir(key) == category {
+			total += count
+		}
+	}
+	return total
+}
+
+// GetDailyStats returns per-file, per-day download counts within [from, to]
+func (s *FileService) GetDailyStats(from, to time.Time) []models.DailyStat {
+	fromDay := from.Format(dateLayout)
+	toDay := to.Format(dateLayout)
+
+	s.mu.RLock()
+	var stats []models.DailyStat
+	for day, files := range s.dailyCounts {
+		// YYYY-MM-DD sorts lexically, so string comparison is enough
+		if day < fromDay || day > toDay {
+			continue
+		}
+		for key, count := range files {
+			stats = append(stats, models.DailyStat{
+				Date:      day,
+				Category:  filepath.Dir(key),
+				Filename:  filepath.Base(key),
+				Downloads: count,
+			})
+		}
+	}
+	s.mu.RUnlock()
+
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Date != stats[j].Date {
+			return stats[i].Date < stats[j].Date
+		}
+		if stats[i].Category != stats[j].Category {
+			return stats[i].Category < stats[j].Category
+		}
+		return stats[i].Filename < stats[j].Filename
+	})
+
+	return stats
+}
+
+// checkMilestone fires a webhook when a file's public count hits a configured milestone
+func (s *FileService) checkMilestone(category, filename string, count int64) {
+	for _, milestone := range s.cfg.Webhooks.Milestones {
+		if count == milestone {
+			s.notifier.Notify(models.WebhookEvent{
+				Event:     "download.milestone",
+				Text:      fmt.Sprintf("%s/%s reached %s downloads", category, filename, FormatCount(milestone)),
+				Category:  category,
+				Filename:  filename,
+				Downloads: milestone,
+			})
+			return
+		}
+	}
+}
+
+// NotifyReport sends a webhook for a build a user reported, if
+// webhooks.notify_reports is on
+func (s *FileService) NotifyReport(category, filename, reason, message string) {
+	if !s.cfg.Webhooks.NotifyReports {
+		return
+	}
+	text := fmt.Sprintf("%s/%s was reported as %s", category, filename, reason)
+	if message != "" {
+		text += ": " + message
+	}
+	s.notifier.Notify(models.WebhookEvent{
+		Event:    "build.reported",
+		Text:     text,
+		Category: category,
+		Filename: filename,
+	})
+}
+
+// AddTraffic records bytes served for a category in the current month
+func (s *FileService) AddTraffic(category string, bytes int64) {
+	if bytes <= 0 {
+		return
+	}
+	month := time.Now().Format(monthLayout)
+
+	s.mu.Lock()
+	if s.traffic[month] == nil {
+		s.traffic[month] = make(map[string]int64)
+	}
+	s.traffic[month][category] += bytes
+	s.recordDelta(sharedTraffic+month, category, bytes)
+	s.mu.Unlock()
+
+	s.markStatsDirty()
+}
+
+// MonthlyTraffic returns total bytes served in the current month
+func (s *FileService) MonthlyTraffic() int64 {
+	month := time.Now().Format(monthLayout)
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var total int64
+	for _, bytes := range s.traffic[month] {
+		total += bytes
+	}
+	return total
+}
+
+// TrafficCapReached reports whether the configured monthly transfer cap is exhausted
+func (s *FileService) TrafficCapReached() bool {
+	limit := s.cfg.GetMonthlyCap()
+	return limit > 0 && s.MonthlyTraffic() >= limit
+}
+
+// GetTrafficReport returns bytes served per month and category
+func (s *FileService) GetTrafficReport() models.TrafficResponse {
+	current := s.MonthlyTraffic()
+
+	s.mu.RLock()
+	months := make(map[string]map[string]int64, len(s.traffic))
+	for month, cats := range s.traffic {
+		months[month] = make(map[string]int64, len(cats))
+		for cat, bytes := range cats {
+			months[month][cat] = bytes
+		}
+	}
+	s.mu.RUnlock()
+
+	limit := s.cfg.GetMonthlyCap()
+	return models.TrafficResponse{
+		Months:       months,
+		CurrentMonth: time.Now().Format(monthLayout),
+		CurrentBytes: current,
+		CapBytes:     limit,
+		CapReached:   limit > 0 && current >= limit,
+	}
+}
+
+// GetDownloadBreakdown returns per-file download counts split by client class
+func (s *FileService) GetDownloadBreakdown() []models.FileStats {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	stats := make([]models.FileStats, 0, len(s.clientCounts))
+	for key, clients := range s.clientCounts {
+		breakdown := make(map[string]int64, len(clients))
+		var total int64
+		for client, count := range clients {
+			breakdown[client] = count
+			total += count
+		}
+		stats = append(stats, models.FileStats{
+			Category:  filepath.Dir(key),
+			Filename:  filepath.Base(key),
+			Downloads: s.downloadCounts[key],
+			Total:     total,
+			Clients:   breakdown,
+			Referrers: copyCounts(s.referrers[key]),
+		})
+	}
+
+	sort.Slice(stats, func(i, j int) bool {
+		return stats[i].Total > stats[j].Total
+	})
+
+	return stats
+}
+
+// AcquireUploadSlot waits for an upload slot for up to the configured queue
+// timeout, returning ErrUploadsBusy if none frees up, or ctx's error if the
+// client gives up first
+func (s *FileService) AcquireUploadSlot(ctx context.Context) error {
+	select {
+	case s.uploadSem <- struct{}{}:
+		return nil
+	default:
+	}
+
+	atomic.AddInt64(&s.uploadsQueued, 1)
+	defer atomic.AddInt64(&s.uploadsQueued, -1)
+	timer := time.NewTimer(time.Duration(s.cfg.Concurrency.UploadQueueTimeoutSeconds) * time.Second)
+	defer timer.Stop()
+	select {
+	case s.uploadSem <- struct{}{}:
+		return nil
+	case <-timer.C:
+		return ErrUploadsBusy
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// UploadQueue reports how many uploads hold a slot and how many wait for one
+func (s *FileService) UploadQueue() (active, queued int64) {
+	return int64(len(s.uploadSem)), atomic.LoadInt64(&s.uploadsQueued)
 }
 
 // ReleaseUploadSlot releases an upload slot
@@ -89,14 +595,69 @@ func (s *FileService) ReleaseUploadSlot() {
 	<-s.uploadSem
 }
 
-// AcquireDownloadSlot blocks until a download slot is available
-func (s *FileService) AcquireDownloadSlot() {
-	s.downloadSem <- struct{}{}
+// downloadSlots is the semaphore of one download priority class
+type downloadSlots struct {
+	sem    chan struct{}
+	queued int64 // Downloads waiting for a slot (atomic)
+}
+
+func newDownloadSlots(cfg *config.Config) map[string]*downloadSlots {
+	slots := make(map[string]*downloadSlots, len(config.DownloadClasses))
+	for _, class := range config.DownloadClasses {
+		slots[class] = &downloadSlots{sem: make(chan struct{}, cfg.DownloadSlots(class))}
+	}
+	return slots
+}
+
+// AcquireDownloadSlot blocks until a slot of the priority class of a
+// download of size bytes is available, and returns that class for
+// ReleaseDownloadSlot
+func (s *FileService) AcquireDownloadSlot(size int64) string {
+	class := s.cfg.DownloadClass(size)
+	slots := s.downloadSlots[class]
+	select {
+	case slots.sem <- struct{}{}:
+		return class
+	default:
+	}
+	atomic.AddInt64(&slots.queued, 1)
+	defer atomic.AddInt64(&slots.queued, -1)
+	slots.sem <- struct{}{}
+	return class
+}
+
+// ReleaseDownloadSlot releases a download slot of a priority class
+func (s *FileService) ReleaseDownloadSlot(class string) {
+	<-s.downloadSlots[class].sem
 }
 
-// ReleaseDownloadSlot releases a download slot
-func (s *FileService) ReleaseDownloadSlot() {
-	<-s.downloadSem
+// DownloadQueue reports how many downloads of a priority class hold a slot
+// and how many wait for one
+func (s *FileService) DownloadQueue(class string) (active, queued int64) {
+	slots := s.downloadSlots[class]
+	return int64(len(slots.sem)), atomic.LoadInt64(&slots.queued)
+}
+
+// AcquireSegment reserves one of a client's parallel download connections
+// (a segment, to aria2c and friends); false if all max_segments_per_client
+// are open already
+func (s *FileService) AcquireSegment(client string) bool {
+	s.segmentsMu.Lock()
+	defer s.segmentsMu.Unlock()
+	if s.segments[client] >= s.cfg.Concurrency.MaxSegmentsPerClient {
+		return false
+	}
+	s.segments[client]++
+	return true
+}
+
+// ReleaseSegment gives back a connection reserved by AcquireSegment
+func (s *FileService) ReleaseSegment(client string) {
+	s.segmentsMu.Lock()
+	defer s.segmentsMu.Unlock()
+	if s.segments[client]--; s.segments[client] <= 0 {
+		delete(s.segments, client)
+	}
 }
 
 // InitializeStorage creates all required directories
@@ -110,7 +671,7 @@ func (s *FileService) InitializeStorage() error {
 	}
 
 	// Create category directories
-	for catName, cat := range s.cfg.Categories {
+	for catName, cat := range s.cfg.GetCategories() {
 		if cat.Enabled {
 			catDir := filepath.Join(baseDir, catName)
 			if err := os.MkdirAll(catDir, 0755); err != nil {
@@ -122,171 +683,330 @@ func (s *FileService) InitializeStorage() error {
 	return nil
 }
 
-// ListFiles returns all files from enabled categories
-func (s *FileService) ListFiles() ([]models.FileInfo, error) {
-	// 1. Try Fast Path (Read Lock)
-	s.mu.RLock()
-	if s.cacheValid {
-		// Clone cache and inject live counters
-		result := make([]models.FileInfo, len(s.cachedFiles))
-		copy(result, s.cachedFiles)
-		
-		for i := range result {
-			key := filepath.Join(result[i].Category, result[i].Filename)
-			result[i].Downloads = s.downloadCounts[key]
-		}
-		s.mu.RUnlock()
-		return result, nil
-	}
-	s.mu.RUnlock()
-
-	// 2. Slow Path (Write Lock - Rebuild Cache)
+// ApplyConfigChange brings storage in line with reloaded runtime settings:
+// directories for new categories, a fresh listing and the rsync module
+func (s *FileService) ApplyConfigChange() error {
 	s.mu.Lock()
-	defer s.mu.Unlock()
+	s.invalidateListing()
+	s.mu.Unlock()
 
-	// Double-check (in case another goroutine beat us)
-	if s.cacheValid {
-		result := make([]models.FileInfo, len(s.cachedFiles))
-		copy(result, s.cachedFiles)
-		for i := range result {
-			key := filepath.Join(result[i].Category, result[i].Filename)
-			result[i].Downloads = s.downloadCounts[key]
+	if err := s.InitializeStorage(); err != nil {
+		return err
+	}
+	if s.cfg.Rsync.Enabled {
+		if _, err := WriteRsyncdConf(s.cfg); err != nil {
+			return err
 		}
-		return result, nil
 	}
+	return nil
+}
 
-	// Rebuild Cache from Disk
-	var files []models.FileInfo
-	baseDir := s.cfg.Storage.UploadDir
+// UploadOptions describe an upload beyond its content. They are recorded
+// together with the file, so it never appears without them.
+type UploadOptions struct {
+	ExpectedSHA256 string // Discard the file before it goes live if it doesn't match
+	ExpectedMD5    string // Likewise, e.g. from a Content-MD5 header
+	Uploader       string
+	Notes          string
+	Release        *models.ReleaseInfo
+	Tags           []string          // Replace the file's tags when non-nil
+	Attributes     map[string]string // Merged into the file's attributes
+	PublishAt      time.Time         // Hold the file until then (zero = publish now)
+	Stage          bool              // Hold the file until it is published by hand
+	KeepPrevious   bool              // Keep the build this replaces until this one proves good
+	Transaction    string            // Hold the file until this transaction is published
+	Image          *models.ImageInfo // Header details of an Android image, from InspectImage
+	APK            *models.APKInfo   // Package details of an APK, from InspectAPK
+	Context        context.Context   // Abandons the upload when done (nil = never)
+	Released       bool              // Released from quarantine: skip the blocklist and virus scan
+}
 
-	for catName, cat := range s.cfg.Categories {
-		if !cat.Enabled {
-			continue
-		}
+// Held reports whether the upload is held instead of going live: staged,
+// part of a transaction or scheduled. A publish time already past when it
+// is saved holds it until the scheduler's next run.
+func (o UploadOptions) Held() bool {
+	return o.Stage || o.Transaction != "" || !o.PublishAt.IsZero()
+}
 
-		catDir := filepath.Join(baseDir, catName)
-		entries, err := os.ReadDir(catDir)
-		if err != nil {
-			continue // Directory might not exist yet
-		}
+// SaveFile saves an uploaded file with atomic write and enforces file limits.
+// If size is positive the temp file is preallocated to that length. Checksums
+// are computed in the same pass as the write and returned.
+func (s *FileService) SaveFile(category, filename string, reader io.Reader, size int64) (models.Checksums, error) {
+	return s.SaveUpload(category, filename, reader, size, UploadOptions{})
+}
 
-		for _, e := range entries {
-			if e.IsDir() {
-				continue
-			}
+// SpoolUpload copies a body that can only be read once (a WebDAV PUT) to a
+// temp file in the upload dir, so it can be checked before SaveUpload. The
+// file is returned rewound; the caller closes and removes it.
+func (s *FileService) SpoolUpload(body io.Reader) (*os.File, int64, error) {
+	tempDir := filepath.Join(s.cfg.Storage.UploadDir, s.cfg.Storage.TempDir)
+	f, err := os.CreateTemp(tempDir, "spool-*.tmp")
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to create temp file: %w", err)
+	}
+	n, err := io.Copy(f, body)
+	if err == nil {
+		_, err = f.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return nil, n, err
+	}
+	return f, n, nil
+}
 
-			// Check allowed extensions
-			ext := filepath.Ext(e.Name())
-			if !s.cfg.IsAllowedExtension(ext) {
-				continue
-			}
+// SaveUpload is SaveFile with labels, build details, an expected checksum
+// (e.g. for builds pulled from an upstream), or held back as staged or
+// scheduled instead of published
+func (s *FileService) SaveUpload(category, filename string, reader io.Reader, size int64, opts UploadOptions) (models.Checksums, error) {
+	var sums models.Checksums
 
-			info, err := e.Info()
-			if err != nil {
-				continue
-			}
+	// NO GLOBAL LOCK during I/O!
+	// We only lock when swapping the file into the public directory.
 
-			files = append(files, models.FileInfo{
-				Category:  catName,
-				Filename:  e.Name(),
-				Size:      formatSize(info.Size()),
-				SizeBytes: info.Size(),
-				UpdatedAt: info.ModTime().Format("2006-01-02 15:04"),
-				// Downloads populated dynamically
-			})
+	var tags []string
+	if opts.Tags != nil {
+		var err error
+		if tags, err = normalizeTags(opts.Tags); err != nil {
+			return sums, err
 		}
 	}
 
-	// Sort by modification time (newest first)
-	sort.Slice(files, func(i, j int) bool {
-		return files[i].UpdatedAt > files[j].UpdatedAt
-	})
+	tempDir := filepath.Join(s.cfg.Storage.UploadDir, s.cfg.Storage.TempDir)
 
-	// Update Cache
-	s.cachedFiles = files
-	s.cacheValid = true
-
-	// Return result with populated counts
-	result := make([]models.FileInfo, len(files))
-	copy(result, files)
-	for i := range result {
-		key := filepath.Join(result[i].Category, result[i].Filename)
-		result[i].Downloads = s.downloadCounts[key]
+	// 1. Create temp file
+	tempFile, err := os.CreateTemp(tempDir, "upload-*.tmp")
+	if err != nil {
+		return sums, fmt.Errorf("failed to create temp file: %w", err)
 	}
+	tempPath := tempFile.Name()
+	defer os.Remove(tempPath) // Cleanup on failure
 
-	return result, nil
-}
+	// 2. Reserve space up front (fails fast on a full disk)
+	if size > 0 {
+		if err := preallocate(tempFile, size); err != nil {
+			tempFile.Close()
+			return sums, fmt.Errorf("failed to preallocate %d bytes: %w", size, err)
+		}
+	}
 
-// ListFilesByCategory returns files for a specific category
-func (s *FileService) ListFilesByCategory(category string) ([]models.FileInfo, error) {
-	allFiles, err := s.ListFiles()
-	
-	// Invalidate Cache since we are adding a file
-	s.cacheValid = false
+	// 3. Stream data to temp file while hashing (HEAVY I/O - UNLOCKED)
+	sha := sha256.New()
+	sha1Sum := sha1.New()
+	md := md5.New()
+	if opts.Context != nil {
+		reader = contextReader{ctx: opts.Context, r: reader}
+	}
+	written, err := io.Copy(io.MultiWriter(tempFile, sha, sha1Sum, md), reader)
 	if err != nil {
-		return nil, err
+		tempFile.Close()
+		if opts.Context != nil && opts.Context.Err() != nil {
+			// Free the (preallocated) space now rather than when the caller is done
+			os.Remove(tempPath)
+			return sums, fmt.Errorf("%w after %d bytes: %v", ErrUploadAborted, written, opts.Context.Err())
+		}
+		return sums, fmt.Errorf("failed to write file: %w", err)
+	}
+	// Drop any preallocated tail if the body was shorter than announced
+	if size > written {
+		if err := tempFile.Truncate(written); err != nil {
+			tempFile.Close()
+			return sums, fmt.Errorf("failed to truncate file: %w", err)
+		}
+	}
+	tempFile.Close()
+	sums.SHA256 = hex.EncodeToString(sha.Sum(nil))
+	sums.SHA1 = hex.EncodeToString(sha1Sum.Sum(nil))
+	sums.MD5 = hex.EncodeToString(md.Sum(nil))
+	if opts.ExpectedSHA256 != "" && !strings.EqualFold(sums.SHA256, opts.ExpectedSHA256) {
+		return sums, ErrChecksumMismatch
+	}
+	if opts.ExpectedMD5 != "" && !strings.EqualFold(sums.MD5, opts.ExpectedMD5) {
+		return sums, ErrChecksumMismatch
+	}
+	// So must a build an imported checksum manifest is waiting for
+	verification, err := s.checkExpected(category, filename, sums.SHA256)
+	if err != nil {
+		return sums, err
 	}
 
-	var filtered []models.FileInfo
-	for _, f := range allFiles {
-		if f.Category == category {
-			filtered = append(filtered, f)
+	// Blocklisted or infected uploads are set aside for review, not published
+	if !opts.Released {
+		reason, details, err := s.screen(tempPath, sums.SHA256)
+		if err != nil {
+			return sums, err
+		}
+		if reason != "" {
+			item, err := s.quarantine(category, filename, tempPath, written, sums.SHA256, opts.Uploader, reason, details)
+			if err != nil {
+				return sums, err
+			}
+			return sums, &QuarantineError{File: item}
 		}
 	}
 
-	return filtered, nil
-}
+	upload := models.FileMetadata{
+		SHA256:       sums.SHA256,
+		SHA1:         sums.SHA1,
+		MD5:          sums.MD5,
+		Uploader:     opts.Uploader,
+		Notes:        opts.Notes,
+		Release:      opts.Release,
+		Tags:         tags,
+		Attributes:   opts.Attributes,
+		KeepPrevious: opts.KeepPrevious,
+		Transaction:  opts.Transaction,
+		Image:        opts.Image,
+		APK:          opts.APK,
+		Verification: verification,
+	}
 
-// SaveFile saves an uploaded file with atomic write and enforces file limits
-func (s *FileService) SaveFile(category, filename string, reader io.Reader) error {
-	// NO GLOBAL LOCK during I/O!
-	// We only lock when swapping the file into the public directory.
+	// 4. ENTER CRITICAL SECTION
+	s.mu.Lock()
+	if !opts.PublishAt.IsZero() {
+		upload.PublishAt = opts.PublishAt.Unix()
+	}
+	if opts.Held() {
+		err = s.hold(category, filename, tempPath, upload)
+	} else {
+		err = s.install(category, filename, tempPath, upload)
+	}
+	s.mu.Unlock()
 
-	baseDir := s.cfg.Storage.UploadDir
-	tempDir := filepath.Join(baseDir, s.cfg.Storage.TempDir)
-	finalDir := filepath.Join(baseDir, category)
+	// The build is in either way; an entry left behind matches it again
+	if err == nil && verification != nil {
+		s.settleExpected(category, filename)
+	}
+	return sums, err
+}
 
-	// 1. Create temp file
-	tempFile, err := os.CreateTemp(tempDir, "upload-*.tmp")
+// install publishes a finished upload at srcPath into its category and
+// records its metadata; caller holds s.mu
+func (s *FileService) install(category, filename, srcPath string, upload models.FileMetadata) error {
+	p, err := s.place(category, filename, srcPath, upload, false)
 	if err != nil {
-		return fmt.Errorf("failed to create temp file: %w", err)
+		return err
 	}
-	tempPath := tempFile.Name()
-	defer os.Remove(tempPath) // Cleanup on failure
+	s.settle(p)
 
-	// 2. Stream data to temp file (HEAVY I/O - UNLOCKED)
-	if _, err := io.Copy(tempFile, reader); err != nil {
-		tempFile.Close()
-		return fmt.Errorf("failed to write file: %w", err)
+	// 7. Only now that the new build is live, drop the oldest ones over the
+	// limit. It stays published either way; a build left over is removed by
+	// the next upload.
+	if _, err := s.enforceFileLimit(category, filename); err != nil {
+		s.logf("Failed to enforce the file limit of %s: %v", category, err)
 	}
-	tempFile.Close()
+	return nil
+}
 
-	// 3. ENTER CRITICAL SECTION
-	s.mu.Lock()
-	defer s.mu.Unlock()
+// placement is a build put live by place, with what settle (or undo)
+// still has to do about the one it replaced
+type placement struct {
+	category, filename string
+	srcPath            string              // Where the new build came from
+	replaced           bool                // A file of the same name was overwritten
+	previousObject     string              // Bucket copy the new build superseded
+	backup             string              // Hard link to the replaced file, if undoable
+	meta               models.FileMetadata // Record before the new build, if undoable
+	hadMeta            bool
+	keptPrevious       bool // place set the replaced build aside for keep_previous
+}
 
-	// 4. Enforce file limit for category
-	if err := s.enforceFileLimit(category); err != nil {
-		return fmt.Errorf("failed to enforce file limit: %w", err)
+// place moves a finished upload into its category and records its
+// metadata, leaving what can't be taken back (CDN purges, bucket deletes,
+// the file limit) to settle. An undoable placement keeps the replaced file
+// and record so undo can restore them. Caller holds s.mu.
+func (s *FileService) place(category, filename, srcPath string, upload models.FileMetadata, undoable bool) (placement, error) {
+	key := filepath.Join(category, filename)
+	p := placement{category: category, filename: filename, srcPath: srcPath}
+	current, hasMeta := s.meta.Get(key)
+	attrs := mergeAttributes(current.Attributes, upload.Attributes)
+	if err := validateAttributes(attrs); err != nil {
+		return p, err
 	}
 
-	// 5. Move to final destination
-	finalPath := filepath.Join(finalDir, filename)
-	if err := os.Rename(tempPath, finalPath); err != nil {
+	// 5. Move to final destination. Rename replaces a build of the same name
+	// atomically, so downloads see either the old file or the new one.
+	finalPath := filepath.Join(s.cfg.Storage.UploadDir, key)
+	_, statErr := os.Stat(finalPath)
+	p.replaced = statErr == nil
+	if undoable {
+		p.meta, p.hadMeta = current, hasMeta
+		if p.replaced {
+			backup, err := s.linkBackup(finalPath)
+			if err != nil {
+				return p, err
+			}
+			p.backup = backup
+		}
+	}
+	if upload.KeepPrevious {
+		held := s.HasPrevious(category, filename)
+		if err := s.keepPrevious(category, filename); err != nil {
+			s.discardBackup(p)
+			return p, err
+		}
+		p.keptPrevious = !held && s.HasPrevious(category, filename)
+	} else if err := s.dropPrevious(category, filename); err != nil {
+		s.discardBackup(p)
+		return p, err
+	}
+	if err := os.Rename(srcPath, finalPath); err != nil {
 		// Cross-device fallback
-		if copyErr := s.manualMove(tempPath, finalPath); copyErr != nil {
-			return fmt.Errorf("failed to save file: %w", copyErr)
+		if copyErr := s.manualMove(srcPath, finalPath); copyErr != nil {
+			s.discardBackup(p)
+			return p, fmt.Errorf("failed to save file: %w", copyErr)
 		}
 	}
+	s.invalidateListing(category)
+	s.statCache.Invalidate(key)
+
+	// 6. Record checksums (file is already live, so only log-worthy on failure)
+	if err := s.meta.Update(key, func(m *models.FileMetadata) {
+		p.previousObject = m.ObjectKey
+		m.SHA256 = upload.SHA256
+		m.SHA1 = upload.SHA1
+		m.MD5 = upload.MD5
+		m.ObjectKey, m.Size, m.UploadedAt = "", 0, 0
+		// Build details never carry over from the build this one replaced
+		m.Release, m.Notes, m.Uploader = upload.Release, upload.Notes, upload.Uploader
+		m.Image, m.APK = upload.Image, upload.APK
+		m.Verification = upload.Verification // A new build needs checking again
+		if upload.Tags != nil {
+			m.Tags = upload.Tags
+		}
+		m.Attributes = attrs
+	}); err != nil {
+		return p, fmt.Errorf("failed to store checksums: %w", err)
+	}
+	return p, nil
+}
 
-	return nil
+// settle finishes a placement for good; caller holds s.mu
+func (s *FileService) settle(p placement) {
+	key := filepath.Join(p.category, p.filename)
+	s.discardBackup(p)
+	go s.bumpGeneration()
+	if p.replaced || p.previousObject != "" {
+		// Never let the edge keep serving the previous build under this name
+		s.cdn.Purge(p.category, p.filename)
+	}
+	if p.previousObject != "" {
+		// The local upload supersedes a bucket copy under the same name
+		s.removeObject(p.previousObject)
+	}
+
+	s.assignShortCode(key)
 }
 
-// enforceFileLimit removes oldest files if limit exceeded
-func (s *FileService) enforceFileLimit(category string) error {
-	cat, exists := s.cfg.Categories[category]
+// enforceFileLimit removes the oldest builds of category until the others
+// leave room for incoming under max_files and returns how many it removed.
+// incoming builds (already published, or about to be) are never removed,
+// and a build one replaces doesn't take up a second slot.
+func (s *FileService) enforceFileLimit(category string, incoming ...string) (int, error) {
+	cat, exists := s.cfg.GetCategories()[category]
 	if !exists {
-		return fmt.Errorf("category %s not found", category)
+		return 0, fmt.Errorf("category %s not found", category)
 	}
 
 	baseDir := s.cfg.Storage.UploadDir
@@ -294,18 +1014,23 @@ func (s *FileService) enforceFileLimit(category string) error {
 
 	entries, err := os.ReadDir(catDir)
 	if err != nil {
-		return nil // Directory doesn't exist yet
+		return 0, nil // Directory doesn't exist yet
 	}
 
 	// Get file info with mod times
 	type fileWithTime struct {
 		name    string
 		modTime int64
+		object  string // Object key for bucket-backed files
 	}
 
+	// Pinned files are never candidates and don't count against the limit
 	var files []fileWithTime
 	for _, e := range entries {
-		if e.IsDir() {
+		if e.IsDir() || slices.Contains(incoming, e.Name()) || strings.HasPrefix(e.Name(), ".") {
+			continue // Hidden names are publishes still being copied in
+		}
+		if meta, ok := s.meta.Get(filepath.Join(category, e.Name())); ok && meta.Pinned {
 			continue
 		}
 		info, err := e.Info()
@@ -317,43 +1042,314 @@ func (s *FileService) enforceFileLimit(category string) error {
 			modTime: info.ModTime().Unix(),
 		})
 	}
+	for name, meta := range s.remoteFiles(category) {
+		if meta.Pinned || slices.Contains(incoming, name) {
+			continue
+		}
+		files = append(files, fileWithTime{name: name, modTime: meta.UploadedAt, object: meta.ObjectKey})
+	}
 
 	// Sort by mod time (oldest first)
 	sort.Slice(files, func(i, j int) bool {
 		return files[i].modTime < files[j].modTime
 	})
 
-	// Remove oldest files until we're under limit (leaving room for new file)
+	// Remove oldest files until incoming fits under the limit
 	maxFiles := cat.MaxFiles
-	for len(files) >= maxFiles {
+	removed := 0
+	for len(files) > 0 && len(files)+len(incoming) > maxFiles {
 		oldest := files[0]
-		oldPath := filepath.Join(catDir, oldest.name)
-		if err := os.Remove(oldPath); err != nil {
-			return fmt.Errorf("failed to remove old file %s: %w", oldest.name, err)
+		if oldest.object != "" {
+			s.removeObject(oldest.object)
+		} else if err := os.Remove(filepath.Join(catDir, oldest.name)); err != nil {
+			return removed, fmt.Errorf("failed to remove old file %s: %w", oldest.name, err)
 		}
+		s.meta.Delete(filepath.Join(category, oldest.name))
+		s.statCache.Invalidate(filepath.Join(category, oldest.name))
+		s.cdn.Purge(category, oldest.name)
 		files = files[1:]
+		removed++
 	}
 
-	return nil
+	return removed, nil
+}
+
+// ApplyRetention removes the oldest builds of every category over its
+// max_files and returns how many. Publishing enforces the limit as well;
+// this catches a limit lowered by a config reload and a build left over
+// when enforcing it failed.
+func (s *FileService) ApplyRetention() (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	removed := 0
+	for category := range s.cfg.GetCategories() {
+		n, err := s.enforceFileLimit(category)
+		if n > 0 {
+			removed += n
+			s.invalidateListing(category)
+		}
+		if err != nil {
+			return removed, err
+		}
+	}
+	if removed > 0 {
+		go s.bumpGeneration()
+	}
+	return removed, nil
 }
 
 // DeleteFile removes a file from storage
 func (s *FileService) DeleteFile(category, filename string) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	
-	// Invalidate Cache
-	s.cacheValid = false
+	return s.deleteFile(category, filename)
+}
+
+// deleteFile is DeleteFile for callers already holding s.mu
+func (s *FileService) deleteFile(category, filename string) error {
+	s.invalidateListing(category)
 
 	// Sanitize to prevent directory traversal
 	safeFilename := filepath.Base(filename)
 	filePath := filepath.Join(s.cfg.Storage.UploadDir, category, safeFilename)
 
-	if _, err := os.Stat(filePath); os.IsNotExist(err) {
-		return fmt.Errorf("file not found")
+	if meta, ok := s.meta.Get(filepath.Join(category, safeFilename)); ok && meta.ObjectKey != "" {
+		s.removeObject(meta.ObjectKey)
+	} else if _, err := os.Stat(filePath); os.IsNotExist(err) {
+		return ErrNotFound
+	} else if err := os.Remove(filePath); err != nil {
+		return err
+	}
+	s.statCache.Invalidate(filepath.Join(category, safeFilename))
+	s.cdn.Purge(category, safeFilename)
+	go s.bumpGeneration()
+	if err := s.dropPrevious(category, safeFilename); err != nil {
+		return err
 	}
+	return s.meta.Delete(filepath.Join(category, safeFilename))
+}
 
-	return os.Remove(filePath)
+// Bulk operation kinds
+const (
+	BulkDelete = "delete"
+	BulkMove   = "move"
+	BulkPin    = "pin"
+	BulkUnpin  = "unpin"
+)
+
+// Bulk runs a batch of operations under a single lock and returns one result
+// per operation (nil on success). A failed item doesn't stop the rest.
+func (s *FileService) Bulk(ops []models.BulkOperation) []error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	results := make([]error, len(ops))
+	for i, op := range ops {
+		switch op.Op {
+		case BulkDelete:
+			results[i] = s.deleteFile(op.Category, op.Filename)
+		case BulkMove:
+			results[i] = s.moveFile(op.Category, op.Filename, op.ToCategory, op.ToFilename)
+		case BulkPin, BulkUnpin:
+			results[i] = s.setPinned(op.Category, op.Filename, op.Op == BulkPin)
+		default:
+			results[i] = invalid(fmt.Errorf("unknown operation %q", op.Op))
+		}
+	}
+	return results
+}
+
+// SetPinned protects a file from automatic cleanup (or lifts the protection).
+// Pinned files can still be deleted explicitly.
+func (s *FileService) SetPinned(category, filename string, pinned bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.setPinned(category, filename, pinned)
+}
+
+// setPinned is SetPinned for callers already holding s.mu
+func (s *FileService) setPinned(category, filename string, pinned bool) error {
+	if !s.fileExists(category, filename) {
+		return ErrNotFound
+	}
+	key := filepath.Join(category, filepath.Base(filename))
+	return s.meta.Update(key, func(m *models.FileMetadata) { m.Pinned = pinned })
+}
+
+// fileExists reports whether a published build is on disk or in the
+// bucket; caller holds s.mu
+func (s *FileService) fileExists(category, filename string) bool {
+	key := filepath.Join(category, filepath.Base(filename))
+	if meta, ok := s.meta.Get(key); ok && meta.ObjectKey != "" {
+		return true
+	}
+	_, err := os.Stat(filepath.Join(s.cfg.Storage.UploadDir, key))
+	return err == nil
+}
+
+// MoveFile relocates a file to another category and/or name. Local files are
+// renamed on disk (atomic, same filesystem); bucket files keep their object
+// and only change their published name. Checksums and download counters
+// move with the file.
+func (s *FileService) MoveFile(category, filename, toCategory, toFilename string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.moveFile(category, filename, toCategory, toFilename)
+}
+
+// moveFile is MoveFile for callers already holding s.mu
+func (s *FileService) moveFile(category, filename, toCategory, toFilename string) error {
+	filename, toFilename = filepath.Base(filename), filepath.Base(toFilename)
+	if category == toCategory && filename == toFilename {
+		return invalid(fmt.Errorf("source and destination are the same"))
+	}
+
+	oldKey := filepath.Join(category, filename)
+	newKey := filepath.Join(toCategory, toFilename)
+	oldPath := filepath.Join(s.cfg.Storage.UploadDir, oldKey)
+	newPath := filepath.Join(s.cfg.Storage.UploadDir, newKey)
+
+	meta, hasMeta := s.meta.Get(oldKey)
+	remote := hasMeta && meta.ObjectKey != ""
+
+	var size int64
+	if remote {
+		size = meta.Size
+	} else {
+		info, err := os.Stat(oldPath)
+		if err != nil || info.IsDir() {
+			return ErrNotFound
+		}
+		size = info.Size()
+	}
+	if size > s.cfg.MaxUploadSizeFor(toCategory) {
+		return invalid(fmt.Errorf("file exceeds the %s size limit", toCategory))
+	}
+
+	if _, err := os.Stat(newPath); err == nil {
+		return ErrFileExists
+	}
+	if existing, ok := s.meta.Get(newKey); ok && existing.ObjectKey != "" {
+		return ErrFileExists
+	}
+
+	if !remote {
+		if err := os.Rename(oldPath, newPath); err != nil {
+			return fmt.Errorf("failed to move file: %w", err)
+		}
+	}
+
+	if hasMeta {
+		if err := s.meta.Update(newKey, func(m *models.FileMetadata) { *m = meta }); err != nil {
+			return fmt.Errorf("failed to move metadata: %w", err)
+		}
+		if err := s.meta.Delete(oldKey); err != nil {
+			return fmt.Errorf("failed to move metadata: %w", err)
+		}
+	}
+	s.moveCounters(oldKey, newKey)
+	// A build kept for the old name is no fallback for the new one
+	if err := s.dropPrevious(category, filename); err != nil {
+		return err
+	}
+
+	// A new arrival in another category counts against its limit
+	if toCategory != category {
+		if _, err := s.enforceFileLimit(toCategory, toFilename); err != nil {
+			s.logf("Failed to enforce the file limit of %s: %v", toCategory, err)
+		}
+	}
+
+	s.invalidateListing(category, toCategory)
+	s.statCache.Invalidate(oldKey)
+	s.statCache.Invalidate(newKey)
+	s.cdn.Purge(category, filename)
+	go s.bumpGeneration()
+	s.markStatsDirty()
+	return nil
+}
+
+// ReplaceFile moves a file over an existing one (WebDAV MOVE with
+// Overwrite: T). The old build is set aside until the move has gone
+// through, so a move that fails leaves both builds where they were.
+func (s *FileService) ReplaceFile(category, filename, toCategory, toFilename string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	toFilename = filepath.Base(toFilename)
+	key := filepath.Join(toCategory, toFilename)
+	path := filepath.Join(s.cfg.Storage.UploadDir, key)
+	if category == toCategory && filepath.Base(filename) == toFilename {
+		return invalid(fmt.Errorf("source and destination are the same"))
+	}
+
+	// Hidden names are skipped by listings and the file limit
+	aside := filepath.Join(filepath.Dir(path), "."+toFilename+".replaced")
+	local := true
+	if err := os.Rename(path, aside); os.IsNotExist(err) {
+		local = false
+	} else if err != nil {
+		return fmt.Errorf("failed to set aside %s: %w", key, err)
+	}
+	old, hasOld := s.meta.Get(key)
+	if hasOld {
+		if err := s.meta.Delete(key); err != nil {
+			if local {
+				os.Rename(aside, path)
+			}
+			return err
+		}
+	}
+
+	if err := s.moveFile(category, filename, toCategory, toFilename); err != nil {
+		// Put the old build back unless the new one already took its place
+		if _, statErr := os.Stat(path); local && os.IsNotExist(statErr) {
+			os.Rename(aside, path)
+		}
+		if _, moved := s.meta.Get(key); hasOld && !moved {
+			s.meta.Update(key, func(m *models.FileMetadata) { *m = old })
+		}
+		return err
+	}
+
+	if local {
+		if err := os.Remove(aside); err != nil {
+			s.logf("Failed to remove replaced build %s: %v", key, err)
+		}
+	}
+	if moved, _ := s.meta.Get(key); hasOld && old.ObjectKey != "" && old.ObjectKey != moved.ObjectKey {
+		s.removeObject(old.ObjectKey)
+	}
+	s.cdn.Purge(toCategory, toFilename)
+	return s.dropPrevious(toCategory, toFilename)
+}
+
+// moveCounters carries public, per-client and daily counts over to a new
+// file key; caller holds s.mu
+func (s *FileService) moveCounters(oldKey, newKey string) {
+	if n, ok := s.downloadCounts[oldKey]; ok {
+		s.downloadCounts[newKey] += n
+		delete(s.downloadCounts, oldKey)
+		s.recordDelta(sharedDownloads, oldKey, -n)
+		s.recordDelta(sharedDownloads, newKey, n)
+	}
+	if clients, ok := s.clientCounts[oldKey]; ok {
+		s.clientCounts[newKey] = clients
+		delete(s.clientCounts, oldKey)
+	}
+	if refs, ok := s.referrers[oldKey]; ok {
+		s.referrers[newKey] = refs
+		delete(s.referrers, oldKey)
+	}
+	for day, files := range s.dailyCounts {
+		if n, ok := files[oldKey]; ok {
+			files[newKey] += n
+			delete(files, oldKey)
+			s.recordDelta(sharedDailyHash+day, oldKey, -n)
+			s.recordDelta(sharedDailyHash+day, newKey, n)
+		}
+	}
 }
 
 // GetFilePath returns the full path to a file (for downloads)
@@ -362,35 +1358,90 @@ func (s *FileService) GetFilePath(category, filename string) (string, error) {
 	filePath := filepath.Join(s.cfg.Storage.UploadDir, category, safeFilename)
 
 	if _, err := os.Stat(filePath); os.IsNotExist(err) {
-		return "", fmt.Errorf("file not found")
+		return "", ErrNotFound
 	}
 
 	return filePath, nil
 }
 
+// StatFile returns size and modification time of a published file, served
+// from the LRU for hot files
+func (s *FileService) StatFile(category, filename string) (CachedStat, error) {
+	safeFilename := filepath.Base(filename)
+	key := filepath.Join(category, safeFilename)
+
+	if stat, ok := s.statCache.Get(key); ok {
+		return stat, nil
+	}
+
+	filePath := filepath.Join(s.cfg.Storage.UploadDir, category, safeFilename)
+	info, err := os.Stat(filePath)
+	if err != nil || info.IsDir() {
+		return CachedStat{}, ErrNotFound
+	}
+
+	stat := CachedStat{Path: filePath, Size: info.Size(), ModTime: info.ModTime()}
+	s.statCache.Put(key, stat)
+	return stat, nil
+}
+
 // GetCategoryStats returns statistics for all categories
 func (s *FileService) GetCategoryStats() []models.CategoryInfo {
 	var stats []models.CategoryInfo
 
-	for catName, cat := range s.cfg.Categories {
+	for catName, cat := range s.cfg.GetCategories() {
 		if !cat.Enabled {
 			continue
 		}
 
 		files, _ := s.ListFilesByCategory(catName)
 		stats = append(stats, models.CategoryInfo{
-			Name:        catName,
-			DisplayName: cat.DisplayName,
-			Description: cat.Description,
-			MaxFiles:    cat.MaxFiles,
-			FileCount:   len(files),
+			Name:           catName,
+			DisplayName:    cat.DisplayName,
+			Description:    cat.Description,
+			MaxFiles:       cat.MaxFiles,
+			FileCount:      len(files),
+			AllowedExts:    s.cfg.AllowedExtsFor(catName),
+			MaxUploadBytes: s.cfg.MaxUploadSizeFor(catName),
+			Restricted:     cat.Restricted,
 		})
 	}
 
 	return stats
 }
 
-// manualMove copies file then removes source (for cross-device moves)
+// CleanupTempFiles removes abandoned upload temp files older than maxAge.
+// Active uploads keep touching their temp file, so they are never affected.
+func (s *FileService) CleanupTempFiles(maxAge time.Duration) (int, int64, error) {
+	tempDir := filepath.Join(s.cfg.Storage.UploadDir, s.cfg.Storage.TempDir)
+	entries, err := os.ReadDir(tempDir)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	cutoff := time.Now().Add(-maxAge)
+	var removed int
+	var reclaimed int64
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil || info.ModTime().After(cutoff) {
+			continue
+		}
+		if err := os.Remove(filepath.Join(tempDir, e.Name())); err == nil {
+			removed++
+			reclaimed += info.Size()
+		}
+	}
+
+	return removed, reclaimed, nil
+}
+
+// manualMove copies file then removes source (for cross-device moves). The
+// copy goes to a hidden temp file beside dest and is renamed over it, so
+// dest is never seen half-written.
 func (s *FileService) manualMove(source, dest string) error {
 	inputFile, err := os.Open(source)
 	if err != nil {
@@ -398,10 +1449,12 @@ func (s *FileService) manualMove(source, dest string) error {
 	}
 	defer inputFile.Close()
 
-	outputFile, err := os.Create(dest)
+	outputFile, err := os.CreateTemp(filepath.Dir(dest), "."+filepath.Base(dest)+".*.tmp")
 	if err != nil {
 		return err
 	}
+	tmpPath := outputFile.Name()
+	defer os.Remove(tmpPath) // No-op once renamed
 
 	if _, err := io.Copy(outputFile, inputFile); err != nil {
 		outputFile.Close()
@@ -417,16 +1470,10 @@ func (s *FileService) manualMove(source, dest string) error {
 		return err
 	}
 
-	return os.Remove(source)
-}
-
-// ValidateZipMagicBytes checks if file starts with ZIP magic bytes
-func ValidateZipMagicBytes(header []byte) bool {
-	if len(header) < 4 {
-		return false
+	if err := os.Rename(tmpPath, dest); err != nil {
+		return err
 	}
-	// ZIP magic: 0x50 0x4B 0x03 0x04
-	return header[0] == 0x50 && header[1] == 0x4B && header[2] == 0x03 && header[3] == 0x04
+	return os.Remove(source)
 }
 
 // formatSize converts bytes to human readable format
@@ -441,10 +1488,44 @@ func formatSize(bytes int64) string {
 	return fmt.Sprintf("%d B", bytes)
 }
 
+// FormatSize converts bytes to a human readable size (e.g. 1.50 GB)
+func FormatSize(bytes int64) string {
+	return formatSize(bytes)
+}
+
+// FormatCount converts a counter to a compact human readable form (e.g. 12.3k)
+func FormatCount(n int64) string {
+	if n >= 1000000 {
+		return fmt.Sprintf("%.1fM", float64(n)/1000000)
+	} else if n >= 1000 {
+		return fmt.Sprintf("%.1fk", float64(n)/1000)
+	}
+	return fmt.Sprintf("%d", n)
+}
+
+// DownloadPath is the percent-encoded /downloads/ path of a file
+func DownloadPath(category, filename string) string {
+	return "/downloads/" + url.PathEscape(category) + "/" + url.PathEscape(filename)
+}
+
+// PreviewPath is the percent-encoded path of a file's landing page, which
+// carries the link preview tags
+func PreviewPath(category, filename string) string {
+	return "/builds/" + url.PathEscape(category) + "/" + url.PathEscape(filename)
+}
+
+// NormalizeFilename puts a name in Unicode NFC, so a build uploaded from a
+// system that decomposes accents (macOS) has the same name, stats key and
+// URL as one typed elsewhere. Names coming from requests go through it
+// before any lookup.
+func NormalizeFilename(filename string) string {
+	return norm.NFC.String(filename)
+}
+
 // SanitizeFilename cleans a filename to prevent security issues
 func SanitizeFilename(filename string) string {
 	// Take only base name to prevent directory traversal
-	safe := filepath.Base(filename)
+	safe := filepath.Base(NormalizeFilename(filename))
 	// Remove any path separators that might have snuck through
 	safe = strings.ReplaceAll(safe, "/", "")
 	safe = strings.ReplaceAll(safe, "\\", "")
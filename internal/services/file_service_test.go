@@ -0,0 +1,168 @@
+package services
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"rom-server/internal/config"
+	"rom-server/internal/models"
+)
+
+// newTestService returns a FileService over a fresh upload dir with the
+// given enabled categories, each keeping up to 10 .zip builds
+func newTestService(t *testing.T, categories ...string) *FileService {
+	t.Helper()
+	dir := t.TempDir()
+	cfg := &config.Config{
+		Storage:     config.StorageConfig{UploadDir: dir, TempDir: ".tmp"},
+		Categories:  make(map[string]config.Category),
+		AllowedExts: []string{".zip"},
+	}
+	for _, name := range categories {
+		cfg.Categories[name] = config.Category{Enabled: true, MaxFiles: 10}
+		if err := os.MkdirAll(filepath.Join(dir, name), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.MkdirAll(filepath.Join(dir, cfg.Storage.TempDir), 0755); err != nil {
+		t.Fatal(err)
+	}
+	meta, err := NewMetadataStore(filepath.Join(dir, "metadata.json"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewFileService(cfg, nil, nil, nil, nil, meta, nil, nil)
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+// writeFile creates a file under the upload dir
+func writeFile(t *testing.T, s *FileService, key, content string) {
+	t.Helper()
+	path := filepath.Join(s.cfg.Storage.UploadDir, key)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// readFile returns the content of a file under the upload dir, or "" if
+// there is none
+func readFile(t *testing.T, s *FileService, key string) string {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(s.cfg.Storage.UploadDir, key))
+	if err != nil && !os.IsNotExist(err) {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestFileExists(t *testing.T) {
+	s := newTestService(t, "vanilla")
+	writeFile(t, s, filepath.Join("vanilla", "local.zip"), "x")
+	writeFile(t, s, pendingKey("vanilla", "held.zip"), "x")
+	s.meta.Update(filepath.Join("vanilla", "remote.zip"), func(m *models.FileMetadata) { m.ObjectKey = "uploads/remote.zip" })
+	s.meta.Update(filepath.Join("vanilla", "gone.zip"), func(m *models.FileMetadata) { m.SHA256 = "ab" })
+
+	tests := []struct {
+		filename string
+		want     bool
+	}{
+		{"local.zip", true},
+		{"remote.zip", true},
+		{"held.zip", false},
+		{"gone.zip", false},
+		{"../vanilla/local.zip", true},
+		{"missing.zip", false},
+	}
+	for _, tt := range tests {
+		if got := s.fileExists("vanilla", tt.filename); got != tt.want {
+			t.Errorf("fileExists(vanilla, %s) = %v, want %v", tt.filename, got, tt.want)
+		}
+	}
+}
+
+func TestApplyRetention(t *testing.T) {
+	s := newTestService(t, "vanilla", "gapps")
+	base := time.Now().Add(-time.Hour)
+	for i, name := range []string{"a.zip", "b.zip", "c.zip", "d.zip"} {
+		key := filepath.Join("vanilla", name)
+		writeFile(t, s, key, name)
+		mtime := base.Add(time.Duration(i) * time.Minute)
+		if err := os.Chtimes(filepath.Join(s.cfg.Storage.UploadDir, key), mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeFile(t, s, filepath.Join("gapps", "e.zip"), "e")
+	s.meta.Update(filepath.Join("vanilla", "a.zip"), func(m *models.FileMetadata) { m.Pinned = true })
+	s.cfg.Categories["vanilla"] = config.Category{Enabled: true, MaxFiles: 2}
+
+	removed, err := s.ApplyRetention()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if removed != 1 {
+		t.Errorf("removed %d builds, want 1", removed)
+	}
+	for name, want := range map[string]bool{"vanilla/a.zip": true, "vanilla/b.zip": false, "vanilla/c.zip": true, "vanilla/d.zip": true, "gapps/e.zip": true} {
+		_, err := os.Stat(filepath.Join(s.cfg.Storage.UploadDir, name))
+		if got := err == nil; got != want {
+			t.Errorf("%s kept = %v, want %v", name, got, want)
+		}
+	}
+
+	if removed, err := s.ApplyRetention(); err != nil || removed != 0 {
+		t.Errorf("second run removed %d (err %v), want 0", removed, err)
+	}
+}
+
+func TestOnChange(t *testing.T) {
+	s := newTestService(t, "vanilla")
+	writeFile(t, s, filepath.Join("vanilla", "a.zip"), "a")
+	changes := 0
+	s.OnChange(func() { changes++ })
+
+	if _, _, err := s.QueryFiles(FileQuery{}); err != nil || changes != 0 {
+		t.Errorf("listing ran OnChange %d times (err %v), want 0", changes, err)
+	}
+	if err := s.DeleteFile("vanilla", "a.zip"); err != nil || changes != 1 {
+		t.Errorf("delete ran OnChange %d times (err %v), want 1", changes, err)
+	}
+}
+
+func TestReplaceFile(t *testing.T) {
+	s := newTestService(t, "vanilla", "gapps")
+	s.cfg.Storage.MaxUploadSizeGB = 1
+	writeFile(t, s, filepath.Join("vanilla", "new.zip"), "new")
+	writeFile(t, s, filepath.Join("gapps", "old.zip"), "old")
+	s.meta.Update(filepath.Join("gapps", "old.zip"), func(m *models.FileMetadata) { m.Tags = []string{"old"} })
+
+	// A failed move keeps the destination as it was
+	if err := s.ReplaceFile("vanilla", "missing.zip", "gapps", "old.zip"); err != ErrNotFound {
+		t.Fatalf("moving a missing file: err = %v, want ErrNotFound", err)
+	}
+	if got := readFile(t, s, filepath.Join("gapps", "old.zip")); got != "old" {
+		t.Errorf("destination after a failed move = %q, want old", got)
+	}
+	if meta, _ := s.meta.Get(filepath.Join("gapps", "old.zip")); len(meta.Tags) != 1 {
+		t.Errorf("destination metadata lost after a failed move: %+v", meta)
+	}
+
+	if err := s.ReplaceFile("vanilla", "new.zip", "gapps", "old.zip"); err != nil {
+		t.Fatal(err)
+	}
+	if got := readFile(t, s, filepath.Join("gapps", "old.zip")); got != "new" {
+		t.Errorf("destination after the move = %q, want new", got)
+	}
+	if meta, ok := s.meta.Get(filepath.Join("gapps", "old.zip")); ok && len(meta.Tags) != 0 {
+		t.Errorf("old metadata survived the replace: %+v", meta)
+	}
+	entries, _ := os.ReadDir(filepath.Join(s.cfg.Storage.UploadDir, "gapps"))
+	if len(entries) != 1 {
+		t.Errorf("gapps holds %d entries after the replace, want 1", len(entries))
+	}
+}
@@ -0,0 +1,93 @@
+package services
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// GCResult summarizes a storage cleanup
+type GCResult struct {
+	TempFiles     int   // Abandoned upload temp files
+	PartialWrites int   // Leftover *.tmp files from interrupted state writes
+	Records       int   // Metadata records for builds no longer on disk
+	Reclaimed     int64 // Bytes freed (or that would be, on a dry run)
+}
+
+// CollectGarbage removes upload temp files and interrupted state writes older
+// than maxAge and, with pruneRecords, metadata records whose build is gone from
+// disk and from the bucket. With dryRun set it only counts what it would remove.
+func (s *FileService) CollectGarbage(maxAge time.Duration, pruneRecords, dryRun bool) (GCResult, error) {
+	var result GCResult
+	root := s.cfg.Storage.UploadDir
+	cutoff := time.Now().Add(-maxAge)
+
+	tempDir := filepath.Join(root, s.cfg.Storage.TempDir)
+	n, size, err := removeStale(tempDir, cutoff, dryRun, func(string) bool { return true })
+	if err != nil && !os.IsNotExist(err) {
+		return result, err
+	}
+	result.TempFiles, result.Reclaimed = n, size
+
+	n, size, err = removeStale(root, cutoff, dryRun, func(name string) bool {
+		return strings.HasSuffix(name, ".tmp")
+	})
+	if err != nil {
+		return result, err
+	}
+	result.PartialWrites, result.Reclaimed = n, result.Reclaimed+size
+
+	if !pruneRecords {
+		return result, nil
+	}
+	for key, meta := range s.meta.All() {
+		if meta.ObjectKey != "" {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(root, key)); !os.IsNotExist(err) {
+			continue
+		}
+		if !dryRun {
+			if err := s.meta.Delete(key); err != nil {
+				return result, err
+			}
+		}
+		result.Records++
+	}
+	if result.Records > 0 && !dryRun {
+		s.mu.Lock()
+		s.invalidateListing()
+		s.mu.Unlock()
+	}
+	return result, nil
+}
+
+// removeStale deletes the regular files in dir (not below it) that match and
+// were last modified before cutoff, returning how many and their total size
+func removeStale(dir string, cutoff time.Time, dryRun bool, match func(name string) bool) (int, int64, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var removed int
+	var reclaimed int64
+	for _, e := range entries {
+		if !e.Type().IsRegular() || !match(e.Name()) {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil || info.ModTime().After(cutoff) {
+			continue
+		}
+		if !dryRun {
+			if err := os.Remove(filepath.Join(dir, e.Name())); err != nil {
+				continue
+			}
+		}
+		removed++
+		reclaimed += info.Size()
+	}
+	return removed, reclaimed, nil
+}
@@ -0,0 +1,155 @@
+package services
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"rom-server/internal/models"
+)
+
+// Outcomes of checking a stored file against its recorded checksums
+const (
+	HashAdded    = "added"    // A checksum wasn't recorded; it is now
+	HashOK       = "ok"       // Recorded checksum matches the file
+	HashMismatch = "mismatch" // File differs from its recorded checksum
+	HashUpdated  = "updated"  // Mismatch, and the record was replaced
+	HashMissing  = "missing"  // Metadata refers to a file that isn't on disk
+	HashError    = "error"    // File couldn't be read or recorded
+)
+
+// HashResult is the outcome for one file; Key is its metadata key
+type HashResult struct {
+	Key    string
+	Status string
+	SHA256 string
+	Err    error
+}
+
+// HashStorage walks the upload dir (published, held and previous builds),
+// records checksums for files that have none and verifies the rest. Mismatches are
+// only reported unless fix is set, in which case the file wins. report is
+// called once per file, in key order.
+func (s *FileService) HashStorage(fix bool, report func(HashResult)) error {
+	root := s.cfg.Storage.UploadDir
+	tempDir := filepath.Clean(filepath.Join(root, s.cfg.Storage.TempDir))
+
+	var keys []string
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if filepath.Clean(path) == tempDir || !buildDir(root, path, d.Name()) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		// Files directly in the upload dir are state (stats.json, audit.log, ...)
+		if d.Type().IsRegular() && strings.ContainsRune(rel, filepath.Separator) {
+			keys = append(keys, rel)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	onDisk := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		onDisk[key] = true
+		report(s.hashOne(key, fix))
+	}
+
+	// Records without a file, other than builds kept in the bucket
+	var missing []string
+	for key, meta := range s.meta.All() {
+		if !onDisk[key] && meta.ObjectKey == "" && meta.SHA256 != "" {
+			missing = append(missing, key)
+		}
+	}
+	sort.Strings(missing)
+	for _, key := range missing {
+		report(HashResult{Key: key, Status: HashMissing})
+	}
+	return nil
+}
+
+// buildDir reports whether a directory met walking the upload dir can hold
+// builds. Dot directories don't, quarantined uploads included, except
+// those of held and previous builds.
+func buildDir(root, path, name string) bool {
+	if !strings.HasPrefix(name, ".") || filepath.Clean(path) == filepath.Clean(root) {
+		return true
+	}
+	return filepath.Dir(filepath.Clean(path)) == filepath.Clean(root) && (name == pendingDir || name == previousDir)
+}
+
+// hashOne checks a single file against its metadata
+func (s *FileService) hashOne(key string, fix bool) HashResult {
+	result := HashResult{Key: key}
+	sums, err := hashFile(filepath.Join(s.cfg.Storage.UploadDir, key))
+	if err != nil {
+		result.Status, result.Err = HashError, err
+		return result
+	}
+	result.SHA256 = sums.SHA256
+
+	meta, _ := s.meta.Get(key)
+	switch {
+	case meta.SHA256 == "":
+		result.Status = HashAdded
+	case strings.EqualFold(meta.SHA256, sums.SHA256) && (meta.SHA1 == "" || meta.MD5 == ""):
+		// Recorded before SHA-1 was, or finalized from the bucket
+		result.Status = HashAdded
+	case strings.EqualFold(meta.SHA256, sums.SHA256):
+		result.Status = HashOK
+		return result
+	case !fix:
+		result.Status = HashMismatch
+		return result
+	default:
+		result.Status = HashUpdated
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.meta.Update(key, func(m *models.FileMetadata) {
+		m.SHA256, m.SHA1, m.MD5 = sums.SHA256, sums.SHA1, sums.MD5
+	}); err != nil {
+		result.Status, result.Err = HashError, err
+	}
+	return result
+}
+
+// hashFile computes the checksums of a file in one pass
+func hashFile(path string) (models.Checksums, error) {
+	var sums models.Checksums
+	f, err := os.Open(path)
+	if err != nil {
+		return sums, err
+	}
+	defer f.Close()
+
+	sha := sha256.New()
+	sha1Sum := sha1.New()
+	md := md5.New()
+	if _, err := io.Copy(io.MultiWriter(sha, sha1Sum, md), f); err != nil {
+		return sums, err
+	}
+	sums.SHA256 = hex.EncodeToString(sha.Sum(nil))
+	sums.SHA1 = hex.EncodeToString(sha1Sum.Sum(nil))
+	sums.MD5 = hex.EncodeToString(md.Sum(nil))
+	return sums, nil
+}
@@ -0,0 +1,33 @@
+package services
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestHashStorageWalksBuildsOnly(t *testing.T) {
+	s := newTestService(t, "vanilla")
+	for _, key := range []string{
+		filepath.Join("vanilla", "rom.zip"),
+		pendingKey("vanilla", "held.zip"),
+		previousKey("vanilla", "rom.zip"),
+		filepath.Join(quarantineDir, "vanilla", "bad.zip"),
+		filepath.Join(".git", "objects", "pack.idx"),
+		filepath.Join("vanilla", ".thumbs", "rom.png"),
+		filepath.Join(".tmp", "upload-1.tmp"),
+		"stats.json",
+	} {
+		writeFile(t, s, key, key)
+	}
+
+	var got []string
+	err := s.HashStorage(false, func(r HashResult) { got = append(got, r.Key) })
+	if err != nil {
+		t.Fatalf("HashStorage() error = %v", err)
+	}
+	want := []string{pendingKey("vanilla", "held.zip"), previousKey("vanilla", "rom.zip"), filepath.Join("vanilla", "rom.zip")}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("HashStorage() walked %v, want %v", got, want)
+	}
+}
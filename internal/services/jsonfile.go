@@ -0,0 +1,95 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// jsonFile is a small store kept as one JSON document in the upload dir.
+// The file is re-read when it changes on disk, so a change made by another
+// node sharing the upload dir, or by a CLI command, applies to the next
+// request. Stores embed it and serialize access with their own mutex.
+type jsonFile[T any] struct {
+	path    string
+	name    string      // What the file holds, for errors ("announcements")
+	perm    os.FileMode // 0600 for files with secrets or client addresses
+	modTime time.Time
+	data    T
+	saved   []func() // Run after each save; see OnChange
+}
+
+// OnChange registers fn to run after every change the store saves. Register
+// before the store is shared: it isn't guarded by the store's lock.
+func (f *jsonFile[T]) OnChange(fn func()) {
+	f.saved = append(f.saved, fn)
+}
+
+// refresh reloads the file if another writer changed it; a missing file
+// is empty. Caller holds the store's lock (or owns it exclusively).
+func (f *jsonFile[T]) refresh() error {
+	info, err := os.Stat(f.path)
+	if os.IsNotExist(err) {
+		var empty T
+		f.data, f.modTime = empty, time.Time{}
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", f.name, err)
+	}
+	if info.ModTime().Equal(f.modTime) {
+		return nil
+	}
+
+	raw, err := os.ReadFile(f.path)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", f.name, err)
+	}
+	var data T
+	if err := json.Unmarshal(raw, &data); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", f.name, err)
+	}
+	f.data, f.modTime = data, info.ModTime()
+	return nil
+}
+
+// save writes data atomically and keeps it as the current contents;
+// caller holds the store's lock
+func (f *jsonFile[T]) save(data T) error {
+	raw, err := json.MarshalIndent(data, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmpPath := f.path + ".tmp"
+	if err := os.WriteFile(tmpPath, raw, f.perm); err != nil {
+		return fmt.Errorf("failed to write %s: %w", f.name, err)
+	}
+	if err := os.Rename(tmpPath, f.path); err != nil {
+		return err
+	}
+	f.data = data
+	if info, err := os.Stat(f.path); err == nil {
+		f.modTime = info.ModTime()
+	}
+	for _, fn := range f.saved {
+		fn()
+	}
+	return nil
+}
+
+// restore moves src, a checked copy of the file on the same filesystem, over
+// the file; the next refresh loads it. Caller holds the store's lock.
+func (f *jsonFile[T]) restore(src string) error {
+	if err := os.Chmod(src, f.perm); err != nil {
+		return err
+	}
+	if err := os.Rename(src, f.path); err != nil {
+		return fmt.Errorf("failed to restore %s: %w", f.name, err)
+	}
+	f.modTime = time.Time{}
+	for _, fn := range f.saved {
+		fn()
+	}
+	return nil
+}
@@ -0,0 +1,47 @@
+package services
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestJSONFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "items.json")
+	f := &jsonFile[[]string]{path: path, name: "items", perm: 0600}
+	changes := 0
+	f.OnChange(func() { changes++ })
+
+	if err := f.refresh(); err != nil || f.data != nil {
+		t.Fatalf("refresh() of a missing file = %v, %v; want no error and no items", f.data, err)
+	}
+	if err := f.save([]string{"a"}); err != nil {
+		t.Fatalf("save() error = %v", err)
+	}
+	if changes != 1 {
+		t.Errorf("OnChange ran %d times after a save, want 1", changes)
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0600 {
+		t.Fatalf("saved file: %v, %v; want mode 0600", info, err)
+	}
+
+	// Another writer changes the file
+	os.WriteFile(path, []byte(`["b", "c"]`), 0600)
+	later := time.Now().Add(time.Second)
+	os.Chtimes(path, later, later)
+	if err := f.refresh(); err != nil || len(f.data) != 2 || f.data[1] != "c" {
+		t.Errorf("refresh() after a change = %v, %v; want [b c]", f.data, err)
+	}
+
+	os.WriteFile(path, []byte(`{broken`), 0600)
+	os.Chtimes(path, later.Add(time.Second), later.Add(time.Second))
+	if err := f.refresh(); err == nil {
+		t.Errorf("refresh() of a broken file succeeded")
+	}
+
+	os.Remove(path)
+	if err := f.refresh(); err != nil || f.data != nil {
+		t.Errorf("refresh() after removal = %v, %v; want no items", f.data, err)
+	}
+}
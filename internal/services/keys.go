@@ -0,0 +1,139 @@
+package services
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"rom-server/internal/config"
+	"rom-server/internal/models"
+)
+
+// keyPrefixLen is how much of a key listings show
+const keyPrefixLen = 8
+
+// ErrKeyExists is returned when creating a key under a name already in use
+var ErrKeyExists = errors.New("a key with that name already exists")
+
+// KeyStore keeps API keys created with `rom-server key` in a JSON file next
+// to the builds, readable by the owner only. Only SHA-256 hashes are
+// stored. Keys created or revoked while the server is running apply to the
+// next request.
+type KeyStore struct {
+	mu sync.Mutex
+	jsonFile[[]models.APIKey]
+}
+
+// NewKeyStore loads the key file at path (missing file is fine)
+func NewKeyStore(path string) (*KeyStore, error) {
+	k := &KeyStore{jsonFile: jsonFile[[]models.APIKey]{path: path, name: "keys", perm: 0600}}
+	if err := k.refresh(); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// Restore replaces the API keys with a file unpacked from a backup
+func (k *KeyStore) Restore(src string) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return k.restore(src)
+}
+
+// List returns the stored keys by name
+func (k *KeyStore) List() ([]models.APIKey, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if err := k.refresh(); err != nil {
+		return nil, err
+	}
+	keys := append([]models.APIKey{}, k.data...)
+	sort.Slice(keys, func(i, j int) bool { return keys[i].Name < keys[j].Name })
+	return keys, nil
+}
+
+// Create generates a key for name and returns it; this is the only time the
+// key itself is available
+func (k *KeyStore) Create(name string) (string, models.APIKey, error) {
+	if !config.ValidMaintainerName(name) {
+		return "", models.APIKey{}, fmt.Errorf("name %q must be letters, digits, '.', '_' or '-' and not %q", name, config.AdminName)
+	}
+	key, err := config.GenerateAPIKey()
+	if err != nil {
+		return "", models.APIKey{}, err
+	}
+	record := models.APIKey{
+		Name:      name,
+		Hash:      hashKey(key),
+		Prefix:    key[:keyPrefixLen],
+		CreatedAt: time.Now().UTC().Format(time.RFC3339),
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if err := k.refresh(); err != nil {
+		return "", models.APIKey{}, err
+	}
+	for _, existing := range k.data {
+		if existing.Name == name {
+			return "", models.APIKey{}, ErrKeyExists
+		}
+	}
+	keys := append(append([]models.APIKey{}, k.data...), record)
+	return key, record, k.save(keys)
+}
+
+// Revoke deletes the key named name
+func (k *KeyStore) Revoke(name string) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if err := k.refresh(); err != nil {
+		return err
+	}
+	keys := make([]models.APIKey, 0, len(k.data))
+	for _, existing := range k.data {
+		if existing.Name != name {
+			keys = append(keys, existing)
+		}
+	}
+	if len(keys) == len(k.data) {
+		return ErrNotFound
+	}
+	return k.save(keys)
+}
+
+// Authenticate returns the name owning key. Every stored hash is compared in
+// constant time. A nil store or an unreadable file knows no keys.
+func (k *KeyStore) Authenticate(key string) (string, bool) {
+	if k == nil || key == "" {
+		return "", false
+	}
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if err := k.refresh(); err != nil {
+		return "", false
+	}
+	hash := []byte(hashKey(key))
+	name, ok := "", false
+	for _, record := range k.data {
+		if subtle.ConstantTimeCompare(hash, []byte(record.Hash)) == 1 && !ok {
+			name, ok = record.Name, true
+		}
+	}
+	return name, ok
+}
+
+// hashKey returns the hex SHA-256 of an API key
+func hashKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
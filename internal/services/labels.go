@@ -0,0 +1,221 @@
+package services
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"rom-server/internal/models"
+)
+
+// Limits on per-file tags and attributes
+const (
+	maxTags          = 32
+	maxAttributes    = 32
+	maxAttributeSize = 256
+	maxNotesLen      = 1000
+)
+
+// labelName matches tags and attribute keys: short, URL- and shell-friendly
+var labelName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,63}$`)
+
+// ParseAttributes turns "key=value" pairs (from form fields or query
+// parameters) into a map
+func ParseAttributes(pairs []string) (map[string]string, error) {
+	if len(pairs) == 0 {
+		return nil, nil
+	}
+	attrs := make(map[string]string, len(pairs))
+	for _, pair := range pairs {
+		key, value, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("attribute %q must be key=value", pair)
+		}
+		attrs[strings.TrimSpace(key)] = strings.TrimSpace(value)
+	}
+	return attrs, nil
+}
+
+// normalizeTags validates tags and returns them sorted without duplicates
+func normalizeTags(tags []string) ([]string, error) {
+	seen := make(map[string]bool, len(tags))
+	var out []string
+	for _, tag := range tags {
+		tag = strings.TrimSpace(tag)
+		if !labelName.MatchString(tag) {
+			return nil, invalid(fmt.Errorf("invalid tag %q (letters, digits, '.', '_' or '-', up to 64)", tag))
+		}
+		if !seen[tag] {
+			seen[tag] = true
+			out = append(out, tag)
+		}
+	}
+	if len(out) > maxTags {
+		return nil, invalid(fmt.Errorf("at most %d tags per file", maxTags))
+	}
+	sort.Strings(out)
+	return out, nil
+}
+
+// validateAttributes checks attribute keys and value sizes
+func validateAttributes(attrs map[string]string) error {
+	if len(attrs) > maxAttributes {
+		return invalid(fmt.Errorf("at most %d attributes per file", maxAttributes))
+	}
+	for key, value := range attrs {
+		if !labelName.MatchString(key) {
+			return invalid(fmt.Errorf("invalid attribute key %q (letters, digits, '.', '_' or '-', up to 64)", key))
+		}
+		if len(value) > maxAttributeSize {
+			return invalid(fmt.Errorf("attribute %s is longer than %d bytes", key, maxAttributeSize))
+		}
+	}
+	return nil
+}
+
+// NormalizeNotes trims release notes and enforces their length limit
+func NormalizeNotes(notes string) (string, error) {
+	notes = strings.TrimSpace(notes)
+	if utf8.RuneCountInString(notes) > maxNotesLen {
+		return "", invalid(fmt.Errorf("notes are longer than %d characters", maxNotesLen))
+	}
+	return notes, nil
+}
+
+// ValidateLabels checks tags and attributes before they are stored, so an
+// upload can be rejected before its body is written
+func ValidateLabels(tags []string, attrs map[string]string) error {
+	if _, err := normalizeTags(tags); err != nil {
+		return err
+	}
+	return validateAttributes(attrs)
+}
+
+// mergeAttributes overlays attrs on current, returning nil when empty
+func mergeAttributes(current, attrs map[string]string) map[string]string {
+	merged := make(map[string]string, len(current)+len(attrs))
+	for k, v := range current {
+		merged[k] = v
+	}
+	for k, v := range attrs {
+		merged[k] = v
+	}
+	if len(merged) == 0 {
+		return nil
+	}
+	return merged
+}
+
+// UpdateLabels applies a patch to a file's tags, attributes and notes: Tags
+// replaces the whole set when present, Attributes are merged and a null value
+// removes the key, Notes replaces the text when present. The file must be
+// published. Returns the updated metadata.
+func (s *FileService) UpdateLabels(category, filename string, patch models.LabelPatch) (models.FileMetadata, error) {
+	var tags []string
+	if patch.Tags != nil {
+		var err error
+		if tags, err = normalizeTags(patch.Tags); err != nil {
+			return models.FileMetadata{}, err
+		}
+	}
+	var notes string
+	if patch.Notes != nil {
+		var err error
+		if notes, err = NormalizeNotes(*patch.Notes); err != nil {
+			return models.FileMetadata{}, err
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.fileExists(category, filename) {
+		return models.FileMetadata{}, ErrNotFound
+	}
+	key := filepath.Join(category, filepath.Base(filename))
+	meta, _ := s.meta.Get(key)
+
+	attrs := make(map[string]string, len(meta.Attributes)+len(patch.Attributes))
+	for k, v := range meta.Attributes {
+		attrs[k] = v
+	}
+	for k, v := range patch.Attributes {
+		if v == nil {
+			delete(attrs, k)
+		} else {
+			attrs[k] = *v
+		}
+	}
+	if err := validateAttributes(attrs); err != nil {
+		return models.FileMetadata{}, err
+	}
+	if len(attrs) == 0 {
+		attrs = nil
+	}
+
+	err := s.meta.Update(key, func(m *models.FileMetadata) {
+		if patch.Tags != nil {
+			m.Tags = tags
+		}
+		m.Attributes = attrs
+		if patch.Notes != nil {
+			m.Notes = notes
+		}
+	})
+	updated, _ := s.meta.Get(key)
+	return updated, err
+}
+
+// FilterFiles keeps files carrying every given tag and attribute value and,
+// when uploader is set, uploaded by that maintainer
+func FilterFiles(files []models.FileInfo, tags []string, attrs map[string]string, uploader string) []models.FileInfo {
+	if len(tags) == 0 && len(attrs) == 0 && uploader == "" {
+		return files
+	}
+
+	var out []models.FileInfo
+	for _, f := range files {
+		if MatchFile(f, tags, attrs, uploader) {
+			out = append(out, f)
+		}
+	}
+	return out
+}
+
+// MatchFile is FilterFiles for a single file
+func MatchFile(f models.FileInfo, tags []string, attrs map[string]string, uploader string) bool {
+	if uploader != "" && !strings.EqualFold(f.Uploader, uploader) {
+		return false
+	}
+	return hasTags(f.Tags, tags) && hasAttributes(f.Attributes, attrs)
+}
+
+// hasTags reports whether have contains every wanted tag
+func hasTags(have, want []string) bool {
+	for _, w := range want {
+		found := false
+		for _, h := range have {
+			if strings.EqualFold(h, w) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// hasAttributes reports whether have matches every wanted key/value
+func hasAttributes(have, want map[string]string) bool {
+	for k, v := range want {
+		if got, ok := have[k]; !ok || !strings.EqualFold(got, v) {
+			return false
+		}
+	}
+	return true
+}
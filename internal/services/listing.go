@@ -0,0 +1,234 @@
+package services
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"rom-server/internal/models"
+)
+
+// updatedAtLayout is how listings show when a build was last changed
+const updatedAtLayout = "2006-01-02 15:04"
+
+// FileQuery narrows the listing and picks one page of it
+type FileQuery struct {
+	Category string                     // Only this category ("" = every enabled one)
+	Match    func(models.FileInfo) bool // Sees entries with live fields filled in (nil = all)
+	Offset   int                        // Matching files to skip
+	Limit    int                        // Page size (0 = all from Offset on)
+}
+
+// ListFiles returns all files from enabled categories, newest first
+func (s *FileService) ListFiles() ([]models.FileInfo, error) {
+	files, _, err := s.QueryFiles(FileQuery{})
+	return files, err
+}
+
+// ListFilesByCategory returns files for a specific category, newest first
+func (s *FileService) ListFilesByCategory(category string) ([]models.FileInfo, error) {
+	files, _, err := s.QueryFiles(FileQuery{Category: category})
+	return files, err
+}
+
+// QueryFiles returns the page of the listing q asks for, newest first, and
+// how many files match in all. Only the entries on the page are copied, so
+// paging through thousands of builds stays cheap.
+func (s *FileService) QueryFiles(q FileQuery) ([]models.FileInfo, int, error) {
+	s.mu.RLock()
+	for !s.cacheValid {
+		s.mu.RUnlock()
+		s.mu.Lock()
+		s.refreshListing()
+		s.mu.Unlock()
+		s.mu.RLock()
+	}
+	defer s.mu.RUnlock()
+
+	files := s.cachedFiles
+	if q.Category != "" {
+		files = s.listing[q.Category]
+	}
+	page := make([]models.FileInfo, 0)
+	total := 0
+	for _, f := range files {
+		f = s.withLiveFields(f)
+		if q.Match != nil && !q.Match(f) {
+			continue
+		}
+		if total >= q.Offset && (q.Limit <= 0 || len(page) < q.Limit) {
+			page = append(page, f)
+		}
+		total++
+	}
+	return page, total, nil
+}
+
+// OnChange registers fn to run whenever published files change: uploads,
+// deletes, moves, label edits, config changes and, in cluster mode, changes
+// made on other nodes. fn runs with the service locked and must not call it.
+func (s *FileService) OnChange(fn func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.onChange = append(s.onChange, fn)
+}
+
+// invalidateListing marks categories for re-reading on the next listing,
+// or every category when none are given; caller holds s.mu
+func (s *FileService) invalidateListing(categories ...string) {
+	for _, fn := range s.onChange {
+		fn()
+	}
+	s.cacheValid = false
+	if len(categories) == 0 {
+		s.listing = nil
+		return
+	}
+	for _, category := range categories {
+		delete(s.listing, category)
+	}
+}
+
+// refreshListing reads the categories invalidated since the last listing
+// and merges them with the rest; caller holds s.mu for writing
+func (s *FileService) refreshListing() {
+	if s.cacheValid {
+		return
+	}
+	if s.listing == nil {
+		s.listing = make(map[string][]models.FileInfo)
+	}
+
+	categories := s.cfg.GetCategories()
+	for name := range s.listing {
+		if cat, ok := categories[name]; !ok || !cat.Enabled {
+			delete(s.listing, name)
+		}
+	}
+	for name, cat := range categories {
+		if _, ok := s.listing[name]; ok || !cat.Enabled {
+			continue
+		}
+		files := s.readCategory(name)
+		// Builds published before short links existed get theirs now
+		for _, f := range files {
+			s.assignShortCode(filepath.Join(f.Category, f.Filename))
+		}
+		s.listing[name] = files
+	}
+
+	s.cachedFiles = mergeNewest(s.listing)
+	s.cacheValid = true
+}
+
+// readCategory lists the builds of one category, on disk and in the bucket,
+// newest first
+func (s *FileService) readCategory(category string) []models.FileInfo {
+	var files []models.FileInfo
+	entries, err := os.ReadDir(filepath.Join(s.cfg.Storage.UploadDir, category))
+	if err != nil {
+		entries = nil // Directory might not exist yet
+	}
+	for _, e := range entries {
+		if e.IsDir() || !s.cfg.IsAllowedExtensionFor(category, filepath.Ext(e.Name())) {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		files = append(files, listingEntry(category, e.Name(), info.Size(), info.ModTime()))
+	}
+
+	// Builds uploaded straight to the bucket
+	for name, meta := range s.remoteFiles(category) {
+		files = append(files, listingEntry(category, name, meta.Size, time.Unix(meta.UploadedAt, 0)))
+	}
+
+	sort.Slice(files, func(i, j int) bool { return newer(files[i], files[j]) })
+	return files
+}
+
+// listingEntry is the cached part of a listing entry; counters and
+// metadata are filled in per request
+func listingEntry(category, filename string, size int64, modTime time.Time) models.FileInfo {
+	return models.FileInfo{
+		Category:  category,
+		Filename:  filename,
+		Size:      formatSize(size),
+		SizeBytes: size,
+		UpdatedAt: modTime.Format(updatedAtLayout),
+		ModTime:   modTime,
+	}
+}
+
+// newer orders listings newest first, then by name so equal times keep
+// a stable order
+func newer(a, b models.FileInfo) bool {
+	if !a.ModTime.Equal(b.ModTime) {
+		return a.ModTime.After(b.ModTime)
+	}
+	if a.Category != b.Category {
+		return a.Category < b.Category
+	}
+	return a.Filename < b.Filename
+}
+
+// mergeNewest merges per-category listings, each newest first, into one
+func mergeNewest(listing map[string][]models.FileInfo) []models.FileInfo {
+	lists := make([][]models.FileInfo, 0, len(listing))
+	total := 0
+	for _, files := range listing {
+		if len(files) > 0 {
+			lists = append(lists, files)
+			total += len(files)
+		}
+	}
+
+	merged := make([]models.FileInfo, 0, total)
+	for len(lists) > 0 {
+		next := 0
+		for i := 1; i < len(lists); i++ {
+			if newer(lists[i][0], lists[next][0]) {
+				next = i
+			}
+		}
+		merged = append(merged, lists[next][0])
+		if lists[next] = lists[next][1:]; len(lists[next]) == 0 {
+			lists = append(lists[:next], lists[next+1:]...)
+		}
+	}
+	return merged
+}
+
+// withLiveFields fills counters and metadata into a listing entry; caller
+// holds s.mu
+func (s *FileService) withLiveFields(f models.FileInfo) models.FileInfo {
+	key := filepath.Join(f.Category, f.Filename)
+	f.Downloads = s.downloadCounts[key]
+	if meta, ok := s.meta.Get(key); ok {
+		f.SHA256 = meta.SHA256
+		f.SHA1 = meta.SHA1
+		f.MD5 = meta.MD5
+		f.Pinned = meta.Pinned
+		f.Tags = meta.Tags
+		f.Attributes = meta.Attributes
+		f.Release = meta.Release
+		f.Image = meta.Image
+		f.APK = meta.APK
+		f.Verification = meta.Verification
+		f.Notes = meta.Notes
+		f.Uploader = meta.Uploader
+		if meta.ShortCode != "" {
+			f.ShortURL = ShortLinkPath(meta.ShortCode)
+		}
+	}
+	_, f.Fallback = s.meta.Get(previousKey(f.Category, f.Filename))
+	f.URL = s.cdn.URL(f.Category, f.Filename)
+	// The CDN can't check beta tester tokens, so restricted builds bypass it
+	if f.URL == "" || s.cfg.IsRestricted(f.Category) {
+		f.URL = DownloadPath(f.Category, f.Filename)
+	}
+	return f
+}
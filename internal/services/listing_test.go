@@ -0,0 +1,109 @@
+package services
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"rom-server/internal/models"
+)
+
+// names joins the category/filename of listing entries for comparison
+func names(files []models.FileInfo) string {
+	out := make([]string, len(files))
+	for i, f := range files {
+		out[i] = f.Category + "/" + f.Filename
+	}
+	return strings.Join(out, ",")
+}
+
+func TestMergeNewest(t *testing.T) {
+	at := func(category, filename string, minute int) models.FileInfo {
+		return models.FileInfo{Category: category, Filename: filename, ModTime: time.Unix(int64(minute)*60, 0)}
+	}
+	tests := []struct {
+		name    string
+		listing map[string][]models.FileInfo
+		want    string
+	}{
+		{name: "empty", listing: nil, want: ""},
+		{
+			name:    "one category",
+			listing: map[string][]models.FileInfo{"a": {at("a", "2.zip", 2), at("a", "1.zip", 1)}},
+			want:    "a/2.zip,a/1.zip",
+		},
+		{
+			name: "interleaved",
+			listing: map[string][]models.FileInfo{
+				"a": {at("a", "5.zip", 5), at("a", "3.zip", 3), at("a", "1.zip", 1)},
+				"b": {at("b", "4.zip", 4), at("b", "2.zip", 2)},
+				"c": {},
+			},
+			want: "a/5.zip,b/4.zip,a/3.zip,b/2.zip,a/1.zip",
+		},
+		{
+			name: "equal times by category then name",
+			listing: map[string][]models.FileInfo{
+				"b": {at("b", "x.zip", 1)},
+				"a": {at("a", "y.zip", 1), at("a", "z.zip", 1)},
+			},
+			want: "a/y.zip,a/z.zip,b/x.zip",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := names(mergeNewest(tt.listing)); got != tt.want {
+				t.Errorf("mergeNewest() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQueryFiles(t *testing.T) {
+	s := newTestService(t, "gapps", "vanilla")
+	base := time.Now().Add(-time.Hour)
+	for i, key := range []string{"vanilla/1.zip", "gapps/2.zip", "vanilla/3.zip", "gapps/4.zip", "vanilla/5.zip"} {
+		writeFile(t, s, key, key)
+		mtime := base.Add(time.Duration(i) * time.Minute)
+		if err := os.Chtimes(filepath.Join(s.cfg.Storage.UploadDir, key), mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeFile(t, s, "vanilla/notes.txt", "not a build")
+
+	tests := []struct {
+		name      string
+		query     FileQuery
+		want      string
+		wantTotal int
+	}{
+		{name: "everything", query: FileQuery{}, want: "vanilla/5.zip,gapps/4.zip,vanilla/3.zip,gapps/2.zip,vanilla/1.zip", wantTotal: 5},
+		{name: "first page", query: FileQuery{Limit: 2}, want: "vanilla/5.zip,gapps/4.zip", wantTotal: 5},
+		{name: "middle page", query: FileQuery{Offset: 2, Limit: 2}, want: "vanilla/3.zip,gapps/2.zip", wantTotal: 5},
+		{name: "last partial page", query: FileQuery{Offset: 4, Limit: 2}, want: "vanilla/1.zip", wantTotal: 5},
+		{name: "past the end", query: FileQuery{Offset: 9, Limit: 2}, want: "", wantTotal: 5},
+		{name: "rest from offset", query: FileQuery{Offset: 3}, want: "gapps/2.zip,vanilla/1.zip", wantTotal: 5},
+		{name: "one category", query: FileQuery{Category: "gapps", Limit: 1}, want: "gapps/4.zip", wantTotal: 2},
+		{
+			name: "match counts before paging",
+			query: FileQuery{Offset: 1, Limit: 1, Match: func(f models.FileInfo) bool {
+				return f.Category == "vanilla"
+			}},
+			want:      "vanilla/3.zip",
+			wantTotal: 3,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files, total, err := s.QueryFiles(tt.query)
+			if err != nil {
+				t.Fatalf("QueryFiles() error = %v", err)
+			}
+			if got := names(files); got != tt.want || total != tt.wantTotal {
+				t.Errorf("QueryFiles() = %s (%d in all), want %s (%d in all)", got, total, tt.want, tt.wantTotal)
+			}
+		})
+	}
+}
@@ -0,0 +1,263 @@
+package services
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"rom-server/internal/models"
+)
+
+// Verification statuses
+const (
+	VerifyOK       = "verified"
+	VerifyMismatch = "mismatch"
+)
+
+// MaxManifestSize bounds an imported checksum manifest
+const MaxManifestSize = 1 << 20
+
+// expectedSumsFile keeps the manifest entries of builds that haven't been
+// uploaded yet, by category/filename
+const expectedSumsFile = "expected_checksums.json"
+
+// ErrManifestMismatch means an upload differs from the SHA-256 an imported
+// manifest listed for it
+var ErrManifestMismatch = fmt.Errorf("%w: doesn't match the imported checksum manifest", ErrChecksumMismatch)
+
+// manifestLine matches "<hex>  <name>" (sha256sum; a '*' marks binary mode)
+// and "SHA256 (<name>) = <hex>" (BSD tags, sha256sum --tag)
+var (
+	manifestLine    = regexp.MustCompile(`^([0-9A-Fa-f]{64}) [ *](.+)$`)
+	manifestTagLine = regexp.MustCompile(`^SHA256 \((.+)\) = ([0-9A-Fa-f]{64})$`)
+)
+
+// ParseManifest reads a sha256sums.txt as a build system writes it and
+// returns the SHA-256 of each build by file name. Build systems list paths
+// in their output dir, so only the base name is kept.
+func ParseManifest(r io.Reader) (map[string]string, error) {
+	sums := make(map[string]string)
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		var sum, name string
+		if m := manifestLine.FindStringSubmatch(line); m != nil {
+			sum, name = m[1], m[2]
+		} else if m := manifestTagLine.FindStringSubmatch(line); m != nil {
+			name, sum = m[1], m[2]
+		} else {
+			return nil, &InvalidField{Field: "manifest", Message: fmt.Sprintf("line %d is not in sha256sum format", n)}
+		}
+		name = SanitizeFilename(name)
+		if !validName(name) {
+			return nil, &InvalidField{Field: "manifest", Message: fmt.Sprintf("line %d names no usable file", n)}
+		}
+		sums[name] = strings.ToLower(sum)
+	}
+	if err := scanner.Err(); err == bufio.ErrTooLong {
+		return nil, &InvalidField{Field: "manifest", Message: "has a line that is too long"}
+	} else if err != nil {
+		return nil, err
+	}
+	if len(sums) == 0 {
+		return nil, &InvalidField{Field: "manifest", Message: "lists no files"}
+	}
+	return sums, nil
+}
+
+// validName rejects the names SanitizeFilename leaves for empty or dot paths
+func validName(name string) bool {
+	return name != "" && name != "." && name != ".."
+}
+
+// ImportManifest checks the builds of a category against the SHA-256 sums
+// of a manifest. Builds already uploaded, or held for publishing, are
+// marked verified or mismatched in their metadata; the rest are remembered
+// and checked by SaveUpload when they arrive. A live build that verifies is
+// confirmed, letting go of the previous build kept for it.
+func (s *FileService) ImportManifest(category string, sums map[string]string) (models.ManifestReport, error) {
+	report := models.ManifestReport{
+		Category:   category,
+		Verified:   []string{},
+		Mismatched: []models.ManifestMismatch{},
+		Pending:    []string{},
+	}
+	names := make([]string, 0, len(sums))
+	for name := range sums {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	s.manifestMu.Lock()
+	defer s.manifestMu.Unlock()
+	expected, err := s.loadExpected()
+	if err != nil {
+		return report, err
+	}
+
+	now := time.Now().UTC()
+	var confirmed []string
+	for _, name := range names {
+		sum, key := sums[name], filepath.Join(category, name)
+		meta, ok := s.meta.Get(key)
+		if !ok || meta.SHA256 == "" {
+			key = pendingKey(category, name)
+			meta, ok = s.meta.Get(key)
+		}
+		if !ok || meta.SHA256 == "" {
+			expected[filepath.Join(category, name)] = models.ExpectedChecksum{Category: category, Filename: name, SHA256: sum, ImportedAt: now}
+			report.Pending = append(report.Pending, name)
+			continue
+		}
+
+		v := &models.Verification{Status: VerifyOK, VerifiedAt: now}
+		if !strings.EqualFold(meta.SHA256, sum) {
+			v.Status, v.Expected = VerifyMismatch, sum
+			report.Mismatched = append(report.Mismatched, models.ManifestMismatch{Filename: name, Expected: sum, Actual: meta.SHA256})
+		} else {
+			report.Verified = append(report.Verified, name)
+			if key == filepath.Join(category, name) {
+				confirmed = append(confirmed, name)
+			}
+		}
+		if err := s.meta.Update(key, func(m *models.FileMetadata) { m.Verification = v }); err != nil {
+			return report, err
+		}
+		delete(expected, filepath.Join(category, name))
+	}
+
+	if err := s.saveExpected(expected); err != nil {
+		return report, err
+	}
+	for _, name := range confirmed {
+		if err := s.ConfirmBuild(category, name); err != nil && !errors.Is(err, ErrNotFound) {
+			return report, fmt.Errorf("failed to drop the previous build of %s: %w", name, err)
+		}
+	}
+	s.mu.Lock()
+	s.invalidateListing(category)
+	s.mu.Unlock()
+	return report, nil
+}
+
+// ExpectedChecksums returns the manifest entries still waiting for their
+// build, by category and file name
+func (s *FileService) ExpectedChecksums() ([]models.ExpectedChecksum, error) {
+	s.manifestMu.Lock()
+	defer s.manifestMu.Unlock()
+	expected, err := s.loadExpected()
+	if err != nil {
+		return nil, err
+	}
+	items := make([]models.ExpectedChecksum, 0, len(expected))
+	for _, item := range expected {
+		items = append(items, item)
+	}
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].Category != items[j].Category {
+			return items[i].Category < items[j].Category
+		}
+		return items[i].Filename < items[j].Filename
+	})
+	return items, nil
+}
+
+// DropExpectedChecksums forgets the waiting manifest entries of a category,
+// or of one file in it, and returns how many there were
+func (s *FileService) DropExpectedChecksums(category, filename string) (int, error) {
+	s.manifestMu.Lock()
+	defer s.manifestMu.Unlock()
+	expected, err := s.loadExpected()
+	if err != nil {
+		return 0, err
+	}
+	dropped := 0
+	for key, item := range expected {
+		if item.Category == category && (filename == "" || item.Filename == filename) {
+			delete(expected, key)
+			dropped++
+		}
+	}
+	if dropped == 0 {
+		return 0, nil
+	}
+	return dropped, s.saveExpected(expected)
+}
+
+// checkExpected compares an upload with the manifest entry waiting for it,
+// if any; nil without one
+func (s *FileService) checkExpected(category, filename, sum string) (*models.Verification, error) {
+	s.manifestMu.Lock()
+	defer s.manifestMu.Unlock()
+	expected, err := s.loadExpected()
+	if err != nil {
+		return nil, err
+	}
+	item, ok := expected[filepath.Join(category, filename)]
+	if !ok {
+		return nil, nil
+	}
+	if !strings.EqualFold(item.SHA256, sum) {
+		return nil, ErrManifestMismatch
+	}
+	return &models.Verification{Status: VerifyOK, VerifiedAt: time.Now().UTC()}, nil
+}
+
+// settleExpected forgets the manifest entry of an upload that matched it
+func (s *FileService) settleExpected(category, filename string) error {
+	s.manifestMu.Lock()
+	defer s.manifestMu.Unlock()
+	expected, err := s.loadExpected()
+	if err != nil {
+		return err
+	}
+	key := filepath.Join(category, filename)
+	if _, ok := expected[key]; !ok {
+		return nil
+	}
+	delete(expected, key)
+	return s.saveExpected(expected)
+}
+
+// loadExpected reads the waiting manifest entries; caller holds
+// s.manifestMu
+func (s *FileService) loadExpected() (map[string]models.ExpectedChecksum, error) {
+	expected := make(map[string]models.ExpectedChecksum)
+	data, err := os.ReadFile(filepath.Join(s.cfg.Storage.UploadDir, expectedSumsFile))
+	if os.IsNotExist(err) {
+		return expected, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read expected checksums: %w", err)
+	}
+	if err := json.Unmarshal(data, &expected); err != nil {
+		return nil, fmt.Errorf("failed to parse expected checksums: %w", err)
+	}
+	return expected, nil
+}
+
+// saveExpected writes the waiting manifest entries atomically; caller holds
+// s.manifestMu
+func (s *FileService) saveExpected(expected map[string]models.ExpectedChecksum) error {
+	data, err := json.MarshalIndent(expected, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(s.cfg.Storage.UploadDir, expectedSumsFile)
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write expected checksums: %w", err)
+	}
+	return os.Rename(tmpPath, path)
+}
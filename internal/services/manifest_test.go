@@ -0,0 +1,36 @@
+package services
+
+import (
+	"path/filepath"
+	"testing"
+
+	"rom-server/internal/models"
+)
+
+func TestImportManifestConfirmsVerifiedBuilds(t *testing.T) {
+	tests := []struct {
+		name         string
+		sum          string
+		wantPrevious bool
+	}{
+		{name: "verified", sum: "AAAA", wantPrevious: false},
+		{name: "mismatched", sum: "bbbb", wantPrevious: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestService(t, "vanilla")
+			key := filepath.Join("vanilla", "rom.zip")
+			writeFile(t, s, key, "new")
+			writeFile(t, s, previousKey("vanilla", "rom.zip"), "old")
+			s.meta.Update(key, func(m *models.FileMetadata) { m.SHA256 = "aaaa" })
+			s.meta.Update(previousKey("vanilla", "rom.zip"), func(m *models.FileMetadata) { m.SHA256 = "old" })
+
+			if _, err := s.ImportManifest("vanilla", map[string]string{"rom.zip": tt.sum}); err != nil {
+				t.Fatalf("ImportManifest() error = %v", err)
+			}
+			if got := s.HasPrevious("vanilla", "rom.zip"); got != tt.wantPrevious {
+				t.Errorf("HasPrevious() = %v, want %v", got, tt.wantPrevious)
+			}
+		})
+	}
+}
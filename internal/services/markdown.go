@@ -0,0 +1,177 @@
+package services
+
+import (
+	"html"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Inline Markdown, matched against already-escaped text
+var (
+	mdLink    = regexp.MustCompile(`\[([^\]]+)\]\(([^)\s]+)\)`)
+	mdBold    = regexp.MustCompile(`\*\*([^*]+)\*\*`)
+	mdItalic  = regexp.MustCompile(`\*([^*\s][^*]*)\*`)
+	mdOList   = regexp.MustCompile(`^\d+[.)]\s+`)
+	mdHeading = regexp.MustCompile(`^#{1,6}(\s|$)`)
+)
+
+// RenderMarkdown turns the Markdown of a page into HTML. It covers what
+// instructions need (headings, paragraphs, flat lists, quotes, rules, fenced
+// code, code spans, bold, italics and links) and nothing else. Raw HTML is
+// escaped and links are limited to http(s), mailto and relative URLs, so the
+// output can be inserted into the download page as it is.
+func RenderMarkdown(src string) string {
+	var md mdRenderer
+	lines := strings.Split(strings.ReplaceAll(src, "\r\n", "\n"), "\n")
+	for i := 0; i < len(lines); i++ {
+		line := strings.TrimRight(lines[i], " \t")
+		trimmed := strings.TrimSpace(line)
+
+		switch {
+		case strings.HasPrefix(trimmed, "```"):
+			md.flush()
+			var code []string
+			for i++; i < len(lines) && !strings.HasPrefix(strings.TrimSpace(lines[i]), "```"); i++ {
+				code = append(code, lines[i])
+			}
+			md.out.WriteString("<pre><code>" + html.EscapeString(strings.Join(code, "\n")) + "</code></pre>\n")
+
+		case trimmed == "":
+			md.flush()
+
+		case trimmed == "---" || trimmed == "***" || trimmed == "___":
+			md.flush()
+			md.out.WriteString("<hr>\n")
+
+		case strings.HasPrefix(trimmed, "#") && mdHeading.MatchString(trimmed):
+			md.flush()
+			level := len(trimmed) - len(strings.TrimLeft(trimmed, "#"))
+			tag := "h" + strconv.Itoa(level)
+			text := strings.TrimSpace(strings.TrimRight(trimmed[level:], "#"))
+			md.out.WriteString("<" + tag + ">" + renderInline(text) + "</" + tag + ">\n")
+
+		case strings.HasPrefix(trimmed, ">"):
+			md.flushPara()
+			md.closeList()
+			md.quote = append(md.quote, strings.TrimSpace(strings.TrimPrefix(trimmed, ">")))
+
+		case strings.HasPrefix(trimmed, "- ") || strings.HasPrefix(trimmed, "* ") || strings.HasPrefix(trimmed, "+ "):
+			md.startItem("ul", strings.TrimSpace(trimmed[2:]))
+
+		case mdOList.MatchString(trimmed):
+			md.startItem("ol", mdOList.ReplaceAllString(trimmed, ""))
+
+		case md.item != nil && line != trimmed:
+			// An indented line continues the list item above it
+			md.item = append(md.item, trimmed)
+
+		default:
+			md.closeList()
+			md.flushQuote()
+			md.para = append(md.para, trimmed)
+		}
+	}
+	md.flush()
+	return md.out.String()
+}
+
+// mdRenderer holds the blocks RenderMarkdown has started but not written
+type mdRenderer struct {
+	out   strings.Builder
+	para  []string // Lines of the open paragraph
+	quote []string // Lines of the open block quote
+	list  string   // "ul" or "ol" while a list is open
+	item  []string // Lines of the open list item
+}
+
+func (md *mdRenderer) flushPara() {
+	if len(md.para) > 0 {
+		md.out.WriteString("<p>" + renderInline(strings.Join(md.para, " ")) + "</p>\n")
+		md.para = nil
+	}
+}
+
+func (md *mdRenderer) flushQuote() {
+	if len(md.quote) > 0 {
+		md.out.WriteString("<blockquote><p>" + renderInline(strings.Join(md.quote, " ")) + "</p></blockquote>\n")
+		md.quote = nil
+	}
+}
+
+func (md *mdRenderer) flushItem() {
+	if md.item != nil {
+		md.out.WriteString("<li>" + renderInline(strings.Join(md.item, " ")) + "</li>\n")
+		md.item = nil
+	}
+}
+
+func (md *mdRenderer) closeList() {
+	md.flushItem()
+	if md.list != "" {
+		md.out.WriteString("</" + md.list + ">\n")
+		md.list = ""
+	}
+}
+
+// startItem begins a list item, opening a list of kind if needed
+func (md *mdRenderer) startItem(kind, text string) {
+	md.flushPara()
+	md.flushQuote()
+	if md.list != kind {
+		md.closeList()
+		md.out.WriteString("<" + kind + ">\n")
+		md.list = kind
+	}
+	md.flushItem()
+	md.item = []string{text}
+}
+
+// flush writes every open block
+func (md *mdRenderer) flush() {
+	md.flushPara()
+	md.flushQuote()
+	md.closeList()
+}
+
+// renderInline escapes a run of text and applies code spans, links, bold
+// and italics
+func renderInline(text string) string {
+	var out strings.Builder
+	// Odd parts are inside backticks and are left as written; an unpaired
+	// backtick is kept as text
+	parts := strings.Split(text, "`")
+	for i, part := range parts {
+		if i%2 == 1 && i < len(parts)-1 {
+			out.WriteString("<code>" + html.EscapeString(part) + "</code>")
+			continue
+		}
+		if i%2 == 1 {
+			out.WriteString("`")
+		}
+		s := html.EscapeString(part)
+		s = mdLink.ReplaceAllStringFunc(s, func(m string) string {
+			groups := mdLink.FindStringSubmatch(m)
+			if !safeLink(html.UnescapeString(groups[2])) {
+				return groups[1]
+			}
+			return `<a href="` + groups[2] + `" rel="nofollow noopener">` + groups[1] + `</a>`
+		})
+		s = mdBold.ReplaceAllString(s, "<strong>$1</strong>")
+		s = mdItalic.ReplaceAllString(s, "<em>$1</em>")
+		out.WriteString(s)
+	}
+	return out.String()
+}
+
+// safeLink allows web, mail and relative links, never javascript: and the like
+func safeLink(url string) bool {
+	lower := strings.ToLower(url)
+	if strings.HasPrefix(lower, "http://") || strings.HasPrefix(lower, "https://") || strings.HasPrefix(lower, "mailto:") {
+		return true
+	}
+	if strings.HasPrefix(lower, "//") {
+		return false
+	}
+	return !strings.Contains(strings.SplitN(strings.SplitN(lower, "?", 2)[0], "/", 2)[0], ":")
+}
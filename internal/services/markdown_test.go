@@ -0,0 +1,30 @@
+package services
+
+import "testing"
+
+func TestSafeLink(t *testing.T) {
+	tests := []struct {
+		url  string
+		want bool
+	}{
+		{"https://example.com/changelog", true},
+		{"HTTP://example.com", true},
+		{"mailto:maintainer@example.com", true},
+		{"/builds/vanilla/rom.zip", true},
+		{"changelog.html", true},
+		{"#flashing", true},
+		{"notes?from=a:b", true},
+		{"docs/a:b", true},
+		{"javascript:alert(1)", false},
+		{"JavaScript:alert(1)", false},
+		{"data:text/html;base64,PHNjcmlwdD4=", false},
+		{"vbscript:msgbox", false},
+		{"//evil.example.com", false},
+		{"", true},
+	}
+	for _, tt := range tests {
+		if got := safeLink(tt.url); got != tt.want {
+			t.Errorf("safeLink(%q) = %v, want %v", tt.url, got, tt.want)
+		}
+	}
+}
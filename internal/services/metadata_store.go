@@ -0,0 +1,145 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+
+	"rom-server/internal/cluster"
+	"rom-server/internal/models"
+)
+
+// MetadataStore persists per-file metadata (checksums etc.) in a JSON file.
+// Keys match the stats keys: filepath.Join(category, filename).
+type MetadataStore struct {
+	mu     sync.RWMutex
+	path   string
+	files  map[string]*models.FileMetadata
+	shared cluster.Store // Mirrors writes for other instances (nil outside cluster mode)
+}
+
+// NewMetadataStore loads the metadata file at path (missing file is fine)
+func NewMetadataStore(path string, shared cluster.Store) (*MetadataStore, error) {
+	m := &MetadataStore{
+		path:   path,
+		files:  make(map[string]*models.FileMetadata),
+		shared: shared,
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return m, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read metadata: %w", err)
+	}
+	if err := json.Unmarshal(data, &m.files); err != nil {
+		return nil, fmt.Errorf("failed to parse metadata: %w", err)
+	}
+	return m, nil
+}
+
+// Get returns a copy of the metadata for a file
+func (m *MetadataStore) Get(key string) (models.FileMetadata, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	meta, ok := m.files[key]
+	if !ok {
+		return models.FileMetadata{}, false
+	}
+	return *meta, true
+}
+
+// All returns a copy of every metadata entry
+func (m *MetadataStore) All() map[string]models.FileMetadata {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	all := make(map[string]models.FileMetadata, len(m.files))
+	for key, meta := range m.files {
+		all[key] = *meta
+	}
+	return all
+}
+
+// FindShortCode returns the key of the file whose short link code is code
+func (m *MetadataStore) FindShortCode(code string) (string, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for key, meta := range m.files {
+		if meta.ShortCode == code {
+			return key, true
+		}
+	}
+	return "", false
+}
+
+// Update applies fn to a file's metadata (creating it if needed) and persists
+func (m *MetadataStore) Update(key string, fn func(*models.FileMetadata)) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	meta, ok := m.files[key]
+	if !ok {
+		meta = &models.FileMetadata{}
+		m.files[key] = meta
+	}
+	fn(meta)
+
+	if err := m.save(); err != nil {
+		return err
+	}
+	if m.shared != nil {
+		data, err := json.Marshal(meta)
+		if err != nil {
+			return err
+		}
+		return m.shared.HashSet(sharedMetadata, key, string(data))
+	}
+	return nil
+}
+
+// Delete removes a file's metadata and persists
+func (m *MetadataStore) Delete(key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.files[key]; !ok {
+		return nil
+	}
+	delete(m.files, key)
+
+	if err := m.save(); err != nil {
+		return err
+	}
+	if m.shared != nil {
+		return m.shared.HashDel(sharedMetadata, key)
+	}
+	return nil
+}
+
+// Replace swaps in a complete set of metadata, e.g. from a backup, and persists
+func (m *MetadataStore) Replace(files map[string]*models.FileMetadata) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.files = files
+	return m.save()
+}
+
+// save writes the metadata atomically; caller must hold the lock
+func (m *MetadataStore) save() error {
+	data, err := json.MarshalIndent(m.files, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmpPath := m.path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write metadata: %w", err)
+	}
+	return os.Rename(tmpPath, m.path)
+}
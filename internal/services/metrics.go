@@ -0,0 +1,85 @@
+package services
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// Metrics is a minimal registry of named counters and gauges
+type Metrics struct {
+	mu     sync.RWMutex
+	values map[string]*int64
+}
+
+// NewMetrics creates an empty metrics registry
+func NewMetrics() *Metrics {
+	return &Metrics{values: make(map[string]*int64)}
+}
+
+// value returns the storage for a metric, creating it on first use
+func (m *Metrics) value(name string) *int64 {
+	m.mu.RLock()
+	v, ok := m.values[name]
+	m.mu.RUnlock()
+	if ok {
+		return v
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if v, ok = m.values[name]; !ok {
+		v = new(int64)
+		m.values[name] = v
+	}
+	return v
+}
+
+// Add increments a counter or gauge by delta; a nil registry (metrics flag
+// off) ignores it
+func (m *Metrics) Add(name string, delta int64) {
+	if m == nil {
+		return
+	}
+	atomic.AddInt64(m.value(name), delta)
+}
+
+// Set overwrites a gauge
+func (m *Metrics) Set(name string, value int64) {
+	if m == nil {
+		return
+	}
+	atomic.StoreInt64(m.value(name), value)
+}
+
+// Snapshot returns the current value of every metric
+func (m *Metrics) Snapshot() map[string]int64 {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	snap := make(map[string]int64, len(m.values))
+	for name, v := range m.values {
+		snap[name] = atomic.LoadInt64(v)
+	}
+	return snap
+}
+
+// WritePrometheus writes all metrics in the Prometheus text exposition format
+func (m *Metrics) WritePrometheus(w io.Writer) error {
+	snap := m.Snapshot()
+
+	names := make([]string, 0, len(snap))
+	for name := range snap {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if _, err := fmt.Fprintf(w, "photon_%s %d\n", name, snap[name]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,160 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"rom-server/internal/config"
+	"rom-server/internal/models"
+)
+
+// MirrorUserAgent identifies mirror pulls so upstreams don't count them as downloads
+const MirrorUserAgent = "photon-serve-mirror/1.0"
+
+// Mirror keeps a read-only instance in sync with an upstream photon-serve
+type Mirror struct {
+	cfg         *config.Config
+	fileService *FileService
+	client      *http.Client // No overall timeout: builds can take a while to pull
+	logger      *log.Logger
+}
+
+// NewMirror creates a mirror syncer, or returns nil when mirror mode is off
+func NewMirror(cfg *config.Config, fs *FileService, logger *log.Logger) *Mirror {
+	if !cfg.Mirror.Enabled {
+		return nil
+	}
+	return &Mirror{
+		cfg:         cfg,
+		fileService: fs,
+		client:      &http.Client{},
+		logger:      logger,
+	}
+}
+
+// Sync pulls new or changed builds from the upstream listing and removes local
+// ones the upstream no longer publishes. Only locally configured categories
+// are mirrored.
+func (m *Mirror) Sync() error {
+	upstream, err := m.fetchListing()
+	if err != nil {
+		return err
+	}
+
+	local, err := m.fileService.ListFiles()
+	if err != nil {
+		return err
+	}
+	have := make(map[string]models.FileInfo, len(local))
+	for _, f := range local {
+		have[filepath.Join(f.Category, f.Filename)] = f
+	}
+
+	wanted := make(map[string]bool, len(upstream))
+	var pulled, failed int
+	for _, f := range upstream {
+		if !m.cfg.IsValidCategory(f.Category) || f.Filename != SanitizeFilename(f.Filename) {
+			continue
+		}
+		key := filepath.Join(f.Category, f.Filename)
+		wanted[key] = true
+
+		if cur, ok := have[key]; ok && sameBuild(cur, f) {
+			continue
+		}
+		if err := m.pull(f); err != nil {
+			m.logger.Printf("Mirror: failed to pull %s: %v", key, err)
+			failed++
+			continue
+		}
+		pulled++
+	}
+
+	removed := 0
+	for key, f := range have {
+		if wanted[key] {
+			continue
+		}
+		if err := m.fileService.DeleteFile(f.Category, f.Filename); err == nil {
+			removed++
+		}
+	}
+
+	if pulled > 0 || removed > 0 || failed > 0 {
+		m.logger.Printf("Mirror: pulled %d, removed %d, failed %d", pulled, removed, failed)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d files failed to sync", failed)
+	}
+	return nil
+}
+
+// sameBuild compares by checksum when both sides have one, else by size
+func sameBuild(local, upstream models.FileInfo) bool {
+	if local.SHA256 != "" && upstream.SHA256 != "" {
+		return strings.EqualFold(local.SHA256, upstream.SHA256)
+	}
+	return local.SizeBytes == upstream.SizeBytes
+}
+
+// fetchListing reads the upstream's public /list
+func (m *Mirror) fetchListing() ([]models.FileInfo, error) {
+	resp, err := m.get(strings.TrimRight(m.cfg.Mirror.UpstreamURL, "/") + "/list")
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch upstream listing: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var list models.ListResponse
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		return nil, fmt.Errorf("failed to parse upstream listing: %w", err)
+	}
+	return list.Files, nil
+}
+
+// pull downloads a single build and publishes it, verifying its checksum
+func (m *Mirror) pull(f models.FileInfo) error {
+	source := f.URL // Upstream CDN, if it has one
+	if source == "" {
+		source = strings.TrimRight(m.cfg.Mirror.UpstreamURL, "/") + DownloadPath(f.Category, f.Filename)
+	}
+
+	resp, err := m.get(source)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	_, err = m.fileService.SaveUpload(f.Category, f.Filename, resp.Body, resp.ContentLength, UploadOptions{
+		ExpectedSHA256: f.SHA256,
+		Uploader:       f.Uploader,
+		Notes:          f.Notes,
+		Release:        f.Release,
+		Tags:           f.Tags,
+		Attributes:     f.Attributes,
+	})
+	return err
+}
+
+// get performs a GET identifying as a mirror and fails on non-200 responses
+func (m *Mirror) get(target string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, target, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", MirrorUserAgent)
+
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("unexpected status %d from %s", resp.StatusCode, target)
+	}
+	return resp, nil
+}
@@ -0,0 +1,81 @@
+package services
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"rom-server/internal/config"
+	"rom-server/internal/models"
+)
+
+// Notifier delivers event webhooks to the configured endpoint
+type Notifier struct {
+	cfg     *config.Config
+	client  *http.Client
+	workers *WorkerPool
+	logger  *log.Logger
+}
+
+// NewNotifier creates a Notifier delivering on the given worker pool
+func NewNotifier(cfg *config.Config, workers *WorkerPool, logger *log.Logger) *Notifier {
+	timeout := time.Duration(cfg.Webhooks.TimeoutSeconds) * time.Second
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	return &Notifier{
+		cfg:     cfg,
+		client:  &http.Client{Timeout: timeout},
+		workers: workers,
+		logger:  logger,
+	}
+}
+
+// Notify queues an event for delivery; failures are only logged
+func (n *Notifier) Notify(event models.WebhookEvent) {
+	if n == nil || !n.cfg.Webhooks.Enabled || n.cfg.Webhooks.URL == "" {
+		return
+	}
+	event.Timestamp = time.Now()
+
+	n.workers.Submit("webhook "+event.Event, func() error {
+		return n.send(event)
+	})
+}
+
+// send posts the event, signing the body with HMAC-SHA256 if a secret is set
+func (n *Notifier) send(event models.WebhookEvent) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, n.cfg.Webhooks.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	if secret := n.cfg.GetSecrets().WebhookSecret; secret != "" {
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write(body)
+		req.Header.Set("X-Signature-256", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return nil
+}
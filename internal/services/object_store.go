@@ -0,0 +1,226 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"rom-server/internal/config"
+)
+
+// errObjectNotFound is returned for an object the bucket doesn't have
+var errObjectNotFound = errors.New("object not found")
+
+// ObjectStore talks to an S3-compatible bucket using SigV4 presigned URLs,
+// so large uploads go straight from the client to the bucket
+type ObjectStore struct {
+	cfg    config.ObjectStoreConfig
+	root   *config.Config // Source of credentials, which Vault may rotate
+	client *http.Client
+}
+
+// NewObjectStore creates a bucket client, or returns nil when none is configured
+func NewObjectStore(cfg *config.Config) *ObjectStore {
+	if !cfg.ObjectStore.Enabled {
+		return nil
+	}
+	return &ObjectStore{
+		cfg:    cfg.ObjectStore,
+		root:   cfg,
+		client: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// PresignTTL is how long presigned URLs handed to clients stay valid
+func (o *ObjectStore) PresignTTL() time.Duration {
+	if o.cfg.PresignTTLSeconds <= 0 {
+		return time.Hour
+	}
+	return time.Duration(o.cfg.PresignTTLSeconds) * time.Second
+}
+
+// Presign returns a query-authenticated URL for method on key. Any headers
+// passed are signed too, so the client must send them unchanged.
+func (o *ObjectStore) Presign(method, key string, ttl time.Duration, headers map[string]string) (string, error) {
+	return o.presignAt(time.Now().UTC(), method, key, ttl, headers)
+}
+
+// presignAt signs as of a fixed time
+func (o *ObjectStore) presignAt(now time.Time, method, key string, ttl time.Duration, headers map[string]string) (string, error) {
+	endpoint, err := url.Parse(o.cfg.Endpoint)
+	if err != nil || endpoint.Host == "" {
+		return "", fmt.Errorf("invalid object store endpoint %q", o.cfg.Endpoint)
+	}
+
+	host := endpoint.Host
+	path := "/" + s3Escape(key, false)
+	if o.cfg.PathStyle {
+		path = "/" + o.cfg.Bucket + path
+	} else {
+		host = o.cfg.Bucket + "." + host
+	}
+
+	creds := o.root.GetSecrets()
+	amzDate := now.Format("20060102T150405Z")
+	day := now.Format("20060102")
+	scope := day + "/" + o.cfg.Region + "/s3/aws4_request"
+
+	signed := map[string]string{"host": host}
+	for k, v := range headers {
+		signed[strings.ToLower(k)] = strings.TrimSpace(v)
+	}
+	names := make([]string, 0, len(signed))
+	for k := range signed {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, k := range names {
+		canonicalHeaders.WriteString(k + ":" + signed[k] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	query := map[string]string{
+		"X-Amz-Algorithm":     "AWS4-HMAC-SHA256",
+		"X-Amz-Credential":    creds.S3AccessKeyID + "/" + scope,
+		"X-Amz-Date":          amzDate,
+		"X-Amz-Expires":       strconv.Itoa(int(ttl.Seconds())),
+		"X-Amz-SignedHeaders": signedHeaders,
+	}
+	canonicalQuery := s3CanonicalQuery(query)
+
+	canonicalRequest := strings.Join([]string{
+		method,
+		path,
+		canonicalQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		"UNSIGNED-PAYLOAD",
+	}, "\n")
+
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		hex.EncodeToString(requestHash[:]),
+	}, "\n")
+
+	signingKey := hmacSHA256([]byte("AWS4"+creds.S3SecretAccessKey), day)
+	signingKey = hmacSHA256(signingKey, o.cfg.Region)
+	signingKey = hmacSHA256(signingKey, "s3")
+	signingKey = hmacSHA256(signingKey, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(signingKey, stringToSign))
+
+	return fmt.Sprintf("%s://%s%s?%s&X-Amz-Signature=%s", endpoint.Scheme, host, path, canonicalQuery, signature), nil
+}
+
+// Head returns the size of an object
+func (o *ObjectStore) Head(key string) (int64, error) {
+	resp, err := o.do(http.MethodHead, key)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return 0, fmt.Errorf("%s: %w", key, errObjectNotFound)
+	}
+	if resp.StatusCode >= 300 {
+		return 0, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return resp.ContentLength, nil
+}
+
+// Get opens the body of an object; the caller closes it
+func (o *ObjectStore) Get(key string) (io.ReadCloser, error) {
+	resp, err := o.do(http.MethodGet, key)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 300 {
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusNotFound {
+			return nil, fmt.Errorf("%s: %w", key, errObjectNotFound)
+		}
+		return nil, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return resp.Body, nil
+}
+
+// Delete removes an object (deleting a missing object is not an error)
+func (o *ObjectStore) Delete(key string) error {
+	resp, err := o.do(http.MethodDelete, key)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 && resp.StatusCode != http.StatusNotFound {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// do sends a bodyless request through a short-lived presigned URL
+func (o *ObjectStore) do(method, key string) (*http.Response, error) {
+	target, err := o.Presign(method, key, time.Minute, nil)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(method, target, nil)
+	if err != nil {
+		return nil, err
+	}
+	return o.client.Do(req)
+}
+
+// s3CanonicalQuery encodes query parameters sorted by key, as SigV4 requires
+func s3CanonicalQuery(params map[string]string) string {
+	keys := make([]string, 0, len(params))
+	for k := range params {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	parts := make([]string, len(keys))
+	for i, k := range keys {
+		parts[i] = s3Escape(k, true) + "=" + s3Escape(params[k], true)
+	}
+	return strings.Join(parts, "&")
+}
+
+// s3Escape percent-encodes everything except RFC 3986 unreserved characters
+// (and '/' unless encodeSlash is set)
+func s3Escape(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,144 @@
+package services
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"rom-server/internal/models"
+)
+
+// Bounds on a device page
+const (
+	maxPageTitle   = 100
+	maxPageContent = 64 << 10
+)
+
+// pageDevice matches device codenames: lowercase, as on build filenames
+var pageDevice = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,63}$`)
+
+// ValidPageDevice reports whether name can name a device page
+func ValidPageDevice(name string) bool {
+	return pageDevice.MatchString(name)
+}
+
+// PageStore keeps the device pages in a JSON file next to the builds
+type PageStore struct {
+	mu sync.Mutex
+	jsonFile[[]models.Page]
+}
+
+// NewPageStore loads the pages file at path (missing file is fine)
+func NewPageStore(path string) (*PageStore, error) {
+	p := &PageStore{jsonFile: jsonFile[[]models.Page]{path: path, name: "pages", perm: 0644}}
+	if err := p.refresh(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Restore replaces the device pages with a file unpacked from a backup
+func (p *PageStore) Restore(src string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.restore(src)
+}
+
+// save writes the pages sorted by device; caller holds p.mu
+func (p *PageStore) save(pages []models.Page) error {
+	sort.Slice(pages, func(i, j int) bool { return pages[i].Device < pages[j].Device })
+	return p.jsonFile.save(pages)
+}
+
+// List returns every page by device
+func (p *PageStore) List() ([]models.Page, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if err := p.refresh(); err != nil {
+		return nil, err
+	}
+	return append([]models.Page{}, p.data...), nil
+}
+
+// Get returns the page of a device
+func (p *PageStore) Get(device string) (models.Page, error) {
+	pages, err := p.List()
+	if err != nil {
+		return models.Page{}, err
+	}
+	for _, page := range pages {
+		if page.Device == device {
+			return page, nil
+		}
+	}
+	return models.Page{}, ErrNotFound
+}
+
+// Save creates or replaces the page of a device. created is true when the
+// device had no page before.
+func (p *PageStore) Save(device string, req models.PageRequest) (page models.Page, created bool, err error) {
+	if !ValidPageDevice(device) {
+		return page, false, &InvalidField{Field: "device", Message: "must be a lowercase codename (letters, digits, - and _)"}
+	}
+	page = models.Page{
+		Device:    device,
+		Title:     strings.TrimSpace(req.Title),
+		Content:   strings.TrimSpace(req.Content),
+		UpdatedAt: time.Now().UTC().Format(time.RFC3339),
+	}
+	if page.Title == "" {
+		page.Title = device
+	}
+	if utf8.RuneCountInString(page.Title) > maxPageTitle || !utf8.ValidString(page.Title) {
+		return page, false, &InvalidField{Field: "title", Message: fmt.Sprintf("must be at most %d characters", maxPageTitle)}
+	}
+	if page.Content == "" {
+		return page, false, &InvalidField{Field: "content", Message: "is required"}
+	}
+	if len(page.Content) > maxPageContent || !utf8.ValidString(page.Content) {
+		return page, false, &InvalidField{Field: "content", Message: fmt.Sprintf("must be valid UTF-8 of at most %d KiB", maxPageContent>>10)}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if err := p.refresh(); err != nil {
+		return page, false, err
+	}
+	pages := append([]models.Page{}, p.data...)
+	created = true
+	for i := range pages {
+		if pages[i].Device == device {
+			pages[i], created = page, false
+		}
+	}
+	if created {
+		pages = append(pages, page)
+	}
+	return page, created, p.save(pages)
+}
+
+// Delete removes the page of a device
+func (p *PageStore) Delete(device string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if err := p.refresh(); err != nil {
+		return err
+	}
+	pages := make([]models.Page, 0, len(p.data))
+	for _, page := range p.data {
+		if page.Device != device {
+			pages = append(pages, page)
+		}
+	}
+	if len(pages) == len(p.data) {
+		return ErrNotFound
+	}
+	return p.save(pages)
+}
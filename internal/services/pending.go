@@ -0,0 +1,264 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"rom-server/internal/models"
+)
+
+// pendingDir holds uploads that aren't public yet: staged ones waiting for
+// an explicit publish and scheduled ones waiting for their time. It lives in
+// the upload dir (so publishing is a rename) but outside every category, so
+// neither /downloads, /list nor the rsync module can reach it.
+const pendingDir = ".pending"
+
+// pendingKey is the metadata key of a held upload
+func pendingKey(category, filename string) string {
+	return filepath.Join(pendingDir, category, filename)
+}
+
+// ParsePublishAt reads a publish time given as RFC 3339 or Unix seconds
+func ParsePublishAt(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if secs, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(secs, 0), nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, &InvalidField{Field: "publish_at", Message: fmt.Sprintf("%q must be RFC 3339 (2024-06-01T18:00:00Z) or Unix seconds", value)}
+	}
+	return t, nil
+}
+
+// hold parks a finished upload until it is published; caller holds s.mu.
+// A held upload under the same name is replaced.
+func (s *FileService) hold(category, filename, srcPath string, upload models.FileMetadata) error {
+	key := pendingKey(category, filename)
+	heldPath := filepath.Join(s.cfg.Storage.UploadDir, key)
+	if err := os.MkdirAll(filepath.Dir(heldPath), 0755); err != nil {
+		return fmt.Errorf("failed to create pending directory: %w", err)
+	}
+	if err := os.Rename(srcPath, heldPath); err != nil {
+		if copyErr := s.manualMove(srcPath, heldPath); copyErr != nil {
+			return fmt.Errorf("failed to save file: %w", copyErr)
+		}
+	}
+	token, err := newPreviewToken()
+	if err != nil {
+		return err
+	}
+	upload.Preview = token
+	return s.meta.Update(key, func(m *models.FileMetadata) { *m = upload })
+}
+
+// newPreviewToken returns a random 128-bit token, hex encoded
+func newPreviewToken() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// pendingInfo describes a held upload; false if its file is gone
+func (s *FileService) pendingInfo(key string, meta models.FileMetadata) (models.PendingFile, bool) {
+	category, filename, ok := splitPendingKey(key)
+	if !ok {
+		return models.PendingFile{}, false
+	}
+	info, err := os.Stat(filepath.Join(s.cfg.Storage.UploadDir, key))
+	if err != nil {
+		return models.PendingFile{}, false
+	}
+	f := models.PendingFile{
+		Category:    category,
+		Filename:    filename,
+		Size:        formatSize(info.Size()),
+		SizeBytes:   info.Size(),
+		SHA256:      meta.SHA256,
+		Uploader:    meta.Uploader,
+		PreviewURL:  "/preview/" + meta.Preview + "/" + url.PathEscape(filename),
+		Transaction: meta.Transaction,
+	}
+	if meta.PublishAt > 0 {
+		f.PublishAt = time.Unix(meta.PublishAt, 0).UTC().Format(time.RFC3339)
+	}
+	return f, true
+}
+
+// PendingFile describes one held upload
+func (s *FileService) PendingFile(category, filename string) (models.PendingFile, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	key := pendingKey(category, filepath.Base(filename))
+	meta, ok := s.meta.Get(key)
+	if !ok {
+		return models.PendingFile{}, false
+	}
+	return s.pendingInfo(key, meta)
+}
+
+// PreviewPath resolves a preview token to the held file, as long as the
+// filename matches the one it was uploaded under
+func (s *FileService) PreviewPath(token, filename string) (string, bool) {
+	if token == "" {
+		return "", false
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for key, meta := range s.meta.All() {
+		_, name, ok := splitPendingKey(key)
+		if ok && name == filename && subtle.ConstantTimeCompare([]byte(meta.Preview), []byte(token)) == 1 {
+			return filepath.Join(s.cfg.Storage.UploadDir, key), true
+		}
+	}
+	return "", false
+}
+
+// PendingFiles lists held uploads, soonest publish time first
+func (s *FileService) PendingFiles() []models.PendingFile {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	files := []models.PendingFile{}
+	for key, meta := range s.meta.All() {
+		if f, ok := s.pendingInfo(key, meta); ok {
+			files = append(files, f)
+		}
+	}
+
+	// RFC 3339 in UTC sorts chronologically; staged uploads go last
+	sort.Slice(files, func(i, j int) bool {
+		a, b := files[i], files[j]
+		if (a.PublishAt == "") != (b.PublishAt == "") {
+			return b.PublishAt == ""
+		}
+		if a.PublishAt != b.PublishAt {
+			return a.PublishAt < b.PublishAt
+		}
+		return a.Category+"/"+a.Filename < b.Category+"/"+b.Filename
+	})
+	return files
+}
+
+// splitPendingKey returns the category and filename of a pending metadata key
+func splitPendingKey(key string) (string, string, bool) {
+	rest, ok := strings.CutPrefix(key, pendingDir+string(filepath.Separator))
+	if !ok {
+		return "", "", false
+	}
+	category, filename := filepath.Split(rest)
+	category = strings.TrimSuffix(category, string(filepath.Separator))
+	return category, filename, category != "" && filename != ""
+}
+
+// PublishPending makes a held upload public now, replacing any live file of
+// the same name. One held in a transaction answers ErrInTransaction.
+func (s *FileService) PublishPending(category, filename string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.publishPending(category, filepath.Base(filename))
+}
+
+// publishPending is PublishPending for callers already holding s.mu
+func (s *FileService) publishPending(category, filename string) error {
+	key := pendingKey(category, filename)
+	upload, ok := s.meta.Get(key)
+	heldPath := filepath.Join(s.cfg.Storage.UploadDir, key)
+	if _, err := os.Stat(heldPath); err != nil || !ok {
+		return ErrNotFound
+	}
+	if upload.Transaction != "" {
+		return fmt.Errorf("%w %s", ErrInTransaction, upload.Transaction)
+	}
+	if !s.cfg.IsValidCategory(category) {
+		return invalid(fmt.Errorf("category %s is no longer enabled", category))
+	}
+
+	// The listing dates builds by mtime; show when it went public, not when it was queued
+	now := time.Now()
+	if err := os.Chtimes(heldPath, now, now); err != nil {
+		return err
+	}
+
+	upload.PublishAt, upload.Preview = 0, ""
+	if err := s.install(category, filename, heldPath, upload); err != nil {
+		return err
+	}
+	return s.meta.Delete(key)
+}
+
+// PublishDue publishes every held upload whose publish time has passed and
+// returns how many went live. A transaction goes live as a whole once the
+// latest publish time among its uploads has passed.
+func (s *FileService) PublishDue() (int, error) {
+	now := time.Now().Unix()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var published int
+	var errs []error
+	transactions := make(map[string]int64)
+	for key, meta := range s.meta.All() {
+		category, filename, ok := splitPendingKey(key)
+		if !ok {
+			continue
+		}
+		if meta.Transaction != "" {
+			transactions[meta.Transaction] = max(transactions[meta.Transaction], meta.PublishAt)
+			continue
+		}
+		if meta.PublishAt == 0 || meta.PublishAt > now {
+			continue
+		}
+		if err := s.publishPending(category, filename); err != nil {
+			errs = append(errs, fmt.Errorf("%s/%s: %w", category, filename, err))
+			continue
+		}
+		published++
+	}
+	for name, publishAt := range transactions {
+		if publishAt == 0 || publishAt > now {
+			continue
+		}
+		files, err := s.publishTransaction(name)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("transaction %s: %w", name, err))
+			continue
+		}
+		published += len(files)
+	}
+	return published, errors.Join(errs...)
+}
+
+// CancelPending discards a held upload
+func (s *FileService) CancelPending(category, filename string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := pendingKey(category, filepath.Base(filename))
+	if err := os.Remove(filepath.Join(s.cfg.Storage.UploadDir, key)); err != nil {
+		if os.IsNotExist(err) {
+			return ErrNotFound
+		}
+		return err
+	}
+	return s.meta.Delete(key)
+}
@@ -0,0 +1,22 @@
+//go:build linux
+
+package services
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// preallocate reserves disk blocks for the whole file up front so large
+// uploads are laid out contiguously and a full disk is detected immediately
+func preallocate(f *os.File, size int64) error {
+	err := syscall.Fallocate(int(f.Fd()), 0, 0, size)
+	if errors.Is(err, syscall.ENOSPC) {
+		return ErrInsufficientSpace
+	}
+	if errors.Is(err, syscall.EOPNOTSUPP) || errors.Is(err, syscall.ENOSYS) {
+		return nil // Filesystem can't preallocate; fall back to normal writes
+	}
+	return err
+}
@@ -0,0 +1,140 @@
+package services
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"rom-server/internal/models"
+)
+
+// previousDir keeps the build a keep_previous upload replaced, until the
+// new build has been downloaded in full once, verified by an imported
+// manifest or confirmed by a maintainer.
+// Like pendingDir it lives in the upload dir but outside every category,
+// so it is never listed or served.
+const previousDir = ".previous"
+
+// previousKey is the metadata key of a kept previous build
+func previousKey(category, filename string) string {
+	return filepath.Join(previousDir, category, filename)
+}
+
+// keepPrevious sets the live build aside before an upload replaces it;
+// caller holds s.mu. A build that never proved good isn't worth falling
+// back to, so while an earlier fallback is still held it stays.
+func (s *FileService) keepPrevious(category, filename string) error {
+	key := filepath.Join(category, filename)
+	prevKey := previousKey(category, filename)
+	if _, held := s.meta.Get(prevKey); held {
+		return nil
+	}
+	livePath := filepath.Join(s.cfg.Storage.UploadDir, key)
+	if _, err := os.Stat(livePath); err != nil {
+		return nil // Nothing on disk to keep (new name, or a bucket build)
+	}
+
+	prevPath := filepath.Join(s.cfg.Storage.UploadDir, prevKey)
+	if err := os.MkdirAll(filepath.Dir(prevPath), 0755); err != nil {
+		return fmt.Errorf("failed to create previous build directory: %w", err)
+	}
+	os.Remove(prevPath) // Left behind without a record
+	// A hard link costs no space or time; the rename that follows replaces
+	// only the live name
+	if err := os.Link(livePath, prevPath); err != nil {
+		if err := copyFile(livePath, prevPath); err != nil {
+			return fmt.Errorf("failed to keep previous build: %w", err)
+		}
+	}
+
+	meta, _ := s.meta.Get(key)
+	meta.ShortCode, meta.Preview, meta.PublishAt, meta.KeepPrevious = "", "", 0, false
+	return s.meta.Update(prevKey, func(m *models.FileMetadata) { *m = meta })
+}
+
+// copyFile copies source to dest through a temp file in dest's directory
+func copyFile(source, dest string) error {
+	in, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.CreateTemp(filepath.Dir(dest), "."+filepath.Base(dest)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(out.Name()) // No-op once renamed
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	return os.Rename(out.Name(), dest)
+}
+
+// dropPrevious deletes the kept previous build of a file, if any; caller
+// holds s.mu
+func (s *FileService) dropPrevious(category, filename string) error {
+	prevKey := previousKey(category, filename)
+	if _, held := s.meta.Get(prevKey); !held {
+		return nil
+	}
+	if err := os.Remove(filepath.Join(s.cfg.Storage.UploadDir, prevKey)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return s.meta.Delete(prevKey)
+}
+
+// HasPrevious reports whether a build still has its previous one kept
+func (s *FileService) HasPrevious(category, filename string) bool {
+	_, held := s.meta.Get(previousKey(category, filepath.Base(filename)))
+	return held
+}
+
+// ConfirmBuild marks a build as good, after a complete download or a
+// maintainer's check, and lets go of the previous build kept for it.
+// ErrNotFound means none was kept.
+func (s *FileService) ConfirmBuild(category, filename string) error {
+	if !s.HasPrevious(category, filename) {
+		return ErrNotFound // The common case, answered without the lock
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.dropPrevious(category, filepath.Base(filename))
+}
+
+// RestorePrevious puts the kept previous build back in place of the one
+// that replaced it, which is deleted. Its short link stays with the name.
+func (s *FileService) RestorePrevious(category, filename string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	filename = filepath.Base(filename)
+	key := filepath.Join(category, filename)
+	prevKey := previousKey(category, filename)
+	previous, held := s.meta.Get(prevKey)
+	prevPath := filepath.Join(s.cfg.Storage.UploadDir, prevKey)
+	if _, err := os.Stat(prevPath); err != nil || !held {
+		return ErrNotFound
+	}
+
+	current, _ := s.meta.Get(key)
+	if err := os.Rename(prevPath, filepath.Join(s.cfg.Storage.UploadDir, key)); err != nil {
+		return fmt.Errorf("failed to restore previous build: %w", err)
+	}
+	if current.ObjectKey != "" {
+		s.removeObject(current.ObjectKey)
+	}
+	previous.ShortCode = current.ShortCode
+	if err := s.meta.Update(key, func(m *models.FileMetadata) { *m = previous }); err != nil {
+		return err
+	}
+	s.invalidateListing(category)
+	s.statCache.Invalidate(key)
+	s.cdn.Purge(category, filename)
+	go s.bumpGeneration()
+	return s.meta.Delete(prevKey)
+}
@@ -0,0 +1,373 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"rom-server/internal/models"
+)
+
+// quarantineDir holds uploads set aside for review, each as <id> next to
+// its record in <id>.json. Like pendingDir it lives in the upload dir but
+// outside every category, so it is never listed or served.
+const quarantineDir = ".quarantine"
+
+// Reasons an upload is quarantined
+const (
+	QuarantineInvalid   = "invalid"   // Failed the ZIP, image or APK checks
+	QuarantineMalware   = "malware"   // Flagged by quarantine.scan_command
+	QuarantineBlocklist = "blocklist" // SHA-256 is in quarantine.blocklist_file
+)
+
+// ErrQuarantined means an upload was set aside instead of published; the
+// error is a *QuarantineError with its record
+var ErrQuarantined = errors.New("upload quarantined")
+
+// ErrScanFailed means an upload couldn't be screened (the scanner failed
+// or the blocklist is unreadable), so it was refused
+var ErrScanFailed = errors.New("upload could not be screened")
+
+// quarantineID matches the IDs handed out by quarantine
+var quarantineID = regexp.MustCompile(`^[0-9a-f]{16}$`)
+
+// maxScanOutput bounds the scanner output kept as a quarantine reason
+const maxScanOutput = 200
+
+// QuarantineError is returned for an upload that went to quarantine
+type QuarantineError struct {
+	File models.QuarantinedFile
+}
+
+func (e *QuarantineError) Error() string {
+	return fmt.Sprintf("%v as %s (%s: %s)", ErrQuarantined, e.File.ID, e.File.Reason, e.File.Details)
+}
+
+func (e *QuarantineError) Unwrap() error {
+	return ErrQuarantined
+}
+
+// hashBlocklist is quarantine.blocklist_file, re-read when it changes on disk
+type hashBlocklist struct {
+	mu      sync.Mutex
+	path    string
+	modTime time.Time
+	hashes  map[string]bool
+}
+
+// contains reports whether a SHA-256 is on the blocklist
+func (b *hashBlocklist) contains(sum string) (bool, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	info, err := os.Stat(b.path)
+	if err != nil {
+		return false, fmt.Errorf("%w: blocklist: %v", ErrScanFailed, err)
+	}
+	if !info.ModTime().Equal(b.modTime) {
+		data, err := os.ReadFile(b.path)
+		if err != nil {
+			return false, fmt.Errorf("%w: blocklist: %v", ErrScanFailed, err)
+		}
+		b.hashes, b.modTime = parseBlocklist(data), info.ModTime()
+	}
+	return b.hashes[strings.ToLower(sum)], nil
+}
+
+// parseBlocklist reads one SHA-256 per line, optionally followed by a file
+// name as sha256sum prints it. Blank lines, # comments and anything that
+// isn't a hash are skipped.
+func parseBlocklist(data []byte) map[string]bool {
+	hashes := make(map[string]bool)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		if sum := strings.ToLower(fields[0]); blocklistHash.MatchString(sum) {
+			hashes[sum] = true
+		}
+	}
+	return hashes
+}
+
+// blocklistHash matches a hex encoded SHA-256
+var blocklistHash = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// screen checks a finished upload against the blocklist and the virus
+// scanner, returning why it must be quarantined ("" if it passed)
+func (s *FileService) screen(path, sum string) (reason, details string, err error) {
+	if s.blocklist != nil {
+		blocked, err := s.blocklist.contains(sum)
+		if err != nil {
+			return "", "", err
+		}
+		if blocked {
+			return QuarantineBlocklist, "SHA-256 " + sum + " is on the blocklist", nil
+		}
+	}
+	command := s.cfg.Quarantine.ScanCommand
+	if len(command) == 0 {
+		return "", "", nil
+	}
+
+	timeout := time.Duration(s.cfg.Quarantine.ScanTimeoutSeconds) * time.Second
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	args := append(append([]string(nil), command[1:]...), path)
+	out, err := exec.CommandContext(ctx, command[0], args...).CombinedOutput()
+	output := scanOutput(out, path)
+
+	var exit *exec.ExitError
+	switch {
+	case err == nil:
+		return "", "", nil
+	case ctx.Err() != nil:
+		return "", "", fmt.Errorf("%w: scanner timed out after %s", ErrScanFailed, timeout)
+	case errors.As(err, &exit) && exit.ExitCode() == 1:
+		if output == "" {
+			output = "flagged by the virus scanner"
+		}
+		return QuarantineMalware, output, nil
+	default:
+		return "", "", fmt.Errorf("%w: scanner: %v %s", ErrScanFailed, err, output)
+	}
+}
+
+// scanOutput picks the first line the scanner printed, without the temp
+// path it was given (clamdscan prints "<path>: <signature> FOUND")
+func scanOutput(out []byte, path string) string {
+	line, _, _ := strings.Cut(strings.TrimSpace(string(out)), "\n")
+	line = strings.TrimSpace(strings.TrimPrefix(line, path+":"))
+	if len(line) > maxScanOutput {
+		line = line[:maxScanOutput]
+	}
+	return line
+}
+
+// QuarantineUpload sets aside an upload that failed a check before it got
+// to SaveUpload, e.g. a ZIP without a central directory
+func (s *FileService) QuarantineUpload(category, filename string, r io.Reader, uploader, reason, details string) (models.QuarantinedFile, error) {
+	tempDir := filepath.Join(s.cfg.Storage.UploadDir, s.cfg.Storage.TempDir)
+	f, err := os.CreateTemp(tempDir, "quarantine-*.tmp")
+	if err != nil {
+		return models.QuarantinedFile{}, fmt.Errorf("failed to create temp file: %w", err)
+	}
+	defer os.Remove(f.Name()) // No-op once moved
+
+	sha := sha256.New()
+	size, err := io.Copy(io.MultiWriter(f, sha), r)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return models.QuarantinedFile{}, fmt.Errorf("failed to write file: %w", err)
+	}
+	return s.quarantine(category, filename, f.Name(), size, hex.EncodeToString(sha.Sum(nil)), uploader, reason, details)
+}
+
+// quarantine moves the file at srcPath into quarantine, records why and
+// sends an upload.quarantined webhook
+func (s *FileService) quarantine(category, filename, srcPath string, size int64, sum, uploader, reason, details string) (models.QuarantinedFile, error) {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		return models.QuarantinedFile{}, err
+	}
+	item := models.QuarantinedFile{
+		ID:            hex.EncodeToString(buf),
+		Category:      category,
+		Filename:      filename,
+		Size:          FormatSize(size),
+		SizeBytes:     size,
+		SHA256:        sum,
+		Uploader:      uploader,
+		Reason:        reason,
+		Details:       details,
+		QuarantinedAt: time.Now().UTC(),
+	}
+
+	s.quarantineMu.Lock()
+	defer s.quarantineMu.Unlock()
+
+	dir := filepath.Join(s.cfg.Storage.UploadDir, quarantineDir)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return item, fmt.Errorf("failed to create quarantine directory: %w", err)
+	}
+	path := filepath.Join(dir, item.ID)
+	if err := os.Rename(srcPath, path); err != nil {
+		if copyErr := s.manualMove(srcPath, path); copyErr != nil {
+			return item, fmt.Errorf("failed to quarantine file: %w", copyErr)
+		}
+	}
+	data, err := json.MarshalIndent(item, "", "  ")
+	if err == nil {
+		err = os.WriteFile(path+".json", data, 0600)
+	}
+	if err != nil {
+		os.Remove(path)
+		return item, fmt.Errorf("failed to record quarantined file: %w", err)
+	}
+
+	s.notifier.Notify(models.WebhookEvent{
+		Event:    "upload.quarantined",
+		Text:     fmt.Sprintf("%s/%s was quarantined (%s): %s", category, filename, reason, details),
+		Category: category,
+		Filename: filename,
+	})
+	return item, nil
+}
+
+// ListQuarantine returns the quarantined uploads, newest first
+func (s *FileService) ListQuarantine() ([]models.QuarantinedFile, error) {
+	s.quarantineMu.Lock()
+	defer s.quarantineMu.Unlock()
+
+	dir := filepath.Join(s.cfg.Storage.UploadDir, quarantineDir)
+	entries, err := os.ReadDir(dir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	items := []models.QuarantinedFile{}
+	for _, e := range entries {
+		id, ok := strings.CutSuffix(e.Name(), ".json")
+		if !ok || !quarantineID.MatchString(id) {
+			continue
+		}
+		item, err := s.quarantineRecord(id)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].QuarantinedAt.After(items[j].QuarantinedAt)
+	})
+	return items, nil
+}
+
+// QuarantinedFile returns a quarantined upload and the path of its file
+func (s *FileService) QuarantinedFile(id string) (models.QuarantinedFile, string, error) {
+	s.quarantineMu.Lock()
+	defer s.quarantineMu.Unlock()
+	item, err := s.quarantineRecord(id)
+	return item, filepath.Join(s.cfg.Storage.UploadDir, quarantineDir, id), err
+}
+
+// quarantineRecord reads the record of a quarantined upload; caller holds
+// s.quarantineMu
+func (s *FileService) quarantineRecord(id string) (models.QuarantinedFile, error) {
+	var item models.QuarantinedFile
+	if !quarantineID.MatchString(id) {
+		return item, ErrNotFound
+	}
+	data, err := os.ReadFile(filepath.Join(s.cfg.Storage.UploadDir, quarantineDir, id+".json"))
+	if os.IsNotExist(err) {
+		return item, ErrNotFound
+	}
+	if err != nil {
+		return item, err
+	}
+	if err := json.Unmarshal(data, &item); err != nil {
+		return item, fmt.Errorf("failed to parse quarantine record %s: %w", id, err)
+	}
+	return item, nil
+}
+
+// ReleaseQuarantined publishes a quarantined upload under its original
+// name, skipping the checks that held it, and removes it from quarantine
+func (s *FileService) ReleaseQuarantined(id string) (models.QuarantinedFile, error) {
+	s.quarantineMu.Lock()
+	defer s.quarantineMu.Unlock()
+
+	item, err := s.quarantineRecord(id)
+	if err != nil {
+		return item, err
+	}
+	if !s.cfg.IsValidCategory(item.Category) {
+		return item, fmt.Errorf("category %s is no longer enabled", item.Category)
+	}
+	path := filepath.Join(s.cfg.Storage.UploadDir, quarantineDir, id)
+	f, err := os.Open(path)
+	if err != nil {
+		return item, err
+	}
+	defer f.Close()
+
+	if _, err := s.SaveUpload(item.Category, item.Filename, f, item.SizeBytes, UploadOptions{
+		ExpectedSHA256: item.SHA256,
+		Uploader:       item.Uploader,
+		Released:       true,
+	}); err != nil {
+		return item, err
+	}
+	return item, s.removeQuarantined(id)
+}
+
+// PurgeQuarantined deletes a quarantined upload for good
+func (s *FileService) PurgeQuarantined(id string) (models.QuarantinedFile, error) {
+	s.quarantineMu.Lock()
+	defer s.quarantineMu.Unlock()
+
+	item, err := s.quarantineRecord(id)
+	if err != nil {
+		return item, err
+	}
+	return item, s.removeQuarantined(id)
+}
+
+// PurgeExpiredQuarantine deletes uploads quarantined longer than
+// quarantine.retention_days ago and returns how many
+func (s *FileService) PurgeExpiredQuarantine() (int, error) {
+	days := s.cfg.Quarantine.RetentionDays
+	if days <= 0 {
+		return 0, nil
+	}
+	items, err := s.ListQuarantine()
+	if err != nil {
+		return 0, err
+	}
+
+	s.quarantineMu.Lock()
+	defer s.quarantineMu.Unlock()
+	cutoff := time.Now().AddDate(0, 0, -days)
+	purged := 0
+	for _, item := range items {
+		if item.QuarantinedAt.After(cutoff) {
+			continue
+		}
+		if err := s.removeQuarantined(item.ID); err != nil {
+			return purged, err
+		}
+		purged++
+	}
+	return purged, nil
+}
+
+// removeQuarantined deletes a quarantined file and its record; caller
+// holds s.quarantineMu
+func (s *FileService) removeQuarantined(id string) error {
+	path := filepath.Join(s.cfg.Storage.UploadDir, quarantineDir, id)
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := os.Remove(path + ".json"); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,188 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"path/filepath"
+	"sync"
+
+	"rom-server/internal/models"
+)
+
+// RatingVotes are the votes a user can cast on a build
+var RatingVotes = []string{"up", "down"}
+
+// buildRatings holds the votes on one build, by voter
+type buildRatings struct {
+	SHA256 string            `json:"sha256,omitempty"` // Build the votes were cast on
+	Votes  map[string]string `json:"votes"`
+}
+
+// ratingsFile is the on-disk form of the ratings
+type ratingsFile struct {
+	Secret string                   `json:"secret"`
+	Builds map[string]*buildRatings `json:"builds"` // By category/filename
+}
+
+// RatingStore keeps thumbs up/down votes on builds in a JSON file. Voters
+// are known only by a keyed hash of their address, so each gets one vote
+// per build (which they can change) without any address being stored.
+// Votes on an earlier upload under the same name are dropped when the
+// build is replaced.
+type RatingStore struct {
+	mu sync.Mutex
+	jsonFile[ratingsFile]
+}
+
+// NewRatingStore loads the ratings file at path (missing file is fine)
+func NewRatingStore(path string) (*RatingStore, error) {
+	s := &RatingStore{jsonFile: jsonFile[ratingsFile]{path: path, name: "ratings", perm: 0600}} // Holds the secret voters are hashed with
+	if err := s.refresh(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Restore replaces the ratings with a file unpacked from a backup
+func (s *RatingStore) Restore(src string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.restore(src)
+}
+
+// refresh reloads the file if another writer changed it and makes sure
+// there is a secret; caller holds s.mu (or owns s exclusively)
+func (s *RatingStore) refresh() error {
+	if err := s.jsonFile.refresh(); err != nil {
+		return err
+	}
+	if s.data.Builds == nil {
+		s.data.Builds = make(map[string]*buildRatings)
+	}
+	if s.data.Secret == "" {
+		buf := make([]byte, 32)
+		if _, err := rand.Read(buf); err != nil {
+			return err
+		}
+		s.data.Secret = hex.EncodeToString(buf)
+		return s.save()
+	}
+	return nil
+}
+
+// save writes the ratings; caller holds s.mu
+func (s *RatingStore) save() error {
+	return s.jsonFile.save(s.data)
+}
+
+// Voter returns the hash a client address votes and is rate limited under
+func (s *RatingStore) Voter(addr string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.refresh(); err != nil {
+		return "", err
+	}
+	return s.voter(addr), nil
+}
+
+// voter hashes an address with the secret; caller holds s.mu
+func (s *RatingStore) voter(addr string) string {
+	mac := hmac.New(sha256.New, []byte(s.data.Secret))
+	mac.Write([]byte(addr))
+	return hex.EncodeToString(mac.Sum(nil))[:16]
+}
+
+// Vote records a voter's vote on a build, replacing any earlier one, and
+// returns the new tally
+func (s *RatingStore) Vote(category, filename, sha256, voter, vote string) (models.Rating, error) {
+	known := false
+	for _, v := range RatingVotes {
+		known = known || vote == v
+	}
+	if !known {
+		return models.Rating{}, &InvalidField{Field: "vote", Message: "must be up or down"}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.refresh(); err != nil {
+		return models.Rating{}, err
+	}
+	key := filepath.Join(category, filename)
+	build := s.data.Builds[key]
+	if build == nil || build.SHA256 != sha256 {
+		build = &buildRatings{SHA256: sha256, Votes: make(map[string]string)}
+		s.data.Builds[key] = build
+	}
+	build.Votes[voter] = vote
+	return build.tally(), s.save()
+}
+
+// Fill sets the rating of every build in files that has votes. Votes cast
+// on an earlier upload under the same name don't count. A nil store or an
+// unreadable file fills in nothing.
+func (s *RatingStore) Fill(files []models.FileInfo) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.refresh(); err != nil {
+		return
+	}
+	for i, f := range files {
+		build := s.data.Builds[filepath.Join(f.Category, f.Filename)]
+		if build == nil || len(build.Votes) == 0 || (build.SHA256 != "" && f.SHA256 != "" && build.SHA256 != f.SHA256) {
+			continue
+		}
+		rating := build.tally()
+		files[i].Rating = &rating
+	}
+}
+
+// Purge removes the votes of one client, found by hashing each address or
+// pseudonym searched for, and returns how many there were. A nil store
+// purges nothing.
+func (s *RatingStore) Purge(m AddressMatcher) (int, error) {
+	if s == nil {
+		return 0, nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.refresh(); err != nil {
+		return 0, err
+	}
+	purged := 0
+	for _, subject := range m.Subjects() {
+		voter := s.voter(subject)
+		for _, build := range s.data.Builds {
+			if _, ok := build.Votes[voter]; ok {
+				delete(build.Votes, voter)
+				purged++
+			}
+		}
+	}
+	if purged == 0 {
+		return 0, nil
+	}
+	return purged, s.save()
+}
+
+// tally counts the votes on a build
+func (b *buildRatings) tally() models.Rating {
+	var rating models.Rating
+	for _, vote := range b.Votes {
+		if vote == "up" {
+			rating.Up++
+		} else {
+			rating.Down++
+		}
+	}
+	return rating
+}
@@ -0,0 +1,89 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"rom-server/internal/models"
+)
+
+// MaxReleaseInfoSize caps the metadata part of an upload
+const MaxReleaseInfoSize = 64 << 10
+
+const maxMaintainerLen = 128
+
+// maxRequirementLen bounds the firmware and recovery requirements
+const maxRequirementLen = 64
+
+// androidVersion matches "14", "13.0", "12.1.0"
+var androidVersion = regexp.MustCompile(`^[0-9]{1,3}(\.[0-9]{1,3}){0,2}$`)
+
+// buildTypes are the Android build variants
+var buildTypes = map[string]bool{"user": true, "userdebug": true, "eng": true}
+
+// ParseReleaseInfo decodes and validates release metadata. Unknown fields
+// are rejected so typos don't silently drop information.
+func ParseReleaseInfo(data []byte) (*models.ReleaseInfo, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+
+	var info models.ReleaseInfo
+	if err := dec.Decode(&info); err != nil {
+		return nil, fmt.Errorf("invalid release metadata: %w", err)
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, fmt.Errorf("invalid release metadata: trailing data after object")
+	}
+
+	info.Maintainer = strings.TrimSpace(info.Maintainer)
+	info.AndroidVersion = strings.TrimSpace(info.AndroidVersion)
+	info.BuildType = strings.ToLower(strings.TrimSpace(info.BuildType))
+	info.SecurityPatch = strings.TrimSpace(info.SecurityPatch)
+	info.RequiredFirmware = strings.TrimSpace(info.RequiredFirmware)
+	info.RequiredRecovery = strings.TrimSpace(info.RequiredRecovery)
+
+	if utf8.RuneCountInString(info.Maintainer) > maxMaintainerLen {
+		return nil, fmt.Errorf("maintainer is longer than %d characters", maxMaintainerLen)
+	}
+	if info.AndroidVersion != "" && !androidVersion.MatchString(info.AndroidVersion) {
+		return nil, fmt.Errorf("android_version %q must look like 14 or 13.0", info.AndroidVersion)
+	}
+	if info.BuildType != "" && !buildTypes[info.BuildType] {
+		return nil, fmt.Errorf("build_type %q must be user, userdebug or eng", info.BuildType)
+	}
+	if info.SecurityPatch != "" {
+		if _, err := time.Parse("2006-01-02", info.SecurityPatch); err != nil {
+			return nil, fmt.Errorf("security_patch %q must be a YYYY-MM-DD date", info.SecurityPatch)
+		}
+	}
+	if err := checkRequirement("required_firmware", info.RequiredFirmware); err != nil {
+		return nil, err
+	}
+	if err := checkRequirement("required_recovery", info.RequiredRecovery); err != nil {
+		return nil, err
+	}
+
+	if info == (models.ReleaseInfo{}) {
+		return nil, nil
+	}
+	return &info, nil
+}
+
+// checkRequirement rejects a firmware or recovery requirement that is too
+// long or spans lines, since updaters show it as is
+func checkRequirement(field, value string) error {
+	if utf8.RuneCountInString(value) > maxRequirementLen {
+		return fmt.Errorf("%s is longer than %d characters", field, maxRequirementLen)
+	}
+	if strings.ContainsFunc(value, unicode.IsControl) {
+		return fmt.Errorf("%s must be a single line", field)
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+
+	"rom-server/internal/config"
+)
+
+// RenderRsyncdConf builds an rsyncd.conf with a read-only module exposing
+// only published builds (no stats, metadata, audit log or temp files)
+func RenderRsyncdConf(cfg *config.Config) (string, error) {
+	uploadDir, err := filepath.Abs(cfg.Storage.UploadDir)
+	if err != nil {
+		return "", err
+	}
+
+	module := cfg.Rsync.Module
+	if module == "" {
+		module = "photon"
+	}
+	maxConns := cfg.Rsync.MaxConnections
+	if maxConns <= 0 {
+		maxConns = 10
+	}
+
+	// Categories are sorted so the file only changes when the config does.
+	// rsync has no way to check beta tester tokens, so restricted ones stay out.
+	var names []string
+	for name, cat := range cfg.GetCategories() {
+		if cat.Enabled && !cat.Restricted {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var rules []string
+	for _, name := range names {
+		rules = append(rules, "+ /"+name+"/")
+		for _, ext := range cfg.AllowedExtsFor(name) {
+			rules = append(rules, "+ /"+name+"/*"+ext)
+		}
+	}
+	rules = append(rules, "- *")
+
+	var b strings.Builder
+	b.WriteString("# Generated by photon-serve from its config; edits will be overwritten\n")
+	b.WriteString("use chroot = no\n")
+	fmt.Fprintf(&b, "max connections = %d\n", maxConns)
+	if cfg.Rsync.Port > 0 {
+		fmt.Fprintf(&b, "port = %d\n", cfg.Rsync.Port)
+	}
+	b.WriteString("\n")
+	fmt.Fprintf(&b, "[%s]\n", module)
+	fmt.Fprintf(&b, "    path = %s\n", uploadDir)
+	b.WriteString("    comment = photon-serve published builds\n")
+	b.WriteString("    read only = yes\n")
+	b.WriteString("    list = yes\n")
+	if len(cfg.Rsync.HostsAllow) > 0 {
+		fmt.Fprintf(&b, "    hosts allow = %s\n", strings.Join(cfg.Rsync.HostsAllow, " "))
+	}
+	fmt.Fprintf(&b, "    filter = %s\n", strings.Join(rules, " "))
+	return b.String(), nil
+}
+
+// WriteRsyncdConf renders the module config to cfg.Rsync.ConfPath
+func WriteRsyncdConf(cfg *config.Config) (string, error) {
+	conf, err := RenderRsyncdConf(cfg)
+	if err != nil {
+		return "", err
+	}
+
+	path := cfg.Rsync.ConfPath
+	if path == "" {
+		path = "rsyncd.conf"
+	}
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, []byte(conf), 0644); err != nil {
+		return "", fmt.Errorf("failed to write rsyncd.conf: %w", err)
+	}
+	return path, os.Rename(tmpPath, path)
+}
+
+// RsyncDaemon is an rsync --daemon child process serving the module
+type RsyncDaemon struct {
+	cmd  *exec.Cmd
+	done chan struct{}
+}
+
+// StartRsyncDaemon launches rsync in daemon mode with the given config file
+func StartRsyncDaemon(confPath string, logger *log.Logger) (*RsyncDaemon, error) {
+	cmd := exec.Command("rsync", "--daemon", "--no-detach", "--config="+confPath)
+	cmd.Stdout = logger.Writer()
+	cmd.Stderr = logger.Writer()
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start rsync daemon: %w", err)
+	}
+
+	d := &RsyncDaemon{cmd: cmd, done: make(chan struct{})}
+	go func() {
+		err := cmd.Wait()
+		close(d.done)
+		if err != nil {
+			logger.Printf("rsync daemon exited: %v", err)
+		}
+	}()
+	return d, nil
+}
+
+// Stop terminates the daemon and waits for it to exit
+func (d *RsyncDaemon) Stop() {
+	if d == nil {
+		return
+	}
+	select {
+	case <-d.done:
+		return
+	default:
+	}
+	_ = d.cmd.Process.Signal(syscall.SIGTERM)
+	<-d.done
+}
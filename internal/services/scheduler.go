@@ -0,0 +1,62 @@
+package services
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// LeaderChecker reports whether this instance should run exclusive jobs
+type LeaderChecker interface {
+	IsLeader() bool
+}
+
+// Scheduler runs periodic maintenance jobs (retention, scrubbing, mirror
+// sync). In cluster mode only the elected leader runs them, so nodes never
+// race each other cleaning up the same storage.
+type Scheduler struct {
+	leader LeaderChecker
+	logger *log.Logger
+	stop   chan struct{}
+	wg     sync.WaitGroup
+}
+
+// NewScheduler creates a scheduler gated by the given leader checker
+func NewScheduler(leader LeaderChecker, logger *log.Logger) *Scheduler {
+	return &Scheduler{
+		leader: leader,
+		logger: logger,
+		stop:   make(chan struct{}),
+	}
+}
+
+// Every runs job at the given interval while this instance is leader
+func (s *Scheduler) Every(name string, interval time.Duration, job func() error) {
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				if !s.leader.IsLeader() {
+					continue
+				}
+				if err := job(); err != nil && s.logger != nil {
+					s.logger.Printf("Job %s failed: %v", name, err)
+				}
+			case <-s.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop halts all jobs and waits for running ones to finish
+func (s *Scheduler) Stop() {
+	close(s.stop)
+	s.wg.Wait()
+}
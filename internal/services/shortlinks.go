@@ -0,0 +1,125 @@
+package services
+
+import (
+	"crypto/rand"
+	"math/big"
+	"net/url"
+	"path/filepath"
+	"strings"
+
+	"rom-server/internal/models"
+)
+
+// shortCodeAlphabet leaves out look-alikes (0/O, 1/l/I) so codes survive
+// being read aloud or retyped from a screenshot
+const shortCodeAlphabet = "23456789abcdefghijkmnopqrstuvwxyzABCDEFGHJKLMNPQRSTUVWXYZ"
+
+// shortCodeLength gives 57^6 (about 34 billion) codes
+const shortCodeLength = 6
+
+// maxReferrerSites bounds the sites counted per file, as the Referer header
+// is up to the client; visits from further sites count as otherReferrer
+const maxReferrerSites = 50
+
+const otherReferrer = "other"
+
+// ShortLinkPath returns the short link path for a code
+func ShortLinkPath(code string) string {
+	return "/d/" + code
+}
+
+// assignShortCode gives the published file at key a short link code unless
+// it has one. A build replaced under the same name keeps its code, so shared
+// links always lead to the current build. Caller holds s.mu.
+func (s *FileService) assignShortCode(key string) {
+	if meta, ok := s.meta.Get(key); ok && meta.ShortCode != "" {
+		return
+	}
+	code, err := s.newShortCode()
+	if err != nil {
+		return // Retried on the next listing rebuild
+	}
+	s.meta.Update(key, func(m *models.FileMetadata) {
+		if m.ShortCode == "" {
+			m.ShortCode = code
+		}
+	})
+}
+
+// newShortCode returns a random code no file uses yet
+func (s *FileService) newShortCode() (string, error) {
+	max := big.NewInt(int64(len(shortCodeAlphabet)))
+	for {
+		var b strings.Builder
+		for i := 0; i < shortCodeLength; i++ {
+			n, err := rand.Int(rand.Reader, max)
+			if err != nil {
+				return "", err
+			}
+			b.WriteByte(shortCodeAlphabet[n.Int64()])
+		}
+		if _, taken := s.meta.FindShortCode(b.String()); !taken {
+			return b.String(), nil
+		}
+	}
+}
+
+// ShortURL returns the short link path of a published file, or "" if it
+// has none yet
+func (s *FileService) ShortURL(category, filename string) string {
+	if meta, ok := s.meta.Get(filepath.Join(category, filename)); ok && meta.ShortCode != "" {
+		return ShortLinkPath(meta.ShortCode)
+	}
+	return ""
+}
+
+// ResolveShortCode returns the published file a short link code points to
+func (s *FileService) ResolveShortCode(code string) (category, filename string, ok bool) {
+	if code == "" {
+		return "", "", false
+	}
+	key, ok := s.meta.FindShortCode(code)
+	if !ok || strings.HasPrefix(key, pendingDir) {
+		return "", "", false
+	}
+	return filepath.Dir(key), filepath.Base(key), true
+}
+
+// RecordShortLinkVisit counts a short link visit by the site it came from
+func (s *FileService) RecordShortLinkVisit(category, filename, referrer string) {
+	key := filepath.Join(category, filename)
+	s.mu.Lock()
+	counts := s.referrers[key]
+	if counts == nil {
+		counts = make(map[string]int64)
+		s.referrers[key] = counts
+	}
+	if _, seen := counts[referrer]; !seen && len(counts) >= maxReferrerSites {
+		referrer = otherReferrer
+	}
+	counts[referrer]++
+	s.mu.Unlock()
+	s.markStatsDirty()
+}
+
+// ReferrerSite reduces a Referer header to the referring host, e.g.
+// "t.me" or "forum.xda-developers.com", or "direct" when there is none
+func ReferrerSite(referer string) string {
+	u, err := url.Parse(referer)
+	if err != nil || u.Hostname() == "" {
+		return "direct"
+	}
+	return strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+}
+
+// copyCounts returns a copy of a counter map, or nil for an empty one
+func copyCounts(m map[string]int64) map[string]int64 {
+	if len(m) == 0 {
+		return nil
+	}
+	out := make(map[string]int64, len(m))
+	for k, v := range m {
+		out[k] = v
+	}
+	return out
+}
@@ -0,0 +1,129 @@
+package services
+
+import (
+	"crypto/rand"
+	"io"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"rom-server/internal/models"
+)
+
+// SpeedTestTraffic is the traffic report key speed test payloads are
+// counted under; the underscore keeps it apart from category names
+const SpeedTestTraffic = "_speedtest"
+
+// SpeedTestPayloads are the test downloads by name, smallest first
+var SpeedTestPayloads = []struct {
+	Name  string
+	Bytes int64
+}{
+	{"1mb", 1 << 20},
+	{"10mb", 10 << 20},
+	{"100mb", 100 << 20},
+}
+
+// SpeedTestSize returns the size of a named payload
+func SpeedTestSize(name string) (int64, bool) {
+	for _, p := range SpeedTestPayloads {
+		if p.Name == name {
+			return p.Bytes, true
+		}
+	}
+	return 0, false
+}
+
+// speedTestBlock is repeated to make up payloads. It is random so that
+// compression along the way can't make a link look faster than it is.
+var speedTestBlock = func() []byte {
+	b := make([]byte, 64<<10)
+	rand.Read(b)
+	return b
+}()
+
+// speedTestData reads as speedTestBlock repeated forever
+type speedTestData struct{}
+
+func (speedTestData) ReadAt(p []byte, off int64) (int, error) {
+	n := 0
+	for n < len(p) {
+		i := (off + int64(n)) % int64(len(speedTestBlock))
+		n += copy(p[n:], speedTestBlock[i:])
+	}
+	return n, nil
+}
+
+// SpeedTestContent returns size bytes of test data. Nothing is stored; it
+// seeks, so payloads can be served with ranges.
+func SpeedTestContent(size int64) io.ReadSeeker {
+	return io.NewSectionReader(speedTestData{}, 0, size)
+}
+
+// maxSpeedTestResults bounds the results kept; older ones are dropped
+const maxSpeedTestResults = 1000
+
+// SpeedTests keeps the most recent client-reported speed test results in
+// memory for the admin summary
+type SpeedTests struct {
+	mu      sync.Mutex
+	results []models.SpeedTestResult // Oldest first
+}
+
+// NewSpeedTests creates an empty result store
+func NewSpeedTests() *SpeedTests {
+	return &SpeedTests{}
+}
+
+// Record stores a result, dropping the oldest once the store is full
+func (t *SpeedTests) Record(result models.SpeedTestResult) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(t.results) >= maxSpeedTestResults {
+		t.results = append(t.results[:0], t.results[1:]...)
+	}
+	t.results = append(t.results, result)
+}
+
+// Summary aggregates the stored results per source, fastest median first
+func (t *SpeedTests) Summary() []models.SpeedTestSummary {
+	t.mu.Lock()
+	bySource := make(map[string][]models.SpeedTestResult)
+	for _, r := range t.results {
+		bySource[r.Source] = append(bySource[r.Source], r)
+	}
+	t.mu.Unlock()
+
+	summaries := make([]models.SpeedTestSummary, 0, len(bySource))
+	for source, results := range bySource {
+		speeds := make([]float64, len(results))
+		for i, r := range results {
+			speeds[i] = r.Mbps
+		}
+		sort.Float64s(speeds)
+		summaries = append(summaries, models.SpeedTestSummary{
+			Source:     source,
+			Tests:      len(results),
+			MedianMbps: percentile(speeds, 0.5),
+			P10Mbps:    percentile(speeds, 0.1),
+			P90Mbps:    percentile(speeds, 0.9),
+			LastAt:     results[len(results)-1].Time,
+		})
+	}
+	sort.Slice(summaries, func(i, j int) bool {
+		return summaries[i].MedianMbps > summaries[j].MedianMbps
+	})
+	return summaries
+}
+
+// percentile picks the p-th (0..1) value of sorted speeds, rounded to 0.1
+func percentile(sorted []float64, p float64) float64 {
+	v := sorted[int(math.Round(p*float64(len(sorted)-1)))]
+	return math.Round(v*10) / 10
+}
+
+// SpeedTestMbps turns a transfer of bytes in d into megabits per second
+func SpeedTestMbps(bytes int64, d time.Duration) float64 {
+	return math.Round(float64(bytes)*8/d.Seconds()/1e5) / 10
+}
@@ -0,0 +1,111 @@
+package services
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// CachedStat is the subset of file information needed to serve a download
+type CachedStat struct {
+	Path    string
+	Size    int64
+	ModTime time.Time
+}
+
+// StatCache is a small LRU of stat results for hot files, so thousands of
+// updater clients hitting the same build don't each cost a stat syscall
+type StatCache struct {
+	mu       sync.Mutex
+	capacity int
+	ttl      time.Duration // Safety net for files changed outside the server
+	order    *list.List    // Front = most recently used
+	items    map[string]*list.Element
+}
+
+type statCacheEntry struct {
+	key     string
+	stat    CachedStat
+	expires time.Time
+}
+
+// NewStatCache creates an LRU holding up to capacity entries
+func NewStatCache(capacity int, ttl time.Duration) *StatCache {
+	return &StatCache{
+		capacity: capacity,
+		ttl:      ttl,
+		order:    list.New(),
+		items:    make(map[string]*list.Element),
+	}
+}
+
+// Get returns a cached stat if present and not expired
+func (c *StatCache) Get(key string) (CachedStat, bool) {
+	if c.capacity <= 0 {
+		return CachedStat{}, false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.items[key]
+	if !ok {
+		return CachedStat{}, false
+	}
+	entry := el.Value.(*statCacheEntry)
+	if time.Now().After(entry.expires) {
+		c.order.Remove(el)
+		delete(c.items, key)
+		return CachedStat{}, false
+	}
+
+	c.order.MoveToFront(el)
+	return entry.stat, true
+}
+
+// Put stores a stat, evicting the least recently used entry when full
+func (c *StatCache) Put(key string, stat CachedStat) {
+	if c.capacity <= 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	expires := time.Now().Add(c.ttl)
+	if el, ok := c.items[key]; ok {
+		entry := el.Value.(*statCacheEntry)
+		entry.stat = stat
+		entry.expires = expires
+		c.order.MoveToFront(el)
+		return
+	}
+
+	c.items[key] = c.order.PushFront(&statCacheEntry{key: key, stat: stat, expires: expires})
+
+	if c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(*statCacheEntry).key)
+	}
+}
+
+// Invalidate drops a single entry (on publish, replace or delete)
+func (c *StatCache) Invalidate(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.items[key]; ok {
+		c.order.Remove(el)
+		delete(c.items, key)
+	}
+}
+
+// Purge drops every entry (e.g. when another instance changed the file set)
+func (c *StatCache) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.order.Init()
+	c.items = make(map[string]*list.Element)
+}
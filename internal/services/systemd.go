@@ -0,0 +1,111 @@
+package services
+
+import (
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"time"
+)
+
+// SystemdNotifier reports service state to systemd over $NOTIFY_SOCKET (see
+// sd_notify(3)), for Type=notify units with an optional WatchdogSec=
+type SystemdNotifier struct {
+	socket   string
+	watchdog time.Duration // WatchdogSec from the unit, 0 if not set
+	logger   *log.Logger
+	stop     chan struct{}
+}
+
+// NewSystemdNotifier returns a notifier, or nil when not started by systemd
+// with a notify socket; a nil notifier ignores every call
+func NewSystemdNotifier(logger *log.Logger) *SystemdNotifier {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return nil
+	}
+	n := &SystemdNotifier{socket: socket, logger: logger, stop: make(chan struct{})}
+
+	// WATCHDOG_PID, when set, says which process the watchdog is meant for
+	if usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64); err == nil && usec > 0 {
+		if pid := os.Getenv("WATCHDOG_PID"); pid == "" || pid == strconv.Itoa(os.Getpid()) {
+			n.watchdog = time.Duration(usec) * time.Microsecond
+		}
+	}
+	return n
+}
+
+// send writes one state message to the notify socket
+func (n *SystemdNotifier) send(state string) error {
+	name := n.socket
+	if name[0] == '@' {
+		name = "\x00" + name[1:] // Abstract socket
+	}
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: name, Net: "unixgram"})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_, err = conn.Write([]byte(state))
+	return err
+}
+
+// notify sends state, logging failures
+func (n *SystemdNotifier) notify(state string) {
+	if err := n.send(state); err != nil && n.logger != nil {
+		n.logger.Printf("sd_notify %q failed: %v", state, err)
+	}
+}
+
+// Ready tells systemd the server is accepting connections
+func (n *SystemdNotifier) Ready() {
+	if n == nil {
+		return
+	}
+	n.notify("READY=1\nSTATUS=Serving")
+}
+
+// Reloading brackets a config reload; call the returned func when done
+func (n *SystemdNotifier) Reloading() func() {
+	if n == nil {
+		return func() {}
+	}
+	n.notify("RELOADING=1")
+	return func() { n.notify("READY=1") }
+}
+
+// Stopping tells systemd shutdown has begun and stops the watchdog
+func (n *SystemdNotifier) Stopping() {
+	if n == nil {
+		return
+	}
+	close(n.stop)
+	n.notify("STOPPING=1\nSTATUS=Draining connections")
+}
+
+// StartWatchdog pings systemd at half the watchdog interval for as long as
+// check passes. A check that fails or hangs (say on a deadlocked lock) stops
+// the pings, and systemd restarts the service once WatchdogSec runs out.
+func (n *SystemdNotifier) StartWatchdog(check func() error) {
+	if n == nil || n.watchdog == 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(n.watchdog / 2)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-n.stop:
+				return
+			case <-ticker.C:
+			}
+			if err := check(); err != nil {
+				if n.logger != nil {
+					n.logger.Printf("Watchdog check failed, not pinging systemd: %v", err)
+				}
+				continue
+			}
+			n.notify("WATCHDOG=1")
+		}
+	}()
+}
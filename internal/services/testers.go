@@ -0,0 +1,146 @@
+package services
+
+import (
+	"crypto/subtle"
+	"errors"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"rom-server/internal/config"
+	"rom-server/internal/models"
+)
+
+// ErrTesterExists is returned when adding a tester whose name is taken
+var ErrTesterExists = errors.New("a tester with that name already exists")
+
+// maxTesterName bounds tester names (the longest valid email address)
+const maxTesterName = 254
+
+// TesterStore keeps the beta tester allowlist in a JSON file next to the
+// builds. Like KeyStore it stores token hashes only.
+type TesterStore struct {
+	mu sync.Mutex
+	jsonFile[[]models.Tester]
+}
+
+// NewTesterStore loads the tester file at path (missing file is fine)
+func NewTesterStore(path string) (*TesterStore, error) {
+	t := &TesterStore{jsonFile: jsonFile[[]models.Tester]{path: path, name: "testers", perm: 0600}}
+	if err := t.refresh(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// Restore replaces the tester allowlist with a file unpacked from a backup
+func (t *TesterStore) Restore(src string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.restore(src)
+}
+
+// ValidTesterName reports whether name can identify a tester: an email
+// address or handle of printable characters without spaces
+func ValidTesterName(name string) bool {
+	if name == "" || len(name) > maxTesterName {
+		return false
+	}
+	return !strings.ContainsFunc(name, func(r rune) bool {
+		return unicode.IsSpace(r) || !unicode.IsPrint(r)
+	})
+}
+
+// List returns the testers by name
+func (t *TesterStore) List() ([]models.Tester, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if err := t.refresh(); err != nil {
+		return nil, err
+	}
+	testers := append([]models.Tester{}, t.data...)
+	sort.Slice(testers, func(i, j int) bool { return testers[i].Name < testers[j].Name })
+	return testers, nil
+}
+
+// Add puts name on the allowlist for categories (all restricted ones if
+// empty) and returns their token; this is the only time it is available
+func (t *TesterStore) Add(name string, categories []string) (string, models.Tester, error) {
+	token, err := config.GenerateAPIKey()
+	if err != nil {
+		return "", models.Tester{}, err
+	}
+	record := models.Tester{
+		Name:       name,
+		Hash:       hashKey(token),
+		Prefix:     token[:keyPrefixLen],
+		Categories: categories,
+		CreatedAt:  time.Now().UTC().Format(time.RFC3339),
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if err := t.refresh(); err != nil {
+		return "", models.Tester{}, err
+	}
+	for _, existing := range t.data {
+		if strings.EqualFold(existing.Name, name) {
+			return "", models.Tester{}, ErrTesterExists
+		}
+	}
+	testers := append(append([]models.Tester{}, t.data...), record)
+	return token, record, t.save(testers)
+}
+
+// Remove takes name off the allowlist; their token stops working at once
+func (t *TesterStore) Remove(name string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if err := t.refresh(); err != nil {
+		return err
+	}
+	testers := make([]models.Tester, 0, len(t.data))
+	for _, existing := range t.data {
+		if !strings.EqualFold(existing.Name, name) {
+			testers = append(testers, existing)
+		}
+	}
+	if len(testers) == len(t.data) {
+		return ErrNotFound
+	}
+	return t.save(testers)
+}
+
+// Lookup returns the tester owning token. Every stored hash is compared in
+// constant time. A nil store or an unreadable file knows no testers.
+func (t *TesterStore) Lookup(token string) (models.Tester, bool) {
+	if t == nil || token == "" {
+		return models.Tester{}, false
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if err := t.refresh(); err != nil {
+		return models.Tester{}, false
+	}
+	hash := []byte(hashKey(token))
+	var found models.Tester
+	ok := false
+	for _, record := range t.data {
+		if subtle.ConstantTimeCompare(hash, []byte(record.Hash)) == 1 && !ok {
+			found, ok = record, true
+		}
+	}
+	return found, ok
+}
+
+// TesterSees reports whether a tester may see a restricted category
+func TesterSees(tester models.Tester, category string) bool {
+	return len(tester.Categories) == 0 || slices.Contains(tester.Categories, category)
+}
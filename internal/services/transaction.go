@@ -0,0 +1,181 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"time"
+
+	"rom-server/internal/models"
+)
+
+// ErrInTransaction means a held upload can only go public with the rest of
+// its transaction
+var ErrInTransaction = errors.New("file belongs to a transaction")
+
+// transactionName matches release transaction names, like labelName
+var transactionName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,63}$`)
+
+// ValidateTransaction checks a transaction name given with an upload
+func ValidateTransaction(name string) error {
+	if name != "" && !transactionName.MatchString(name) {
+		return &InvalidField{Field: "transaction", Message: fmt.Sprintf("%q must be letters, digits, '.', '_' or '-', up to 64", name)}
+	}
+	return nil
+}
+
+// transactionMembers returns the pending keys of a transaction in a fixed
+// order; caller holds s.mu
+func (s *FileService) transactionMembers(name string) []string {
+	var keys []string
+	for key, meta := range s.meta.All() {
+		if _, _, ok := splitPendingKey(key); ok && meta.Transaction == name {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// PublishTransaction makes every upload held in a transaction public at
+// once and returns them as category/filename. Either all of them go live or,
+// if one can't, none do and the live builds are left as they were.
+func (s *FileService) PublishTransaction(name string) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.publishTransaction(name)
+}
+
+// publishTransaction is PublishTransaction for callers already holding s.mu.
+// Holding it for writing throughout is what keeps /list from ever showing
+// half a release.
+func (s *FileService) publishTransaction(name string) ([]string, error) {
+	keys := s.transactionMembers(name)
+	if len(keys) == 0 {
+		return nil, ErrNotFound
+	}
+
+	// Check everything that can be checked before anything goes live
+	for _, key := range keys {
+		category, filename, _ := splitPendingKey(key)
+		if _, err := os.Stat(filepath.Join(s.cfg.Storage.UploadDir, key)); err != nil {
+			return nil, fmt.Errorf("%s/%s: held file is missing", category, filename)
+		}
+		if !s.cfg.IsValidCategory(category) {
+			return nil, invalid(fmt.Errorf("%s/%s: category %s is no longer enabled", category, filename, category))
+		}
+	}
+
+	// One publish time for the whole release, so it lists together
+	now := time.Now()
+	placed := make([]placement, 0, len(keys))
+	for _, key := range keys {
+		category, filename, _ := splitPendingKey(key)
+		heldPath := filepath.Join(s.cfg.Storage.UploadDir, key)
+		upload, _ := s.meta.Get(key)
+		upload.PublishAt, upload.Preview, upload.Transaction = 0, "", ""
+
+		err := os.Chtimes(heldPath, now, now)
+		var p placement
+		if err == nil {
+			p, err = s.place(category, filename, heldPath, upload, true)
+		}
+		if err != nil {
+			for i := len(placed) - 1; i >= 0; i-- {
+				s.undo(placed[i])
+			}
+			return nil, fmt.Errorf("%s/%s: %w (nothing was published)", category, filename, err)
+		}
+		placed = append(placed, p)
+	}
+
+	// Past this point the release is live; what's left can't be taken back
+	published := make([]string, 0, len(placed))
+	incoming := make(map[string][]string)
+	for i, p := range placed {
+		s.settle(p)
+		s.meta.Delete(keys[i])
+		incoming[p.category] = append(incoming[p.category], p.filename)
+		published = append(published, p.category+"/"+p.filename)
+	}
+	for category, filenames := range incoming {
+		if _, err := s.enforceFileLimit(category, filenames...); err != nil {
+			s.logf("Failed to enforce the file limit of %s: %v", category, err)
+		}
+	}
+	return published, nil
+}
+
+// CancelTransaction discards every upload held in a transaction and
+// returns how many there were
+func (s *FileService) CancelTransaction(name string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	keys := s.transactionMembers(name)
+	if len(keys) == 0 {
+		return 0, ErrNotFound
+	}
+	for _, key := range keys {
+		if err := os.Remove(filepath.Join(s.cfg.Storage.UploadDir, key)); err != nil && !os.IsNotExist(err) {
+			return 0, err
+		}
+		if err := s.meta.Delete(key); err != nil {
+			return 0, err
+		}
+	}
+	return len(keys), nil
+}
+
+// linkBackup hard links a live build into the temp dir so an undoable
+// placement can put it back
+func (s *FileService) linkBackup(livePath string) (string, error) {
+	tempDir := filepath.Join(s.cfg.Storage.UploadDir, s.cfg.Storage.TempDir)
+	f, err := os.CreateTemp(tempDir, "rollback-*.tmp")
+	if err != nil {
+		return "", fmt.Errorf("failed to create rollback file: %w", err)
+	}
+	f.Close()
+	backup := f.Name()
+	os.Remove(backup)
+	if err := os.Link(livePath, backup); err != nil {
+		if err := copyFile(livePath, backup); err != nil {
+			return "", fmt.Errorf("failed to back up %s: %w", filepath.Base(livePath), err)
+		}
+	}
+	return backup, nil
+}
+
+// discardBackup removes the backup of a placement, if it made one
+func (s *FileService) discardBackup(p placement) {
+	if p.backup != "" {
+		os.Remove(p.backup)
+	}
+}
+
+// undo reverses an undoable placement before it is settled: the new build
+// goes back to where it was held and the one it replaced, with its record,
+// comes back; caller holds s.mu
+func (s *FileService) undo(p placement) {
+	key := filepath.Join(p.category, p.filename)
+	livePath := filepath.Join(s.cfg.Storage.UploadDir, key)
+	if err := os.Rename(livePath, p.srcPath); err != nil {
+		os.Remove(livePath) // Keep the new build from staying live regardless
+	}
+	if p.backup != "" {
+		os.Rename(p.backup, livePath)
+	}
+	if p.keptPrevious {
+		s.dropPrevious(p.category, p.filename)
+	}
+	if p.hadMeta {
+		s.meta.Update(key, func(m *models.FileMetadata) { *m = p.meta })
+	} else {
+		s.meta.Delete(key)
+	}
+	s.invalidateListing(p.category)
+	s.statCache.Invalidate(key)
+}
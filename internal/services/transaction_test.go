@@ -0,0 +1,99 @@
+package services
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"rom-server/internal/models"
+)
+
+func TestPublishTransaction(t *testing.T) {
+	tests := []struct {
+		name     string
+		sabotage func(t *testing.T, s *FileService) // Makes the second placement fail
+		wantErr  string
+		invalid  bool // The client's fault, not the server's
+	}{
+		{name: "all placed"},
+		{
+			name: "second has invalid attributes",
+			sabotage: func(t *testing.T, s *FileService) {
+				s.meta.Update(pendingKey("vanilla", "b.zip"), func(m *models.FileMetadata) {
+					m.Attributes = map[string]string{"not a key": "x"}
+				})
+			},
+			wantErr: "vanilla/b.zip: invalid attribute key",
+			invalid: true,
+		},
+		{
+			name: "second can't replace its live path",
+			sabotage: func(t *testing.T, s *FileService) {
+				writeFile(t, s, filepath.Join("vanilla", "b.zip", "blocker"), "")
+			},
+			wantErr: "vanilla/b.zip: failed to back up b.zip",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestService(t, "vanilla")
+			writeFile(t, s, filepath.Join("vanilla", "a.zip"), "old a")
+			s.meta.Update(filepath.Join("vanilla", "a.zip"), func(m *models.FileMetadata) { m.SHA256 = "old-a" })
+			for _, name := range []string{"a.zip", "b.zip"} {
+				writeFile(t, s, pendingKey("vanilla", name), "new "+name)
+				s.meta.Update(pendingKey("vanilla", name), func(m *models.FileMetadata) {
+					m.SHA256, m.Transaction = "new-"+name, "release"
+				})
+			}
+			if tt.sabotage != nil {
+				tt.sabotage(t, s)
+			}
+
+			published, err := s.PublishTransaction("release")
+
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("PublishTransaction() error = %v", err)
+				}
+				if got := strings.Join(published, ","); got != "vanilla/a.zip,vanilla/b.zip" {
+					t.Errorf("published = %s, want vanilla/a.zip,vanilla/b.zip", got)
+				}
+				for _, name := range []string{"a.zip", "b.zip"} {
+					if got := readFile(t, s, filepath.Join("vanilla", name)); got != "new "+name {
+						t.Errorf("live %s = %q, want %q", name, got, "new "+name)
+					}
+					if meta, _ := s.meta.Get(filepath.Join("vanilla", name)); meta.SHA256 != "new-"+name {
+						t.Errorf("live %s sha256 = %q, want %q", name, meta.SHA256, "new-"+name)
+					}
+					if _, ok := s.meta.Get(pendingKey("vanilla", name)); ok {
+						t.Errorf("%s is still held after publishing", name)
+					}
+				}
+				return
+			}
+
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) || !strings.HasSuffix(err.Error(), "(nothing was published)") {
+				t.Fatalf("PublishTransaction() error = %v, want %q ... (nothing was published)", err, tt.wantErr)
+			}
+			if errors.Is(err, ErrInvalid) != tt.invalid {
+				t.Errorf("errors.Is(%v, ErrInvalid) = %v, want %v", err, !tt.invalid, tt.invalid)
+			}
+			// The first member went live and has to have been taken back
+			if got := readFile(t, s, filepath.Join("vanilla", "a.zip")); got != "old a" {
+				t.Errorf("live a.zip = %q after rollback, want %q", got, "old a")
+			}
+			if meta, _ := s.meta.Get(filepath.Join("vanilla", "a.zip")); meta.SHA256 != "old-a" {
+				t.Errorf("live a.zip sha256 = %q after rollback, want old-a", meta.SHA256)
+			}
+			for _, name := range []string{"a.zip", "b.zip"} {
+				if got := readFile(t, s, pendingKey("vanilla", name)); got != "new "+name {
+					t.Errorf("held %s = %q after rollback, want %q", name, got, "new "+name)
+				}
+				if meta, ok := s.meta.Get(pendingKey("vanilla", name)); !ok || meta.Transaction != "release" {
+					t.Errorf("held %s left its transaction", name)
+				}
+			}
+		})
+	}
+}
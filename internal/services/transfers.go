@@ -0,0 +1,277 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"rom-server/internal/models"
+)
+
+// Transfer directions
+const (
+	TransferUpload   = "upload"
+	TransferDownload = "download"
+)
+
+// Transfer is one in-flight upload or download. Handlers report progress
+// through Add (or a Reader) and call Done when the request ends.
+type Transfer struct {
+	id       uint64
+	kind     string
+	category string
+	filename string
+	client   string
+	user     string
+	total    int64 // Expected bytes, 0 if unknown
+	started  time.Time
+	bytes    atomic.Int64
+	lastIO   atomic.Int64 // UnixNano of the last progress report
+	abort    func()       // Breaks the client connection, nil if not cancellable
+	tracker  *TransferTracker
+}
+
+// Add records n more bytes moved
+func (t *Transfer) Add(n int64) {
+	if t == nil || n <= 0 {
+		return
+	}
+	t.bytes.Add(n)
+	t.lastIO.Store(time.Now().UnixNano())
+}
+
+// Bytes returns how many bytes have moved so far
+func (t *Transfer) Bytes() int64 {
+	if t == nil {
+		return 0
+	}
+	return t.bytes.Load()
+}
+
+// SetFilename names the file once it is known; multipart uploads only
+// reveal it after the body has been read
+func (t *Transfer) SetFilename(filename string) {
+	if t == nil {
+		return
+	}
+	t.tracker.mu.Lock()
+	t.filename = filename
+	t.tracker.mu.Unlock()
+}
+
+// Filename returns the name set by SetFilename, if any
+func (t *Transfer) Filename() string {
+	if t == nil {
+		return ""
+	}
+	t.tracker.mu.Lock()
+	defer t.tracker.mu.Unlock()
+	return t.filename
+}
+
+// Done removes the transfer from the active list
+func (t *Transfer) Done() {
+	if t == nil {
+		return
+	}
+	t.tracker.mu.Lock()
+	delete(t.tracker.active, t.id)
+	t.tracker.mu.Unlock()
+}
+
+// Reader counts bytes read from rc towards the transfer
+func (t *Transfer) Reader(rc io.ReadCloser) io.ReadCloser {
+	return &transferReader{ReadCloser: rc, t: t}
+}
+
+type transferReader struct {
+	io.ReadCloser
+	t *Transfer
+}
+
+func (r *transferReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.t.Add(int64(n))
+	return n, err
+}
+
+// contextReader fails reads once ctx is done, so copying from a source that
+// doesn't watch the context itself (a spooled multipart file) stops promptly
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (c contextReader) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return c.r.Read(p)
+}
+
+// info snapshots the transfer for the admin API
+func (t *Transfer) info(now time.Time) models.TransferInfo {
+	bytes := t.bytes.Load()
+	elapsed := now.Sub(t.started)
+	info := models.TransferInfo{
+		ID:             strconv.FormatUint(t.id, 10),
+		Kind:           t.kind,
+		Category:       t.category,
+		Filename:       t.filename,
+		Client:         t.client,
+		User:           t.user,
+		Bytes:          bytes,
+		TotalBytes:     t.total,
+		StartedAt:      t.started.UTC().Format(time.RFC3339),
+		ElapsedSeconds: elapsed.Seconds(),
+		IdleSeconds:    now.Sub(time.Unix(0, t.lastIO.Load())).Seconds(),
+	}
+	if elapsed > 0 {
+		info.BytesPerSecond = int64(float64(bytes) / elapsed.Seconds())
+	}
+	return info
+}
+
+// TransferTracker keeps the set of in-flight transfers
+type TransferTracker struct {
+	mu     sync.Mutex
+	nextID uint64
+	active map[uint64]*Transfer
+}
+
+// NewTransferTracker creates an empty tracker
+func NewTransferTracker() *TransferTracker {
+	return &TransferTracker{active: make(map[uint64]*Transfer)}
+}
+
+// Start registers a transfer; total is the expected size (0 if unknown) and
+// abort, if set, is called to cut the transfer off on Cancel
+func (tt *TransferTracker) Start(kind, category, filename, client, user string, total int64, abort func()) *Transfer {
+	now := time.Now()
+	t := &Transfer{
+		kind:     kind,
+		category: category,
+		filename: filename,
+		client:   client,
+		user:     user,
+		total:    total,
+		started:  now,
+		abort:    abort,
+		tracker:  tt,
+	}
+	t.lastIO.Store(now.UnixNano())
+
+	tt.mu.Lock()
+	tt.nextID++
+	t.id = tt.nextID
+	tt.active[t.id] = t
+	tt.mu.Unlock()
+	return t
+}
+
+// Cancel aborts an in-flight transfer. The handler serving it sees its
+// reads or writes fail, returns and frees its slot as usual.
+func (tt *TransferTracker) Cancel(id string) (models.TransferInfo, error) {
+	n, err := strconv.ParseUint(id, 10, 64)
+	if err != nil {
+		return models.TransferInfo{}, ErrNotFound
+	}
+
+	tt.mu.Lock()
+	t, ok := tt.active[n]
+	var info models.TransferInfo
+	if ok {
+		info = t.info(time.Now())
+	}
+	tt.mu.Unlock()
+
+	if !ok {
+		return models.TransferInfo{}, ErrNotFound
+	}
+	if t.abort == nil {
+		return info, fmt.Errorf("transfer %s cannot be cancelled", id)
+	}
+	t.abort()
+	return info, nil
+}
+
+// CancelAll aborts every in-flight transfer of a kind and returns how many
+func (tt *TransferTracker) CancelAll(kind string) int {
+	tt.mu.Lock()
+	var victims []*Transfer
+	for _, t := range tt.active {
+		if t.kind == kind && t.abort != nil {
+			victims = append(victims, t)
+		}
+	}
+	tt.mu.Unlock()
+
+	for _, t := range victims {
+		t.abort()
+	}
+	return len(victims)
+}
+
+// Count returns how many transfers of a kind are in flight
+func (tt *TransferTracker) Count(kind string) int {
+	tt.mu.Lock()
+	defer tt.mu.Unlock()
+
+	n := 0
+	for _, t := range tt.active {
+		if t.kind == kind {
+			n++
+		}
+	}
+	return n
+}
+
+// List returns the active transfers, fastest first
+func (tt *TransferTracker) List() []models.TransferInfo {
+	now := time.Now()
+
+	tt.mu.Lock()
+	list := make([]models.TransferInfo, 0, len(tt.active))
+	for _, t := range tt.active {
+		list = append(list, t.info(now))
+	}
+	tt.mu.Unlock()
+
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].BytesPerSecond != list[j].BytesPerSecond {
+			return list[i].BytesPerSecond > list[j].BytesPerSecond
+		}
+		return list[i].ID < list[j].ID
+	})
+	return list
+}
+
+// StartTransfer registers an in-flight upload or download for monitoring
+func (s *FileService) StartTransfer(kind, category, filename, client, user string, total int64, abort func()) *Transfer {
+	return s.transfers.Start(kind, category, filename, client, user, total, abort)
+}
+
+// CancelTransfer cuts off an in-flight upload or download by ID
+func (s *FileService) CancelTransfer(id string) (models.TransferInfo, error) {
+	return s.transfers.Cancel(id)
+}
+
+// CancelTransfers cuts off every in-flight transfer of a kind
+func (s *FileService) CancelTransfers(kind string) int {
+	return s.transfers.CancelAll(kind)
+}
+
+// CountTransfers returns how many transfers of a kind are in flight
+func (s *FileService) CountTransfers(kind string) int {
+	return s.transfers.Count(kind)
+}
+
+// Transfers lists in-flight uploads and downloads
+func (s *FileService) Transfers() []models.TransferInfo {
+	return s.transfers.List()
+}
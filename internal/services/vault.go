@@ -0,0 +1,197 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"rom-server/internal/config"
+)
+
+// Vault loads credentials from a HashiCorp Vault KV secret and keeps them
+// (and its own token) fresh. Every instance refreshes independently, so this
+// doesn't go through the leader-gated Scheduler.
+type Vault struct {
+	cfg       *config.Config
+	client    *http.Client
+	logger    *log.Logger
+	renewable bool
+	ttl       time.Duration
+	stop      chan struct{}
+	done      chan struct{}
+}
+
+// NewVault creates a Vault client, or returns nil when Vault is disabled
+func NewVault(cfg *config.Config, logger *log.Logger) *Vault {
+	if !cfg.Vault.Enabled {
+		return nil
+	}
+	return &Vault{
+		cfg:    cfg,
+		client: &http.Client{Timeout: 15 * time.Second},
+		logger: logger,
+	}
+}
+
+// Load looks up the token and applies the secret's values to the config.
+// Keys missing from the secret keep their file or environment values.
+func (v *Vault) Load() error {
+	if v.cfg.Vault.Token == "" {
+		return fmt.Errorf("vault token not set (%s or %s_FILE)", v.cfg.Vault.TokenEnv, v.cfg.Vault.TokenEnv)
+	}
+
+	var lookup struct {
+		Data struct {
+			Renewable bool  `json:"renewable"`
+			TTL       int64 `json:"ttl"`
+		} `json:"data"`
+	}
+	if err := v.call(http.MethodGet, "auth/token/lookup-self", &lookup); err != nil {
+		return fmt.Errorf("vault token lookup failed: %w", err)
+	}
+	v.renewable = lookup.Data.Renewable
+	v.ttl = time.Duration(lookup.Data.TTL) * time.Second
+
+	return v.fetch()
+}
+
+// fetch reads the KV secret and applies it
+func (v *Vault) fetch() error {
+	mount := strings.Trim(v.cfg.Vault.Mount, "/")
+	if mount == "" {
+		mount = "secret"
+	}
+	path := strings.Trim(v.cfg.Vault.Path, "/")
+
+	var raw json.RawMessage
+	if v.cfg.Vault.KVVersion == 1 {
+		var resp struct {
+			Data json.RawMessage `json:"data"`
+		}
+		if err := v.call(http.MethodGet, mount+"/"+path, &resp); err != nil {
+			return fmt.Errorf("vault read failed: %w", err)
+		}
+		raw = resp.Data
+	} else {
+		var resp struct {
+			Data struct {
+				Data json.RawMessage `json:"data"`
+			} `json:"data"`
+		}
+		if err := v.call(http.MethodGet, mount+"/data/"+path, &resp); err != nil {
+			return fmt.Errorf("vault read failed: %w", err)
+		}
+		raw = resp.Data.Data
+	}
+
+	var secrets config.Secrets
+	if err := json.Unmarshal(raw, &secrets); err != nil {
+		return fmt.Errorf("vault secret %s/%s is malformed: %w", mount, path, err)
+	}
+
+	before := v.cfg.GetSecrets()
+	v.cfg.SetSecrets(secrets)
+	if after := v.cfg.GetSecrets(); after != before && v.logger != nil {
+		v.logger.Printf("Vault: applied secrets from %s/%s", mount, path)
+	}
+	return nil
+}
+
+// renew extends the token's lease when Vault allows it
+func (v *Vault) renew() error {
+	if !v.renewable {
+		return nil
+	}
+	var resp struct {
+		Auth struct {
+			LeaseDuration int64 `json:"lease_duration"`
+		} `json:"auth"`
+	}
+	if err := v.call(http.MethodPost, "auth/token/renew-self", &resp); err != nil {
+		return fmt.Errorf("vault token renewal failed: %w", err)
+	}
+	v.ttl = time.Duration(resp.Auth.LeaseDuration) * time.Second
+	return nil
+}
+
+// Start renews the token and re-reads the secret in the background. The
+// interval shrinks to half the token TTL so the token never lapses.
+func (v *Vault) Start() {
+	if v == nil {
+		return
+	}
+	interval := time.Duration(v.cfg.Vault.RefreshIntervalMinutes) * time.Minute
+	if interval <= 0 {
+		interval = 15 * time.Minute
+	}
+	if v.renewable && v.ttl > 0 && v.ttl/2 < interval {
+		interval = v.ttl / 2
+	}
+
+	v.stop = make(chan struct{})
+	v.done = make(chan struct{})
+	go func() {
+		defer close(v.done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				if err := v.renew(); err != nil && v.logger != nil {
+					v.logger.Printf("Vault: %v", err)
+				}
+				if err := v.fetch(); err != nil && v.logger != nil {
+					v.logger.Printf("Vault: %v", err)
+				}
+			case <-v.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop halts background refreshes
+func (v *Vault) Stop() {
+	if v == nil || v.stop == nil {
+		return
+	}
+	close(v.stop)
+	<-v.done
+}
+
+// call performs an authenticated Vault API request and decodes the response
+func (v *Vault) call(method, path string, out interface{}) error {
+	endpoint := strings.TrimRight(v.cfg.Vault.Address, "/") + "/v1/" + path
+
+	var body io.Reader
+	if method == http.MethodPost {
+		body = strings.NewReader("{}")
+	}
+	req, err := http.NewRequest(method, endpoint, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("X-Vault-Token", v.cfg.Vault.Token)
+
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var apiErr struct {
+			Errors []string `json:"errors"`
+		}
+		if json.NewDecoder(resp.Body).Decode(&apiErr) == nil && len(apiErr.Errors) > 0 {
+			return fmt.Errorf("status %d: %s", resp.StatusCode, strings.Join(apiErr.Errors, "; "))
+		}
+		return fmt.Errorf("status %d", resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
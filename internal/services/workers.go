@@ -0,0 +1,128 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// Jobs queued per worker before Submit starts turning work away
+const workerQueuePerWorker = 20
+
+// job is one unit of background work
+type job struct {
+	name string
+	run  func() error
+}
+
+// WorkerPool runs background jobs (webhook deliveries, CDN purges, object
+// deletes, mirror pulls) on a fixed number of goroutines, so a burst of
+// uploads can't start an unbounded number of them. Queue depth, running
+// jobs and failures are kept as photon_jobs_* metrics.
+type WorkerPool struct {
+	jobs    chan job
+	metrics *Metrics
+	logger  *log.Logger
+
+	mu     sync.RWMutex // Guards closed against Submit racing Stop
+	closed bool
+	wg     sync.WaitGroup
+}
+
+// NewWorkerPool starts size workers (at least one) with a bounded queue
+func NewWorkerPool(size int, metrics *Metrics, logger *log.Logger) *WorkerPool {
+	if size <= 0 {
+		size = 1
+	}
+	p := &WorkerPool{
+		jobs:    make(chan job, size*workerQueuePerWorker),
+		metrics: metrics,
+		logger:  logger,
+	}
+	p.wg.Add(size)
+	for i := 0; i < size; i++ {
+		go p.work()
+	}
+	return p
+}
+
+// work runs queued jobs until the pool is stopped and the queue is empty
+func (p *WorkerPool) work() {
+	defer p.wg.Done()
+	for j := range p.jobs {
+		p.metrics.Add("jobs_queue_depth", -1)
+		p.metrics.Add("jobs_running", 1)
+		err := p.run(j)
+		p.metrics.Add("jobs_running", -1)
+		p.metrics.Add("jobs_total", 1)
+		if err != nil {
+			p.metrics.Add("jobs_failed_total", 1)
+			if p.logger != nil {
+				p.logger.Printf("Job %s failed: %v", j.name, err)
+			}
+		}
+	}
+}
+
+// run calls a job, turning a panic into a failure so the worker survives
+func (p *WorkerPool) run(j job) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return j.run()
+}
+
+// Submit queues a job without blocking and reports whether it was taken;
+// a full queue or stopped pool drops it (counted in jobs_dropped_total).
+// A nil pool runs the job on its own goroutine, as before the pool existed.
+func (p *WorkerPool) Submit(name string, run func() error) bool {
+	if p == nil {
+		go run()
+		return true
+	}
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if !p.closed {
+		select {
+		case p.jobs <- job{name: name, run: run}:
+			p.metrics.Add("jobs_queue_depth", 1)
+			return true
+		default:
+		}
+	}
+	p.metrics.Add("jobs_dropped_total", 1)
+	if p.logger != nil {
+		p.logger.Printf("Job %s dropped: worker queue is full", name)
+	}
+	return false
+}
+
+// Stop refuses new jobs and waits up to timeout for queued and running
+// ones to finish; it reports whether they all did
+func (p *WorkerPool) Stop(timeout time.Duration) bool {
+	if p == nil {
+		return true
+	}
+	p.mu.Lock()
+	if !p.closed {
+		p.closed = true
+		close(p.jobs)
+	}
+	p.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
@@ -0,0 +1,137 @@
+package services
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"time"
+
+	"rom-server/internal/models"
+)
+
+// ErrNotZip is returned when a build can't be read as a ZIP archive
+var ErrNotZip = errors.New("build is not a zip archive")
+
+// ErrEntryNotFound is returned when a zip build has no entry at a path
+var ErrEntryNotFound = errors.New("no such file in the archive")
+
+// ZipEntry is one file inside a published zip build, open for reading
+type ZipEntry struct {
+	Name     string
+	Size     int64
+	Modified time.Time
+	// Content is an io.ReadSeeker over the archive for stored entries, so
+	// they can be served with ranges; compressed ones inflate as read
+	Content io.Reader
+	closers []io.Closer
+}
+
+// Close releases the entry and the archive behind it
+func (e *ZipEntry) Close() error {
+	var first error
+	for i := len(e.closers) - 1; i >= 0; i-- {
+		if err := e.closers[i].Close(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// OpenZipEntry opens the file at name inside a published zip build. Only the
+// central directory at the end of the archive and the entry itself are read,
+// so pulling boot.img out of a 3 GB ROM costs about the size of boot.img.
+func (s *FileService) OpenZipEntry(category, filename, name string) (*ZipEntry, error) {
+	zr, archive, err := s.openZip(category, filename)
+	if err != nil {
+		return nil, err
+	}
+
+	name = path.Clean("/" + name)[1:]
+	for _, f := range zr.File {
+		if f.Name != name || f.FileInfo().IsDir() {
+			continue
+		}
+		entry := &ZipEntry{
+			Name:     f.Name,
+			Size:     int64(f.UncompressedSize64),
+			Modified: f.Modified,
+			closers:  []io.Closer{archive},
+		}
+		if f.Method == zip.Store {
+			offset, err := f.DataOffset()
+			if err != nil {
+				archive.Close()
+				return nil, ErrNotZip
+			}
+			entry.Content = io.NewSectionReader(archive, offset, entry.Size)
+			return entry, nil
+		}
+		rc, err := f.Open()
+		if err != nil {
+			archive.Close()
+			return nil, fmt.Errorf("can't read %s: %w", f.Name, err)
+		}
+		entry.Content = rc
+		entry.closers = append(entry.closers, rc)
+		return entry, nil
+	}
+	archive.Close()
+	return nil, ErrEntryNotFound
+}
+
+// ZipContents lists the entries of a published zip build, reading only its
+// central directory
+func (s *FileService) ZipContents(category, filename string) ([]models.ZipEntryInfo, error) {
+	zr, archive, err := s.openZip(category, filename)
+	if err != nil {
+		return nil, err
+	}
+	defer archive.Close()
+
+	entries := make([]models.ZipEntryInfo, 0, len(zr.File))
+	for _, f := range zr.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		info := models.ZipEntryInfo{
+			Path:           f.Name,
+			Size:           int64(f.UncompressedSize64),
+			CompressedSize: int64(f.CompressedSize64),
+			CRC32:          fmt.Sprintf("%08x", f.CRC32),
+			Method:         fmt.Sprintf("method-%d", f.Method),
+		}
+		switch f.Method {
+		case zip.Store:
+			info.Method = "store"
+		case zip.Deflate:
+			info.Method = "deflate"
+		}
+		if !f.Modified.IsZero() {
+			info.Modified = f.Modified.UTC().Format(time.RFC3339)
+		}
+		entries = append(entries, info)
+	}
+	return entries, nil
+}
+
+// openZip opens a published build and reads its central directory; the
+// caller closes the returned file
+func (s *FileService) openZip(category, filename string) (*zip.Reader, *os.File, error) {
+	stat, err := s.StatFile(category, filename)
+	if err != nil {
+		return nil, nil, ErrNotFound
+	}
+	archive, err := os.Open(stat.Path)
+	if err != nil {
+		return nil, nil, ErrNotFound
+	}
+	zr, err := zip.NewReader(archive, stat.Size)
+	if err != nil {
+		archive.Close()
+		return nil, nil, ErrNotZip
+	}
+	return zr, archive, nil
+}
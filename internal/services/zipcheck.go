@@ -0,0 +1,131 @@
+package services
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// ZIP record signatures (APPNOTE.TXT 4.3)
+var (
+	zipLocalHeader   = []byte("PK\x03\x04")
+	zipCentralHeader = []byte("PK\x01\x02")
+	zipEndRecord     = []byte("PK\x05\x06")
+	zipSpanMarker    = []byte("PK\x07\x08") // First bytes of a split or spanned archive
+	zipSpanSingle    = []byte("PK00")       // Spanned archive that fit in one segment
+	zip64EndRecord   = []byte("PK\x06\x06")
+	zip64EndLocator  = []byte("PK\x06\x07")
+)
+
+const (
+	zipEndRecordLen     = 22
+	zip64EndLocatorLen  = 20
+	zip64EndRecordLen   = 56
+	zipMaxCommentLen    = 0xFFFF
+	zipEndSearchWindow  = zipEndRecordLen + zipMaxCommentLen
+	zip64EntriesMarker  = 0xFFFF
+	zip64OffsetMarker   = 0xFFFFFFFF
+	zipSignatureLen     = 4
+	zipEndCommentOffset = 20
+)
+
+// ErrInvalidZip means a .zip upload isn't a ZIP archive
+var ErrInvalidZip = errors.New("not a real ZIP")
+
+// ValidateZipMagicBytes checks if a file starts like a ZIP archive: a local
+// file header, an empty archive's end record, or a split/spanned marker
+func ValidateZipMagicBytes(header []byte) bool {
+	if len(header) < zipSignatureLen {
+		return false
+	}
+	sig := header[:zipSignatureLen]
+	return bytes.Equal(sig, zipLocalHeader) || bytes.Equal(sig, zipEndRecord) ||
+		bytes.Equal(sig, zipSpanMarker) || bytes.Equal(sig, zipSpanSingle)
+}
+
+// ValidateZip checks that r holds a whole ZIP archive: a known signature up
+// front and an end of central directory record (ZIP64 included) that points
+// inside the file. A truncated upload or a renamed non-ZIP fails with
+// ErrInvalidZip.
+func ValidateZip(r io.ReaderAt, size int64) error {
+	header := make([]byte, zipSignatureLen)
+	if _, err := r.ReadAt(header, 0); err != nil || !ValidateZipMagicBytes(header) {
+		return ErrInvalidZip
+	}
+	_, err := zipDirectory(r, size)
+	return err
+}
+
+// zipDirectory finds where the central directory of the archive in r
+// starts, going by its end record; ErrInvalidZip if there is none
+func zipDirectory(r io.ReaderAt, size int64) (int64, error) {
+	// The end record sits at the very end, behind a comment of up to 64 KiB
+	window := int64(zipEndSearchWindow)
+	if window > size {
+		window = size
+	}
+	tail := make([]byte, window)
+	if _, err := r.ReadAt(tail, size-window); err != nil && err != io.EOF {
+		return 0, ErrInvalidZip
+	}
+	for i := len(tail) - zipEndRecordLen; i >= 0; i-- {
+		if !bytes.Equal(tail[i:i+zipSignatureLen], zipEndRecord) {
+			continue
+		}
+		end := tail[i : i+zipEndRecordLen]
+		commentLen := int(binary.LittleEndian.Uint16(end[zipEndCommentOffset:]))
+		if i+zipEndRecordLen+commentLen > len(tail) {
+			continue // Signature bytes inside the comment or the data
+		}
+		if start, ok := checkZipEnd(r, size-window+int64(i), end); ok {
+			return start, nil
+		}
+	}
+	return 0, ErrInvalidZip
+}
+
+// checkZipEnd checks that the end record at offset describes a central
+// directory inside the file, following the ZIP64 locator when the record's
+// own fields overflowed, and returns where the directory starts
+func checkZipEnd(r io.ReaderAt, offset int64, end []byte) (int64, bool) {
+	entries := uint64(binary.LittleEndian.Uint16(end[10:]))
+	cdSize := uint64(binary.LittleEndian.Uint32(end[12:]))
+	cdOffset := uint64(binary.LittleEndian.Uint32(end[16:]))
+	cdEnd := uint64(offset)
+
+	if entries == zip64EntriesMarker || cdSize == zip64OffsetMarker || cdOffset == zip64OffsetMarker {
+		if offset < zip64EndLocatorLen {
+			return 0, false
+		}
+		locator := make([]byte, zip64EndLocatorLen)
+		if _, err := r.ReadAt(locator, offset-zip64EndLocatorLen); err != nil || !bytes.Equal(locator[:4], zip64EndLocator) {
+			return 0, false
+		}
+		recordOffset := binary.LittleEndian.Uint64(locator[8:])
+		if recordOffset+zip64EndRecordLen > uint64(offset-zip64EndLocatorLen) {
+			return 0, false
+		}
+		record := make([]byte, zip64EndRecordLen)
+		if _, err := r.ReadAt(record, int64(recordOffset)); err != nil || !bytes.Equal(record[:4], zip64EndRecord) {
+			return 0, false
+		}
+		entries = binary.LittleEndian.Uint64(record[32:])
+		cdSize = binary.LittleEndian.Uint64(record[40:])
+		cdOffset = binary.LittleEndian.Uint64(record[48:])
+		cdEnd = recordOffset
+	}
+
+	if cdOffset > cdEnd || cdSize > cdEnd-cdOffset {
+		return 0, false
+	}
+	// Self-extracting stubs and split archives shift offsets, so the central
+	// directory is looked for right before the end records instead
+	start := int64(cdEnd - cdSize)
+	if entries == 0 {
+		return start, true
+	}
+	sig := make([]byte, zipSignatureLen)
+	_, err := r.ReadAt(sig, start)
+	return start, err == nil && bytes.Equal(sig, zipCentralHeader)
+}
@@ -0,0 +1,140 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"testing"
+)
+
+// testZip returns a ZIP archive with the given files and comment
+func testZip(t *testing.T, comment string, files ...string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for _, name := range files {
+		f, err := w.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Write([]byte("content of " + name))
+	}
+	if err := w.SetComment(comment); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// testZip64 rewrites the end of a one-file archive into ZIP64 records: the
+// classic end record only carries overflow markers and the real values are
+// in the ZIP64 end record its locator points to. edit may break the new
+// records before they are written.
+func testZip64(t *testing.T, edit func(record, locator []byte)) []byte {
+	t.Helper()
+	archive := testZip(t, "", "system.img")
+	end := archive[len(archive)-zipEndRecordLen:]
+	entries := binary.LittleEndian.Uint16(end[10:])
+	cdSize := binary.LittleEndian.Uint32(end[12:])
+	cdOffset := binary.LittleEndian.Uint32(end[16:])
+	body := archive[:len(archive)-zipEndRecordLen]
+
+	record := make([]byte, zip64EndRecordLen)
+	copy(record, zip64EndRecord)
+	binary.LittleEndian.PutUint64(record[4:], zip64EndRecordLen-12)
+	binary.LittleEndian.PutUint64(record[24:], uint64(entries))
+	binary.LittleEndian.PutUint64(record[32:], uint64(entries))
+	binary.LittleEndian.PutUint64(record[40:], uint64(cdSize))
+	binary.LittleEndian.PutUint64(record[48:], uint64(cdOffset))
+
+	locator := make([]byte, zip64EndLocatorLen)
+	copy(locator, zip64EndLocator)
+	binary.LittleEndian.PutUint64(locator[8:], uint64(len(body)))
+	binary.LittleEndian.PutUint32(locator[16:], 1)
+
+	if edit != nil {
+		edit(record, locator)
+	}
+	classic := make([]byte, zipEndRecordLen)
+	copy(classic, zipEndRecord)
+	binary.LittleEndian.PutUint16(classic[8:], zip64EntriesMarker)
+	binary.LittleEndian.PutUint16(classic[10:], zip64EntriesMarker)
+	binary.LittleEndian.PutUint32(classic[12:], zip64OffsetMarker)
+	binary.LittleEndian.PutUint32(classic[16:], zip64OffsetMarker)
+
+	out := append([]byte{}, body...)
+	out = append(out, record...)
+	out = append(out, locator...)
+	return append(out, classic...)
+}
+
+func TestValidateZip(t *testing.T) {
+	plain := testZip(t, "", "boot.img", "system.img")
+	tests := []struct {
+		name string
+		data []byte
+		want error
+	}{
+		{name: "plain", data: plain},
+		{name: "empty archive", data: testZip(t, "")},
+		{name: "with comment", data: testZip(t, "signed by PK\x05\x06 build bot", "boot.img")},
+		{name: "truncated", data: plain[:len(plain)-10], want: ErrInvalidZip},
+		{name: "no end record", data: plain[:len(plain)/2], want: ErrInvalidZip},
+		{name: "not a zip", data: []byte("#!/bin/sh\necho hello\n"), want: ErrInvalidZip},
+		{name: "too short", data: []byte("PK"), want: ErrInvalidZip},
+
+		{name: "zip64", data: testZip64(t, nil)},
+		{
+			name: "zip64 locator points past itself",
+			data: testZip64(t, func(record, locator []byte) {
+				binary.LittleEndian.PutUint64(locator[8:], 1<<40)
+			}),
+			want: ErrInvalidZip,
+		},
+		{
+			name: "zip64 locator misses the record",
+			data: testZip64(t, func(record, locator []byte) {
+				binary.LittleEndian.PutUint64(locator[8:], 0)
+			}),
+			want: ErrInvalidZip,
+		},
+		{
+			name: "zip64 locator signature",
+			data: testZip64(t, func(record, locator []byte) { locator[3] = 0 }),
+			want: ErrInvalidZip,
+		},
+		{
+			name: "zip64 directory past the records",
+			data: testZip64(t, func(record, locator []byte) {
+				binary.LittleEndian.PutUint64(record[48:], 1<<33)
+			}),
+			want: ErrInvalidZip,
+		},
+		{
+			name: "zip64 directory size overflows",
+			data: testZip64(t, func(record, locator []byte) {
+				binary.LittleEndian.PutUint64(record[40:], ^uint64(0))
+			}),
+			want: ErrInvalidZip,
+		},
+		{
+			name: "zip64 directory not where it says",
+			data: testZip64(t, func(record, locator []byte) {
+				size := binary.LittleEndian.Uint64(record[40:])
+				binary.LittleEndian.PutUint64(record[40:], size-1)
+			}),
+			want: ErrInvalidZip,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateZip(bytes.NewReader(tt.data), int64(len(tt.data)))
+			if !errors.Is(err, tt.want) {
+				t.Errorf("ValidateZip() = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,55 @@
+// Package version describes the running build. Release builds set the
+// variables with -ldflags, e.g.
+//
+//	go build -ldflags "-X rom-server/internal/version.Version=2.1.0 \
+//	  -X rom-server/internal/version.Commit=$(git rev-parse --short HEAD) \
+//	  -X rom-server/internal/version.BuildDate=$(date -u +%Y-%m-%dT%H:%M:%SZ)" ./cmd/server
+package version
+
+import (
+	"runtime"
+	"runtime/debug"
+
+	"rom-server/internal/models"
+)
+
+// Set at build time; Commit and BuildDate fall back to the VCS stamp Go
+// records when building from a git checkout
+var (
+	Version   = "2.0.0"
+	Commit    = ""
+	BuildDate = ""
+)
+
+// Get returns the build description
+func Get() models.VersionResponse {
+	info := models.VersionResponse{
+		Version:   Version,
+		Commit:    Commit,
+		BuildDate: BuildDate,
+		GoVersion: runtime.Version(),
+	}
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		for _, s := range bi.Settings {
+			switch s.Key {
+			case "vcs.revision":
+				if info.Commit == "" {
+					info.Commit = s.Value
+				}
+			case "vcs.time":
+				if info.BuildDate == "" {
+					info.BuildDate = s.Value
+				}
+			case "vcs.modified":
+				info.Modified = s.Value == "true"
+			}
+		}
+	}
+	if info.Commit == "" {
+		info.Commit = "unknown"
+	}
+	if info.BuildDate == "" {
+		info.BuildDate = "unknown"
+	}
+	return info
+}
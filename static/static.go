@@ -0,0 +1,10 @@
+// Package static holds the web UI. It is embedded in the binary so a
+// deployment doesn't depend on a static/ folder next to it.
+package static
+
+import "embed"
+
+// Files is the download page, the admin page and their assets
+//
+//go:embed *.html *.png
+var Files embed.FS